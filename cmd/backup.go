@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/backup"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <file>",
+	Short: "Back up the catalog database",
+	Long: `Write a consistent copy of the catalog database to a file, safe to run
+while other commands use the catalog.
+
+With --verify the copy is integrity checked and its SHA-256 is recorded in
+the catalog, so 'backup check' can later tell whether an offsite copy is
+still intact.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		verify, _ := cmd.Flags().GetBool("verify")
+		force, _ := cmd.Flags().GetBool("force")
+
+		recorded, err := backup.Create(db, args[0], verify, force)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if recorded == nil {
+			fmt.Printf("✓ Backed up catalog to %s\n", args[0])
+			return
+		}
+		fmt.Printf("✓ Backed up catalog to %s (%s)\n", recorded.Path, humanize.Bytes(recorded.Size))
+		fmt.Printf("  SHA-256: %s\n", recorded.SHA256)
+	},
+}
+
+var backupCheckCmd = &cobra.Command{
+	Use:   "check [file]",
+	Short: "Verify recorded backups against their SHA-256",
+	Long: `Check that backups written with 'backup --verify' still match the
+SHA-256 recorded when they were made. Without a file every recorded backup is
+checked. Exits with status 1 when a backup is missing or modified.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var backups []*models.Backup
+		if len(args) == 1 {
+			path, err := filepath.Abs(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Invalid path: %v\n", err)
+				exit(1)
+			}
+			recorded, err := db.GetBackup(path)
+			if errors.Is(err, sql.ErrNoRows) {
+				fmt.Fprintf(os.Stderr, "Error: %s is not a recorded backup, create it with 'backup --verify'\n", path)
+				exit(1)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			backups = append(backups, recorded)
+		} else {
+			var err error
+			backups, err = db.ListBackups()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing backups: %v\n", err)
+				exit(1)
+			}
+			if len(backups) == 0 {
+				fmt.Println("No recorded backups. Create one with 'backup --verify'.")
+				return
+			}
+		}
+
+		failed := 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "STATUS\tCREATED\tSIZE\tPATH\n")
+		for _, recorded := range backups {
+			status, err := backup.Check(db, recorded)
+			if err != nil {
+				status = "error: " + err.Error()
+			}
+			if status != backup.StatusOK {
+				failed++
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status,
+				recorded.CreatedAt.Local().Format("2006-01-02 15:04"),
+				humanize.Bytes(recorded.Size), recorded.Path)
+		}
+		w.Flush()
+
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d of %d backups failed the check\n", failed, len(backups))
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	backupCmd.Flags().Bool("verify", false, "Integrity check the backup and record its SHA-256 in the catalog")
+	backupCmd.Flags().Bool("force", false, "Replace an existing file")
+	backupCmd.AddCommand(backupCheckCmd)
+	rootCmd.AddCommand(backupCmd)
+}
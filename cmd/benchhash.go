@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/indexer"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var benchHashCmd = &cobra.Command{
+	Use:   "bench-hash [path]",
+	Short: "Measure checksum algorithm speed on a drive",
+	Long: `Read sample files from a drive and measure how fast each checksum
+algorithm hashes them on this machine, next to how fast the drive reads.
+When hashing is faster than the drive, the drive is the bottleneck and the
+choice of algorithm does not change indexing time.
+
+The catalog stores SHA-256 checksums; the other algorithms are measured for
+comparison. Only collision resistant algorithms are recommended.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		extra, _ := cmd.Flags().GetStringArray("exclude")
+		sampleMB, _ := cmd.Flags().GetInt64("sample-mb")
+
+		absPath, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid path: %v\n", err)
+			exit(1)
+		}
+		if _, err := os.Stat(absPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Path does not exist: %s\n", absPath)
+			exit(1)
+		}
+		if sampleMB <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --sample-mb must be positive\n")
+			exit(1)
+		}
+
+		excludes := append(append([]string{}, cfg.Exclude...), extra...)
+		if err := indexer.ValidateExcludes(excludes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		idxr := indexer.NewIndexer(nil, "", absPath)
+		idxr.SetExcludes(excludes)
+		bench, err := idxr.BenchHash(sampleMB * 1024 * 1024)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading samples: %v\n", err)
+			exit(1)
+		}
+		if bench.ReadBytes == 0 {
+			fmt.Println("No readable files found to sample.")
+			return
+		}
+
+		fmt.Printf("Sampled %d files (%s) from %s\n", bench.Files, humanize.Bytes(bench.ReadBytes), absPath)
+		fmt.Printf("Drive read speed: %s/s (cached files read faster than the drive)\n\n",
+			humanize.Bytes(int64(bench.ReadRate())))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ALGORITHM\tSPEED\tVS DRIVE\tCOLLISION RESISTANT\n")
+		for _, r := range bench.Results {
+			secure := "no"
+			if r.Algorithm.Secure {
+				secure = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s/s\t%.1fx\t%s\n", r.Algorithm.Name,
+				humanize.Bytes(int64(r.Rate())), r.Rate()/bench.ReadRate(), secure)
+		}
+		w.Flush()
+
+		best, driveBound := bench.Recommend()
+		fmt.Printf("\nRecommended: %s", best.Algorithm.Name)
+		if driveBound {
+			fmt.Printf(" (hashing keeps up with the drive; indexing is limited by reads)\n")
+		} else {
+			fmt.Printf(" (hashing is slower than the drive; indexing is limited by the CPU)\n")
+		}
+		if best.Algorithm.Name != "sha256" {
+			fmt.Printf("Note: the catalog stores SHA-256 checksums; other algorithms are not selectable yet.\n")
+		}
+	},
+}
+
+func init() {
+	benchHashCmd.Flags().StringArray("exclude", []string{}, "Additional exclude pattern (can specify multiple)")
+	benchHashCmd.Flags().Int64("sample-mb", 256, "Megabytes of file content to sample")
+
+	rootCmd.AddCommand(benchHashCmd)
+}
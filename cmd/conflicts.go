@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/sync"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var conflictsCmd = &cobra.Command{
+	Use:   "conflicts",
+	Short: "Review and resolve sync conflicts",
+	Long: `A sync never overwrites a target file that changed since the last sync
+between the two indexes (or, before the first sync, that is newer than the
+source). It records a conflict with both sides' size, modification time and
+checksum instead, and leaves the file alone until the conflict is resolved.`,
+}
+
+var conflictsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sync conflicts",
+	Long:  `List the open sync conflicts. Use --all to include resolved ones.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		conflicts, err := db.ListConflicts(all)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing conflicts: %v\n", err)
+			exit(1)
+		}
+		if len(conflicts) == 0 {
+			fmt.Println("No sync conflicts.")
+			return
+		}
+
+		names := make(map[string]string)
+		indexName := func(id string) string {
+			if _, ok := names[id]; !ok {
+				names[id] = id
+				if index, err := db.GetIndex(id); err == nil {
+					names[id] = index.Name
+				}
+			}
+			return names[id]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tPATH\tSOURCE\tTARGET\tDETECTED\tSTATUS\n")
+		for _, c := range conflicts {
+			status := "open"
+			if !c.ResolvedAt.IsZero() {
+				status = "kept " + c.Resolution
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s: %s, %s\t%s: %s, %s\t%s\t%s\n", c.ID, c.RelativePath,
+				indexName(c.SourceIndexID), humanize.Bytes(c.SourceSize), c.SourceModTime.Local().Format("2006-01-02 15:04"),
+				indexName(c.TargetIndexID), humanize.Bytes(c.TargetSize), c.TargetModTime.Local().Format("2006-01-02 15:04"),
+				c.DetectedAt.Local().Format("2006-01-02"), status)
+		}
+		w.Flush()
+	},
+}
+
+var conflictsResolveCmd = &cobra.Command{
+	Use:   "resolve [conflict-id]...",
+	Short: "Resolve sync conflicts",
+	Long: `Resolve sync conflicts by keeping one copy of each file:
+
+  --prefer source  copy the source file over the target file
+  --prefer target  keep the target file; later syncs leave it alone until
+                   either copy changes again
+  --prefer newest  keep the copy modified last
+
+Use --all to resolve every open conflict.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		prefer, _ := cmd.Flags().GetString("prefer")
+		all, _ := cmd.Flags().GetBool("all")
+
+		switch prefer {
+		case models.PreferSource, models.PreferTarget, models.PreferNewest:
+		case "":
+			fmt.Fprintf(os.Stderr, "Error: --prefer is required: source, target or newest\n")
+			exit(1)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Invalid --prefer %q: use source, target or newest\n", prefer)
+			exit(1)
+		}
+		if all == (len(args) > 0) {
+			fmt.Fprintf(os.Stderr, "Error: Give conflict IDs or --all\n")
+			exit(1)
+		}
+
+		var conflicts []*models.Conflict
+		if all {
+			var err error
+			conflicts, err = db.ListConflicts(false)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing conflicts: %v\n", err)
+				exit(1)
+			}
+		}
+		for _, arg := range args {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Invalid conflict ID: %s\n", arg)
+				exit(1)
+			}
+			c, err := db.GetConflict(id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Conflict not found: %d\n", id)
+				exit(1)
+			}
+			conflicts = append(conflicts, c)
+		}
+
+		syncer := sync.NewSyncer(db)
+		failed := false
+		for _, c := range conflicts {
+			if cfg.MountHook != "" {
+				for _, indexID := range []string{c.SourceIndexID, c.TargetIndexID} {
+					if index, err := db.GetIndex(indexID); err == nil {
+						if err := ensureMounted(index); err != nil {
+							fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+							exit(1)
+						}
+					}
+				}
+			}
+
+			side, err := syncer.ResolveConflict(c, prefer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error resolving conflict %d (%s): %v\n", c.ID, c.RelativePath, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("✓ %d %s: kept %s copy\n", c.ID, c.RelativePath, side)
+		}
+		if failed {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	conflictsListCmd.Flags().Bool("all", false, "Include resolved conflicts")
+	conflictsResolveCmd.Flags().String("prefer", "", "Copy to keep: source, target or newest")
+	conflictsResolveCmd.Flags().Bool("all", false, "Resolve every open conflict")
+
+	conflictsCmd.AddCommand(conflictsListCmd)
+	conflictsCmd.AddCommand(conflictsResolveCmd)
+	syncCmd.AddCommand(conflictsCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/report"
+	"github.com/victor/stormindexer/pkg/filter"
+)
+
+var digestCmd = &cobra.Command{
+	Use:   "digest",
+	Short: "Summarize recent catalog activity",
+	Long: `Print a short plain-text summary of a period, e.g. the last week: new and
+removed data per drive, failed scans, new duplicates, and verification issues
+(degraded drive health, stale checksums, backups not checked in the period).
+
+The output is meant to be mailed, e.g. from cron:
+
+  stormindexer digest --since 7d | mail -s "Catalog digest" me@example.com`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sinceStr, _ := cmd.Flags().GetString("since")
+
+		now := time.Now()
+		since, err := filter.ParseAge(sinceStr, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid --since: %v\n", err)
+			exit(1)
+		}
+
+		digest, err := report.BuildDigest(db, since, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error building digest: %v\n", err)
+			exit(1)
+		}
+		digest.WriteText(os.Stdout)
+	},
+}
+
+func init() {
+	digestCmd.Flags().String("since", "7d", "Start of the period, e.g. 7d, 4w or 2024-01-01")
+	rootCmd.AddCommand(digestCmd)
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/config"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print the catalog settings as shell variables",
+	Long: `Print the catalog settings and the index roots as variable assignments,
+for wrapper scripts and Makefiles to use without parsing table output:
+
+  STORMINDEXER_DB            path of the catalog database
+  STORMINDEXER_CONFIG        configuration file in use, empty with the defaults
+  STORMINDEXER_MACHINE_ID    machine ID of this machine
+  STORMINDEXER_INDEXES       names of all indexes, one per line
+  STORMINDEXER_ROOT_<NAME>   root path of each index, the name upper-cased with
+                             anything but letters and digits replaced by _
+  STORMINDEXER_INDEX         name of the index containing the current directory
+  STORMINDEXER_INDEX_ROOT    and its root, empty outside any index
+
+  eval "$(stormindexer env)"
+  stormindexer env --shell fish | source
+  stormindexer env --shell make > catalog.mk   # then: include catalog.mk`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		shell, _ := cmd.Flags().GetString("shell")
+
+		var format func(name, value string) string
+		switch shell {
+		case "sh":
+			format = func(name, value string) string { return fmt.Sprintf("export %s=%s", name, shellQuote(value)) }
+		case "fish":
+			format = func(name, value string) string { return fmt.Sprintf("set -gx %s %s", name, shellQuote(value)) }
+		case "make":
+			format = makeAssignment
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Invalid --shell %q, expected sh, fish or make\n", shell)
+			exit(1)
+		}
+
+		indexes, err := db.ListIndexes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
+			exit(1)
+		}
+
+		var names []string
+		roots := make(map[string]string)
+		var lines []string
+		for _, index := range indexes {
+			names = append(names, index.Name)
+			variable := "STORMINDEXER_ROOT_" + envName(index.Name)
+			if other, ok := roots[variable]; ok {
+				lines = append(lines, fmt.Sprintf("# %s of index %s is already the root of %s", variable, index.Name, other))
+				continue
+			}
+			roots[variable] = index.Name
+			lines = append(lines, format(variable, index.RootPath))
+		}
+
+		var current, currentRoot string
+		if cwd, err := os.Getwd(); err == nil {
+			if index, err := db.FindIndexByPath(cwd); err == nil {
+				current, currentRoot = index.Name, index.RootPath
+			}
+		}
+
+		fmt.Println(format("STORMINDEXER_DB", cfg.DatabasePath))
+		fmt.Println(format("STORMINDEXER_CONFIG", config.File()))
+		fmt.Println(format("STORMINDEXER_MACHINE_ID", cfg.MachineID))
+		// Index names cannot contain control characters, so a newline
+		// separates them unambiguously
+		fmt.Println(format("STORMINDEXER_INDEXES", strings.Join(names, "\n")))
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		fmt.Println(format("STORMINDEXER_INDEX", current))
+		fmt.Println(format("STORMINDEXER_INDEX_ROOT", currentRoot))
+	},
+}
+
+// envName turns an index name into the suffix of a variable name
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// makeAssignment assigns a value to an exported make variable. "$" and "#"
+// are escaped so that make neither expands the value nor reads the rest of
+// the line as a comment. A value of several lines is assigned with define.
+func makeAssignment(name, value string) string {
+	value = strings.ReplaceAll(value, "$", "$$")
+	if strings.Contains(value, "\n") {
+		return fmt.Sprintf("define %s\n%s\nendef\nexport %s", name, value, name)
+	}
+	return fmt.Sprintf("export %s := %s", name, strings.ReplaceAll(value, "#", `\#`))
+}
+
+// shellQuote quotes a value for sh and fish
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func init() {
+	envCmd.Flags().String("shell", "sh", "Syntax of the assignments: sh, fish or make")
+	rootCmd.AddCommand(envCmd)
+}
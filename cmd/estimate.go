@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/indexer"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var estimateCmd = &cobra.Command{
+	Use:   "estimate [path]",
+	Short: "Estimate the cost of indexing a directory",
+	Long: `Walk a directory the way index would, applying the configured excludes,
+and report how many files it holds, their total size and a projection of the
+indexing time and database growth, with and without checksums. A sample of
+the files is read to measure the hashing speed of the drive. Nothing is
+written to the database.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		extra, _ := cmd.Flags().GetStringArray("exclude")
+		sampleMB, _ := cmd.Flags().GetInt64("sample-mb")
+
+		absPath, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid path: %v\n", err)
+			exit(1)
+		}
+		if _, err := os.Stat(absPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Path does not exist: %s\n", absPath)
+			exit(1)
+		}
+
+		excludes := append(append([]string{}, cfg.Exclude...), extra...)
+		if err := indexer.ValidateExcludes(excludes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		idxr := indexer.NewIndexer(nil, "", absPath)
+		idxr.SetExcludes(excludes)
+		estimate, err := idxr.Estimate(sampleMB * 1024 * 1024)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error scanning: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("Estimate for: %s\n", absPath)
+		if len(excludes) > 0 {
+			fmt.Printf("Excluding: %v\n", excludes)
+		}
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Files:\t%d\n", estimate.Files)
+		fmt.Fprintf(w, "Directories:\t%d\n", estimate.Directories)
+		fmt.Fprintf(w, "Total Size:\t%s\n", humanize.Bytes(estimate.Bytes))
+		if rate := estimate.HashRate(); rate > 0 {
+			fmt.Fprintf(w, "Hashing Speed:\t%s/s (measured on %s)\n",
+				humanize.Bytes(int64(rate)), humanize.Bytes(estimate.HashedBytes))
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "\tINDEX TIME\tDB GROWTH\n")
+		fmt.Fprintf(w, "Without checksums:\t~%s\t~%s\n",
+			humanize.Duration(estimate.IndexTime(false)), humanize.Bytes(estimate.DBGrowth(false)))
+		fmt.Fprintf(w, "With checksums:\t~%s\t~%s\n",
+			humanize.Duration(estimate.IndexTime(true)), humanize.Bytes(estimate.DBGrowth(true)))
+		w.Flush()
+	},
+}
+
+func init() {
+	estimateCmd.Flags().StringArray("exclude", []string{}, "Additional exclude pattern to try (can specify multiple)")
+	estimateCmd.Flags().Int64("sample-mb", 256, "Megabytes of file content to read to measure the hashing speed (0 to skip)")
+
+	rootCmd.AddCommand(estimateCmd)
+}
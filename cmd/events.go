@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/events"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/filter"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Show the event log",
+	Long: `Show the most recent catalog events, oldest first:
+
+  scan.started        an index, reindex or rehash started
+  scan.finished       it finished, failed or was cancelled
+  file.changed        a reindex found a file added, modified, moved or removed
+  duplicate.detected  a scan hashed a file whose content exists in another index
+  drive.mounted       the mount_hook brought an offline index online
+  policy.triggered    an index met a policy, see 'policy'
+
+With --follow the command keeps running and prints new events as they are
+recorded, by any process sharing the database, until interrupted. With --json
+every event is printed as one JSON object per line, for scripts to consume:
+
+  stormindexer events --follow --json --kind scan.finished | while read -r event; do ...; done
+
+Events older than the event_retention setting (30 days by default) are
+deleted after each scan.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		follow, _ := cmd.Flags().GetBool("follow")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		limit, _ := cmd.Flags().GetInt("limit")
+		kinds, _ := cmd.Flags().GetStringArray("kind")
+		sinceStr, _ := cmd.Flags().GetString("since")
+		indexIdentifier, _ := cmd.Flags().GetString("index")
+
+		eventFilter := database.EventFilter{Kinds: kinds, Limit: limit}
+		for _, kind := range kinds {
+			if !validEventKind(kind) {
+				fmt.Fprintf(os.Stderr, "Error: Invalid --kind %q, expected one of %s\n", kind, strings.Join(models.EventKinds, ", "))
+				exit(1)
+			}
+		}
+		if sinceStr != "" {
+			since, err := filter.ParseAge(sinceStr, time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Invalid --since: %v\n", err)
+				exit(1)
+			}
+			eventFilter.Since = since
+		}
+		if indexIdentifier != "" {
+			eventFilter.IndexID = findIndex(indexIdentifier, "Index").ID
+		}
+
+		names := make(map[string]string)
+		print := func(event *models.Event) error {
+			if asJSON {
+				return json.NewEncoder(os.Stdout).Encode(event)
+			}
+			name := event.IndexID
+			if name != "" {
+				if _, ok := names[name]; !ok {
+					names[name] = indexName(name)
+				}
+				name = names[name]
+			}
+			_, err := fmt.Printf("%s  %-18s  %s  %s  %s\n", event.OccurredAt.Local().Format("2006-01-02 15:04:05"),
+				event.Kind, name, event.Path, event.Detail)
+			return err
+		}
+
+		list, err := db.ListEvents(eventFilter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing events: %v\n", err)
+			exit(1)
+		}
+		for _, event := range list {
+			if err := print(event); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				exit(1)
+			}
+		}
+		if !follow {
+			if len(list) == 0 && !asJSON {
+				fmt.Println("No events recorded.")
+			}
+			return
+		}
+
+		// Continue after the last event shown, or after the most recent
+		// one when none matched
+		if len(list) > 0 {
+			eventFilter.AfterID = list[len(list)-1].ID
+		} else if latest, err := db.ListEvents(database.EventFilter{Limit: 1}); err == nil && len(latest) > 0 {
+			eventFilter.AfterID = latest[0].ID
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := events.Follow(ctx, db, eventFilter, print); err != nil {
+			fmt.Fprintf(os.Stderr, "Error following events: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+// validEventKind reports whether kind is one of models.EventKinds
+func validEventKind(kind string) bool {
+	for _, k := range models.EventKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	eventsCmd.Flags().BoolP("follow", "f", false, "Keep printing new events until interrupted")
+	eventsCmd.Flags().Bool("json", false, "Print every event as a JSON object on its own line")
+	eventsCmd.Flags().Int("limit", 50, "Number of recent events to show, 0 for all")
+	eventsCmd.Flags().StringArray("kind", []string{}, "Only show events of this kind (can specify multiple)")
+	eventsCmd.Flags().String("since", "", "Only show events since, e.g. 1d, 4w or 2024-01-01")
+	eventsCmd.Flags().StringP("index", "i", "", "Only show events of this index")
+
+	rootCmd.AddCommand(eventsCmd)
+}
@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/export"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/internal/progress"
+	"github.com/victor/stormindexer/pkg/filter"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [index-id|name]...",
+	Short: "Export indexes as NDJSON",
+	Long: `Stream one or more indexes (all indexes when none are given) as
+newline-delimited JSON. Rows are written as they are read from the database,
+so even very large indexes export with constant memory.
+
+With --since only the files added or changed after a date, or after the scans
+recorded in a previous export file (snapshot), are written together with the
+files removed since then. Importing such a delta brings an older copy of the
+catalog up to date.
+
+Exports are deterministic, so two exports of the same index can be compared
+with diff to audit what changed between scans: indexes are written in the
+order of their IDs, files in the order of their relative paths, and every
+file carries a key that stays the same across exports. Use --no-last-seen
+to leave out the time each file was last seen, which every scan updates.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		sinceStr, _ := cmd.Flags().GetString("since")
+		noLastSeen, _ := cmd.Flags().GetBool("no-last-seen")
+
+		var indexIDs []string
+		var totalFiles int64
+		if len(args) == 0 {
+			indexes, err := db.ListIndexes()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
+				exit(1)
+			}
+			for _, index := range indexes {
+				indexIDs = append(indexIDs, index.ID)
+				totalFiles += index.TotalFiles
+			}
+		} else {
+			// Each index is written once, whether named by name or ID
+			seen := make(map[string]bool)
+			for _, identifier := range args {
+				index, err := db.FindIndexByNameOrID(identifier)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					exit(1)
+				}
+				if seen[index.ID] {
+					continue
+				}
+				seen[index.ID] = true
+				indexIDs = append(indexIDs, index.ID)
+				totalFiles += index.TotalFiles
+			}
+		}
+		sort.Strings(indexIDs)
+
+		var w io.Writer = os.Stdout
+		exporter := export.NewExporter(db)
+		exporter.OmitLastSeen = noLastSeen
+
+		if sinceStr != "" {
+			if snapshot, err := os.Open(sinceStr); err == nil {
+				exporter.SinceIndex, err = export.ReadSnapshot(snapshot)
+				snapshot.Close()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading snapshot %s: %v\n", sinceStr, err)
+					exit(1)
+				}
+			} else {
+				sinceTime, err := filter.ParseDate(sinceStr, time.Now())
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error parsing --since: %v\n", err)
+					exit(1)
+				}
+				exporter.Since = sinceTime
+			}
+		}
+		if output != "" && output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+				exit(1)
+			}
+			defer f.Close()
+			w = f
+
+			bar := progress.New("Exporting", totalFiles)
+			defer bar.Close()
+			exporter.OnFile = func() { bar.Add(1) }
+		}
+
+		count, err := exporter.Export(w, indexIDs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting: %v\n", err)
+			exit(1)
+		}
+
+		if w != os.Stdout {
+			fmt.Fprintf(os.Stderr, "✓ Exported %d indexes (%d files) to %s\n", len(indexIDs), count, output)
+		}
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import indexes from an NDJSON export or another cataloging tool",
+	Long: `Import indexes from a file produced by 'stormindexer export' (use - for stdin).
+Rows are committed in chunks and the position is checkpointed, so an
+interrupted import can be continued with --resume.
+
+When an imported index already exists locally, diverged rows are settled by
+--policy:
+  newest       keep the most recently scanned row (default)
+  local        always keep the local row
+  remote       always take the imported row
+  interactive  ask for every conflict
+
+With --from the file is the export of another cataloging tool, imported as
+the index of --root, so drives cataloged before need not be rescanned:
+  everything  Everything file list (.efu) or CSV export
+  locate      locate output, one path per line, or NUL separated (locate -0)
+  wincatalog  WinCatalog CSV export
+
+  locate -0 '/mnt/archive1/' | stormindexer import --from locate --root /mnt/archive1 -
+  stormindexer import --from everything --root 'E:\' --name archive2 archive2.efu
+
+Entries outside --root are skipped; relative paths are read as relative to
+it. The files have no checksums until the index is rehashed with its drive
+mounted. Importing again into the same index updates the listed files.
+
+Dates such as 03/04/2010 read differently in the US and in Europe. The
+import stops at the first one that is ambiguous unless --date-order gives
+the order of day and month, mdy or dmy. Entries without a date, such as those
+of locate, have an unknown modification time that reports leave out.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if from, _ := cmd.Flags().GetString("from"); from != "" {
+			importListing(cmd, from, args[0])
+			return
+		}
+
+		resume, _ := cmd.Flags().GetBool("resume")
+		chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+		policyName, _ := cmd.Flags().GetString("policy")
+
+		policy, err := export.ParseConflictPolicy(policyName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if policy == export.PolicyInteractive && args[0] == "-" {
+			fmt.Fprintf(os.Stderr, "Error: --policy interactive cannot read the import from stdin\n")
+			exit(1)
+		}
+
+		importer := export.NewImporter(db)
+		importer.ChunkSize = chunkSize
+		importer.Resume = resume
+		importer.Policy = policy
+		importer.Resolver = promptConflict(bufio.NewReader(os.Stdin))
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening import file: %v\n", err)
+				exit(1)
+			}
+			defer f.Close()
+
+			absPath, _ := filepath.Abs(args[0])
+			importer.Source = absPath
+
+			info, err := f.Stat()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading import file: %v\n", err)
+				exit(1)
+			}
+			bar := progress.NewBytes("Importing", info.Size())
+			defer bar.Close()
+			r = io.TeeReader(f, bar)
+		}
+
+		result, err := importer.Import(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError importing: %v\n", err)
+			if importer.Source != "" {
+				fmt.Fprintf(os.Stderr, "Progress was saved. Re-run with --resume to continue.\n")
+			}
+			exit(1)
+		}
+
+		fmt.Printf("\n✓ Imported %d files into %d indexes", result.Files, len(result.Indexes))
+		if result.Removed > 0 {
+			fmt.Printf(", removed %d files", result.Removed)
+		}
+		if result.SkippedLines > 0 {
+			fmt.Printf(" (resumed, skipped %d already imported rows)", result.SkippedLines)
+		}
+		fmt.Println()
+
+		printMergeReport(&result.Merge)
+	},
+}
+
+var locateDBCmd = &cobra.Command{
+	Use:   "locate-db [index-id|name]",
+	Short: "Publish an index as a locate database",
+	Long: `Write an index as an mlocate database so its files appear in the OS
+search tools, even while the drive is unplugged:
+
+  stormindexer locate-db "Backup Drive" -o ~/.cache/backup.mlocate.db
+  locate -d ~/.cache/backup.mlocate.db holiday.jpg
+
+plocate users can convert the file with:
+
+  plocate-build ~/.cache/backup.mlocate.db ~/.cache/backup.plocate.db
+  plocate -d ~/.cache/backup.plocate.db holiday.jpg`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			exit(1)
+		}
+		defer f.Close()
+
+		if err := export.WriteLocateDB(db, f, index.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing locate database: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("✓ Wrote %d entries of %s to %s\n", index.TotalFiles, index.Name, output)
+		fmt.Printf("  Search it with: locate -d %s <pattern>\n", output)
+	},
+}
+
+// importListing imports the export of another cataloging tool as an index
+func importListing(cmd *cobra.Command, format, file string) {
+	root, _ := cmd.Flags().GetString("root")
+	name, _ := cmd.Flags().GetString("name")
+	chunkSize, _ := cmd.Flags().GetInt("chunk-size")
+	dateOrder, _ := cmd.Flags().GetString("date-order")
+
+	if root == "" {
+		fmt.Fprintf(os.Stderr, "Error: --from needs the --root of the listed drive\n")
+		exit(1)
+	}
+	if !paths.IsWindows(root) {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+	root = paths.NormalizeRoot(root)
+	if name == "" {
+		name = filepath.Base(strings.ReplaceAll(root, `\`, "/"))
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening import file: %v\n", err)
+			exit(1)
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading import file: %v\n", err)
+			exit(1)
+		}
+		bar := progress.NewBytes("Importing", info.Size())
+		defer bar.Close()
+		r = io.TeeReader(f, bar)
+	}
+
+	index := &models.Index{
+		ID:        generateIndexID(root),
+		Name:      name,
+		RootPath:  root,
+		CreatedAt: time.Now(),
+		MachineID: cfg.MachineID,
+	}
+	if existing, err := db.GetIndex(index.ID); err == nil {
+		index = existing
+	}
+	result, err := export.ImportListing(db, index, format, dateOrder, r, chunkSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError importing: %v\n", err)
+		exit(1)
+	}
+
+	fmt.Printf("\n✓ Imported %d files and %d directories into %s (%s)\n", result.Files, result.Directories, index.Name, root)
+	if result.Outside > 0 {
+		fmt.Printf("  Skipped %d entries outside %s\n", result.Outside, root)
+	}
+	fmt.Printf("  Run 'rehash %s' with the drive mounted to compute checksums\n", index.Name)
+}
+
+// promptConflict returns a resolver that asks on the terminal which side of a conflict to keep
+func promptConflict(in *bufio.Reader) export.Resolver {
+	var all string
+	return func(c *export.Conflict) (bool, error) {
+		if all != "" {
+			return all == "r", nil
+		}
+
+		fmt.Fprintf(os.Stderr, "\nConflict: %s\n", c.Local.Path)
+		fmt.Fprintf(os.Stderr, "  local:  %s, modified %s, scanned %s\n",
+			humanize.Bytes(c.Local.Size), c.Local.ModTime.Format("2006-01-02 15:04:05"), c.Local.LastScanned.Format("2006-01-02 15:04:05"))
+		if c.Removal {
+			fmt.Fprintf(os.Stderr, "  remote: removed %s\n", c.Remote.LastScanned.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Fprintf(os.Stderr, "  remote: %s, modified %s, scanned %s\n",
+				humanize.Bytes(c.Remote.Size), c.Remote.ModTime.Format("2006-01-02 15:04:05"), c.Remote.LastScanned.Format("2006-01-02 15:04:05"))
+		}
+
+		for {
+			fmt.Fprintf(os.Stderr, "Keep [l]ocal, take [r]emote, [L]ocal for all, [R]emote for all? ")
+			answer, err := in.ReadString('\n')
+			if err != nil {
+				return false, fmt.Errorf("no answer for conflict on %s: %w", c.Local.Path, err)
+			}
+			switch strings.TrimSpace(answer) {
+			case "l":
+				return false, nil
+			case "r":
+				return true, nil
+			case "L":
+				all = "l"
+				return false, nil
+			case "R":
+				all = "r"
+				return true, nil
+			}
+		}
+	}
+}
+
+// printMergeReport shows how rows of existing indexes were merged
+func printMergeReport(report *export.MergeReport) {
+	if report.Added+report.Updated+report.Unchanged+report.ConflictCount == 0 {
+		return
+	}
+
+	fmt.Printf("\n=== Merge Report ===\n")
+	fmt.Printf("Added:     %d\n", report.Added)
+	fmt.Printf("Updated:   %d\n", report.Updated)
+	fmt.Printf("Unchanged: %d\n", report.Unchanged)
+	fmt.Printf("Conflicts: %d (%d kept local)\n", report.ConflictCount, report.KeptLocal)
+
+	for _, c := range report.Conflicts[:min(10, len(report.Conflicts))] {
+		winner := "local"
+		if c.TookRemote {
+			winner = "remote"
+		}
+		action := "changed"
+		if c.Removal {
+			action = "removed"
+		}
+		fmt.Printf("  ! %s (%s remotely, kept %s)\n", c.Local.RelativePath, action, winner)
+	}
+	if report.ConflictCount > 10 {
+		fmt.Printf("  ... and %d more\n", report.ConflictCount-10)
+	}
+}
+
+func init() {
+	exportCmd.Flags().StringP("output", "o", "", "Write the export to a file instead of stdout")
+	exportCmd.Flags().Bool("no-last-seen", false, "Leave out when each file was last seen, so exports of unchanged files diff cleanly")
+	exportCmd.Flags().String("since", "", "Only export changes since a date (e.g. \"2 weeks ago\") or a previous export file")
+
+	importCmd.Flags().Bool("resume", false, "Continue an interrupted import of the same file")
+	importCmd.Flags().Int("chunk-size", export.DefaultChunkSize, "Number of rows committed per transaction")
+	importCmd.Flags().String("policy", "newest", "Conflict policy for existing indexes: newest, local, remote or interactive")
+	importCmd.Flags().String("from", "", "Import the export of another tool: "+strings.Join(export.ListingFormats, ", "))
+	importCmd.Flags().String("root", "", "Root path of the drive a --from listing describes")
+	importCmd.Flags().String("name", "", "Name of the index imported with --from (default: last element of --root)")
+	importCmd.Flags().String("date-order", "", "Order of day and month in dates with slashes of a --from listing: mdy or dmy")
+
+	locateDBCmd.Flags().StringP("output", "o", "", "Path of the locate database to write")
+	locateDBCmd.MarkFlagRequired("output")
+
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(locateDBCmd)
+	rootCmd.AddCommand(importCmd)
+}
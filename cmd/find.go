@@ -3,25 +3,47 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/output"
+	"github.com/victor/stormindexer/pkg/filter"
 )
 
 var findCmd = &cobra.Command{
-	Use:   "find",
+	Use:   "find [expression]",
 	Short: "Find files across multiple drives/indexes",
 	Long: `Find files across all indexed locations with support for various filters.
 You can search by filename pattern, directory name, checksum, size, modification date, and more.
-Duplicate files can be grouped by drive for easy review.`,
+Duplicate files can be grouped by drive for easy review.
+
+Filters can also be written as one expression, combined with the flags:
+
+  find 'ext=mp4 and size>1G and (index=NAS or index=USB1) and mtime<2020-01-01'
+
+Fields: name, path, dir, ext, index, checksum, size, mtime, seen, type
+(file, dir, link) and dup (true, false). Conditions are joined with and, or,
+not and parentheses; values with spaces are quoted.
+
+Run inside an indexed directory, find searches only that index unless
+--index, --all or an index condition is given.
+
+When a mount_hook is configured, it runs for every offline drive holding a
+result once the results are printed, unless --no-mount is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		opts := database.FindOptions{}
 
+		if len(args) > 0 {
+			where, err := filter.ParseExpr(strings.Join(args, " "), time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			opts.Where = where
+		}
+
 		// Parse flags
 		namePattern, _ := cmd.Flags().GetString("name")
 		dirPattern, _ := cmd.Flags().GetString("dir")
@@ -32,12 +54,22 @@ Duplicate files can be grouped by drive for easy review.`,
 		sinceStr, _ := cmd.Flags().GetString("since")
 		untilStr, _ := cmd.Flags().GetString("until")
 		fileType, _ := cmd.Flags().GetString("type")
+		noMount, _ := cmd.Flags().GetBool("no-mount")
+		formatter := getFormatter(cmd)
 
 		opts.NamePattern = namePattern
 		opts.DirectoryPattern = dirPattern
 		opts.Checksum = checksum
-		opts.IndexIDs = indexIDs
+		for _, identifier := range indexIDs {
+			opts.IndexIDs = append(opts.IndexIDs, findIndex(identifier, "--index").ID)
+		}
+		if all, _ := cmd.Flags().GetBool("all"); !all && len(opts.IndexIDs) == 0 && !selectsIndex(opts.Where) {
+			if index, err := workingDirIndex(); err == nil {
+				opts.IndexIDs = []string{index.ID}
+			}
+		}
 		opts.OnlyDuplicates = duplicates
+		opts.Sort = sortOrder(cmd)
 
 		// Parse file type
 		if fileType == "" {
@@ -45,36 +77,36 @@ Duplicate files can be grouped by drive for easy review.`,
 		}
 		if fileType != "file" && fileType != "dir" && fileType != "directory" && fileType != "all" {
 			fmt.Fprintf(os.Stderr, "Error: Invalid file type: %s. Must be 'file', 'dir', 'directory', or 'all'\n", fileType)
-			os.Exit(1)
+			exit(1)
 		}
 		opts.FileType = fileType
 
 		// Parse size filter
 		if sizeFilter != "" {
-			minSize, maxSize, err := parseSizeFilter(sizeFilter)
+			sizeRange, err := filter.ParseSize(sizeFilter)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error parsing size filter: %v\n", err)
-				os.Exit(1)
+				exit(1)
 			}
-			opts.MinSize = minSize
-			opts.MaxSize = maxSize
+			opts.MinSize = sizeRange.Min
+			opts.MaxSize = sizeRange.Max
 		}
 
 		// Parse date filters
 		if sinceStr != "" {
-			sinceTime, err := parseDate(sinceStr)
+			sinceTime, err := filter.ParseDate(sinceStr, time.Now())
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error parsing --since date: %v\n", err)
-				os.Exit(1)
+				exit(1)
 			}
 			opts.ModifiedSince = &sinceTime
 		}
 
 		if untilStr != "" {
-			untilTime, err := parseDate(untilStr)
+			untilTime, err := filter.ParseDate(untilStr, time.Now())
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error parsing --until date: %v\n", err)
-				os.Exit(1)
+				exit(1)
 			}
 			opts.ModifiedUntil = &untilTime
 		}
@@ -83,7 +115,7 @@ Duplicate files can be grouped by drive for easy review.`,
 		if opts.ModifiedSince != nil && opts.ModifiedUntil != nil {
 			if opts.ModifiedSince.After(*opts.ModifiedUntil) {
 				fmt.Fprintf(os.Stderr, "Error: --since date must be before --until date\n")
-				os.Exit(1)
+				exit(1)
 			}
 		}
 
@@ -91,7 +123,7 @@ Duplicate files can be grouped by drive for easy review.`,
 		results, err := db.FindFiles(opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error finding files: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if len(results) == 0 {
@@ -101,223 +133,85 @@ Duplicate files can be grouped by drive for easy review.`,
 
 		// Format and display results
 		if duplicates {
-			displayDuplicatesGrouped(results)
+			err = formatter.Duplicates(os.Stdout, output.GroupDuplicates(results))
 		} else {
-			displayResultsTable(results, fileType)
+			err = formatter.Files(os.Stdout, output.FileList{
+				Title: fmt.Sprintf("Found %d %s", len(results), typeLabel(fileType)),
+				Files: results,
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			exit(1)
+		}
+
+		if cfg.MountHook != "" && !noMount {
+			mountResultIndexes(results)
 		}
 	},
 }
 
+// selectsIndex reports whether a filter expression has an index condition
+func selectsIndex(e filter.Expr) bool {
+	switch e := e.(type) {
+	case *filter.And:
+		return selectsIndex(e.Left) || selectsIndex(e.Right)
+	case *filter.Or:
+		return selectsIndex(e.Left) || selectsIndex(e.Right)
+	case *filter.Not:
+		return selectsIndex(e.Expr)
+	case *filter.Cond:
+		return e.Field == "index"
+	}
+	return false
+}
+
+// mountResultIndexes runs the mount hook for the offline drives holding
+// the results, once per drive
+func mountResultIndexes(results []*database.FileWithIndex) {
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if seen[result.IndexID] {
+			continue
+		}
+		seen[result.IndexID] = true
+
+		index, err := db.GetIndex(result.IndexID)
+		if err != nil {
+			continue
+		}
+		if err := ensureMounted(index); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
 func init() {
 	findCmd.Flags().StringP("name", "n", "", "Search by filename pattern (supports wildcards: *, ?)")
 	findCmd.Flags().StringP("dir", "D", "", "Search by directory name pattern (supports wildcards: *, ?)")
 	findCmd.Flags().StringP("checksum", "c", "", "Search by checksum (exact match)")
 	findCmd.Flags().StringP("size", "s", "", "Filter by size (e.g., >100M, <1G, =500K)")
 	findCmd.Flags().StringArrayP("index", "i", []string{}, "Limit search to specific index(es) (can specify multiple)")
+	findCmd.Flags().Bool("all", false, "Search every index, even when run inside an indexed directory")
 	findCmd.Flags().BoolP("duplicates", "d", false, "Show only duplicate files (grouped by checksum)")
 	findCmd.Flags().String("since", "", "Show files modified since the given date/time (e.g., \"2 weeks ago\", \"2024-01-15\")")
 	findCmd.Flags().String("until", "", "Show files modified until the given date/time (e.g., \"yesterday\", \"2024-01-20\")")
 	findCmd.Flags().StringP("type", "t", "all", "Filter by type: file (only files), dir or directory (only directories), all (default: both)")
+	findCmd.Flags().Bool("no-mount", false, "Do not run the mount hook for offline drives holding the results")
+	addSortFlag(findCmd)
+	addFormatFlag(findCmd)
 
 	rootCmd.AddCommand(findCmd)
 }
 
-// parseDate parses various date formats including relative dates
-func parseDate(dateStr string) (time.Time, error) {
-	dateStr = strings.TrimSpace(dateStr)
-	now := time.Now()
-
-	// Handle relative dates
-	switch strings.ToLower(dateStr) {
-	case "yesterday":
-		return now.AddDate(0, 0, -1), nil
-	case "today":
-		return now, nil
-	}
-
-	// Parse "N days/weeks/months/years ago"
-	relativePattern := regexp.MustCompile(`^(\d+)\s+(day|days|week|weeks|month|months|year|years)\s+ago$`)
-	if matches := relativePattern.FindStringSubmatch(strings.ToLower(dateStr)); matches != nil {
-		num, _ := strconv.Atoi(matches[1])
-		unit := matches[2]
-
-		switch unit {
-		case "day", "days":
-			return now.AddDate(0, 0, -num), nil
-		case "week", "weeks":
-			return now.AddDate(0, 0, -num*7), nil
-		case "month", "months":
-			return now.AddDate(0, -num, 0), nil
-		case "year", "years":
-			return now.AddDate(-num, 0, 0), nil
-		}
-	}
-
-	// Try parsing as ISO date
-	if t, err := time.Parse("2006-01-02", dateStr); err == nil {
-		return t, nil
-	}
-
-	// Try parsing as ISO datetime
-	if t, err := time.Parse(time.RFC3339, dateStr); err == nil {
-		return t, nil
-	}
-
-	// Try parsing as common datetime format
-	if t, err := time.Parse("2006-01-02 15:04:05", dateStr); err == nil {
-		return t, nil
-	}
-
-	return time.Time{}, fmt.Errorf("unable to parse date: %s", dateStr)
-}
-
-// parseSizeFilter parses size filter strings like ">100M", "<1G", "=500K"
-func parseSizeFilter(sizeStr string) (int64, int64, error) {
-	sizeStr = strings.TrimSpace(sizeStr)
-	var minSize, maxSize int64
-
-	// Parse operators: >, <, =, >=, <=
-	pattern := regexp.MustCompile(`^([><=]+)\s*(\d+(?:\.\d+)?)\s*([KMGT]?B?)$`)
-	matches := pattern.FindStringSubmatch(strings.ToUpper(sizeStr))
-	if len(matches) != 4 {
-		return 0, 0, fmt.Errorf("invalid size format: %s (expected format: >100M, <1G, =500K)", sizeStr)
-	}
-
-	operator := matches[1]
-	value, _ := strconv.ParseFloat(matches[2], 64)
-	unit := matches[3]
-
-	// Convert to bytes
-	multiplier := int64(1)
-	switch unit {
-	case "KB", "K":
-		multiplier = 1024
-	case "MB", "M":
-		multiplier = 1024 * 1024
-	case "GB", "G":
-		multiplier = 1024 * 1024 * 1024
-	case "TB", "T":
-		multiplier = 1024 * 1024 * 1024 * 1024
-	}
-
-	sizeBytes := int64(value * float64(multiplier))
-
-	switch operator {
-	case ">":
-		minSize = sizeBytes + 1
-	case ">=":
-		minSize = sizeBytes
-	case "<":
-		maxSize = sizeBytes - 1
-	case "<=":
-		maxSize = sizeBytes
-	case "=":
-		minSize = sizeBytes
-		maxSize = sizeBytes
-	default:
-		return 0, 0, fmt.Errorf("invalid operator: %s", operator)
-	}
-
-	return minSize, maxSize, nil
-}
-
-// displayResultsTable displays search results in a table format
-func displayResultsTable(results []*database.FileWithIndex, fileType string) {
-	var typeLabel string
+// typeLabel returns the noun used to describe results of the given file type
+func typeLabel(fileType string) string {
 	switch fileType {
 	case "file":
-		typeLabel = "files"
+		return "files"
 	case "dir", "directory":
-		typeLabel = "directories"
+		return "directories"
 	default:
-		typeLabel = "items"
-	}
-
-	fmt.Printf("Found %d %s\n\n", len(results), typeLabel)
-
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintln(w, "PATH\tSIZE\tMODIFIED\tCHECKSUM\tDRIVE")
-	fmt.Fprintln(w, "----\t----\t--------\t--------\t-----")
-
-	for _, result := range results {
-		sizeStr := "-"
-		if !result.IsDirectory {
-			sizeStr = formatBytes(result.Size)
-		}
-
-		checksum := result.Checksum
-		if checksum == "" {
-			checksum = "-"
-		} else if len(checksum) > 12 {
-			checksum = checksum[:12] + "..."
-		}
-
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			result.RelativePath,
-			sizeStr,
-			result.ModTime.Format("2006-01-02 15:04:05"),
-			checksum,
-			result.IndexName,
-		)
+		return "items"
 	}
-
-	w.Flush()
 }
-
-// displayDuplicatesGrouped displays duplicate files grouped by checksum and drive
-func displayDuplicatesGrouped(results []*database.FileWithIndex) {
-	// Group by checksum
-	checksumGroups := make(map[string][]*database.FileWithIndex)
-	for _, result := range results {
-		if result.Checksum != "" {
-			checksumGroups[result.Checksum] = append(checksumGroups[result.Checksum], result)
-		}
-	}
-
-	// Count total files
-	totalFiles := len(results)
-	totalSets := len(checksumGroups)
-
-	fmt.Printf("Found %d duplicate set(s) (%d files total)\n\n", totalSets, totalFiles)
-
-	// Display each duplicate set
-	setNum := 0
-	for checksum, files := range checksumGroups {
-		setNum++
-		fmt.Println("========================================")
-		checksumDisplay := checksum
-		if len(checksumDisplay) > 12 {
-			checksumDisplay = checksumDisplay[:12] + "..."
-		}
-		fmt.Printf("Checksum: %s (%d copies)\n", checksumDisplay, len(files))
-		fmt.Println("========================================")
-
-		// Group by drive/index
-		driveGroups := make(map[string][]*database.FileWithIndex)
-		for _, file := range files {
-			driveKey := file.IndexName
-			driveGroups[driveKey] = append(driveGroups[driveKey], file)
-		}
-
-		// Display files grouped by drive
-		for driveName, driveFiles := range driveGroups {
-			// Get index path from first file
-			indexPath := driveFiles[0].IndexPath
-			fmt.Printf("\n📁 Drive: %s (%s)\n", driveName, indexPath)
-
-			for _, file := range driveFiles {
-				sizeStr := formatBytes(file.Size)
-				fmt.Printf("  • %s (%s, %s)\n",
-					file.RelativePath,
-					sizeStr,
-					file.ModTime.Format("2006-01-02 15:04:05"),
-				)
-			}
-		}
-
-		if setNum < totalSets {
-			fmt.Println()
-		}
-	}
-}
-
@@ -3,14 +3,20 @@ package cmd
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/victor/stormindexer/internal/indexer"
+	"github.com/victor/stormindexer/internal/jobs"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/internal/power"
+	"github.com/victor/stormindexer/internal/smart"
 )
 
 var indexCmd = &cobra.Command{
@@ -39,12 +45,12 @@ or updates an existing one if the path was previously indexed.`,
 			fmt.Fprintf(os.Stderr, "Error: Invalid flag usage. Did you mean --name or -n?\n")
 			fmt.Fprintf(os.Stderr, "The flag -name is not recognized. Use --name or -n instead.\n")
 			fmt.Fprintf(os.Stderr, "Example: stormindexer index /path --name myindex\n")
-			os.Exit(1)
+			exit(1)
 		} else {
 			// Normal parsing - get path from args
 			if len(args) == 0 {
 				fmt.Fprintf(os.Stderr, "Error: Path argument required\n")
-				os.Exit(1)
+				exit(1)
 			}
 			path = args[0]
 			
@@ -53,19 +59,20 @@ or updates an existing one if the path was previously indexed.`,
 				fmt.Fprintf(os.Stderr, "Error: Unexpected argument: %s\n", args[1])
 				fmt.Fprintf(os.Stderr, "Use --name or -n flag to specify index name\n")
 				fmt.Fprintf(os.Stderr, "Example: stormindexer index %s --name %s\n", path, args[1])
-				os.Exit(1)
+				exit(1)
 			}
 		}
 		
 		absPath, err := filepath.Abs(path)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Invalid path: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
+		absPath = paths.NormalizeRoot(absPath)
 
 		if _, err := os.Stat(absPath); os.IsNotExist(err) {
 			fmt.Fprintf(os.Stderr, "Error: Path does not exist: %s\n", absPath)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Get name from flag if not already set from args
@@ -78,6 +85,7 @@ or updates an existing one if the path was previously indexed.`,
 
 		calculateChecksums, _ := cmd.Flags().GetBool("checksums")
 		force, _ := cmd.Flags().GetBool("force")
+		verbose, _ := cmd.Flags().GetBool("verbose")
 
 		// Generate index ID from path and machine ID
 		indexID := generateIndexID(absPath)
@@ -87,7 +95,10 @@ or updates an existing one if the path was previously indexed.`,
 		if err == nil && !force {
 			fmt.Printf("Index already exists: %s\n", existingIndex.Name)
 			fmt.Printf("Use --force to reindex or use 'reindex' command\n")
-			os.Exit(0)
+			exit(0)
+		}
+		if deferredForPower(cmd) {
+			return
 		}
 
 		// Create or update index entry
@@ -98,57 +109,249 @@ or updates an existing one if the path was previously indexed.`,
 			CreatedAt: time.Now(),
 			MachineID: cfg.MachineID,
 		}
+		index.SkipDirectories, _ = cmd.Flags().GetBool("no-dirs")
+		index.Compact, _ = cmd.Flags().GetBool("compact")
+		if existingIndex != nil && index.Compact != existingIndex.Compact && cmd.Flags().Changed("compact") {
+			fmt.Fprintf(os.Stderr, "Warning: --compact only applies to new indexes; remove %s and index it again to change its storage\n", existingIndex.Name)
+		}
 
 		if existingIndex == nil {
 			if err := db.CreateIndex(index); err != nil {
 				fmt.Fprintf(os.Stderr, "Error creating index: %v\n", err)
-				os.Exit(1)
+				exit(1)
 			}
+		} else if cmd.Flags().Changed("no-dirs") {
+			if err := db.SetSkipDirectories(indexID, index.SkipDirectories); err != nil {
+				fmt.Fprintf(os.Stderr, "Error updating index: %v\n", err)
+				exit(1)
+			}
+		} else {
+			index.SkipDirectories = existingIndex.SkipDirectories
 		}
 
 		// Perform indexing
+		job := startJob("index", index, absPath)
+		captureHealth(cmd, index, job)
 		idxr := indexer.NewIndexer(db, indexID, absPath)
+		idxr.SetVerbose(verbose)
+		idxr.SetSkipDirectories(index.SkipDirectories)
+		idxr.SetThumbnails(thumbnailsEnabled(cmd, calculateChecksums))
+		idxr.SetExcludes(cfg.Exclude)
+		if include, _ := cmd.Flags().GetBool("include-nested"); !include {
+			idxr.SetNestedRoots(nestedRoots(index))
+		}
+		idxr.SetRetries(cfg.Retries, cfg.RetryDelay)
+		idxr.SetContext(jobContext(job))
+		idxr.SetEvents(bus)
+		setTimeLimit(cmd, idxr)
 		if err := idxr.Index(calculateChecksums); err != nil {
+			if stoppedAtTimeLimit(err, index) {
+				stopJob(job)
+				return
+			}
+			finishJob(job, err)
 			fmt.Fprintf(os.Stderr, "Error indexing: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Update index stats
-		if err := db.UpdateIndexStats(indexID); err != nil {
+		err = db.UpdateIndexStats(indexID)
+		finishJob(job, err)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error updating stats: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Printf("\nIndexing completed successfully!\n")
+		for _, parent := range parentIndexes(index) {
+			fmt.Printf("Note: %s is inside index %s (%s); reindex it to stop counting these files twice\n",
+				absPath, parent.Name, parent.RootPath)
+		}
+		applyPoliciesAfterScan(index)
 	},
 }
 
 var reindexCmd = &cobra.Command{
-	Use:   "reindex [index-id]",
+	Use:   "reindex [index-id|name]",
 	Short: "Reindex an existing index",
-	Long: `Updates an existing index by scanning for changes, additions, and deletions.`,
-	Args: cobra.ExactArgs(1),
+	Long: `Updates an existing index by scanning for changes, additions, and deletions.
+Without an index, the index containing the current directory is reindexed.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		indexID := args[0]
-
-		index, err := db.GetIndex(indexID)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Index not found: %s\n", indexID)
-			os.Exit(1)
+		var index *models.Index
+		if len(args) == 0 {
+			var err error
+			if index, err = workingDirIndex(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: no index given and %v\n", err)
+				exit(1)
+			}
+		} else {
+			index = findIndex(args[0], "Index")
 		}
+		indexID := index.ID
 
 		calculateChecksums, _ := cmd.Flags().GetBool("checksums")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		if deferredForPower(cmd) {
+			return
+		}
+
+		if cmd.Flags().Changed("no-dirs") || cmd.Flags().Changed("dirs") {
+			skip, _ := cmd.Flags().GetBool("no-dirs")
+			if cmd.Flags().Changed("dirs") {
+				keep, _ := cmd.Flags().GetBool("dirs")
+				skip = !keep
+			}
+			if err := db.SetSkipDirectories(indexID, skip); err != nil {
+				fmt.Fprintf(os.Stderr, "Error updating index: %v\n", err)
+				exit(1)
+			}
+			index.SkipDirectories = skip
+		}
 
+		job := startJob("reindex", index, index.RootPath)
+		captureHealth(cmd, index, job)
 		idxr := indexer.NewIndexer(db, indexID, index.RootPath)
-		if err := idxr.Reindex(calculateChecksums); err != nil {
+		idxr.SetVerbose(verbose)
+		idxr.SetSkipDirectories(index.SkipDirectories)
+		idxr.SetThumbnails(thumbnailsEnabled(cmd, calculateChecksums))
+		idxr.SetExcludes(cfg.Exclude)
+		if include, _ := cmd.Flags().GetBool("include-nested"); !include {
+			idxr.SetNestedRoots(nestedRoots(index))
+		}
+		idxr.SetRetries(cfg.Retries, cfg.RetryDelay)
+		idxr.SetContext(jobContext(job))
+		idxr.SetEvents(bus)
+		setTimeLimit(cmd, idxr)
+		err := idxr.Reindex(calculateChecksums)
+		if stoppedAtTimeLimit(err, index) {
+			stopJob(job)
+			return
+		}
+		finishJob(job, err)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reindexing: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Printf("\nReindexing completed successfully!\n")
+		applyPoliciesAfterScan(index)
 	},
 }
 
+var rehashCmd = &cobra.Command{
+	Use:   "rehash [index-id|name]",
+	Short: "Compute missing or stale checksums",
+	Long: `Hash the files of an index that have no valid checksum: files indexed
+without --checksums and files whose checksum was dropped because they changed
+and could not be rehashed. With --stale only the latter are processed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		onlyStale, _ := cmd.Flags().GetBool("stale")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		workers, _ := cmd.Flags().GetInt("workers")
+
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if deferredForPower(cmd) {
+			return
+		}
+
+		job := startJob("rehash", index, index.RootPath)
+		idxr := indexer.NewIndexer(db, index.ID, index.RootPath)
+		idxr.SetVerbose(verbose)
+		idxr.SetWorkers(workers)
+		idxr.SetRetries(cfg.Retries, cfg.RetryDelay)
+		idxr.SetContext(jobContext(job))
+		idxr.SetEvents(bus)
+		result, err := idxr.Rehash(onlyStale)
+		finishJob(job, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rehashing: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("✓ Rehashed %d files", result.Hashed)
+		if result.Changed > 0 {
+			fmt.Printf(" (%d had changed since the last scan)", result.Changed)
+		}
+		fmt.Println()
+		if result.Missing > 0 {
+			fmt.Printf("  %d files no longer exist; run reindex to remove them\n", result.Missing)
+		}
+		if result.Failed > 0 {
+			fmt.Printf("  %d files could not be read\n", result.Failed)
+		}
+	},
+}
+
+// rescanIndex reindexes an index as a tracked job, hashing changed files
+// when the index has checksums
+func rescanIndex(index *models.Index) error {
+	coverage, err := db.GetChecksumCoverage(index.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read checksum coverage: %w", err)
+	}
+
+	job := startJob("reindex", index, index.RootPath)
+	idxr := indexer.NewIndexer(db, index.ID, index.RootPath)
+	idxr.SetExcludes(cfg.Exclude)
+	idxr.SetSkipDirectories(index.SkipDirectories)
+	idxr.SetNestedRoots(nestedRoots(index))
+	idxr.SetRetries(cfg.Retries, cfg.RetryDelay)
+	idxr.SetContext(jobContext(job))
+	idxr.SetEvents(bus)
+	err = idxr.Reindex(coverage.Hashed > 0)
+	finishJob(job, err)
+	return err
+}
+
+// nestedRoots returns the roots of the other indexes of this machine below
+// the root of index, mapped to their IDs, for the scan to skip. It returns
+// nil when the skip_nested_indexes setting is off.
+func nestedRoots(index *models.Index) map[string]string {
+	if !cfg.SkipNestedIndexes {
+		return nil
+	}
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to list indexes, nested indexes are scanned: %v\n", err)
+		return nil
+	}
+	roots := make(map[string]string)
+	for _, other := range indexes {
+		if other.MachineID == index.MachineID && other.RootPath != index.RootPath &&
+			paths.Contains(index.RootPath, other.RootPath) {
+			roots[other.RootPath] = other.ID
+		}
+	}
+	return roots
+}
+
+// parentIndexes returns the indexes of this machine whose roots contain the
+// root of index, and whose scans therefore also counted its files
+func parentIndexes(index *models.Index) []*models.Index {
+	if !cfg.SkipNestedIndexes {
+		return nil
+	}
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		return nil
+	}
+	var parents []*models.Index
+	for _, other := range indexes {
+		if other.MachineID == index.MachineID && other.RootPath != index.RootPath &&
+			paths.Contains(other.RootPath, index.RootPath) {
+			parents = append(parents, other)
+		}
+	}
+	return parents
+}
+
 func generateIndexID(path string) string {
 	// Generate a unique ID based on machine ID and path
 	data := fmt.Sprintf("%s:%s", cfg.MachineID, path)
@@ -156,6 +359,105 @@ func generateIndexID(path string) string {
 	return hex.EncodeToString(hash[:16]) // Use first 16 bytes (32 hex chars)
 }
 
+// captureHealth records the SMART health of the drive holding an index with
+// the scan, when --smart or the smart setting asks for it. A failed capture
+// only prints a warning.
+func captureHealth(cmd *cobra.Command, index *models.Index, job *jobs.Tracker) {
+	enabled, _ := cmd.Flags().GetBool("smart")
+	if !enabled && !cfg.SMART {
+		return
+	}
+
+	health, err := smart.Capture(jobContext(job), index.RootPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: drive health not recorded: %v\n", err)
+		return
+	}
+	health.IndexID = index.ID
+	if job != nil {
+		health.JobID = job.Job.ID
+	}
+	if err := db.RecordDriveHealth(health); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: drive health not recorded: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Drive health: %s\n", describeHealth(health))
+	if _, reasons, err := smart.Check(db, index.ID); err == nil && len(reasons) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠ Drive health degraded: %s\n", strings.Join(reasons, ", "))
+	}
+}
+
+// deferredForPower tells when a scan waits for the charger, as --on-ac and
+// --min-battery or the require_ac_power and min_battery settings ask. A
+// deferred scan is not a failure, so scheduled runs simply try again later.
+func deferredForPower(cmd *cobra.Command) bool {
+	policy := power.Policy{RequireAC: cfg.RequireACPower, MinBattery: cfg.MinBattery}
+	if cmd.Flags().Changed("on-ac") {
+		policy.RequireAC, _ = cmd.Flags().GetBool("on-ac")
+	}
+	if cmd.Flags().Changed("min-battery") {
+		policy.MinBattery, _ = cmd.Flags().GetInt("min-battery")
+	}
+	if !policy.Active() {
+		return false
+	}
+
+	status, err := power.Read()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot tell whether this machine runs on battery (%v); scanning anyway\n", err)
+		return false
+	}
+	if reason := policy.Defer(status); reason != "" {
+		fmt.Printf("Deferred: %s. Run again on AC power, or pass --on-ac=false --min-battery 0 to scan anyway.\n", reason)
+		return true
+	}
+	return false
+}
+
+// setTimeLimit applies --max-duration and --restart to a scan
+func setTimeLimit(cmd *cobra.Command, idxr *indexer.Indexer) {
+	maxDuration, _ := cmd.Flags().GetDuration("max-duration")
+	restart, _ := cmd.Flags().GetBool("restart")
+	idxr.SetMaxDuration(maxDuration)
+	idxr.SetRestart(restart)
+}
+
+// stoppedAtTimeLimit tells how to resume a scan that stopped at its
+// --max-duration, which is not a failure
+func stoppedAtTimeLimit(err error, index *models.Index) bool {
+	if !errors.Is(err, indexer.ErrTimeLimit) {
+		return false
+	}
+	fmt.Printf("\nStopped at the time limit. Run 'stormindexer reindex %s' to resume where the scan stopped.\n", index.Name)
+	return true
+}
+
+// thumbnailsEnabled reports whether a scan stores previews, asked for by
+// --thumbnails or the thumbnails setting. Previews are keyed by checksum, so
+// only files the scan hashes get one.
+func thumbnailsEnabled(cmd *cobra.Command, calculateChecksums bool) bool {
+	enabled, _ := cmd.Flags().GetBool("thumbnails")
+	if !enabled && !cfg.Thumbnails {
+		return false
+	}
+	if !calculateChecksums && cmd.Name() == "index" {
+		fmt.Fprintf(os.Stderr, "Warning: thumbnails need checksums; pass --checksums to generate them\n")
+	}
+	return true
+}
+
+// describeHealth summarizes a SMART capture on one line
+func describeHealth(health *models.DriveHealth) string {
+	status := "PASSED"
+	if !health.Passed {
+		status = "FAILED"
+	}
+	return fmt.Sprintf("%s (%s %s, %d reallocated, %d pending, %d uncorrectable sectors, %dh powered on)",
+		status, health.Device, health.Model, health.ReallocatedSectors, health.PendingSectors,
+		health.UncorrectableSectors, health.PowerOnHours)
+}
+
 func init() {
 	// Add name flag with both short (-n) and long (--name) forms
 	nameFlag := indexCmd.Flags().StringP("name", "n", "", "Name for the index")
@@ -166,10 +468,32 @@ func init() {
 	// so users should use --name or -n. But we'll handle -name in the Run function.
 	indexCmd.Flags().BoolP("checksums", "c", false, "Calculate file checksums (slower but enables duplicate detection)")
 	indexCmd.Flags().BoolP("force", "f", false, "Force reindex even if index exists")
+	indexCmd.Flags().BoolP("verbose", "v", false, "Print duplicates as they are discovered")
+	indexCmd.Flags().Bool("compact", false, "Store file names once per directory instead of full paths, for very large catalogs")
 
 	reindexCmd.Flags().BoolP("checksums", "c", false, "Calculate file checksums")
+	reindexCmd.Flags().BoolP("verbose", "v", false, "Print duplicates as they are discovered")
+	reindexCmd.Flags().Bool("dirs", false, "Store directory entries again after --no-dirs")
+	for _, c := range []*cobra.Command{indexCmd, reindexCmd} {
+		c.Flags().Bool("smart", false, "Record the SMART health of the drive with this scan (needs smartctl)")
+		c.Flags().Duration("max-duration", 0, "Stop cleanly after this long (e.g. 2h, 45m), keeping what was scanned; the next scan resumes")
+		c.Flags().Bool("restart", false, "Scan the whole tree again instead of resuming where the last scan stopped")
+		c.Flags().Bool("thumbnails", false, "Store a small preview of hashed images and videos (videos need ffmpeg)")
+		c.Flags().Bool("include-nested", false, "Also scan directories that are the roots of other indexes")
+		c.Flags().Bool("no-dirs", false, "Do not store directory entries, derive them from the file paths (kept for later scans)")
+	}
+	reindexCmd.MarkFlagsMutuallyExclusive("no-dirs", "dirs")
 
 	rootCmd.AddCommand(indexCmd)
+	for _, c := range []*cobra.Command{indexCmd, reindexCmd, rehashCmd} {
+		c.Flags().Bool("on-ac", false, "Do nothing while this machine runs on battery (default: the require_ac_power setting)")
+		c.Flags().Int("min-battery", 0, "Do nothing while on battery below this charge in percent (default: the min_battery setting)")
+	}
+	rehashCmd.Flags().Bool("stale", false, "Only refresh checksums dropped after a change")
+	rehashCmd.Flags().BoolP("verbose", "v", false, "Print duplicates as they are discovered")
+	rehashCmd.Flags().IntP("workers", "w", 1, "Number of files to hash in parallel")
+
 	rootCmd.AddCommand(reindexCmd)
+	rootCmd.AddCommand(rehashCmd)
 }
 
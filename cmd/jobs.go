@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/jobs"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "List running operations",
+	Long: `List the scans, syncs and other long running operations that are using
+the database. Jobs whose process exited without finishing, or that stopped
+sending heartbeats, are shown as dead. Use --all to include finished jobs.
+
+With the max_concurrent_jobs setting, jobs beyond the limit wait for a slot
+and are shown as queued with their place in the queue of their machine,
+"queued #1" starting next. Queued jobs can be cancelled like running ones.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		list, err := db.ListJobs(all)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing jobs: %v\n", err)
+			exit(1)
+		}
+
+		if len(list) == 0 {
+			fmt.Println("No running jobs.")
+			return
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "ID\tKIND\tSTATUS\tPID\tHOST\tSTARTED\tHEARTBEAT\tDESCRIPTION\n")
+		for _, job := range list {
+			state := jobs.State(job, now)
+			if state == models.JobQueued {
+				state = fmt.Sprintf("queued #%d", jobs.QueuePosition(list, job, now))
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s ago\t%s\n",
+				job.ID, job.Kind, state, job.PID, job.Host,
+				job.StartedAt.Local().Format("2006-01-02 15:04:05"),
+				now.Sub(job.Heartbeat).Round(time.Second), job.Description)
+		}
+		w.Flush()
+	},
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel [job-id]",
+	Short: "Cancel a running job",
+	Long: `Ask a running job to stop at its next safe checkpoint. The job notices
+the request within a few seconds and keeps the work done so far: a scan keeps
+the files it already indexed, a sync records the files it already copied.
+This works from any machine sharing the database.
+
+With --kill the process is killed right away instead. This only works on the
+machine the job runs on.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runCancel,
+}
+
+// jobsCancelCmd is the same command under jobs
+var jobsCancelCmd = &cobra.Command{
+	Use:   cancelCmd.Use,
+	Short: cancelCmd.Short,
+	Long:  cancelCmd.Long,
+	Args:  cobra.ExactArgs(1),
+	Run:   runCancel,
+}
+
+func runCancel(cmd *cobra.Command, args []string) {
+	kill, _ := cmd.Flags().GetBool("kill")
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid job ID: %s\n", args[0])
+		exit(1)
+	}
+
+	job, err := jobs.Cancel(db, id, kill)
+	if errors.Is(err, jobs.ErrNotRunning) {
+		fmt.Printf("Job %d is not running (%s)\n", id, jobs.State(job, time.Now()))
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	if kill {
+		fmt.Printf("✓ Killed job %d (%s, pid %d)\n", job.ID, job.Kind, job.PID)
+	} else {
+		fmt.Printf("✓ Asked job %d (%s) to stop at its next checkpoint\n", job.ID, job.Kind)
+	}
+}
+
+// jobSignals stops the interrupt handling of each job started with startJob
+// once it finishes, so the jobs run one after the other by a command do not
+// pile up handlers
+var jobSignals = make(map[*jobs.Tracker]func())
+
+// startJob records a long running operation in the jobs table. With the
+// max_concurrent_jobs setting it first waits in the queue of this machine
+// until a slot is free. The first interrupt asks the job to stop at its next
+// checkpoint, or cancels it while queued; a second one exits right away.
+// Failing to record the job only prints a warning.
+func startJob(kind string, index *models.Index, description string) *jobs.Tracker {
+	var indexID string
+	if index != nil {
+		indexID = index.ID
+	}
+	start := jobs.Start
+	if cfg.MaxConcurrentJobs > 0 {
+		start = jobs.Enqueue
+	}
+	tracker, err := start(db, kind, indexID, description)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		publishScanStarted(kind, indexID, description)
+		return nil
+	}
+
+	signals := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	jobSignals[tracker] = func() {
+		signal.Stop(signals)
+		close(done)
+	}
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\nStopping at the next checkpoint, interrupt again to abort...\n")
+		tracker.Interrupt()
+
+		var sig os.Signal
+		select {
+		case sig = <-signals:
+		case <-done:
+			return
+		}
+		tracker.FinishWithStatus(models.JobCancelled, fmt.Errorf("interrupted by %s", sig))
+		publishScanFinished(tracker)
+		exit(130)
+	}()
+
+	if cfg.MaxConcurrentJobs > 0 {
+		err := tracker.Wait(cfg.MaxConcurrentJobs, func(running, ahead int) {
+			fmt.Fprintf(os.Stderr, "Queued as job %d: %d of %d jobs running on this machine, %d queued ahead\n",
+				tracker.Job.ID, running, cfg.MaxConcurrentJobs, ahead)
+		})
+		if errors.Is(err, context.Canceled) {
+			tracker.Finish(err)
+			fmt.Fprintf(os.Stderr, "Cancelled before it started.\n")
+			exit(130)
+		}
+		if err != nil {
+			tracker.Finish(err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+
+	publishScanStarted(kind, indexID, description)
+	return tracker
+}
+
+// publishScanStarted publishes the start of a scan job
+func publishScanStarted(kind, indexID, description string) {
+	if scanKinds[kind] {
+		bus.Publish(models.EventScanStarted, indexID, description, kind)
+	}
+}
+
+// jobContext returns the context cancelled when a job is asked to stop
+func jobContext(tracker *jobs.Tracker) context.Context {
+	if tracker == nil {
+		return context.Background()
+	}
+	return tracker.Context()
+}
+
+// finishJob records the outcome of a job started with startJob. A job that
+// stopped because it was cancelled exits the process.
+func finishJob(tracker *jobs.Tracker, err error) {
+	if tracker != nil {
+		releaseSignals(tracker)
+		tracker.Finish(err)
+		publishScanFinished(tracker)
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "Cancelled, the work done so far has been kept.\n")
+		exit(130)
+	}
+}
+
+// stopJob records a scan that stopped at its time limit. Its status is
+// stopped rather than finished, so LastScan does not take the partly
+// walked tree for a complete scan.
+func stopJob(tracker *jobs.Tracker) {
+	if tracker != nil {
+		releaseSignals(tracker)
+		tracker.FinishWithStatus(models.JobStopped, nil)
+		publishScanFinished(tracker)
+	}
+}
+
+// releaseSignals stops handling the signals of a job started with startJob
+func releaseSignals(tracker *jobs.Tracker) {
+	if stop, ok := jobSignals[tracker]; ok {
+		stop()
+		delete(jobSignals, tracker)
+	}
+}
+
+// scanKinds are the job kinds that publish scan events
+var scanKinds = map[string]bool{"index": true, "reindex": true, "rehash": true}
+
+// publishScanFinished publishes the outcome of a finished scan job and
+// prunes the events older than the event_retention setting
+func publishScanFinished(tracker *jobs.Tracker) {
+	job := tracker.Job
+	if !scanKinds[job.Kind] {
+		return
+	}
+	detail := job.Kind + " " + job.Status
+	if job.Error != "" {
+		detail += ": " + job.Error
+	}
+	bus.Publish(models.EventScanFinished, job.IndexID, job.Description, detail)
+	if cfg.EventRetention > 0 {
+		db.PruneEvents(time.Now().Add(-cfg.EventRetention))
+	}
+}
+
+func init() {
+	jobsCmd.Flags().Bool("all", false, "Include finished, failed, cancelled and stopped jobs")
+
+	cancelCmd.Flags().Bool("kill", false, "Kill the process right away instead of waiting for a checkpoint")
+	jobsCancelCmd.Flags().AddFlagSet(cancelCmd.Flags())
+
+	jobsCmd.AddCommand(jobsCancelCmd)
+	rootCmd.AddCommand(jobsCmd)
+	rootCmd.AddCommand(cancelCmd)
+}
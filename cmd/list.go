@@ -3,10 +3,12 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"text/tabwriter"
-	"time"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/output"
+	"github.com/victor/stormindexer/internal/smart"
 )
 
 var listCmd = &cobra.Command{
@@ -14,10 +16,12 @@ var listCmd = &cobra.Command{
 	Short: "List all indexes",
 	Long:  `List all indexes stored in the database.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		formatter := getFormatter(cmd)
+
 		indexes, err := db.ListIndexes()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if len(indexes) == 0 {
@@ -25,86 +29,92 @@ var listCmd = &cobra.Command{
 			return
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "ID\tNAME\tPATH\tFILES\tSIZE\tLAST SYNC")
-		fmt.Fprintln(w, "---\t----\t----\t-----\t----\t---------")
-
-		for _, index := range indexes {
-			sizeStr := formatBytes(index.TotalSize)
-			lastSync := "Never"
-			if !index.LastSync.IsZero() {
-				lastSync = index.LastSync.Format("2006-01-02 15:04:05")
+		loans, err := db.ListLoans(false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing loans: %v\n", err)
+			exit(1)
+		}
+		for _, loan := range loans {
+			for _, index := range indexes {
+				if index.ID == loan.IndexID {
+					index.Loan = loan
+				}
 			}
+		}
 
-			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
-				index.ID[:12], // Truncate ID for display (12 chars)
-				index.Name,
-				index.RootPath,
-				index.TotalFiles,
-				sizeStr,
-				lastSync,
-			)
+		if err := formatter.Indexes(os.Stdout, indexes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			exit(1)
 		}
 
-		w.Flush()
+		// Warnings go to stderr so they never mix with JSON or CSV output
+		for _, index := range indexes {
+			_, reasons, err := smart.Check(db, index.ID)
+			if err == nil && len(reasons) > 0 {
+				fmt.Fprintf(os.Stderr, "⚠ %s: drive health degraded (%s)\n", index.Name, strings.Join(reasons, ", "))
+			}
+		}
 	},
 }
 
 var listFilesCmd = &cobra.Command{
 	Use:   "files [index-id|name]",
 	Short: "List files in an index",
-	Long:  `List all files in the specified index. You can use full ID, partial ID (8+ chars), or exact name.`,
+	Long:  `List all files in the specified index. You can use full ID, an unambiguous ID prefix (4+ chars), exact name, or a path on the drive.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		identifier := args[0]
+		formatter := getFormatter(cmd)
 
 		index, err := db.FindIndexByNameOrID(identifier)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Index not found: %s\n", identifier)
-			fmt.Fprintf(os.Stderr, "You can use full ID, partial ID (8+ chars), or exact name.\n")
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "You can use full ID, an unambiguous ID prefix (4+ chars), exact name, or a path on the drive.\n")
 			fmt.Fprintf(os.Stderr, "Use 'stormindexer list' to see available indexes.\n")
-			os.Exit(1)
+			exit(1)
 		}
 
-		files, err := db.ListFiles(index.ID)
+		files, err := db.ListFilesSorted(index.ID, sortOrder(cmd))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing files: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
-		fmt.Printf("Index: %s (%s)\n", index.Name, index.RootPath)
-		fmt.Printf("Total files: %d\n\n", len(files))
-
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "PATH\tSIZE\tMODIFIED\tCHECKSUM")
-		fmt.Fprintln(w, "----\t----\t--------\t--------")
+		pins, err := db.ListPins(index.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing pins: %v\n", err)
+			exit(1)
+		}
 
+		var results []*database.FileWithIndex
 		for _, file := range files {
 			if file.IsDirectory {
 				continue
 			}
-
-			checksum := file.Checksum
-			if checksum == "" {
-				checksum = "-"
-			} else if len(checksum) > 12 {
-				checksum = checksum[:12] + "..."
-			}
-
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
-				file.RelativePath,
-				formatBytes(file.Size),
-				file.ModTime.Format(time.RFC3339),
-				checksum,
-			)
+			results = append(results, &database.FileWithIndex{
+				FileEntry: file,
+				IndexName: index.Name,
+				IndexPath: index.RootPath,
+				Pinned:    pins.Covering(file.RelativePath) != nil,
+			})
 		}
 
-		w.Flush()
+		err = formatter.Files(os.Stdout, output.FileList{
+			Title: fmt.Sprintf("Index: %s (%s)\nTotal files: %d", index.Name, index.RootPath, len(results)),
+			Files: results,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			exit(1)
+		}
 	},
 }
 
 func init() {
+	addFormatFlag(listCmd)
+	addFormatFlag(listFilesCmd)
+	addSortFlag(listFilesCmd)
+
 	listCmd.AddCommand(listFilesCmd)
 	rootCmd.AddCommand(listCmd)
 }
-
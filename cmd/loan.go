@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/filter"
+)
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout [index-id|name]",
+	Short: "Mark an indexed drive as checked out",
+	Long: `Record that the drive of an index was lent to a person or taken to a
+place, optionally with a due date. Checked out drives show who has them in
+'list', 'show' and 'loans', and overdue ones are flagged. Use 'checkin' when
+the drive comes back.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		borrower, _ := cmd.Flags().GetString("to")
+		dueStr, _ := cmd.Flags().GetString("due")
+		note, _ := cmd.Flags().GetString("note")
+
+		if borrower == "" {
+			fmt.Fprintf(os.Stderr, "Error: --to is required, e.g. --to \"Sam (site visit)\"\n")
+			exit(1)
+		}
+
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		now := time.Now()
+		loan := &models.Loan{IndexID: index.ID, Borrower: borrower, Note: note, CheckedOutAt: now}
+		if dueStr != "" {
+			loan.DueAt, err = parseDue(dueStr, now)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+
+		if err := db.CheckOut(loan); err != nil {
+			if errors.Is(err, database.ErrCheckedOut) {
+				active, _ := db.ActiveLoan(index.ID)
+				fmt.Fprintf(os.Stderr, "Error: %s is already checked out to %s, check it in first\n", index.Name, active.Borrower)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			exit(1)
+		}
+
+		fmt.Printf("✓ Checked out %s to %s", index.Name, borrower)
+		if !loan.DueAt.IsZero() {
+			fmt.Printf(", due %s", loan.DueAt.Local().Format("2006-01-02"))
+		}
+		fmt.Println()
+	},
+}
+
+var checkinCmd = &cobra.Command{
+	Use:   "checkin [index-id|name]",
+	Short: "Mark a checked out drive as returned",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		loan, err := db.CheckIn(index.ID, time.Now())
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("%s is not checked out\n", index.Name)
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("✓ Checked in %s from %s after %s\n", index.Name, loan.Borrower, formatDays(loan.ReturnedAt.Sub(loan.CheckedOutAt)))
+		if index.Location != "" {
+			fmt.Printf("  Return it to: %s\n", index.Location)
+		}
+	},
+}
+
+var loansCmd = &cobra.Command{
+	Use:   "loans",
+	Short: "List checked out drives",
+	Long:  `List the drives currently checked out, overdue ones first. Use --all to include returned drives.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		loans, err := db.ListLoans(all)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing loans: %v\n", err)
+			exit(1)
+		}
+		if len(loans) == 0 {
+			fmt.Println("No drives are checked out.")
+			return
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "DRIVE\tBORROWER\tCHECKED OUT\tDUE\tSTATUS\tNOTE\n")
+		for _, overdueFirst := range []bool{true, false} {
+			for _, loan := range loans {
+				if loan.Overdue(now) != overdueFirst {
+					continue
+				}
+				name := loan.IndexID
+				if index, err := db.GetIndex(loan.IndexID); err == nil {
+					name = index.Name
+				}
+				due := "-"
+				if !loan.DueAt.IsZero() {
+					due = loan.DueAt.Local().Format("2006-01-02")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, loan.Borrower,
+					loan.CheckedOutAt.Local().Format("2006-01-02"), due, loanStatus(loan, now), loan.Note)
+			}
+		}
+		w.Flush()
+	},
+}
+
+// loanStatus describes a loan for listings
+func loanStatus(loan *models.Loan, now time.Time) string {
+	switch {
+	case !loan.ReturnedAt.IsZero():
+		return "returned " + loan.ReturnedAt.Local().Format("2006-01-02")
+	case loan.Overdue(now):
+		return "OVERDUE by " + formatDays(now.Sub(loan.DueAt))
+	default:
+		return "out"
+	}
+}
+
+// formatDays rounds a period, such as a loan, to days
+func formatDays(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	if days < 1 {
+		return "less than a day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+var duePattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// parseDue reads a due date given as a date or as a period from now such as
+// "14d" or "2w"
+func parseDue(s string, now time.Time) (time.Time, error) {
+	if m := duePattern.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n > 3650 {
+			return time.Time{}, fmt.Errorf("due date too far ahead: %s", s)
+		}
+		if m[2] == "w" {
+			n *= 7
+		}
+		return now.AddDate(0, 0, n), nil
+	}
+	due, err := filter.ParseDate(s, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid due date %q, use a date (2006-01-02) or a period (14d, 2w)", s)
+	}
+	if due.Before(now.Truncate(24 * time.Hour)) {
+		return time.Time{}, fmt.Errorf("due date %s is in the past", s)
+	}
+	return due, nil
+}
+
+func init() {
+	checkoutCmd.Flags().String("to", "", "Person or place the drive goes to (required)")
+	checkoutCmd.Flags().String("due", "", "Due date (2006-01-02) or period from now (14d, 2w)")
+	checkoutCmd.Flags().String("note", "", "Free-form note, e.g. the project")
+	loansCmd.Flags().Bool("all", false, "Include returned drives")
+
+	rootCmd.AddCommand(checkoutCmd)
+	rootCmd.AddCommand(checkinCmd)
+	rootCmd.AddCommand(loansCmd)
+}
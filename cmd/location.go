@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/database"
+)
+
+var locationCmd = &cobra.Command{
+	Use:   "location [index-id|name] [label]",
+	Short: "Show or set the physical location of an index's drive",
+	Long: `Show or set a free-form label telling where the drive of an index is
+kept, such as "shelf B, box 3". 'locate-drive' prints it next to the files
+found on the drive. Use --clear to remove the label.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		clear, _ := cmd.Flags().GetBool("clear")
+
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if len(args) == 1 && !clear {
+			if index.Location == "" {
+				fmt.Printf("%s has no location, set one with 'stormindexer location %s \"shelf B, box 3\"'\n", index.Name, index.Name)
+				return
+			}
+			fmt.Printf("%s: %s\n", index.Name, index.Location)
+			return
+		}
+
+		location := ""
+		if !clear {
+			location = strings.TrimSpace(args[1])
+		}
+		if err := db.SetIndexLocation(index.ID, location); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if location == "" {
+			fmt.Printf("✓ Cleared the location of %s\n", index.Name)
+		} else {
+			fmt.Printf("✓ %s is at: %s\n", index.Name, location)
+		}
+	},
+}
+
+var locateDriveCmd = &cobra.Command{
+	Use:   "locate-drive <file>",
+	Short: "Tell which physical drive holds a file",
+	Long: `Find a file by name and print the drives holding it with their physical
+location. The name may contain * and ? wildcards. When it contains a slash,
+only files whose path ends with it match, e.g. 'photos/2019/img_001.jpg'.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		query := filepath.ToSlash(args[0])
+		name := path.Base(query)
+		if _, err := path.Match(name, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid pattern: %s\n", name)
+			exit(1)
+		}
+
+		// Name patterns match the whole relative path, so search for paths
+		// ending with the name and check the base name below
+		results, err := db.FindFiles(database.FindOptions{NamePattern: "*" + name, FileType: "all"})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error searching files: %v\n", err)
+			exit(1)
+		}
+
+		// Group by drive, keeping the order of the results
+		var order []string
+		byIndex := make(map[string][]*database.FileWithIndex)
+		for _, result := range results {
+			if ok, _ := path.Match(name, path.Base(result.RelativePath)); !ok {
+				continue
+			}
+			if strings.Contains(query, "/") && !pathEndsWith(result.RelativePath, query) && !pathEndsWith(filepath.ToSlash(result.Path), query) {
+				continue
+			}
+			if _, ok := byIndex[result.IndexID]; !ok {
+				order = append(order, result.IndexID)
+			}
+			byIndex[result.IndexID] = append(byIndex[result.IndexID], result)
+		}
+
+		if len(order) == 0 {
+			fmt.Printf("No indexed file matches %s\n", args[0])
+			exit(1)
+		}
+
+		for i, indexID := range order {
+			files := byIndex[indexID]
+			location := "unknown, set it with 'stormindexer location " + files[0].IndexName + " <label>'"
+			if index, err := db.GetIndex(indexID); err == nil && index.Location != "" {
+				location = index.Location
+			}
+
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Drive:    %s (%s)\n", files[0].IndexName, files[0].IndexPath)
+			fmt.Printf("Location: %s\n", location)
+			for _, file := range files {
+				fmt.Printf("  %s\n", file.RelativePath)
+			}
+		}
+	},
+}
+
+// pathEndsWith reports whether p ends with the path elements of suffix
+func pathEndsWith(p, suffix string) bool {
+	suffix = strings.TrimPrefix(suffix, "./")
+	return p == suffix || strings.HasSuffix(p, "/"+suffix)
+}
+
+func init() {
+	locationCmd.Flags().Bool("clear", false, "Remove the location label")
+	rootCmd.AddCommand(locationCmd)
+	rootCmd.AddCommand(locateDriveCmd)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/export"
+)
+
+var compareManifestCmd = &cobra.Command{
+	Use:   "compare-manifest [index-id|name] [manifest]",
+	Short: "Compare an index with a hashdeep or rhash manifest",
+	Long: `Compare the checksums of an index with an audit manifest written by
+another tool: hashdeep manifests, or sha256sum and rhash output in GNU, BSD or
+SFV style. Only SHA-256 hashes can be compared.
+
+Manifest paths are matched relative to the index root. When the manifest was
+made with the drive mounted elsewhere, give that mount point with --base.
+Entries the indexer skips (hidden files, the exclude patterns, nested index
+roots) are counted as not indexed rather than missing.
+Exits with status 1 when files are missing or do not match.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		base, _ := cmd.Flags().GetString("base")
+		showExtra, _ := cmd.Flags().GetBool("extra")
+
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		f, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening manifest: %v\n", err)
+			exit(1)
+		}
+		manifest, err := export.ReadManifest(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading manifest: %v\n", err)
+			exit(1)
+		}
+
+		result, err := export.CompareManifest(db, index.ID, manifest, base, cfg.Exclude)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error comparing manifest: %v\n", err)
+			exit(1)
+		}
+
+		for _, d := range result.Mismatched {
+			fmt.Printf("≠ %s\n", d.File.RelativePath)
+		}
+		for _, entry := range result.Missing {
+			fmt.Printf("- %s\n", entry.Path)
+		}
+		if showExtra {
+			for _, file := range result.Extra {
+				fmt.Printf("+ %s\n", file.RelativePath)
+			}
+		}
+
+		fmt.Printf("\n=== Manifest Comparison (%s, %d entries) ===\n", manifest.Format, len(manifest.Entries))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Matches:\t%d\n", result.Matched)
+		fmt.Fprintf(w, "Mismatches:\t%d\n", len(result.Mismatched))
+		fmt.Fprintf(w, "Missing from index:\t%d\n", len(result.Missing))
+		fmt.Fprintf(w, "Not in manifest:\t%d\n", len(result.Extra))
+		if len(result.NotIndexed) > 0 {
+			fmt.Fprintf(w, "Not indexed (hidden, excluded or nested):\t%d\n", len(result.NotIndexed))
+		}
+		if len(result.Unhashed) > 0 {
+			fmt.Fprintf(w, "Not hashed in index:\t%d (run 'rehash %s' to compare them)\n", len(result.Unhashed), index.Name)
+		}
+		if result.Outside > 0 {
+			fmt.Fprintf(w, "Outside the index root:\t%d (set --base to the manifest's root)\n", result.Outside)
+		}
+		if manifest.Skipped > 0 {
+			fmt.Fprintf(w, "Skipped, no SHA-256:\t%d\n", manifest.Skipped)
+		}
+		w.Flush()
+
+		if len(result.Mismatched) > 0 || len(result.Missing) > 0 {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	compareManifestCmd.Flags().String("base", "", "Directory in the manifest that corresponds to the index root")
+	compareManifestCmd.Flags().Bool("extra", false, "List indexed files the manifest does not mention")
+	rootCmd.AddCommand(compareManifestCmd)
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+)
+
+var pinCmd = &cobra.Command{
+	Use:   "pin [path]...",
+	Short: "Protect files or directories from deletion",
+	Long: `Pin files or directories so stormindexer never deletes them: sync --delete
+keeps pinned files missing from the source, 'report junk --clean' refuses
+to remove them, and policies never match them, so exec actions do not get
+them. Pinning a directory protects everything below it, and pinning
+the root of an index protects the whole drive. Pins are stored in the catalog,
+survive reindexing and are shown by 'find' and 'list files'.
+
+Paths are files or directories on an indexed drive. With --index they are
+relative to the root of that index instead, for drives that are not mounted.`,
+	Example: `  stormindexer pin /mnt/photos/2019/wedding --note "originals"
+  stormindexer pin --index backup taxes/2023.pdf`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		indexFlag, _ := cmd.Flags().GetString("index")
+		note, _ := cmd.Flags().GetString("note")
+
+		for _, arg := range args {
+			index, relativePath := pinTarget(indexFlag, arg)
+			if relativePath != "" {
+				if _, err := db.GetFile(paths.Join(index.RootPath, relativePath), index.ID); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s is not in index %s, reindex it first\n", relativePath, index.Name)
+					exit(1)
+				}
+			}
+
+			pin := &models.Pin{IndexID: index.ID, RelativePath: relativePath, Note: note, CreatedAt: time.Now()}
+			if err := db.AddPin(pin); err != nil {
+				fmt.Fprintf(os.Stderr, "Error pinning %s: %v\n", arg, err)
+				exit(1)
+			}
+			fmt.Printf("✓ Pinned %s\n", pinLabel(index, relativePath))
+		}
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin [path]...",
+	Short: "Remove the protection of pinned files or directories",
+	Long: `Remove pins added with 'pin'. Paths are given as for 'pin'; a path only
+loses the pin added for it, not the pins of the directories above it.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		indexFlag, _ := cmd.Flags().GetString("index")
+
+		for _, arg := range args {
+			index, relativePath := pinTarget(indexFlag, arg)
+			removed, err := db.RemovePin(index.ID, relativePath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error unpinning %s: %v\n", arg, err)
+				exit(1)
+			}
+			if removed {
+				fmt.Printf("✓ Unpinned %s\n", pinLabel(index, relativePath))
+			} else {
+				fmt.Printf("%s is not pinned\n", pinLabel(index, relativePath))
+			}
+
+			pins, err := db.ListPins(index.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing pins: %v\n", err)
+				exit(1)
+			}
+			if pin := pins.Covering(relativePath); pin != nil {
+				fmt.Printf("  It is still protected by the pin of %s\n", pinLabel(index, pin.RelativePath))
+			}
+		}
+	},
+}
+
+var pinsCmd = &cobra.Command{
+	Use:   "pins [index-id|name]...",
+	Short: "List pinned files and directories",
+	Long:  `List the pins of the given indexes, or of every index when none are given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		indexIDs := []string{""}
+		if len(args) > 0 {
+			indexIDs = nil
+			for _, index := range resolveIndexes(args) {
+				indexIDs = append(indexIDs, index.ID)
+			}
+		}
+		var pins models.Pins
+		for _, indexID := range indexIDs {
+			indexPins, err := db.ListPins(indexID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing pins: %v\n", err)
+				exit(1)
+			}
+			pins = append(pins, indexPins...)
+		}
+		if len(pins) == 0 {
+			fmt.Println("Nothing is pinned.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "DRIVE\tPATH\tPINNED\tNOTE\n")
+		for _, pin := range pins {
+			relativePath := pin.RelativePath
+			if relativePath == "" {
+				relativePath = "(whole drive)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", indexName(pin.IndexID), relativePath,
+				pin.CreatedAt.Local().Format("2006-01-02"), pin.Note)
+		}
+		w.Flush()
+	},
+}
+
+// pinTarget resolves a path given to pin or unpin to its index and its
+// slash-separated path relative to the index root. Without an index the
+// path is a path on an indexed drive.
+func pinTarget(indexFlag, arg string) (*models.Index, string) {
+	if indexFlag != "" {
+		index := findIndex(indexFlag, "Index")
+		relativePath := strings.Trim(path.Clean("/"+filepath.ToSlash(arg)), "/")
+		return index, relativePath
+	}
+
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	index, err := db.FindIndexByPath(abs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Use --index to give a path relative to the root of an index.\n")
+		exit(1)
+	}
+	rel, err := filepath.Rel(paths.NormalizeRoot(index.RootPath), paths.NormalizeRoot(abs))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if rel == "." {
+		rel = ""
+	}
+	return index, paths.ToSlash(rel)
+}
+
+// pinLabel names a pinned path for messages
+func pinLabel(index *models.Index, relativePath string) string {
+	if relativePath == "" {
+		return fmt.Sprintf("all of %s", index.Name)
+	}
+	return fmt.Sprintf("%s on %s", relativePath, index.Name)
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{pinCmd, unpinCmd} {
+		cmd.Flags().String("index", "", "Give paths relative to the root of this index (ID or name)")
+	}
+	pinCmd.Flags().String("note", "", "Why the path is pinned")
+
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+	rootCmd.AddCommand(pinsCmd)
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/policy"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "List and check the configured policies",
+	Long: `Policies are rules from the policies setting, evaluated against an index
+after every index and reindex. A policy selects files with a filter
+expression, the syntax of find --where, and triggers once the matching files
+of an index reach its thresholds. A triggered policy prints an alert, records
+a policy.triggered event and, with the exec action, runs its command with the
+matching paths on stdin, NUL-separated. An alert fires once, and again only
+after the index stopped meeting its policy; exec actions run every time.`,
+}
+
+var policyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the configured policies",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(cfg.Policies) == 0 {
+			fmt.Println("No policies configured.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "NAME\tWHERE\tTHRESHOLD\tACTION\n")
+		for _, p := range cfg.Policies {
+			threshold := "any match"
+			switch {
+			case p.MinFiles > 0 && p.MinSize != "":
+				threshold = fmt.Sprintf("%d files or %s", p.MinFiles, p.MinSize)
+			case p.MinFiles > 0:
+				threshold = fmt.Sprintf("%d files", p.MinFiles)
+			case p.MinSize != "":
+				threshold = p.MinSize
+			}
+			action := p.Action
+			if p.Command != "" {
+				action += ": " + p.Command
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.Where, threshold, action)
+		}
+		w.Flush()
+	},
+}
+
+var policyCheckCmd = &cobra.Command{
+	Use:   "check [index-id|name...]",
+	Short: "Evaluate the policies now",
+	Long: `Evaluate the policies against the given indexes, or every index, without
+scanning, and run the actions of the triggered ones. Run it from cron to
+check the whole catalog regularly. With --dry-run the triggered policies are
+only listed, including alerts that already fired.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if len(cfg.Policies) == 0 {
+			fmt.Println("No policies configured.")
+			return
+		}
+
+		triggered := 0
+		for _, index := range resolveIndexes(args) {
+			n, err := applyPolicies(index, dryRun)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			triggered += n
+		}
+		if triggered == 0 {
+			fmt.Println("✓ No new policy triggered")
+		}
+	},
+}
+
+// applyPolicies evaluates the policies against an index, prints the
+// triggered ones, records them in the event log and runs their actions.
+// Alerts that already fired are left out. A failing action only prints a
+// warning. It returns the number of triggered policies.
+func applyPolicies(index *models.Index, dryRun bool) (int, error) {
+	if len(cfg.Policies) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	triggers, err := policy.Evaluate(db, cfg.Policies, index, now)
+	if err != nil {
+		return 0, err
+	}
+	if !dryRun {
+		// An alert fires once until the index no longer meets its policy
+		if triggers, err = policy.Unfired(db, cfg.Policies, index, triggers, now); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, t := range triggers {
+		fmt.Printf("⚠ Policy %s\n", t.Summary())
+		if dryRun {
+			continue
+		}
+		bus.Publish(models.EventPolicyTriggered, index.ID, index.RootPath, t.Summary())
+		if err := t.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return len(triggers), nil
+}
+
+// applyPoliciesAfterScan runs applyPolicies once a scan succeeded. Failing
+// to evaluate the policies does not fail the scan.
+func applyPoliciesAfterScan(index *models.Index) {
+	if _, err := applyPolicies(index, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+func init() {
+	policyCheckCmd.Flags().Bool("dry-run", false, "Only list the triggered policies, without recording or running their actions")
+
+	policyCmd.AddCommand(policyListCmd)
+	policyCmd.AddCommand(policyCheckCmd)
+	rootCmd.AddCommand(policyCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/output"
+)
+
+var recentCmd = &cobra.Command{
+	Use:   "recent",
+	Short: "List files added to the catalog recently",
+	Long: `List the files first seen by a scan in the last days, across all indexes.
+This answers "what landed on my drives this week", regardless of the files'
+own modification dates. Note that every file of a newly indexed drive counts
+as recently seen.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		days, _ := cmd.Flags().GetInt("days")
+		indexIDs, _ := cmd.Flags().GetStringArray("index")
+		formatter := getFormatter(cmd)
+
+		if days <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --days must be positive\n")
+			exit(1)
+		}
+
+		since := time.Now().AddDate(0, 0, -days)
+		results, err := db.FindFiles(database.FindOptions{
+			FirstSeenSince: &since,
+			IndexIDs:       indexIDs,
+			FileType:       "file",
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding recent files: %v\n", err)
+			exit(1)
+		}
+
+		if len(results) == 0 {
+			fmt.Printf("No files added in the last %d days.\n", days)
+			return
+		}
+
+		err = formatter.Files(os.Stdout, output.FileList{
+			Title: fmt.Sprintf("%d files first seen in the last %d days", len(results), days),
+			Files: results,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	recentCmd.Flags().Int("days", 7, "Number of days to look back")
+	recentCmd.Flags().StringArrayP("index", "i", []string{}, "Limit to specific index(es) (can specify multiple)")
+	addFormatFlag(recentCmd)
+
+	rootCmd.AddCommand(recentCmd)
+}
@@ -16,8 +16,9 @@ This does not delete the actual files on disk, only removes the index tracking.
 
 You can specify indexes by:
   - Full index ID
-  - Partial ID (at least 8 characters, e.g., 'f0bd0c0e')
+  - Unambiguous ID prefix (at least 4 characters, e.g., 'f0bd')
   - Exact index name
+  - Path to the root of the index, or a directory inside it
 
 You can remove multiple indexes at once by providing multiple names/IDs.
 
@@ -38,23 +39,25 @@ To find indexes, use 'stormindexer list'.`,
 		for _, identifier := range identifiers {
 			index, err := db.FindIndexByNameOrID(identifier)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: Index not found: %s\n", identifier)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				fmt.Fprintf(os.Stderr, "You can use:\n")
 				fmt.Fprintf(os.Stderr, "  - Full index ID\n")
-				fmt.Fprintf(os.Stderr, "  - Partial ID (at least 8 characters, e.g., 'f0bd0c0e')\n")
+				fmt.Fprintf(os.Stderr, "  - Unambiguous ID prefix (at least 4 characters, e.g., 'f0bd')\n")
 				fmt.Fprintf(os.Stderr, "  - Exact index name\n")
+				fmt.Fprintf(os.Stderr, "  - Path to the root of the index, or a directory inside it\n")
 				fmt.Fprintf(os.Stderr, "\nUse 'stormindexer list' to see available indexes.\n")
-				os.Exit(1)
+				exit(1)
 			}
 			indexesToRemove = append(indexesToRemove, indexInfo{index: index, identifier: identifier})
 			totalFiles += index.TotalFiles
 		}
 
 		// Show what will be removed
+		short := shortIDs()
 		if len(indexesToRemove) == 1 {
 			idx := indexesToRemove[0].index
 			fmt.Printf("Index to remove:\n")
-			fmt.Printf("  ID:   %s\n", idx.ID[:12])
+			fmt.Printf("  ID:   %s\n", short[idx.ID])
 			fmt.Printf("  Name: %s\n", idx.Name)
 			fmt.Printf("  Path: %s\n", idx.RootPath)
 			fmt.Printf("  Files: %d\n", idx.TotalFiles)
@@ -64,7 +67,7 @@ To find indexes, use 'stormindexer list'.`,
 			for i, info := range indexesToRemove {
 				idx := info.index
 				fmt.Printf("\n  %d. %s\n", i+1, idx.Name)
-				fmt.Printf("     ID:   %s\n", idx.ID[:12])
+				fmt.Printf("     ID:   %s\n", short[idx.ID])
 				fmt.Printf("     Path: %s\n", idx.RootPath)
 				fmt.Printf("     Files: %d\n", idx.TotalFiles)
 			}
@@ -83,7 +86,7 @@ To find indexes, use 'stormindexer list'.`,
 					fmt.Printf("  %s\n", identifiers[i])
 				}
 			}
-			os.Exit(0)
+			exit(0)
 		}
 
 		// Remove all indexes
@@ -108,7 +111,7 @@ To find indexes, use 'stormindexer list'.`,
 		}
 
 		if len(errors) > 0 {
-			os.Exit(1)
+			exit(1)
 		}
 	},
 }
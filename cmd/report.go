@@ -0,0 +1,483 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/hooks"
+	"github.com/victor/stormindexer/internal/report"
+	"github.com/victor/stormindexer/pkg/filter"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Reports computed from the catalog",
+	Long: `Reports that analyze indexed files without touching the drives.
+
+With --exclude-noise the reports leave out OS metadata, caches and package
+manager stores; report noise shows how much of each index they take.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		excludeNoise(cmd)
+	},
+}
+
+var noiseCmd = &cobra.Command{
+	Use:   "noise [index-id|name]...",
+	Short: "Show how much of each index is OS metadata, caches and package stores",
+	Long: `Sum the files of each index (all indexes when none are given) that the
+noise rules classify as OS metadata (os), caches (cache), package manager
+stores (packages) or match the noise setting (custom).
+
+The rules match names or consecutive directories anywhere in an index, e.g.
+node_modules, Library/Caches or Thumbs.db, case insensitively. Add your own
+in the configuration file, or turn the built-in ones off:
+
+  noise: ["*.bak", "/scratch"]   # a leading / anchors at the index root
+  noise_builtin: true
+
+stat, show and reports leave noise out with --exclude-noise, or always with
+exclude_noise: true.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		classifier := noiseClassifier()
+		db.ExcludeNoise(nil)
+
+		for _, index := range resolveIndexes(args) {
+			usages, err := report.FindNoise(db, index.ID, classifier)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error classifying %s: %v\n", index.Name, err)
+				exit(1)
+			}
+
+			fmt.Printf("\n=== %s (%s) ===\n", index.Name, index.RootPath)
+			if len(usages) == 0 {
+				fmt.Printf("✓ No noise\n")
+				continue
+			}
+			var files, size int64
+			for _, usage := range usages {
+				fmt.Printf("  %-10s %8d files  %10s\n", usage.Category, usage.Files, humanize.Bytes(usage.Size))
+				files += usage.Files
+				size += usage.Size
+			}
+			fmt.Printf("Noise: %d files, %s (%.1f%% of %s)\n",
+				files, humanize.Bytes(size), percentOf(size, index.TotalSize), humanize.Bytes(index.TotalSize))
+		}
+	},
+}
+
+var similarityCmd = &cobra.Command{
+	Use:   "similarity [index[:dir]] [index[:dir]]",
+	Short: "Compare the content of two directories",
+	Long: `Compare two directories, possibly on different indexes, by checksum and
+show how much of each one's content also exists in the other. A coverage of
+100% means the first directory is fully superseded by the second, e.g. an old
+backup folder that a newer one already contains.
+
+  stormindexer report similarity "Old Backup:Photos" "Photos Drive"`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		a, err := loadDirRef(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		b, err := loadDirRef(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		s := report.CompareDirs(a, b)
+
+		fmt.Printf("\n=== Directory Similarity ===\n")
+		fmt.Printf("A: %s [%s] — %d files, %s\n", a.Path(), a.Index.Name, a.TotalFiles, humanize.Bytes(a.TotalSize))
+		fmt.Printf("B: %s [%s] — %d files, %s\n", b.Path(), b.Index.Name, b.TotalFiles, humanize.Bytes(b.TotalSize))
+		fmt.Printf("\nSimilarity:      %.1f%%\n", s.Score())
+		fmt.Printf("A covered by B:  %.1f%% (%d files, %s)\n", s.CoverageA(), s.SharedFiles, humanize.Bytes(s.SharedBytes))
+		fmt.Printf("B covered by A:  %.1f%%\n", s.CoverageB())
+		fmt.Printf("Only in A:       %d files\n", len(s.OnlyInA))
+		fmt.Printf("Only in B:       %d files\n", s.OnlyInBFiles)
+		if s.Unhashed > 0 {
+			fmt.Printf("Not compared:    %d files without checksum (index with --checksum)\n", s.Unhashed)
+		}
+
+		if len(s.OnlyInA) == 0 && s.Unhashed == 0 && a.TotalFiles > 0 {
+			fmt.Printf("\n✓ Everything in A also exists in B\n")
+		} else if len(s.OnlyInA) > 0 {
+			fmt.Printf("\nFiles only in A:\n")
+			for _, file := range s.OnlyInA[:min(10, len(s.OnlyInA))] {
+				fmt.Printf("  - %s (%s)\n", file.RelativePath, humanize.Bytes(file.Size))
+			}
+			if len(s.OnlyInA) > 10 {
+				fmt.Printf("  ... and %d more\n", len(s.OnlyInA)-10)
+			}
+		}
+	},
+}
+
+var junkCmd = &cobra.Command{
+	Use:   "junk [index-id|name]...",
+	Short: "List empty directories, zero-byte files and junk files",
+	Long: `List empty directories, zero-byte files and known junk files (Thumbs.db,
+ehthumbs.db, desktop.ini) per index (all indexes when none are given).
+Hidden files such as .DS_Store are not indexed, so they are not listed, and a
+directory holding only hidden files counts as empty but is kept by --clean.
+Junk files are noise too, so this report ignores --exclude-noise.
+
+With --clean --force the junk files and empty directories are deleted from
+the drive and the index. Zero-byte files are only deleted with --empty-files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clean, _ := cmd.Flags().GetBool("clean")
+		force, _ := cmd.Flags().GetBool("force")
+		emptyFiles, _ := cmd.Flags().GetBool("empty-files")
+		// Thumbs.db and desktop.ini are noise, which would hide every junk file
+		db.ExcludeNoise(nil)
+
+		for _, index := range resolveIndexes(args) {
+			root, err := report.LoadTree(db, index.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", index.Name, err)
+				exit(1)
+			}
+			junk := report.FindJunk(root)
+
+			fmt.Printf("\n=== %s (%s) ===\n", index.Name, index.RootPath)
+			fmt.Printf("Empty directories: %d\n", len(junk.EmptyDirs))
+			fmt.Printf("Zero-byte files:   %d\n", len(junk.EmptyFiles))
+			fmt.Printf("Junk files:        %d (%s)\n", len(junk.JunkFiles), humanize.Bytes(junk.JunkBytes))
+
+			for _, dir := range junk.EmptyDirs[:min(10, len(junk.EmptyDirs))] {
+				fmt.Printf("  d %s/\n", dir.RelativePath)
+			}
+			if len(junk.EmptyDirs) > 10 {
+				fmt.Printf("  ... and %d more empty directories\n", len(junk.EmptyDirs)-10)
+			}
+			for _, file := range junk.EmptyFiles[:min(10, len(junk.EmptyFiles))] {
+				fmt.Printf("  0 %s\n", file.RelativePath)
+			}
+			if len(junk.EmptyFiles) > 10 {
+				fmt.Printf("  ... and %d more zero-byte files\n", len(junk.EmptyFiles)-10)
+			}
+			for _, file := range junk.JunkFiles[:min(10, len(junk.JunkFiles))] {
+				fmt.Printf("  j %s\n", file.RelativePath)
+			}
+			if len(junk.JunkFiles) > 10 {
+				fmt.Printf("  ... and %d more junk files\n", len(junk.JunkFiles)-10)
+			}
+
+			if !clean {
+				continue
+			}
+			if !force {
+				fmt.Printf("\n⚠️  Re-run with --force to delete these entries from the drive and the index.\n")
+				continue
+			}
+			removed, errs := junk.Clean(db, emptyFiles)
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			fmt.Printf("\n✓ Removed %d entries\n", removed)
+		}
+	},
+}
+
+var brokenLinksCmd = &cobra.Command{
+	Use:   "broken-links [index-id|name]...",
+	Short: "List symlinks whose targets do not exist",
+	Long: `List the symlinks of each index (all indexes when none are given) whose
+target is not part of the index. Links pointing outside the index can only be
+checked on the drive itself with --verify, which resolves every link on disk.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		verify, _ := cmd.Flags().GetBool("verify")
+
+		for _, index := range resolveIndexes(args) {
+			root, err := report.LoadTree(db, index.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", index.Name, err)
+				exit(1)
+			}
+
+			onDisk := verify
+			if verify && !hooks.IsOnline(index) {
+				fmt.Fprintf(os.Stderr, "Warning: %s (%s) is offline, checking the catalog only\n", index.Name, index.RootPath)
+				onDisk = false
+			}
+			links := report.BrokenLinks(root, onDisk)
+
+			fmt.Printf("\n=== %s (%s) ===\n", index.Name, index.RootPath)
+			fmt.Printf("Symlinks: %d, broken: %d\n", links.Links, len(links.Broken))
+			for _, link := range links.Broken {
+				fmt.Printf("  ✗ %s -> %s (%s)\n", link.File.RelativePath, link.File.LinkTarget, link.Reason)
+			}
+			if links.Unverified > 0 {
+				fmt.Printf("%d links point outside the index; use --verify to check them on disk\n", links.Unverified)
+			}
+		}
+	},
+}
+
+var coldCmd = &cobra.Command{
+	Use:   "cold [index-id|name]...",
+	Short: "Summarize data not modified for a long time",
+	Long: `Show how much data per index (all indexes when none are given) has not been
+modified since --older-than, by top-level directory, together with the age
+distribution of all files. Useful to decide what to move to archive drives.
+
+  stormindexer report cold --older-than 3y`,
+	Run: func(cmd *cobra.Command, args []string) {
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		before, err := filter.ParseAge(olderThan, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing --older-than: %v\n", err)
+			exit(1)
+		}
+
+		for _, index := range resolveIndexes(args) {
+			dirs, err := db.ColdDirs(index.ID, before)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error computing cold data: %v\n", err)
+				exit(1)
+			}
+			buckets, err := db.AgeDistribution(index.ID, time.Now(), []int{1, 2, 5, 10})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error computing age distribution: %v\n", err)
+				exit(1)
+			}
+
+			// Counted rather than read from the index, which includes noise
+			_, totalSize, err := db.CountFiles(index.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error counting files: %v\n", err)
+				exit(1)
+			}
+
+			var coldFiles, coldSize int64
+			for _, dir := range dirs {
+				coldFiles += dir.Files
+				coldSize += dir.Size
+			}
+
+			fmt.Printf("\n=== %s (%s) ===\n", index.Name, index.RootPath)
+			fmt.Printf("Not modified since %s: %d files, %s (%.1f%% of %s)\n",
+				before.Format("2006-01-02"), coldFiles, humanize.Bytes(coldSize),
+				percentOf(coldSize, totalSize), humanize.Bytes(totalSize))
+
+			fmt.Printf("\nAge distribution:\n")
+			for _, bucket := range buckets {
+				fmt.Printf("  %-7s %8d files  %10s\n", bucket.Label, bucket.Files, humanize.Bytes(bucket.Size))
+			}
+
+			if len(dirs) > 0 {
+				fmt.Printf("\nCold data by directory:\n")
+				for _, dir := range dirs[:min(20, len(dirs))] {
+					name := dir.Dir + "/"
+					if dir.Dir == "" {
+						name = "(root files)"
+					}
+					fmt.Printf("  %10s  %8d files  %s\n", humanize.Bytes(dir.Size), dir.Files, name)
+				}
+				if len(dirs) > 20 {
+					fmt.Printf("  ... and %d more directories\n", len(dirs)-20)
+				}
+			}
+		}
+	},
+}
+
+var scanErrorsCmd = &cobra.Command{
+	Use:   "scan-errors [index-id|name]...",
+	Short: "List paths the last scan could not read",
+	Long: `List the files and directories the last index or reindex of each index
+(all indexes when none are given) could not read, with the error and the
+number of attempts. Transient IO errors such as EIO or timeouts are retried
+with backoff first (see the retries and retry_delay settings); what remains
+here failed every attempt or was not worth retrying, e.g. permission denied.
+
+Files that could not be stat'ed or whose directory could not be listed keep
+their previous index entries instead of being removed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, index := range resolveIndexes(args) {
+			scanErrors, err := db.ListScanErrors(index.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing scan errors: %v\n", err)
+				exit(1)
+			}
+
+			fmt.Printf("\n=== %s (%s) ===\n", index.Name, index.RootPath)
+			if len(scanErrors) == 0 {
+				fmt.Printf("✓ No errors in the last scan\n")
+				continue
+			}
+			fmt.Printf("%d paths could not be read:\n", len(scanErrors))
+			for _, e := range scanErrors {
+				fmt.Printf("  ✗ %s: %s failed after %d attempt(s): %s\n", e.Path, e.Op, e.Attempts, e.Error)
+			}
+		}
+	},
+}
+
+var overlapCmd = &cobra.Command{
+	Use:   "overlap",
+	Short: "Find indexes that nest or hold the same content",
+	Long: `Find indexes whose roots nest, e.g. / and /home/me/photos indexed
+separately, and indexes whose content overlaps by checksum by at least
+--min-percent of either side. Catalog totals count such content once per
+index; the report shows how many bytes are counted twice and suggests how to
+consolidate the indexes.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		minPercent, _ := cmd.Flags().GetFloat64("min-percent")
+
+		r, err := report.FindOverlaps(db, minPercent)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("\n=== Index Overlap ===\n")
+		fmt.Printf("Catalog size:    %s\n", humanize.Bytes(r.TotalSize))
+		fmt.Printf("Double-counted:  %s (%.1f%%) is content already counted in another index\n",
+			humanize.Bytes(r.DoubleCounted), percentOf(r.DoubleCounted, r.TotalSize))
+
+		if len(r.Overlaps) == 0 {
+			fmt.Printf("\n✓ No nested or overlapping indexes\n")
+			return
+		}
+		for _, o := range r.Overlaps {
+			if o.Nested {
+				fmt.Printf("\n%s (%s) contains %s (%s)\n", o.A.Name, o.A.RootPath, o.B.Name, o.B.RootPath)
+				if o.Skipped {
+					fmt.Printf("  ✓ Scans of %s skip it\n", o.A.Name)
+				}
+			} else {
+				fmt.Printf("\n%s and %s share content\n", o.A.Name, o.B.Name)
+			}
+			if o.Content != nil {
+				fmt.Printf("  Shared:  %d files, %s\n", o.Content.SharedFiles, humanize.Bytes(o.Content.SharedBytes))
+				fmt.Printf("  %.1f%% of %s is in %s, %.1f%% of %s is in %s\n",
+					o.CoverageA(), o.A.Name, o.B.Name, o.CoverageB(), o.B.Name, o.A.Name)
+			}
+			if suggestion := o.Suggestion(); suggestion != "" {
+				fmt.Printf("  → %s\n", suggestion)
+			}
+		}
+	},
+}
+
+var hotspotsCmd = &cobra.Command{
+	Use:   "hotspots [index-id|name]...",
+	Short: "Rank directories by duplicated content",
+	Long: `Rank the directories of each index (all indexes when none are given) by
+how much of their content is also stored elsewhere in the catalog, so cleanup
+starts where it frees the most space. Copies are matched by checksum across
+every index, so hash the drives first (index -c).
+
+RECLAIMABLE is what deleting the duplicates of a directory would free while
+keeping at least one copy of each file somewhere in the catalog; DUPLICATED
+counts every file of the directory that has a copy. A copy shared by two
+directories shows in both, so the lines do not add up.
+
+Files are counted in the directory holding them; --depth 2 counts them in
+their directory cut to two levels instead, summing trees of small folders.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		depth, _ := cmd.Flags().GetInt("depth")
+		limit, _ := cmd.Flags().GetInt("limit")
+		if depth < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --depth must not be negative\n")
+			exit(1)
+		}
+
+		hotspots, err := report.FindHotspots(db, resolveIndexes(args), depth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("\n=== Duplicate Hotspots ===\n")
+		if len(hotspots) == 0 {
+			fmt.Printf("✓ No duplicated content\n")
+			return
+		}
+		fmt.Printf("Directories holding duplicated content: %d\n\n", len(hotspots))
+
+		shown := hotspots
+		if limit > 0 && len(shown) > limit {
+			shown = shown[:limit]
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "RECLAIMABLE\tDUPLICATED\tFILES\tDIRECTORY\n")
+		for _, h := range shown {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", humanize.Bytes(h.Reclaimable), humanize.Bytes(h.DuplicateBytes), h.DuplicateFiles, h.Ref())
+		}
+		w.Flush()
+		if len(hotspots) > len(shown) {
+			fmt.Printf("... and %d more directories\n", len(hotspots)-len(shown))
+		}
+		fmt.Printf("\nCompare two of them with 'report similarity <index:dir> <index:dir>'.\n")
+	},
+}
+
+// percentOf returns part as a percentage of total
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+// loadDirRef resolves "index" or "index:relative/dir" to a directory tree
+func loadDirRef(ref string) (*report.Dir, error) {
+	identifier, rel := ref, ""
+	// Split first: "index:dir/sub" also reads as a path, which would
+	// resolve to whichever index contains the working directory
+	if i := strings.Index(ref, ":"); i > 0 {
+		if _, err := db.FindIndexByNameOrID(ref[:i]); err == nil {
+			identifier, rel = ref[:i], ref[i+1:]
+		}
+	}
+
+	index, err := db.FindIndexByNameOrID(identifier)
+	if err != nil {
+		return nil, err
+	}
+	root, err := report.LoadTree(db, index.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", index.Name, err)
+	}
+	dir := root.Find(rel)
+	if dir == nil {
+		return nil, fmt.Errorf("directory %s not found in %s", rel, index.Name)
+	}
+	return dir, nil
+}
+
+func init() {
+	junkCmd.Flags().Bool("clean", false, "Delete junk files and empty directories, except pinned ones")
+	junkCmd.Flags().Bool("force", false, "Confirm --clean")
+	junkCmd.Flags().Bool("empty-files", false, "Also delete zero-byte files with --clean")
+
+	brokenLinksCmd.Flags().Bool("verify", false, "Also resolve every link on the drive")
+
+	coldCmd.Flags().String("older-than", "3y", "Age of cold data: e.g. 3y, 18m, 6w, 90d or a date")
+
+	overlapCmd.Flags().Float64("min-percent", 50, "Report indexes sharing at least this percentage of either one's content")
+	hotspotsCmd.Flags().Int("depth", 0, "Count files in their directory cut to this many levels (0: the directory holding them)")
+	hotspotsCmd.Flags().Int("limit", 20, "Show at most this many directories (0: all)")
+
+	addNoiseFlag(reportCmd.PersistentFlags())
+
+	reportCmd.AddCommand(similarityCmd)
+	reportCmd.AddCommand(junkCmd)
+	reportCmd.AddCommand(brokenLinksCmd)
+	reportCmd.AddCommand(coldCmd)
+	reportCmd.AddCommand(scanErrorsCmd)
+	reportCmd.AddCommand(overlapCmd)
+	reportCmd.AddCommand(hotspotsCmd)
+	reportCmd.AddCommand(noiseCmd)
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/jobs"
+	"github.com/victor/stormindexer/internal/restore"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [index-id|name]",
+	Short: "Restore part of an index from the best available copies",
+	Long: `Copy the files of an index below --under into --to. Each file is read from
+its indexed location when that drive is online, otherwise from any other
+online drive holding a copy with the same checksum. Copies are verified
+against the indexed checksum, and files without a usable copy are reported.
+Files already present in --to are kept and reported unless --force is given.
+When the drive of the index is offline, the mount_hook runs first.
+Exits with status 1 when any file was not restored.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		under, _ := cmd.Flags().GetString("under")
+		dest, _ := cmd.Flags().GetString("to")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+
+		index, err := db.FindIndexByNameOrID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		restorer := restore.NewRestorer(db)
+		restorer.DryRun = dryRun
+		restorer.Force = force
+
+		// Copies on other drives may do, so an offline index is not an error
+		if cfg.MountHook != "" && !dryRun {
+			if err := ensureMounted(index); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+
+		var job *jobs.Tracker
+		if !dryRun {
+			job = startJob("restore", index, dest)
+			restorer.Context = jobContext(job)
+		}
+		result, err := restorer.Restore(index.ID, under, dest)
+		finishJob(job, err)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error restoring: %v\n", err)
+			exit(1)
+		}
+
+		verb := "Restored"
+		if dryRun {
+			verb = "Would restore"
+		}
+		fmt.Printf("✓ %s %d files (%s) to %s\n", verb, len(result.Restored), humanize.Bytes(result.Bytes), dest)
+
+		borrowed := 0
+		for _, r := range result.Restored {
+			if r.Source != r.File.DiskPath() {
+				borrowed++
+			}
+		}
+		if borrowed > 0 {
+			fmt.Printf("  %d taken from copies on other locations\n", borrowed)
+		}
+
+		if len(result.Existing) > 0 {
+			fmt.Printf("\n✗ %d files already exist in %s (use --force to overwrite them):\n", len(result.Existing), dest)
+			for _, file := range result.Existing[:min(10, len(result.Existing))] {
+				fmt.Printf("  ! %s\n", file.RelativePath)
+			}
+			if len(result.Existing) > 10 {
+				fmt.Printf("  ... and %d more\n", len(result.Existing)-10)
+			}
+		}
+		if len(result.Missing) > 0 {
+			fmt.Printf("\n✗ %d files could not be restored:\n", len(result.Missing))
+			for _, m := range result.Missing {
+				fmt.Printf("  ! %s (%s)\n", m.File.RelativePath, m.Reason)
+			}
+		}
+		if len(result.Existing) > 0 || len(result.Missing) > 0 {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	restoreCmd.Flags().String("under", "", "Only restore files below this directory of the index")
+	restoreCmd.Flags().String("to", "", "Destination directory")
+	restoreCmd.Flags().Bool("dry-run", false, "Show which copies would be used without copying")
+	restoreCmd.Flags().Bool("force", false, "Overwrite files already present in the destination")
+	restoreCmd.MarkFlagRequired("to")
+
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -5,12 +5,19 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/victor/stormindexer/internal/config"
 	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/events"
+	"github.com/victor/stormindexer/internal/output"
+	"github.com/victor/stormindexer/internal/perf"
+	"github.com/victor/stormindexer/pkg/humanize"
 )
 
 var cfg *config.Config
 var db *database.DB
+var recorder *perf.Recorder
+var bus *events.Bus
 
 var rootCmd = &cobra.Command{
 	Use:   "stormindexer",
@@ -22,6 +29,9 @@ and enables synchronization between different locations.`,
 
 func init() {
 	cobra.OnInitialize(initConfig, initDB)
+
+	rootCmd.PersistentFlags().StringArray("attach", []string{}, "Attach another catalog database read-only for this command (can specify multiple)")
+	rootCmd.PersistentFlags().String("perf-log", "", "Append the command duration and slowest SQL statements to this file")
 }
 
 func initConfig() {
@@ -31,6 +41,15 @@ func initConfig() {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	humanize.Default = humanize.ForLocale(cfg.Locale)
+	output.IDLength = cfg.IDLength
+
+	if perfLog, _ := rootCmd.PersistentFlags().GetString("perf-log"); perfLog != "" {
+		cfg.PerfLog = perfLog
+	}
+	if cfg.PerfLog != "" {
+		recorder = perf.New()
+	}
 }
 
 func initDB() {
@@ -38,17 +57,54 @@ func initDB() {
 	db, err = database.NewDB(cfg.DatabasePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+	db.SetRecorder(recorder)
+	db.SetLocale(cfg.Locale)
+	bus = events.New(db)
+
+	attachPaths, _ := rootCmd.PersistentFlags().GetStringArray("attach")
+	for _, path := range attachPaths {
+		if err := db.Attach(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error attaching catalog: %v\n", err)
+			exit(1)
+		}
 	}
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	command, err := rootCmd.ExecuteC()
+	writePerfLog(command, err != nil)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// exit ends the process with code. Commands exit through it rather than
+// os.Exit, which would skip the performance log of a failed command.
+func exit(code int) {
+	if command, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		writePerfLog(command, code != 0)
+	}
+	os.Exit(code)
+}
+
+// writePerfLog appends the timing of the command to the performance log.
+// Only the names of the flags used are written, never their values.
+func writePerfLog(command *cobra.Command, failed bool) {
+	if recorder == nil || command == nil {
+		return
+	}
+	var flags []string
+	command.Flags().Visit(func(f *pflag.Flag) {
+		flags = append(flags, f.Name)
+	})
+	if err := perf.Append(cfg.PerfLog, recorder.Entry(command.CommandPath(), flags, failed)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write performance log: %v\n", err)
+	}
+}
+
 func Cleanup() {
 	if db != nil {
 		db.Close()
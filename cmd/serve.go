@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/fileserver"
+	"github.com/victor/stormindexer/internal/hooks"
+)
+
+// serveQueryCache is the number of query results serve keeps in memory,
+// enough for every group of the duplicates page
+const serveQueryCache = 256
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the catalog over HTTP",
+	Long: `Run an HTTP server until interrupted. With --files it serves, read-only,
+the files of the indexes of this machine whose drive is online, so a file
+found in the catalog can be downloaded or streamed from another machine:
+
+  GET /files/<index>/<relative path>
+
+The index is given by ID, ID prefix or name. Only files recorded in the
+catalog are served, never directories or symlinks; range requests are
+supported. Every request must carry the token of the serve_token setting, as
+a bearer token, as the password of basic authentication or in the token
+query parameter. Without a configured token, a new one is printed at start.
+
+  curl -H "Authorization: Bearer $TOKEN" http://127.0.0.1:8765/files/photos/2019/IMG_0001.jpg
+  mpv "http://127.0.0.1:8765/files/videos/holiday.mkv?token=$TOKEN"
+
+With --thumbnails it serves the previews stored by index --thumbnails, and a
+page browsing the duplicates that have one, linking the copies on online
+indexes when --files is given too:
+
+  GET /thumbs/<checksum>
+  GET /duplicates
+
+With --events it streams the event log (see 'events') as server-sent events,
+including those of scans run by other processes. A stream sends new events
+only, or those after the Last-Event-ID header or the after query parameter;
+kind (repeatable) and index narrow it:
+
+  curl -N -H "Authorization: Bearer $TOKEN" "http://127.0.0.1:8765/events?kind=scan.finished"
+
+With --jobs it lists the running and queued jobs as JSON and cancels them,
+like the cancel command, from any machine sharing the database:
+
+  GET  /jobs
+  POST /jobs/<id>/cancel
+
+The server listens on serve_listen, 127.0.0.1:8765 by default. Put it
+behind a TLS reverse proxy before exposing it beyond this machine.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		files, _ := cmd.Flags().GetBool("files")
+		thumbnails, _ := cmd.Flags().GetBool("thumbnails")
+		serveEvents, _ := cmd.Flags().GetBool("events")
+		serveJobs, _ := cmd.Flags().GetBool("jobs")
+		listen, _ := cmd.Flags().GetString("listen")
+		token, _ := cmd.Flags().GetString("token")
+
+		if !files && !thumbnails && !serveEvents && !serveJobs {
+			fmt.Fprintf(os.Stderr, "Error: Nothing to serve; pass --files to serve the files of online indexes, --thumbnails for previews, --events for the event log or --jobs for jobs\n")
+			exit(1)
+		}
+		if listen == "" {
+			listen = cfg.ServeListen
+		}
+		if token == "" {
+			token = cfg.ServeToken
+		}
+		if token == "" {
+			random := make([]byte, 16)
+			if _, err := rand.Read(random); err != nil {
+				fmt.Fprintf(os.Stderr, "Error generating a token: %v\n", err)
+				exit(1)
+			}
+			token = hex.EncodeToString(random)
+			fmt.Printf("Token: %s (set serve_token to keep it across restarts)\n", token)
+		}
+
+		indexes, err := db.ListIndexes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
+			exit(1)
+		}
+		online := 0
+		for _, index := range indexes {
+			if index.MachineID == cfg.MachineID && hooks.IsOnline(index) {
+				online++
+			}
+		}
+
+		// Every load of the duplicates page runs the same queries again
+		db.EnableQueryCache(serveQueryCache)
+		handler := fileserver.New(db, cfg.MachineID, token)
+		if files {
+			handler.ServeFiles()
+		}
+		if thumbnails {
+			handler.ServeThumbnails()
+		}
+		if serveEvents {
+			handler.ServeEvents()
+		}
+		if serveJobs {
+			handler.ServeJobs()
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		server := &http.Server{
+			Addr:              listen,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+			// Event streams end when the server is interrupted
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdown)
+		}()
+
+		if files {
+			fmt.Printf("Serving the files of %d online indexes on http://%s/files/<index>/<path>\n", online, listen)
+		}
+		if thumbnails {
+			fmt.Printf("Browse duplicates on http://%s/duplicates\n", listen)
+		}
+		if serveEvents {
+			fmt.Printf("Streaming events on http://%s/events\n", listen)
+		}
+		if serveJobs {
+			fmt.Printf("Managing jobs on http://%s/jobs\n", listen)
+		}
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().Bool("files", false, "Serve the files of the indexes online on this machine, read-only")
+	serveCmd.Flags().Bool("thumbnails", false, "Serve the stored thumbnails and a page browsing duplicates")
+	serveCmd.Flags().Bool("events", false, "Stream the event log as server-sent events")
+	serveCmd.Flags().Bool("jobs", false, "List running jobs and cancel them over HTTP")
+	serveCmd.Flags().String("listen", "", "Address to listen on (default: the serve_listen setting)")
+	serveCmd.Flags().String("token", "", "Token clients must send (default: the serve_token setting)")
+
+	rootCmd.AddCommand(serveCmd)
+}
@@ -3,34 +3,52 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/smart"
+	"github.com/victor/stormindexer/pkg/humanize"
 )
 
 var showCmd = &cobra.Command{
 	Use:   "show [index-id|name]",
 	Short: "Show detailed information about an index",
-	Long:  `Display detailed information about a specific index including statistics. You can use full ID, partial ID (8+ chars), or exact name.`,
-	Args:  cobra.ExactArgs(1),
+	Long:  `Display detailed information about a specific index including statistics. You can use full ID, an unambiguous ID prefix (4+ chars), exact name, or a path on the drive.
+Without an index, the index containing the current directory is shown.
+With --exclude-noise the statistics leave out OS metadata, caches and package
+manager stores.`,
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			index, err := workingDirIndex()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: no index given and %v\n", err)
+				exit(1)
+			}
+			args = []string{index.ID}
+		}
 		identifier := args[0]
 
 		index, err := db.FindIndexByNameOrID(identifier)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Index not found: %s\n", identifier)
-			fmt.Fprintf(os.Stderr, "You can use full ID, partial ID (8+ chars), or exact name.\n")
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "You can use full ID, an unambiguous ID prefix (4+ chars), exact name, or a path on the drive.\n")
 			fmt.Fprintf(os.Stderr, "Use 'stormindexer list' to see available indexes.\n")
-			os.Exit(1)
+			exit(1)
 		}
 
+		noiseExcluded := excludeNoise(cmd)
 		files, err := db.ListFiles(index.ID)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing files: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		var totalSize int64
 		var fileCount, dirCount int64
+		// Indexes without directory entries count the directories holding files
+		derivedDirs := make(map[string]bool)
 		for _, file := range files {
 			if file.IsDirectory {
 				dirCount++
@@ -38,6 +56,14 @@ var showCmd = &cobra.Command{
 				fileCount++
 				totalSize += file.Size
 			}
+			if index.SkipDirectories {
+				for dir := path.Dir(file.RelativePath); dir != "." && dir != "/" && !derivedDirs[dir]; dir = path.Dir(dir) {
+					derivedDirs[dir] = true
+				}
+			}
+		}
+		if index.SkipDirectories {
+			dirCount = int64(len(derivedDirs))
 		}
 
 		fmt.Printf("Index Details\n")
@@ -46,6 +72,22 @@ var showCmd = &cobra.Command{
 		fmt.Printf("Name:        %s\n", index.Name)
 		fmt.Printf("Root Path:   %s\n", index.RootPath)
 		fmt.Printf("Machine ID:  %s\n", index.MachineID)
+		if index.Location != "" {
+			fmt.Printf("Location:    %s\n", index.Location)
+		}
+		if index.Compact {
+			fmt.Printf("Storage:     compact\n")
+		}
+		if loan, err := db.ActiveLoan(index.ID); err == nil {
+			fmt.Printf("Checked Out: to %s since %s", loan.Borrower, loan.CheckedOutAt.Local().Format("2006-01-02"))
+			if !loan.DueAt.IsZero() {
+				fmt.Printf(", due %s", loan.DueAt.Local().Format("2006-01-02"))
+			}
+			if loan.Overdue(time.Now()) {
+				fmt.Printf(" (OVERDUE)")
+			}
+			fmt.Println()
+		}
 		fmt.Printf("Created:     %s\n", index.CreatedAt.Format("2006-01-02 15:04:05"))
 		if !index.LastSync.IsZero() {
 			fmt.Printf("Last Sync:   %s\n", index.LastSync.Format("2006-01-02 15:04:05"))
@@ -53,12 +95,66 @@ var showCmd = &cobra.Command{
 		fmt.Printf("\nStatistics\n")
 		fmt.Printf("----------\n")
 		fmt.Printf("Total Files:      %d\n", fileCount)
-		fmt.Printf("Total Directories: %d\n", dirCount)
-		fmt.Printf("Total Size:       %s\n", formatBytes(totalSize))
+		if index.SkipDirectories {
+			fmt.Printf("Total Directories: %d (not stored, derived from the file paths)\n", dirCount)
+		} else {
+			fmt.Printf("Total Directories: %d\n", dirCount)
+		}
+		fmt.Printf("Total Size:       %s\n", humanize.Bytes(totalSize))
+		if noiseExcluded {
+			// Index statistics include noise
+			fmt.Printf("Noise Excluded:   %d entries, %s\n",
+				max(index.TotalFiles-int64(len(files)), 0), humanize.Bytes(max(index.TotalSize-totalSize, 0)))
+		}
+
+		coverage, err := db.GetChecksumCoverage(index.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error computing checksum coverage: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("Checksums:        %.1f%% (%d hashed, %d stale, %d never hashed)\n",
+			coverage.Percent(), coverage.Hashed, coverage.Stale, coverage.Missing)
+		if coverage.Stale > 0 {
+			fmt.Printf("                  Run 'stormindexer rehash %s --stale' to refresh stale checksums\n", index.Name)
+		}
+
+		nested, err := db.ListNestedIndexes(index.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing nested indexes: %v\n", err)
+			exit(1)
+		}
+		if len(nested) > 0 {
+			fmt.Printf("\nNested Indexes\n")
+			fmt.Printf("--------------\n")
+			for _, n := range nested {
+				if n.IndexID == index.ID {
+					fmt.Printf("Skipped %s: indexed as %s\n", n.RelativePath, indexName(n.NestedIndexID))
+				} else {
+					fmt.Printf("Inside %s at %s\n", indexName(n.IndexID), n.RelativePath)
+				}
+			}
+		}
+
+		health, reasons, err := smart.Check(db, index.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading drive health: %v\n", err)
+			exit(1)
+		}
+		if health != nil {
+			fmt.Printf("\nDrive Health\n")
+			fmt.Printf("------------\n")
+			fmt.Printf("Status:           %s\n", describeHealth(health))
+			fmt.Printf("Serial:           %s\n", health.Serial)
+			fmt.Printf("Captured:         %s\n", health.CapturedAt.Local().Format("2006-01-02 15:04:05"))
+			for _, reason := range reasons {
+				fmt.Printf("⚠ Degraded:       %s\n", reason)
+			}
+		}
 	},
 }
 
 func init() {
+	addNoiseFlag(showCmd.Flags())
 	rootCmd.AddCommand(showCmd)
 }
 
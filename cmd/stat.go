@@ -7,13 +7,24 @@ import (
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/humanize"
 )
 
 var statCmd = &cobra.Command{
 	Use:   "stat",
 	Short: "Show database statistics and information",
-	Long:  `Display database file location, size, and statistics about indexed data.`,
+	Long: `Display database file location, size, and statistics about indexed data.
+
+The total size sums all indexes, so content stored on several drives counts
+once per copy. The unique content counts every checksum once; files indexed
+without checksums are reported separately, as their uniqueness is unknown.
+
+With --exclude-noise every figure leaves out OS metadata, caches and package
+manager stores (see the noise settings), so it reflects the data you keep.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		noiseExcluded := excludeNoise(cmd)
+
 		// Get database path
 		dbPath := cfg.DatabasePath
 
@@ -21,7 +32,7 @@ var statCmd = &cobra.Command{
 		fileInfo, err := os.Stat(dbPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Could not access database file: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Get absolute path
@@ -34,7 +45,7 @@ var statCmd = &cobra.Command{
 		indexes, err := db.ListIndexes()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Could not list indexes: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		var totalIndexes int64
@@ -46,6 +57,21 @@ var statCmd = &cobra.Command{
 			totalFiles += index.TotalFiles
 			totalSize += index.TotalSize
 		}
+		var noiseFiles, noiseSize int64
+		if noiseExcluded {
+			// Index statistics include noise; count what is left
+			if err := countWithoutNoise(indexes); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Could not count files: %v\n", err)
+				exit(1)
+			}
+			keptFiles, keptSize := int64(0), int64(0)
+			for _, index := range indexes {
+				keptFiles += index.TotalFiles
+				keptSize += index.TotalSize
+			}
+			noiseFiles, noiseSize = totalFiles-keptFiles, totalSize-keptSize
+			totalFiles, totalSize = keptFiles, keptSize
+		}
 
 		// Display statistics
 		fmt.Println("Database Statistics")
@@ -54,12 +80,27 @@ var statCmd = &cobra.Command{
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		fmt.Fprintf(w, "Database Path:\t%s\n", absPath)
-		fmt.Fprintf(w, "Database Size:\t%s\n", formatBytes(fileInfo.Size()))
+		fmt.Fprintf(w, "Database Size:\t%s\n", humanize.Bytes(fileInfo.Size()))
 		fmt.Fprintf(w, "Last Modified:\t%s\n", fileInfo.ModTime().Format("2006-01-02 15:04:05"))
 		fmt.Fprintf(w, "\n")
 		fmt.Fprintf(w, "Total Indexes:\t%d\n", totalIndexes)
 		fmt.Fprintf(w, "Total Files Indexed:\t%d\n", totalFiles)
-		fmt.Fprintf(w, "Total Size Indexed:\t%s\n", formatBytes(totalSize))
+		fmt.Fprintf(w, "Total Size Indexed:\t%s\n", humanize.Bytes(totalSize))
+		if noiseExcluded {
+			fmt.Fprintf(w, "Noise Excluded:\t%s in %d entries\n", humanize.Bytes(noiseSize), noiseFiles)
+		}
+		if content, err := db.GetUniqueContent(); err == nil {
+			fmt.Fprintf(w, "Unique Content:\t%s in %d distinct files (by checksum)\n",
+				humanize.Bytes(content.UniqueBytes), content.UniqueFiles)
+			if content.UnknownFiles > 0 {
+				fmt.Fprintf(w, "Not Hashed:\t%s in %d files, uniqueness unknown\n",
+					humanize.Bytes(content.UnknownBytes), content.UnknownFiles)
+			}
+		}
+		if coverage, err := db.GetChecksumCoverage(""); err == nil {
+			fmt.Fprintf(w, "Checksum Coverage:\t%.1f%% (%d stale, %d never hashed)\n",
+				coverage.Percent(), coverage.Stale, coverage.Missing)
+		}
 		w.Flush()
 
 		// Show per-index breakdown if there are indexes
@@ -70,20 +111,28 @@ var statCmd = &cobra.Command{
 			fmt.Println()
 
 			w2 := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-			fmt.Fprintln(w2, "NAME\tFILES\tSIZE\tLAST SYNC")
-			fmt.Fprintln(w2, "----\t-----\t----\t---------")
+			fmt.Fprintln(w2, "NAME\tFILES\tSIZE\tHASHED\tSTALE\tLAST SYNC")
+			fmt.Fprintln(w2, "----\t-----\t----\t------\t-----\t---------")
 
 			for _, index := range indexes {
-				sizeStr := formatBytes(index.TotalSize)
+				sizeStr := humanize.Bytes(index.TotalSize)
 				lastSync := "Never"
 				if !index.LastSync.IsZero() {
 					lastSync = index.LastSync.Format("2006-01-02 15:04:05")
 				}
 
-				fmt.Fprintf(w2, "%s\t%d\t%s\t%s\n",
+				hashed, stale := "-", "-"
+				if coverage, err := db.GetChecksumCoverage(index.ID); err == nil {
+					hashed = fmt.Sprintf("%.0f%%", coverage.Percent())
+					stale = fmt.Sprintf("%d", coverage.Stale)
+				}
+
+				fmt.Fprintf(w2, "%s\t%d\t%s\t%s\t%s\t%s\n",
 					index.Name,
 					index.TotalFiles,
 					sizeStr,
+					hashed,
+					stale,
 					lastSync,
 				)
 			}
@@ -92,7 +141,21 @@ var statCmd = &cobra.Command{
 	},
 }
 
+// countWithoutNoise replaces the statistics of the indexes by their counts
+// without noise
+func countWithoutNoise(indexes []*models.Index) error {
+	for _, index := range indexes {
+		files, size, err := db.CountFiles(index.ID)
+		if err != nil {
+			return err
+		}
+		index.TotalFiles, index.TotalSize = files, size
+	}
+	return nil
+}
+
 func init() {
+	addNoiseFlag(statCmd.Flags())
 	rootCmd.AddCommand(statCmd)
 }
 
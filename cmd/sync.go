@@ -3,42 +3,102 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/export"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/output"
+	"github.com/victor/stormindexer/internal/report"
 	"github.com/victor/stormindexer/internal/sync"
+	"github.com/victor/stormindexer/pkg/filter"
+	"github.com/victor/stormindexer/pkg/humanize"
 )
 
 var syncCmd = &cobra.Command{
-	Use:   "sync [source-index-id] [target-index-id]",
+	Use:   "sync [source-index-id|name] [target-index-id|name]",
 	Short: "Sync files between indexes",
 	Long: `Compare and sync files between two indexes. Shows differences
-and optionally syncs files from source to target.`,
+and optionally syncs files from source to target.
+
+The comparison uses the catalog, not the drives. When the target was last
+scanned more than --stale-after before the source, sync refuses to run:
+reindex the target first with --rescan-target, or pass --trust-stale.
+
+After copying, the target is reindexed so the catalog holds what actually
+reached the drive; when the target has checksums, the copied files are
+hashed again, which also verifies them. --no-rescan records the source
+entries in the target index instead, which is faster but trusts the copy.
+
+New files whose content the target already holds at another path, as after
+moving folders around on the source, are copied from that path on the
+target drive instead of being transferred from the source; --hardlink links
+them instead when the modification times match, and --no-reuse transfers
+everything from the source. Checksums are needed on both sides.`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		sourceIndexID := args[0]
-		targetIndexID := args[1]
+		sourceIndex := findIndex(args[0], "Source index")
+		targetIndex := findIndex(args[1], "Target index")
+		sourceIndexID := sourceIndex.ID
+		targetIndexID := targetIndex.ID
 
-		// Verify indexes exist
-		sourceIndex, err := db.GetIndex(sourceIndexID)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Source index not found: %s\n", sourceIndexID)
-			os.Exit(1)
-		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		deleteExtra, _ := cmd.Flags().GetBool("delete")
+		trustStale, _ := cmd.Flags().GetBool("trust-stale")
+		rescanTarget, _ := cmd.Flags().GetBool("rescan-target")
+		staleAfter, _ := cmd.Flags().GetString("stale-after")
+		noRescan, _ := cmd.Flags().GetBool("no-rescan")
+		noReuse, _ := cmd.Flags().GetBool("no-reuse")
+		hardlink, _ := cmd.Flags().GetBool("hardlink")
 
-		targetIndex, err := db.GetIndex(targetIndexID)
+		now := time.Now()
+		staleBefore, err := filter.ParseAge(staleAfter, now)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Target index not found: %s\n", targetIndexID)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Error: Invalid --stale-after: %v\n", err)
+			exit(1)
 		}
 
-		dryRun, _ := cmd.Flags().GetBool("dry-run")
-		deleteExtra, _ := cmd.Flags().GetBool("delete")
-
 		syncer := sync.NewSyncer(db)
+		syncer.SetReuseTarget(!noReuse)
+		syncer.SetHardlink(hardlink)
+		if rescanTarget {
+			if cfg.MountHook != "" {
+				if err := ensureMounted(targetIndex); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					exit(1)
+				}
+			}
+			if err := rescanIndex(targetIndex); err != nil {
+				fmt.Fprintf(os.Stderr, "Error rescanning target: %v\n", err)
+				exit(1)
+			}
+		} else {
+			staleness, err := syncer.CheckStaleness(sourceIndex, targetIndex)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			if staleness.Stale(now.Sub(staleBefore)) {
+				if staleness.TargetScan.IsZero() {
+					fmt.Fprintf(os.Stderr, "⚠ Target %s has never been scanned completely.\n", targetIndex.Name)
+				} else {
+					fmt.Fprintf(os.Stderr, "⚠ Target %s was last scanned %s, %s before source %s.\n",
+						targetIndex.Name, staleness.TargetScan.Local().Format("2006-01-02 15:04"),
+						formatDays(staleness.Lag()), sourceIndex.Name)
+				}
+				fmt.Fprintf(os.Stderr, "  Files added or removed on the target since then are not taken into account.\n")
+				if !dryRun && !trustStale {
+					fmt.Fprintf(os.Stderr, "Error: Target index is stale. Use --rescan-target to reindex it first, or --trust-stale to sync anyway\n")
+					exit(1)
+				}
+			}
+		}
+
 		result, err := syncer.CompareIndexes(sourceIndexID, targetIndexID)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error comparing indexes: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Printf("\n=== Sync Comparison ===\n")
@@ -48,11 +108,15 @@ and optionally syncs files from source to target.`,
 		fmt.Printf("Updated files: %d\n", len(result.UpdatedFiles))
 		fmt.Printf("Deleted files: %d\n", len(result.DeletedFiles))
 		fmt.Printf("Duplicate files: %d\n", len(result.DuplicateFiles))
+		fmt.Printf("Conflicts: %d\n", len(result.Conflicts))
+		if files, size := result.Reusable(); len(files) > 0 && !noReuse {
+			fmt.Printf("Reuse candidates: %d new files (%s) already on the target, reused if their copies are unchanged\n", len(files), humanize.Bytes(size))
+		}
 
 		if len(result.NewFiles) > 0 {
 			fmt.Printf("\nNew files:\n")
 			for _, file := range result.NewFiles[:min(10, len(result.NewFiles))] {
-				fmt.Printf("  + %s (%s)\n", file.RelativePath, formatBytes(file.Size))
+				fmt.Printf("  + %s (%s)\n", file.RelativePath, humanize.Bytes(file.Size))
 			}
 			if len(result.NewFiles) > 10 {
 				fmt.Printf("  ... and %d more\n", len(result.NewFiles)-10)
@@ -69,10 +133,24 @@ and optionally syncs files from source to target.`,
 			}
 		}
 
+		if len(result.Conflicts) > 0 {
+			fmt.Printf("\nConflicts (changed on the target, will not be overwritten):\n")
+			for _, c := range result.Conflicts[:min(10, len(result.Conflicts))] {
+				fmt.Printf("  ! %s\n", c.RelativePath)
+			}
+			if len(result.Conflicts) > 10 {
+				fmt.Printf("  ... and %d more\n", len(result.Conflicts)-10)
+			}
+		}
+
 		if len(result.DeletedFiles) > 0 {
 			fmt.Printf("\nDeleted files:\n")
 			for _, file := range result.DeletedFiles[:min(10, len(result.DeletedFiles))] {
-				fmt.Printf("  - %s\n", file.RelativePath)
+				if result.Pins.Covering(file.RelativePath) != nil {
+					fmt.Printf("  - %s (pinned, kept)\n", file.RelativePath)
+				} else {
+					fmt.Printf("  - %s\n", file.RelativePath)
+				}
 			}
 			if len(result.DeletedFiles) > 10 {
 				fmt.Printf("  ... and %d more\n", len(result.DeletedFiles)-10)
@@ -80,10 +158,34 @@ and optionally syncs files from source to target.`,
 		}
 
 		if !dryRun {
+			if cfg.MountHook != "" {
+				for _, index := range []*models.Index{sourceIndex, targetIndex} {
+					if err := ensureMounted(index); err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						exit(1)
+					}
+				}
+			}
+
 			// Perform actual sync using rsync
-			if err := syncer.SyncToIndex(sourceIndexID, targetIndexID, targetIndex.RootPath, false, deleteExtra); err != nil {
+			job := startJob("sync", targetIndex, fmt.Sprintf("%s -> %s", sourceIndex.Name, targetIndex.Name))
+			syncer.SetContext(jobContext(job))
+			syncer.SetRecordEntries(noRescan)
+			err := syncer.SyncToIndex(sourceIndexID, targetIndexID, targetIndex.RootPath, false, deleteExtra)
+			finishJob(job, err)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error syncing: %v\n", err)
-				os.Exit(1)
+				exit(1)
+			}
+
+			// Record what actually reached the drive, not what should have
+			if !noRescan {
+				fmt.Printf("\nReindexing target %s...\n", targetIndex.Name)
+				if err := rescanIndex(targetIndex); err != nil {
+					fmt.Fprintf(os.Stderr, "Error reindexing target: %v\n", err)
+					fmt.Fprintf(os.Stderr, "The files were synced; run 'reindex %s' to update the catalog\n", targetIndex.ID)
+					exit(1)
+				}
 			}
 		} else {
 			fmt.Printf("\n[DRY RUN] No changes made. Remove --dry-run to sync.\n")
@@ -92,19 +194,19 @@ and optionally syncs files from source to target.`,
 }
 
 var compareCmd = &cobra.Command{
-	Use:   "compare [index-id-1] [index-id-2]",
+	Use:   "compare [index-id|name] [index-id|name]",
 	Short: "Compare two indexes",
 	Long:  `Compare two indexes and show differences without syncing.`,
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		indexID1 := args[0]
-		indexID2 := args[1]
+		index1 := findIndex(args[0], "Index 1")
+		index2 := findIndex(args[1], "Index 2")
 
 		syncer := sync.NewSyncer(db)
-		result, err := syncer.CompareIndexes(indexID1, indexID2)
+		result, err := syncer.CompareIndexes(index1.ID, index2.ID)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error comparing indexes: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Printf("\n=== Comparison Results ===\n")
@@ -117,42 +219,99 @@ var compareCmd = &cobra.Command{
 var duplicatesCmd = &cobra.Command{
 	Use:   "duplicates",
 	Short: "Find duplicate files across all indexes",
-	Long:  `Find files with identical checksums across all indexed locations.`,
+	Long: `Find files with identical checksums across all indexed locations.
+
+With --dirs whole directory trees holding the same relative paths and
+checksums are reported as single units instead of file by file.
+
+With --link-farm a directory is created holding one folder per duplicate
+set, named after the checksum, with a symlink to every copy on disk. Browse
+it to review duplicates before deciding what to delete.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		syncer := sync.NewSyncer(db)
-		duplicates, err := syncer.FindDuplicates()
+		formatter := getFormatter(cmd)
+
+		if dirs, _ := cmd.Flags().GetBool("dirs"); dirs {
+			showDuplicateDirs()
+			return
+		}
+
+		results, err := db.FindFiles(database.FindOptions{OnlyDuplicates: true, FileType: "file"})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error finding duplicates: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
-		if len(duplicates) == 0 {
+		if len(results) == 0 {
 			fmt.Println("No duplicate files found.")
 			return
 		}
 
-		fmt.Printf("Found %d sets of duplicate files:\n\n", len(duplicates))
-
-		count := 0
-		for checksum, files := range duplicates {
-			if count >= 20 {
-				fmt.Printf("... and %d more duplicate sets\n", len(duplicates)-count)
-				break
+		if linkFarm, _ := cmd.Flags().GetString("link-farm"); linkFarm != "" {
+			result, err := export.WriteLinkFarm(linkFarm, output.GroupDuplicates(results))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating link farm: %v\n", err)
+				exit(1)
 			}
-
-			fmt.Printf("Checksum: %s... (%d copies)\n", checksum[:12], len(files))
-			for _, file := range files {
-				fmt.Printf("  - %s [%s]\n", file.Path, file.IndexID[:12])
+			fmt.Printf("✓ Linked %d copies in %d duplicate sets under %s\n", result.Links, result.Sets, linkFarm)
+			if result.Offline > 0 {
+				fmt.Printf("  %d copies are not on disk (drive not mounted?) and were left out\n", result.Offline)
 			}
-			fmt.Println()
-			count++
+			return
+		}
+
+		if err := formatter.Duplicates(os.Stdout, output.GroupDuplicates(results)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			exit(1)
 		}
 	},
 }
 
+// showDuplicateDirs prints the directory trees that exist more than once
+func showDuplicateDirs() {
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
+		exit(1)
+	}
+	var indexIDs []string
+	for _, index := range indexes {
+		indexIDs = append(indexIDs, index.ID)
+	}
+
+	groups, err := report.DuplicateDirs(db, indexIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding duplicate directories: %v\n", err)
+		exit(1)
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No duplicate directories found.")
+		return
+	}
+
+	fmt.Printf("Found %d duplicated directory trees:\n", len(groups))
+	for _, group := range groups {
+		fmt.Printf("\n%d copies of %d files (%s each, %s redundant):\n",
+			len(group.Dirs), group.Files, humanize.Bytes(group.Size), humanize.Bytes(group.Wasted()))
+		for _, dir := range group.Dirs {
+			fmt.Printf("  %s  [%s]\n", dir.Path(), dir.Index.Name)
+		}
+	}
+}
+
 func init() {
 	syncCmd.Flags().BoolP("dry-run", "d", false, "Show what would be synced without making changes")
-	syncCmd.Flags().Bool("delete", false, "Delete files in target that don't exist in source (use with caution)")
+	syncCmd.Flags().Bool("delete", false, "Delete files in target that don't exist in source (use with caution); pinned files are kept")
+	syncCmd.Flags().Bool("rescan-target", false, "Reindex the target before comparing")
+	syncCmd.Flags().Bool("trust-stale", false, "Sync even when the target was scanned long before the source")
+	syncCmd.Flags().Bool("no-rescan", false, "Record the source entries in the target index instead of reindexing the target after the sync")
+	syncCmd.Flags().Bool("no-reuse", false, "Transfer every new file from the source, even when its content is already on the target")
+	syncCmd.Flags().Bool("hardlink", false, "Hard link content already on the target instead of copying it")
+	syncCmd.Flags().String("stale-after", "1d", "How much older than the source scan the target scan may be, e.g. 1d, 2w")
+
+	duplicatesCmd.Flags().Bool("dirs", false, "Report duplicated directory trees instead of single files")
+	duplicatesCmd.Flags().String("link-farm", "", "Create a directory of symlinks, one folder per duplicate set")
+	addFormatFlag(duplicatesCmd)
 
 	rootCmd.AddCommand(syncCmd)
 	rootCmd.AddCommand(compareCmd)
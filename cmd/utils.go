@@ -1,19 +1,18 @@
 package cmd
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strings"
 
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/victor/stormindexer/internal/collation"
+	"github.com/victor/stormindexer/internal/hooks"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/noise"
+	"github.com/victor/stormindexer/internal/output"
+)
 
 func min(a, b int) int {
 	if a < b {
@@ -22,3 +21,165 @@ func min(a, b int) int {
 	return b
 }
 
+// addFormatFlag registers the --format flag shared by commands that print results
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().String("format", "table", fmt.Sprintf(
+		"Output format: %s, exec:<command>, or a name resolved to an %s<name> plugin",
+		strings.Join(output.Names(), ", "), output.PluginPrefix))
+}
+
+// getFormatter resolves the --format flag, exiting on unknown formats
+func getFormatter(cmd *cobra.Command) output.Formatter {
+	name, _ := cmd.Flags().GetString("format")
+	formatter, err := output.Get(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	return formatter
+}
+
+// ensureMounted runs the configured mount hook when the root of an index is offline
+func ensureMounted(index *models.Index) error {
+	if hooks.IsOnline(index) {
+		return nil
+	}
+	if cfg.MountHook == "" {
+		return fmt.Errorf("%s (%s) is offline and no mount_hook is configured", index.Name, index.RootPath)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s (%s) is offline, running mount hook...\n", index.Name, index.RootPath)
+	if err := hooks.NewMountHook(cfg.MountHook, cfg.MountTimeout).EnsureOnline(index); err != nil {
+		return err
+	}
+	bus.Publish(models.EventDriveMounted, index.ID, index.RootPath, "mounted by mount_hook")
+	return nil
+}
+
+// resolveIndexes looks up the indexes named by args, or returns every index
+// when no argument is given. It exits on unknown identifiers.
+func resolveIndexes(args []string) []*models.Index {
+	if len(args) == 0 {
+		indexes, err := db.ListIndexes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
+			exit(1)
+		}
+		return indexes
+	}
+
+	var indexes []*models.Index
+	for _, identifier := range args {
+		index, err := db.FindIndexByNameOrID(identifier)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// findIndex looks up an index by name, ID or ID prefix, exiting with what
+// the identifier names in the error message when it is unknown or ambiguous
+func findIndex(identifier, what string) *models.Index {
+	index, err := db.FindIndexByNameOrID(identifier)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", what, err)
+		exit(1)
+	}
+	return index
+}
+
+// workingDirIndex returns the index containing the working directory, for
+// commands run without an index, and tells the user which one was picked
+func workingDirIndex() (*models.Index, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the current directory: %w", err)
+	}
+	index, err := db.FindIndexByPath(cwd)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Using index %s (%s), which contains the current directory\n", index.Name, index.RootPath)
+	return index, nil
+}
+
+// indexName returns the name of an index, or its ID when it is unknown
+func indexName(id string) string {
+	if index, err := db.GetIndex(id); err == nil {
+		return index.Name
+	}
+	return id
+}
+
+// shortIDs abbreviates the IDs of all indexes in the catalog, so the
+// abbreviations shown stay unique even when only some indexes are listed
+func shortIDs() map[string]string {
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing indexes: %v\n", err)
+		exit(1)
+	}
+	ids := make([]string, len(indexes))
+	for i, index := range indexes {
+		ids[i] = index.ID
+	}
+	return models.ShortIDs(ids, cfg.IDLength)
+}
+
+// noiseClassifier builds the noise rules of the configuration
+func noiseClassifier() *noise.Classifier {
+	var rules []noise.Rule
+	if cfg.NoiseBuiltin {
+		rules = noise.Builtin()
+	}
+	for _, pattern := range cfg.Noise {
+		rules = append(rules, noise.Rule{Category: noise.Custom, Pattern: pattern})
+	}
+	classifier, err := noise.New(rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in the noise setting: %v\n", err)
+		exit(1)
+	}
+	return classifier
+}
+
+// addNoiseFlag adds --exclude-noise to a command reading statistics
+func addNoiseFlag(flags *pflag.FlagSet) {
+	flags.Bool("exclude-noise", false, "Leave out OS metadata, caches and package stores (default: the exclude_noise setting)")
+}
+
+// excludeNoise leaves noise out of the queries of the command when
+// --exclude-noise or the exclude_noise setting asks for it, and reports
+// whether it does
+func excludeNoise(cmd *cobra.Command) bool {
+	exclude := cfg.ExcludeNoise
+	if cmd.Flags().Changed("exclude-noise") {
+		exclude, _ = cmd.Flags().GetBool("exclude-noise")
+	}
+	if exclude {
+		db.ExcludeNoise(noiseClassifier())
+	}
+	return exclude
+}
+
+// addSortFlag adds --sort to a command listing files
+func addSortFlag(cmd *cobra.Command) {
+	cmd.Flags().String("sort", "", "Order paths by path (bytes), natural (numbers by value) or locale (default: the sort setting)")
+}
+
+// sortOrder returns the order of --sort, or of the sort setting
+func sortOrder(cmd *cobra.Command) string {
+	if !cmd.Flags().Changed("sort") {
+		return cfg.Sort
+	}
+	value, _ := cmd.Flags().GetString("sort")
+	order, err := collation.Parse(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	return order
+}
@@ -0,0 +1,108 @@
+// Package backup writes copies of the catalog database and verifies them
+// later against the SHA-256 recorded in the catalog itself.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Check results
+const (
+	StatusOK       = "ok"
+	StatusModified = "modified"
+	StatusMissing  = "missing"
+)
+
+// Create writes a copy of the catalog to dest. With verify the copy is
+// integrity checked and its SHA-256 recorded in the catalog, and the
+// recorded backup is returned; otherwise the result is nil.
+//
+// The copy is written next to dest and renamed into place, so an
+// interrupted backup never replaces a good one. With force an existing
+// file at dest is replaced.
+func Create(db *database.DB, dest string, verify, force bool) (*models.Backup, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dest); err == nil && !force {
+		return nil, fmt.Errorf("%s already exists, use --force to replace it", dest)
+	}
+
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+	if err := db.BackupTo(tmp); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	var backup *models.Backup
+	if verify {
+		if err := database.CheckIntegrity(tmp); err != nil {
+			return nil, err
+		}
+		sum, size, err := HashFile(tmp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash backup: %w", err)
+		}
+		now := time.Now()
+		backup = &models.Backup{Path: dest, CreatedAt: now, Size: size, SHA256: sum, CheckedAt: now}
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return nil, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	if backup != nil {
+		if err := db.RecordBackup(backup); err != nil {
+			return nil, fmt.Errorf("failed to record backup: %w", err)
+		}
+	}
+	return backup, nil
+}
+
+// Check compares a recorded backup with the file on disk and returns its
+// status. A backup that still matches is marked as checked.
+func Check(db *database.DB, backup *models.Backup) (string, error) {
+	sum, size, err := HashFile(backup.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return StatusMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if size != backup.Size || sum != backup.SHA256 {
+		return StatusModified, nil
+	}
+	if err := db.MarkBackupChecked(backup.ID, time.Now()); err != nil {
+		return "", err
+	}
+	return StatusOK, nil
+}
+
+// HashFile returns the hex SHA-256 and size of a file
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
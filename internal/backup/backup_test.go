@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	catalog := testutil.NewCatalog(t)
+	catalog.AddIndex(&models.Index{ID: "idx", Name: "Photos", RootPath: "/photos", MachineID: "m"})
+	return catalog.DB
+}
+
+func TestCreate_VerifyRecordsChecksum(t *testing.T) {
+	db := setupTestDB(t)
+	dest := filepath.Join(t.TempDir(), "catalog-backup.db")
+
+	backup, err := Create(db, dest, true, false)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if backup == nil || len(backup.SHA256) != 64 {
+		t.Fatalf("Expected a recorded backup with a SHA-256, got %+v", backup)
+	}
+
+	recorded, err := db.GetBackup(dest)
+	if err != nil {
+		t.Fatalf("Expected backup to be recorded: %v", err)
+	}
+	if recorded.SHA256 != backup.SHA256 {
+		t.Errorf("Expected recorded checksum %s, got %s", backup.SHA256, recorded.SHA256)
+	}
+
+	// The copy is a working catalog
+	copyDB, err := database.NewDB(dest)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer copyDB.Close()
+	if _, err := copyDB.GetIndex("idx"); err != nil {
+		t.Errorf("Expected index in backup: %v", err)
+	}
+}
+
+func TestCreate_RefusesExistingFile(t *testing.T) {
+	db := setupTestDB(t)
+	dest := filepath.Join(t.TempDir(), "catalog-backup.db")
+	os.WriteFile(dest, []byte("keep me"), 0644)
+
+	if _, err := Create(db, dest, false, false); err == nil {
+		t.Fatal("Expected an error for an existing file")
+	}
+	if _, err := Create(db, dest, false, true); err != nil {
+		t.Fatalf("Expected --force to replace the file: %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db := setupTestDB(t)
+	dest := filepath.Join(t.TempDir(), "catalog-backup.db")
+
+	backup, err := Create(db, dest, true, false)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if status, err := Check(db, backup); err != nil || status != StatusOK {
+		t.Errorf("Expected ok, got %s (%v)", status, err)
+	}
+
+	f, _ := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0})
+	f.Close()
+	if status, _ := Check(db, backup); status != StatusModified {
+		t.Errorf("Expected modified, got %s", status)
+	}
+
+	os.Remove(dest)
+	if status, _ := Check(db, backup); status != StatusMissing {
+		t.Errorf("Expected missing, got %s", status)
+	}
+}
@@ -0,0 +1,106 @@
+// Package collation orders file paths the way people read them. Byte order,
+// the default, puts "file10.txt" before "file2.txt" and "Zebra" before
+// "apple"; the natural and locale orders fix that for listings.
+package collation
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Orders accepted by the sort setting and the --sort flags
+const (
+	// Path compares the bytes of paths, as SQLite does by default
+	Path = "path"
+	// Natural compares runs of digits by their numeric value
+	Natural = "natural"
+	// Locale follows the collation rules of the locale setting, ignoring
+	// case and accents at first and comparing numbers by value
+	Locale = "locale"
+)
+
+// Orders lists the accepted orders, the default first
+var Orders = []string{Path, Natural, Locale}
+
+// Parse checks an order, where "" means Path
+func Parse(order string) (string, error) {
+	order = strings.ToLower(strings.TrimSpace(order))
+	switch order {
+	case "":
+		return Path, nil
+	case Path, Natural, Locale:
+		return order, nil
+	}
+	return "", fmt.Errorf("unknown sort order %q (expected %s)", order, strings.Join(Orders, ", "))
+}
+
+// CompareNatural compares two strings byte by byte, except that runs of
+// digits compare by their numeric value: "file2" sorts before "file10".
+// Strings equal but for leading zeros, "a01" and "a1", fall back to byte
+// order so the order stays total.
+func CompareNatural(a, b string) int {
+	x, y := a, b
+	for x != "" && y != "" {
+		dx, dy := digits(x), digits(y)
+		if dx > 0 && dy > 0 {
+			nx, ny := strings.TrimLeft(x[:dx], "0"), strings.TrimLeft(y[:dy], "0")
+			if c := cmp.Compare(len(nx), len(ny)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(nx, ny); c != 0 {
+				return c
+			}
+			x, y = x[dx:], y[dy:]
+			continue
+		}
+		if x[0] != y[0] {
+			return cmp.Compare(x[0], y[0])
+		}
+		x, y = x[1:], y[1:]
+	}
+	if c := cmp.Compare(len(x), len(y)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func digits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// ForLocale returns the comparison of a locale such as "de_DE.UTF-8",
+// "fr-FR" or "sv". Unknown, empty and POSIX locales use the root collation
+// of the Unicode Collation Algorithm. Strings the locale deems equal fall
+// back to byte order. A comparison must not be shared between goroutines.
+func ForLocale(locale string) func(a, b string) int {
+	collator := collate.New(languageTag(locale), collate.Numeric)
+	return func(a, b string) int {
+		if c := collator.CompareString(a, b); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	}
+}
+
+// languageTag turns a POSIX locale into a BCP 47 tag
+func languageTag(locale string) language.Tag {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return language.Und
+	}
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return language.Und
+	}
+	return tag
+}
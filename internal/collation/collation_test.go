@@ -0,0 +1,53 @@
+package collation
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompareNatural(t *testing.T) {
+	names := []string{"file10.txt", "file2.txt", "file1.txt", "file01.txt", "File3.txt", "file2b.txt", "img/9", "img/10/a", "img"}
+	sort.Slice(names, func(i, j int) bool { return CompareNatural(names[i], names[j]) < 0 })
+
+	expected := []string{"File3.txt", "file01.txt", "file1.txt", "file2.txt", "file2b.txt", "file10.txt", "img", "img/9", "img/10/a"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	if CompareNatural("a99999999999999999999999", "a100000000000000000000000") >= 0 {
+		t.Error("Expected numbers beyond 64 bits to compare by value")
+	}
+	if CompareNatural("same", "same") != 0 {
+		t.Error("Expected equal strings to compare equal")
+	}
+}
+
+func TestForLocale(t *testing.T) {
+	names := []string{"zebra", "Apple", "éclair", "apple", "ecole", "track10", "track9"}
+	compare := ForLocale("en_US.UTF-8")
+	sort.Slice(names, func(i, j int) bool { return compare(names[i], names[j]) < 0 })
+
+	expected := []string{"apple", "Apple", "éclair", "ecole", "track9", "track10", "zebra"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	swedish := ForLocale("sv_SE")
+	if swedish("ö", "z") <= 0 {
+		t.Error("Expected ö to sort after z in Swedish")
+	}
+	if ForLocale("de_DE")("ö", "z") >= 0 {
+		t.Error("Expected ö to sort before z in German")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for input, expected := range map[string]string{"": Path, "path": Path, "Natural": Natural, "locale": Locale} {
+		if order, err := Parse(input); err != nil || order != expected {
+			t.Errorf("Expected %q for %q, got %q (%v)", expected, input, order, err)
+		}
+	}
+	if _, err := Parse("random"); err == nil {
+		t.Error("Expected an error for an unknown order")
+	}
+}
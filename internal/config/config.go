@@ -3,19 +3,103 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
+	"github.com/victor/stormindexer/internal/collation"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/filter"
 )
 
 type Config struct {
 	DatabasePath string `mapstructure:"database_path"`
 	MachineID    string `mapstructure:"machine_id"`
+	// Locale formats sizes and durations and sets the locale sort order.
+	// It is opt-in: empty unless configured, whatever the environment says.
+	Locale string `mapstructure:"locale"`
+	// MountHook is a shell command run to bring an offline index root online
+	MountHook    string        `mapstructure:"mount_hook"`
+	MountTimeout time.Duration `mapstructure:"mount_timeout"`
+	// Exclude lists glob patterns of files and directories never indexed
+	Exclude []string `mapstructure:"exclude"`
+	// PerfLog is a file each command appends its timing and slowest SQL to
+	PerfLog string `mapstructure:"perf_log"`
+	// SMART records the health of the drive with every index and reindex
+	SMART bool `mapstructure:"smart"`
+	// RequireACPower defers index and reindex while a laptop runs on
+	// battery, and MinBattery while its charge is below this percentage
+	RequireACPower bool `mapstructure:"require_ac_power"`
+	MinBattery     int  `mapstructure:"min_battery"`
+	// Thumbnails stores a preview of the images and videos hashed by every
+	// index and reindex
+	Thumbnails bool `mapstructure:"thumbnails"`
+	// Retries is how often scans retry a path after a transient IO error,
+	// waiting RetryDelay before the first retry and doubling it after
+	Retries    int           `mapstructure:"retries"`
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+	// IDLength is the minimum number of characters index IDs are shortened
+	// to for display; IDs are shown longer where needed to stay unique
+	IDLength int `mapstructure:"id_length"`
+	// SkipNestedIndexes leaves the roots of other indexes out of scans of
+	// the indexes containing them, so their files are not counted twice
+	SkipNestedIndexes bool `mapstructure:"skip_nested_indexes"`
+	// EventRetention is how long the event log keeps events; 0 keeps them
+	// forever
+	EventRetention time.Duration `mapstructure:"event_retention"`
+	// Policies are rules evaluated against an index after every scan
+	Policies []Policy `mapstructure:"policies"`
+	// Noise lists patterns of files that are noise besides those of the
+	// noise package, applied unless NoiseBuiltin is off. ExcludeNoise
+	// leaves noise out of stat, show and reports without --exclude-noise.
+	Noise        []string `mapstructure:"noise"`
+	NoiseBuiltin bool     `mapstructure:"noise_builtin"`
+	ExcludeNoise bool     `mapstructure:"exclude_noise"`
+	// ServeListen is the address serve listens on, and ServeToken the
+	// token its clients must send; serve makes one up when it is empty
+	ServeListen string `mapstructure:"serve_listen"`
+	ServeToken  string `mapstructure:"serve_token"`
+	// Sort is the order of find and list files: path, natural or locale,
+	// which follows Locale
+	Sort string `mapstructure:"sort"`
+	// MaxConcurrentJobs is how many scans, syncs and restores may run at
+	// once on this machine; later ones wait in a queue. 0 is no limit.
+	MaxConcurrentJobs int `mapstructure:"max_concurrent_jobs"`
+}
+
+// Policy actions
+const (
+	PolicyAlert = "alert"
+	PolicyExec  = "exec"
+)
+
+// Policy is a rule about the files of an index, see the policy package
+type Policy struct {
+	Name string `mapstructure:"name"`
+	// Where is a filter expression selecting the files the rule is about
+	Where string `mapstructure:"where"`
+	// The rule triggers once the matching files of an index reach MinFiles
+	// files or MinSize bytes; without either, any match triggers it
+	MinFiles int    `mapstructure:"min_files"`
+	MinSize  string `mapstructure:"min_size"`
+	// Action is alert, the default, or exec, which also runs Command
+	Action  string `mapstructure:"action"`
+	Command string `mapstructure:"command"`
 }
 
 var defaultConfig = Config{
-	DatabasePath: ".stormindexer.db",
-	MachineID:    getDefaultMachineID(),
+	DatabasePath:      ".stormindexer.db",
+	MachineID:         getDefaultMachineID(),
+	Sort:              collation.Path,
+	MountTimeout:      2 * time.Minute,
+	Retries:           3,
+	RetryDelay:        500 * time.Millisecond,
+	IDLength:          12,
+	SkipNestedIndexes: true,
+	EventRetention:    30 * 24 * time.Hour,
+	NoiseBuiltin:      true,
+	ServeListen:       "127.0.0.1:8765",
 }
 
 func getDefaultMachineID() string {
@@ -36,6 +120,27 @@ func Load() (*Config, error) {
 	// Set defaults
 	viper.SetDefault("database_path", defaultConfig.DatabasePath)
 	viper.SetDefault("machine_id", defaultConfig.MachineID)
+	viper.SetDefault("locale", defaultConfig.Locale)
+	viper.SetDefault("mount_hook", defaultConfig.MountHook)
+	viper.SetDefault("mount_timeout", defaultConfig.MountTimeout)
+	viper.SetDefault("exclude", defaultConfig.Exclude)
+	viper.SetDefault("perf_log", defaultConfig.PerfLog)
+	viper.SetDefault("smart", defaultConfig.SMART)
+	viper.SetDefault("thumbnails", defaultConfig.Thumbnails)
+	viper.SetDefault("require_ac_power", defaultConfig.RequireACPower)
+	viper.SetDefault("min_battery", defaultConfig.MinBattery)
+	viper.SetDefault("retries", defaultConfig.Retries)
+	viper.SetDefault("retry_delay", defaultConfig.RetryDelay)
+	viper.SetDefault("id_length", defaultConfig.IDLength)
+	viper.SetDefault("skip_nested_indexes", defaultConfig.SkipNestedIndexes)
+	viper.SetDefault("event_retention", defaultConfig.EventRetention)
+	viper.SetDefault("noise", defaultConfig.Noise)
+	viper.SetDefault("noise_builtin", defaultConfig.NoiseBuiltin)
+	viper.SetDefault("exclude_noise", defaultConfig.ExcludeNoise)
+	viper.SetDefault("serve_listen", defaultConfig.ServeListen)
+	viper.SetDefault("serve_token", defaultConfig.ServeToken)
+	viper.SetDefault("sort", defaultConfig.Sort)
+	viper.SetDefault("max_concurrent_jobs", defaultConfig.MaxConcurrentJobs)
 
 	// Read config file
 	if err := viper.ReadInConfig(); err != nil {
@@ -50,6 +155,40 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	for _, pattern := range config.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	if config.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative")
+	}
+
+	if config.EventRetention < 0 {
+		return nil, fmt.Errorf("event_retention must not be negative")
+	}
+
+	if config.MaxConcurrentJobs < 0 {
+		return nil, fmt.Errorf("max_concurrent_jobs must not be negative")
+	}
+
+	for i := range config.Policies {
+		if err := validatePolicy(&config.Policies[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	sort, err := collation.Parse(config.Sort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sort setting: %w", err)
+	}
+	config.Sort = sort
+
+	if config.IDLength < models.MinIDPrefix {
+		return nil, fmt.Errorf("id_length must be at least %d", models.MinIDPrefix)
+	}
+
 	// Expand database path to absolute
 	if !filepath.IsAbs(config.DatabasePath) {
 		cwd, _ := os.Getwd()
@@ -59,6 +198,45 @@ func Load() (*Config, error) {
 	return config, nil
 }
 
+// File returns the path of the configuration file Load read, or "" when
+// it found none and used the defaults
+func File() string {
+	return viper.ConfigFileUsed()
+}
+
+// validatePolicy checks a policy and fills in its default action
+func validatePolicy(p *Policy) error {
+	if p.Name == "" {
+		return fmt.Errorf("policy without a name")
+	}
+	if p.Where == "" {
+		return fmt.Errorf("policy %s: where is required", p.Name)
+	}
+	if _, err := filter.ParseExpr(p.Where, time.Now()); err != nil {
+		return fmt.Errorf("policy %s: %w", p.Name, err)
+	}
+	if p.MinFiles < 0 {
+		return fmt.Errorf("policy %s: min_files must not be negative", p.Name)
+	}
+	if p.MinSize != "" {
+		if _, err := filter.ParseBytes(p.MinSize); err != nil {
+			return fmt.Errorf("policy %s: invalid min_size: %w", p.Name, err)
+		}
+	}
+	switch p.Action {
+	case "":
+		p.Action = PolicyAlert
+	case PolicyAlert:
+	case PolicyExec:
+		if p.Command == "" {
+			return fmt.Errorf("policy %s: the exec action needs a command", p.Name)
+		}
+	default:
+		return fmt.Errorf("policy %s: unknown action %q, expected alert or exec", p.Name, p.Action)
+	}
+	return nil
+}
+
 // Save saves the current configuration to file
 func Save(config *Config) error {
 	viper.Set("database_path", config.DatabasePath)
@@ -55,3 +55,27 @@ func TestGetDefaultMachineID(t *testing.T) {
 	}
 }
 
+
+func TestValidatePolicy(t *testing.T) {
+	p := Policy{Name: "cold", Where: "ext=mov and mtime<2y"}
+	if err := validatePolicy(&p); err != nil {
+		t.Fatalf("Expected a valid policy, got %v", err)
+	}
+	if p.Action != PolicyAlert {
+		t.Errorf("Expected the default action %s, got %s", PolicyAlert, p.Action)
+	}
+
+	invalid := []Policy{
+		{Where: "ext=mov"},
+		{Name: "no-where"},
+		{Name: "bad-where", Where: "size>>1G"},
+		{Name: "bad-size", Where: "ext=mov", MinSize: "lots"},
+		{Name: "no-command", Where: "ext=mov", Action: PolicyExec},
+		{Name: "bad-action", Where: "ext=mov", Action: "delete"},
+	}
+	for _, p := range invalid {
+		if err := validatePolicy(&p); err == nil {
+			t.Errorf("Expected an error for policy %q", p.Name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package database
+
+import "time"
+
+// RecordPolicyAlert records that the alert of a policy fired for an index
+// and reports whether it had not fired already
+func (db *DB) RecordPolicyAlert(policy, indexID string, at time.Time) (bool, error) {
+	result, err := db.conn.Exec(`INSERT OR IGNORE INTO policy_alerts (policy, index_id, fired_at) VALUES (?, ?, ?)`,
+		policy, indexID, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ClearPolicyAlert forgets that the alert of a policy fired for an index,
+// so that it fires again the next time the index meets the policy
+func (db *DB) ClearPolicyAlert(policy, indexID string) error {
+	_, err := db.conn.Exec(`DELETE FROM policy_alerts WHERE policy = ? AND index_id = ?`, policy, indexID)
+	return err
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Columns read from attached catalogs. Both sides of the UNION must list them
+// in the same order.
+const (
+	indexColumns = "id, name, root_path, created_at, last_sync, machine_id, total_files, total_size, location, skip_directories, compact"
+	fileColumns  = "id, path, relative_path, size, mod_time, checksum, index_id, last_scanned, is_directory, link_target, first_seen, last_seen, checksum_stale, raw_path"
+)
+
+// connector opens SQLite connections through a driver whose ConnectHook
+// re-attaches foreign catalogs on every new connection of the pool, and
+// wraps them to time statements
+type connector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+	db     *DB
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), db: c.db}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// onConnect runs for every new SQLite connection
+func (db *DB) onConnect(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterFunc("base_name", baseName, true); err != nil {
+		return fmt.Errorf("failed to register base_name: %w", err)
+	}
+	if err := conn.RegisterFunc("noise_class", db.noiseClass, true); err != nil {
+		return fmt.Errorf("failed to register noise_class: %w", err)
+	}
+	if err := db.registerCollations(conn); err != nil {
+		return err
+	}
+	if db.inMemory {
+		if err := shareMemory(conn); err != nil {
+			return err
+		}
+	}
+	for i, path := range db.attached {
+		uri := "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro"
+		if _, err := conn.Exec(fmt.Sprintf("ATTACH DATABASE ? AS %s", attachedSchema(i)), []driver.Value{uri}); err != nil {
+			return fmt.Errorf("failed to attach %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func attachedSchema(i int) string {
+	return fmt.Sprintf("attached%d", i)
+}
+
+// Attach mounts another catalog read-only for the lifetime of the connection.
+// Read queries (indexes, files, find, duplicates) then span both catalogs,
+// while writes still go to the primary database only.
+func (db *DB) Attach(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("cannot attach catalog: %w", err)
+	}
+
+	db.attached = append(db.attached, absPath)
+
+	// Drop idle connections so the next query opens one with the new attachment
+	db.conn.SetMaxIdleConns(0)
+	db.conn.SetMaxIdleConns(2)
+
+	schema := attachedSchema(len(db.attached) - 1)
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s.indexes", schema)
+	if err := db.conn.QueryRow(query).Scan(&count); err != nil {
+		db.attached = db.attached[:len(db.attached)-1]
+		db.conn.SetMaxIdleConns(0)
+		db.conn.SetMaxIdleConns(2)
+		return fmt.Errorf("%s is not a stormindexer catalog: %w", path, err)
+	}
+
+	db.detectCompact(schema)
+	return db.missingColumns(schema)
+}
+
+// Attached returns the paths of the catalogs attached with Attach
+func (db *DB) Attached() []string {
+	return db.attached
+}
+
+// storedFilesTable returns the table expression spanning the files of
+// attached catalogs and of compact indexes, see filesTable
+func (db *DB) storedFilesTable() string {
+	table := db.unionTable("files", fileColumns)
+	var compact []string
+	for i := -1; i < len(db.attached); i++ {
+		schema, catalog := "main", ""
+		if i >= 0 {
+			schema = attachedSchema(i)
+		}
+		if len(db.attached) > 0 {
+			catalog = fmt.Sprintf("'%s' AS catalog, ", schema)
+		}
+		if db.hasCompact(schema) {
+			compact = append(compact, fmt.Sprintf("SELECT %s%s FROM %s", catalog, compactFileColumns, compactFiles(schema)))
+		}
+	}
+	if len(compact) == 0 {
+		return table
+	}
+
+	if len(db.attached) == 0 {
+		table = "SELECT " + fileColumns + " FROM main.files"
+	} else {
+		table = strings.TrimSuffix(strings.TrimPrefix(table, "("), ")")
+	}
+	return "(" + table + " UNION ALL " + strings.Join(compact, " UNION ALL ") + ")"
+}
+
+// indexesTable returns the table expression to read indexes from, spanning attached catalogs
+func (db *DB) indexesTable() string {
+	return db.unionTable("indexes", indexColumns)
+}
+
+func (db *DB) unionTable(table, columns string) string {
+	if len(db.attached) == 0 {
+		return table
+	}
+
+	parts := []string{fmt.Sprintf("SELECT 'main' AS catalog, %s FROM main.%s", columns, table)}
+	for i := range db.attached {
+		schema := attachedSchema(i)
+		parts = append(parts, fmt.Sprintf("SELECT '%s' AS catalog, %s FROM %s.%s", schema, db.selectColumns(schema, table, columns), schema, table))
+	}
+	return "(" + strings.Join(parts, " UNION ALL ") + ")"
+}
+
+// catalogJoin returns the extra join condition that keeps files matched with
+// the index of their own catalog when the same index exists in several of them
+func (db *DB) catalogJoin(filesAlias, indexesAlias string) string {
+	if len(db.attached) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s.catalog = %s.catalog", filesAlias, indexesAlias)
+}
+
+// prefixColumns qualifies a column list with a table alias
+func prefixColumns(alias, columns string) string {
+	return alias + "." + strings.ReplaceAll(columns, ", ", ", "+alias+".")
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+func TestAttach(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	foreignPath := filepath.Join(t.TempDir(), "foreign.db")
+	foreign, err := NewDB(foreignPath)
+	if err != nil {
+		t.Fatalf("Failed to create foreign database: %v", err)
+	}
+	foreign.CreateIndex(&models.Index{ID: "usb-1", Name: "USB1", RootPath: "/usb", CreatedAt: time.Now(), MachineID: "laptop"})
+	foreign.UpsertFile(&models.FileEntry{Path: "/usb/movie.mp4", RelativePath: "movie.mp4", Size: 10, Checksum: "same", ModTime: time.Now(), IndexID: "usb-1", LastScanned: time.Now()})
+	foreign.Close()
+
+	db.CreateIndex(&models.Index{ID: "nas", Name: "NAS", RootPath: "/nas", CreatedAt: time.Now(), MachineID: "server"})
+	db.UpsertFile(&models.FileEntry{Path: "/nas/movie.mp4", RelativePath: "movie.mp4", Size: 10, Checksum: "same", ModTime: time.Now(), IndexID: "nas", LastScanned: time.Now()})
+
+	if err := db.Attach(foreignPath); err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	if len(indexes) != 2 {
+		t.Errorf("Expected 2 indexes across both catalogs, got %d", len(indexes))
+	}
+
+	if _, err := db.FindIndexByNameOrID("USB1"); err != nil {
+		t.Errorf("Expected to find attached index by name: %v", err)
+	}
+
+	results, err := db.FindFiles(FindOptions{OnlyDuplicates: true})
+	if err != nil {
+		t.Fatalf("FindFiles failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected duplicates to span both catalogs, got %d results", len(results))
+	}
+
+	// The attached catalog must stay read-only
+	if _, err := db.conn.Exec("DELETE FROM attached0.files"); err == nil {
+		t.Error("Expected writes to the attached catalog to fail")
+	}
+}
+
+func TestAttach_NotACatalog(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	if err := db.Attach("/nonexistent/catalog.db"); err == nil {
+		t.Error("Expected error attaching a missing file")
+	}
+	if len(db.Attached()) != 0 {
+		t.Error("Failed attach should not be remembered")
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+const backupColumns = "id, path, created_at, size, sha256, checked_at"
+
+// BackupTo writes a consistent copy of the primary database to dest, which
+// must not exist. Attached catalogs are not included.
+func (db *DB) BackupTo(dest string) error {
+	_, err := db.conn.Exec(`VACUUM main INTO ?`, dest)
+	return err
+}
+
+// CheckIntegrity runs SQLite's integrity check on a database file without
+// modifying it
+func CheckIntegrity(path string) error {
+	conn, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+// RecordBackup stores a backup, replacing an earlier one at the same path,
+// and sets its ID
+func (db *DB) RecordBackup(backup *models.Backup) error {
+	query := `
+	INSERT INTO backups (path, created_at, size, sha256, checked_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(path) DO UPDATE SET
+		created_at = excluded.created_at,
+		size = excluded.size,
+		sha256 = excluded.sha256,
+		checked_at = excluded.checked_at
+	`
+	if _, err := db.conn.Exec(query, backup.Path, backup.CreatedAt, backup.Size, backup.SHA256, backup.CheckedAt); err != nil {
+		return err
+	}
+	return db.conn.QueryRow(`SELECT id FROM backups WHERE path = ?`, backup.Path).Scan(&backup.ID)
+}
+
+// MarkBackupChecked records a successful check of a backup
+func (db *DB) MarkBackupChecked(id int64, checkedAt time.Time) error {
+	_, err := db.conn.Exec(`UPDATE backups SET checked_at = ? WHERE id = ?`, checkedAt, id)
+	return err
+}
+
+// GetBackup retrieves the backup recorded at a path
+func (db *DB) GetBackup(path string) (*models.Backup, error) {
+	row := db.conn.QueryRow(`SELECT `+backupColumns+` FROM backups WHERE path = ?`, path)
+	return scanBackup(row)
+}
+
+// ListBackups returns the recorded backups, newest first
+func (db *DB) ListBackups() ([]*models.Backup, error) {
+	rows, err := db.conn.Query(`SELECT ` + backupColumns + ` FROM backups ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*models.Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, rows.Err()
+}
+
+func scanBackup(row rowScanner) (*models.Backup, error) {
+	backup := &models.Backup{}
+	var createdAt string
+	var checkedAt sql.NullString
+	err := row.Scan(&backup.ID, &backup.Path, &createdAt, &backup.Size, &backup.SHA256, &checkedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	backup.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	if checkedAt.Valid {
+		backup.CheckedAt, _ = time.Parse(time.RFC3339, checkedAt.String)
+	}
+	return backup, nil
+}
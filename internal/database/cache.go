@@ -0,0 +1,160 @@
+package database
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryCache keeps the most recent FindFiles results, for long-running
+// modes such as serve where the same queries run on every page load. Entries are
+// dropped whenever the catalog version changes, i.e. when a scan, import
+// or sync completed (in this or another process), an index was removed or
+// a pin changed.
+type queryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+	version string
+}
+
+type cacheEntry struct {
+	key   string
+	files []*FileWithIndex
+}
+
+// EnableQueryCache keeps up to size recent FindFiles results in memory. A
+// size of 0 disables the cache. Cached results are shared between callers
+// and must not be modified.
+func (db *DB) EnableQueryCache(size int) {
+	if size <= 0 {
+		db.cache = nil
+		return
+	}
+	db.cache = &queryCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// InvalidateQueryCache drops all cached query results
+func (db *DB) InvalidateQueryCache() {
+	if db.cache == nil {
+		return
+	}
+	db.cache.mu.Lock()
+	defer db.cache.mu.Unlock()
+	db.cache.clear()
+}
+
+// catalogVersion fingerprints the state of the indexes. Every completed
+// scan updates last_sync and the totals of its index, so the fingerprint
+// changes whenever cached results may be outdated. Pins are fingerprinted
+// by their count and latest ID, which every pin and unpin changes.
+func (db *DB) catalogVersion() (string, error) {
+	query := `
+	SELECT COUNT(*), COALESCE(GROUP_CONCAT(last_sync), ''), COALESCE(SUM(total_files), 0), COALESCE(SUM(total_size), 0),
+	       (SELECT COUNT(*) || '/' || COALESCE(MAX(id), 0) FROM pins)
+	FROM (SELECT * FROM ` + db.indexesTable() + ` ORDER BY id, last_sync)`
+	var count, files, size int64
+	var lastSync, pins string
+	if err := db.conn.QueryRow(query).Scan(&count, &lastSync, &files, &size, &pins); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d|%d|%s|%d|%d|%s", len(db.attached), count, lastSync, files, size, pins), nil
+}
+
+// cachedFindFiles serves FindFiles from the cache, running find on a miss
+func (db *DB) cachedFindFiles(opts FindOptions, find func(FindOptions) ([]*FileWithIndex, error)) ([]*FileWithIndex, error) {
+	version, err := db.catalogVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog version: %w", err)
+	}
+	key := opts.cacheKey()
+
+	c := db.cache
+	c.mu.Lock()
+	if c.version != version {
+		c.clear()
+		c.version = version
+	}
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		files := el.Value.(*cacheEntry).files
+		c.mu.Unlock()
+		return files, nil
+	}
+	c.mu.Unlock()
+
+	files, err := find(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == version {
+		c.add(key, files)
+	}
+	return files, nil
+}
+
+func (c *queryCache) add(key string, files []*FileWithIndex) {
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		el.Value.(*cacheEntry).files = files
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, files: files})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *queryCache) clear() {
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// cacheKey normalizes the options so equivalent queries share a cache entry
+func (opts FindOptions) cacheKey() string {
+	fileType := opts.FileType
+	switch fileType {
+	case "":
+		fileType = "all"
+	case "directory":
+		fileType = "dir"
+	}
+
+	indexIDs := append([]string(nil), opts.IndexIDs...)
+	sort.Strings(indexIDs)
+
+	size := func(n *int64) string {
+		if n == nil {
+			return ""
+		}
+		return fmt.Sprint(*n)
+	}
+	date := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+
+	where := ""
+	if opts.Where != nil {
+		where = opts.Where.String()
+	}
+
+	return strings.Join([]string{
+		opts.NamePattern, opts.DirectoryPattern, opts.Checksum,
+		size(opts.MinSize), size(opts.MaxSize),
+		strings.Join(indexIDs, ","), fmt.Sprint(opts.OnlyDuplicates), fmt.Sprint(opts.ExcludePinned),
+		date(opts.ModifiedSince), date(opts.ModifiedUntil), fileType, date(opts.FirstSeenSince), where,
+		collate(opts.Sort),
+	}, "\x00")
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetImportCheckpoint returns how many lines of an import source were already committed.
+// A source that was never imported (or finished importing) returns 0.
+func (db *DB) GetImportCheckpoint(source string) (int64, error) {
+	var lines int64
+	err := db.conn.QueryRow(`SELECT lines FROM import_checkpoints WHERE source = ?`, source).Scan(&lines)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return lines, err
+}
+
+// SaveImportCheckpoint records how many lines of an import source have been committed
+func (db *DB) SaveImportCheckpoint(source string, lines int64) error {
+	query := `
+	INSERT INTO import_checkpoints (source, lines, updated_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(source) DO UPDATE SET
+		lines = excluded.lines,
+		updated_at = excluded.updated_at
+	`
+	_, err := db.conn.Exec(query, source, lines, time.Now())
+	return err
+}
+
+// ClearImportCheckpoint forgets the checkpoint of a completed import
+func (db *DB) ClearImportCheckpoint(source string) error {
+	_, err := db.conn.Exec(`DELETE FROM import_checkpoints WHERE source = ?`, source)
+	return err
+}
+
+// ScanCheckpoint records where a scan of an index stopped before walking
+// the whole tree, so the next scan resumes after Path. StartedAt is when the
+// first scan of the unfinished pass started.
+type ScanCheckpoint struct {
+	IndexID   string
+	Path      string
+	StartedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GetScanCheckpoint returns the checkpoint of an index, or nil when its last
+// scan finished
+func (db *DB) GetScanCheckpoint(indexID string) (*ScanCheckpoint, error) {
+	checkpoint := &ScanCheckpoint{IndexID: indexID}
+	err := db.conn.QueryRow(`SELECT path, started_at, updated_at FROM scan_checkpoints WHERE index_id = ?`, indexID).
+		Scan(&checkpoint.Path, &checkpoint.StartedAt, &checkpoint.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// SaveScanCheckpoint records where a scan stopped
+func (db *DB) SaveScanCheckpoint(checkpoint *ScanCheckpoint) error {
+	query := `
+	INSERT INTO scan_checkpoints (index_id, path, started_at, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(index_id) DO UPDATE SET
+		path = excluded.path,
+		started_at = excluded.started_at,
+		updated_at = excluded.updated_at
+	`
+	_, err := db.conn.Exec(query, checkpoint.IndexID, checkpoint.Path, checkpoint.StartedAt, time.Now())
+	return err
+}
+
+// ClearScanCheckpoint forgets the checkpoint of an index whose scan finished
+func (db *DB) ClearScanCheckpoint(indexID string) error {
+	_, err := db.conn.Exec(`DELETE FROM scan_checkpoints WHERE index_id = ?`, indexID)
+	return err
+}
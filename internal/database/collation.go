@@ -0,0 +1,44 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/victor/stormindexer/internal/collation"
+)
+
+// SetLocale selects the locale the locale sort order follows
+func (db *DB) SetLocale(locale string) {
+	db.locale = locale
+}
+
+// registerCollations registers the natural and locale sort orders as SQLite
+// collations. Each connection gets its own locale comparison, which is not
+// safe for concurrent use.
+func (db *DB) registerCollations(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterCollation(collation.Natural, collation.CompareNatural); err != nil {
+		return fmt.Errorf("failed to register the natural collation: %w", err)
+	}
+	var locale string
+	var compare func(a, b string) int
+	err := conn.RegisterCollation(collation.Locale, func(a, b string) int {
+		if compare == nil || locale != db.locale {
+			locale, compare = db.locale, collation.ForLocale(db.locale)
+		}
+		return compare(a, b)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register the locale collation: %w", err)
+	}
+	return nil
+}
+
+// collate returns the COLLATE clause ordering a column by a sort order.
+// The name is quoted as NATURAL is an SQL keyword.
+func collate(order string) string {
+	switch order {
+	case collation.Natural, collation.Locale:
+		return ` COLLATE "` + order + `"`
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Compact indexes store their files in compact_files instead of files: each
+// row keeps the file name and the ID of its directory in compact_dirs,
+// which holds the absolute and relative directory paths once for all the
+// files in it. Reads go through filesTable, which rebuilds the full paths,
+// so the rest of the package sees compact files like any other. Their IDs
+// are negated to keep them apart from the IDs of the files table.
+const compactFileColumns = "-c.id, d.path || c.name, d.relative_path || c.name, c.size, c.mod_time, c.checksum, c.index_id, c.last_scanned, c.is_directory, c.link_target, c.first_seen, c.last_seen, c.checksum_stale, c.raw_path"
+
+// compactFiles joins the compact files of a schema with their directories
+func compactFiles(schema string) string {
+	return fmt.Sprintf("%s.compact_files c JOIN %s.compact_dirs d ON d.id = c.dir_id", schema, schema)
+}
+
+// compactLookup selects the ID of the compact file with an absolute path,
+// given the parameters returned by compactKey. The two ways a path can be
+// stored are looked up separately, since SQLite does not use the indexes
+// for an OR of both.
+const compactLookup = `
+	SELECT c.id FROM compact_files c JOIN compact_dirs d ON d.id = c.dir_id
+	WHERE d.index_id = ? AND d.path = ? AND c.name = ?
+	UNION ALL
+	SELECT c.id FROM compact_files c JOIN compact_dirs d ON d.id = c.dir_id
+	WHERE d.index_id = ? AND d.path = ? AND c.name = ''`
+
+const upsertCompactFileQuery = `
+	INSERT INTO compact_files (dir_id, name, size, mod_time, checksum, index_id, last_scanned, is_directory, link_target, first_seen, last_seen, checksum_stale, raw_path)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(dir_id, name) DO UPDATE SET
+		size = excluded.size,
+		mod_time = excluded.mod_time,
+		checksum = excluded.checksum,
+		last_scanned = excluded.last_scanned,
+		is_directory = excluded.is_directory,
+		link_target = excluded.link_target,
+		last_seen = excluded.last_seen,
+		checksum_stale = excluded.checksum_stale,
+		raw_path = excluded.raw_path
+	`
+
+// compactState remembers which indexes are compact, and which catalogs
+// hold compact files and need compact_files in filesTable
+type compactState struct {
+	mu       sync.Mutex
+	indexes  map[string]bool
+	catalogs map[string]bool
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// splitCompact splits the path and relative path of a file into the
+// directory prefixes stored in compact_dirs and the name stored with the
+// file. Entries whose paths do not end with the same name, such as the root
+// with the relative path ".", are stored whole as a directory prefix with an
+// empty name.
+func splitCompact(path, relativePath string) (dir, relativeDir, name string) {
+	name = relativePath[strings.LastIndexAny(relativePath, `/\`)+1:]
+	dir = strings.TrimSuffix(path, name)
+	if name == "." || dir == path || dir == "" || !strings.ContainsAny(dir[len(dir)-1:], `/\`) {
+		return path, relativePath, ""
+	}
+	return dir, relativePath[:len(relativePath)-len(name)], name
+}
+
+// compactKey returns the parameters of compactLookup for an absolute path
+// of an index: the directory prefix and name it is stored under, or the
+// path itself for entries stored whole
+func compactKey(indexID, path string) []interface{} {
+	name := path[strings.LastIndexAny(path, `/\`)+1:]
+	return []interface{}{indexID, path[:len(path)-len(name)], name, indexID, path}
+}
+
+// IsCompact reports whether the files of an index are stored compactly.
+// Unknown indexes are not compact.
+func (db *DB) IsCompact(indexID string) bool {
+	db.compact.mu.Lock()
+	defer db.compact.mu.Unlock()
+	if compact, ok := db.compact.indexes[indexID]; ok {
+		return compact
+	}
+	var compact bool
+	if err := db.conn.QueryRow(`SELECT compact FROM indexes WHERE id = ?`, indexID).Scan(&compact); err != nil {
+		return false
+	}
+	db.compact.indexes[indexID] = compact
+	return compact
+}
+
+// forgetCompact drops the cached storage mode of an index
+func (db *DB) forgetCompact(indexID string) {
+	db.compact.mu.Lock()
+	defer db.compact.mu.Unlock()
+	delete(db.compact.indexes, indexID)
+}
+
+// detectCompact records whether a catalog holds compact files. Catalogs
+// created before compact storage have no compact_files table.
+func (db *DB) detectCompact(schema string) {
+	var found bool
+	err := db.conn.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s.compact_files)", schema)).Scan(&found)
+	db.compact.mu.Lock()
+	defer db.compact.mu.Unlock()
+	db.compact.catalogs[schema] = err == nil && found
+}
+
+// hasCompact reports whether filesTable must read the compact files of a catalog
+func (db *DB) hasCompact(schema string) bool {
+	db.compact.mu.Lock()
+	defer db.compact.mu.Unlock()
+	return db.compact.catalogs[schema]
+}
+
+// upsertCompactFile inserts or updates a file of a compact index
+func (db *DB) upsertCompactFile(ex execer, file *models.FileEntry) error {
+	dir, relativeDir, name := splitCompact(file.Path, file.RelativePath)
+	if _, err := ex.Exec(`INSERT INTO compact_dirs (index_id, path, relative_path) VALUES (?, ?, ?) ON CONFLICT(index_id, path) DO NOTHING`,
+		file.IndexID, dir, relativeDir); err != nil {
+		return err
+	}
+	var dirID int64
+	if err := ex.QueryRow(`SELECT id FROM compact_dirs WHERE index_id = ? AND path = ?`, file.IndexID, dir).Scan(&dirID); err != nil {
+		return err
+	}
+
+	args := upsertFileArgs(file)
+	if _, err := ex.Exec(upsertCompactFileQuery, append([]interface{}{dirID, name}, args[2:]...)...); err != nil {
+		return err
+	}
+
+	db.compact.mu.Lock()
+	db.compact.catalogs["main"] = true
+	db.compact.mu.Unlock()
+	return nil
+}
+
+// getCompactFile retrieves a file of a compact index by path
+func (db *DB) getCompactFile(path, indexID string) (*models.FileEntry, error) {
+	query := `
+	SELECT ` + compactFileColumns + `
+	FROM ` + compactFiles("main") + `
+	WHERE c.id IN (` + compactLookup + `)`
+	return scanFile(db.conn.QueryRow(query, compactKey(indexID, path)...))
+}
+
+// deleteCompactFile removes a file of a compact index and records its tombstone
+func (db *DB) deleteCompactFile(path, indexID string, removedAt time.Time) error {
+	args := compactKey(indexID, path)
+	query := `
+	INSERT INTO removed_files (path, relative_path, index_id, removed_at)
+	SELECT d.path || c.name, d.relative_path || c.name, c.index_id, ? FROM ` + compactFiles("main") + `
+	WHERE c.id IN (` + compactLookup + `)`
+	if _, err := db.conn.Exec(query, append([]interface{}{removedAt}, args...)...); err != nil {
+		return err
+	}
+
+	_, err := db.conn.Exec(`DELETE FROM compact_files WHERE id IN (`+compactLookup+`)`, args...)
+	return err
+}
+
+// pruneCompactDirs deletes the directories of a compact index left without files
+func (db *DB) pruneCompactDirs(indexID string) error {
+	_, err := db.conn.Exec(`
+	DELETE FROM compact_dirs
+	WHERE index_id = ? AND id NOT IN (SELECT dir_id FROM compact_files WHERE index_id = ?)`, indexID, indexID)
+	return err
+}
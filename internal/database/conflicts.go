@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+const conflictColumns = `id, source_index_id, target_index_id, relative_path,
+	source_path, source_size, source_mod_time, source_checksum,
+	target_path, target_size, target_mod_time, target_checksum,
+	detected_at, resolved_at, resolution`
+
+// RecordConflict stores a sync conflict and sets its ID. An open conflict
+// of the same file between the same indexes is updated instead of being
+// recorded twice.
+func (db *DB) RecordConflict(c *models.Conflict) error {
+	var id int64
+	err := db.conn.QueryRow(`
+	SELECT id FROM sync_conflicts
+	WHERE source_index_id = ? AND target_index_id = ? AND relative_path = ? AND resolved_at IS NULL`,
+		c.SourceIndexID, c.TargetIndexID, c.RelativePath).Scan(&id)
+	if err == sql.ErrNoRows {
+		result, err := db.conn.Exec(`
+		INSERT INTO sync_conflicts (source_index_id, target_index_id, relative_path,
+			source_path, source_size, source_mod_time, source_checksum,
+			target_path, target_size, target_mod_time, target_checksum, detected_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.SourceIndexID, c.TargetIndexID, c.RelativePath,
+			c.SourcePath, c.SourceSize, c.SourceModTime, c.SourceChecksum,
+			c.TargetPath, c.TargetSize, c.TargetModTime, c.TargetChecksum, c.DetectedAt)
+		if err != nil {
+			return err
+		}
+		c.ID, err = result.LastInsertId()
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	c.ID = id
+	_, err = db.conn.Exec(`
+	UPDATE sync_conflicts SET
+		source_path = ?, source_size = ?, source_mod_time = ?, source_checksum = ?,
+		target_path = ?, target_size = ?, target_mod_time = ?, target_checksum = ?
+	WHERE id = ?`,
+		c.SourcePath, c.SourceSize, c.SourceModTime, c.SourceChecksum,
+		c.TargetPath, c.TargetSize, c.TargetModTime, c.TargetChecksum, id)
+	return err
+}
+
+// GetConflict returns a conflict by ID, or sql.ErrNoRows
+func (db *DB) GetConflict(id int64) (*models.Conflict, error) {
+	return scanConflict(db.conn.QueryRow(`SELECT `+conflictColumns+` FROM sync_conflicts WHERE id = ?`, id))
+}
+
+// ListConflicts returns the open conflicts, or every conflict when all is
+// set, oldest first
+func (db *DB) ListConflicts(all bool) ([]*models.Conflict, error) {
+	query := `SELECT ` + conflictColumns + ` FROM sync_conflicts`
+	if !all {
+		query += ` WHERE resolved_at IS NULL`
+	}
+	query += ` ORDER BY detected_at, id`
+	return db.queryConflicts(query)
+}
+
+// PairConflicts returns the open and resolved conflicts of syncs from
+// source to target, oldest first
+func (db *DB) PairConflicts(sourceIndexID, targetIndexID string) ([]*models.Conflict, error) {
+	return db.queryConflicts(`
+	SELECT `+conflictColumns+` FROM sync_conflicts
+	WHERE source_index_id = ? AND target_index_id = ?
+	ORDER BY detected_at, id`, sourceIndexID, targetIndexID)
+}
+
+// ResolveConflict marks a conflict resolved with the side that was kept
+func (db *DB) ResolveConflict(id int64, resolution string, resolvedAt time.Time) error {
+	_, err := db.conn.Exec(`UPDATE sync_conflicts SET resolution = ?, resolved_at = ? WHERE id = ?`, resolution, resolvedAt, id)
+	return err
+}
+
+// LastSync returns when a sync from source to target last completed, or
+// the zero time
+func (db *DB) LastSync(sourceIndexID, targetIndexID string) (time.Time, error) {
+	var syncedAt string
+	err := db.conn.QueryRow(`SELECT synced_at FROM sync_history WHERE source_index_id = ? AND target_index_id = ?`,
+		sourceIndexID, targetIndexID).Scan(&syncedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	t, _ := time.Parse(time.RFC3339, syncedAt)
+	return t, nil
+}
+
+// RecordSync stores when a sync from source to target completed
+func (db *DB) RecordSync(sourceIndexID, targetIndexID string, syncedAt time.Time) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO sync_history (source_index_id, target_index_id, synced_at) VALUES (?, ?, ?)
+	ON CONFLICT(source_index_id, target_index_id) DO UPDATE SET synced_at = excluded.synced_at`,
+		sourceIndexID, targetIndexID, syncedAt)
+	return err
+}
+
+func (db *DB) queryConflicts(query string, args ...interface{}) ([]*models.Conflict, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []*models.Conflict
+	for rows.Next() {
+		c, err := scanConflict(rows)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+func scanConflict(row rowScanner) (*models.Conflict, error) {
+	c := &models.Conflict{}
+	var sourceModTime, targetModTime, detectedAt string
+	var resolvedAt sql.NullString
+	err := row.Scan(&c.ID, &c.SourceIndexID, &c.TargetIndexID, &c.RelativePath,
+		&c.SourcePath, &c.SourceSize, &sourceModTime, &c.SourceChecksum,
+		&c.TargetPath, &c.TargetSize, &targetModTime, &c.TargetChecksum,
+		&detectedAt, &resolvedAt, &c.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SourceModTime, _ = time.Parse(time.RFC3339, sourceModTime)
+	c.TargetModTime, _ = time.Parse(time.RFC3339, targetModTime)
+	c.DetectedAt, _ = time.Parse(time.RFC3339, detectedAt)
+	if resolvedAt.Valid {
+		c.ResolvedAt, _ = time.Parse(time.RFC3339, resolvedAt.String)
+	}
+	return c, nil
+}
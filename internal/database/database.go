@@ -3,34 +3,71 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+	"github.com/victor/stormindexer/internal/collation"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/noise"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/internal/perf"
+	"github.com/victor/stormindexer/pkg/filter"
 )
 
 type DB struct {
-	conn *sql.DB
+	conn     *sql.DB
+	attached []string
+	missing  map[string]bool // columns missing from attached catalogs
+	recorder *perf.Recorder
+	cache    *queryCache
+	compact  compactState
+	noise    *noise.Classifier
+	locale   string
+	inMemory bool
+	held     *sql.Conn // keeps an in-memory catalog alive
 }
 
-// NewDB creates a new database connection
+// NewDB creates a new database connection. dbPath is a file, Memory for a
+// private in-memory catalog, or a SQLite URI such as one of SharedMemory.
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=1")
-	if err != nil {
+	db := &DB{missing: make(map[string]bool)}
+	db.compact.indexes = make(map[string]bool)
+	db.compact.catalogs = make(map[string]bool)
+	dsn, inMemory := dataSourceName(dbPath)
+	db.inMemory = inMemory
+	db.conn = sql.OpenDB(&connector{
+		driver: &sqlite3.SQLiteDriver{ConnectHook: db.onConnect},
+		dsn:    dsn,
+		db:     db,
+	})
+
+	if err := db.conn.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if inMemory {
+		if err := db.keepAlive(); err != nil {
+			db.conn.Close()
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+	}
 
-	db := &DB{conn: conn}
 	if err := db.initSchema(); err != nil {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
+	db.detectCompact("main")
 
 	return db, nil
 }
 
 // Close closes the database connection
 func (db *DB) Close() error {
+	if db.held != nil {
+		db.held.Close()
+	}
 	return db.conn.Close()
 }
 
@@ -45,7 +82,10 @@ func (db *DB) initSchema() error {
 		last_sync DATETIME,
 		machine_id TEXT NOT NULL,
 		total_files INTEGER DEFAULT 0,
-		total_size INTEGER DEFAULT 0
+		total_size INTEGER DEFAULT 0,
+		location TEXT NOT NULL DEFAULT '',
+		skip_directories INTEGER NOT NULL DEFAULT 0,
+		compact INTEGER NOT NULL DEFAULT 0
 	);
 
 	CREATE TABLE IF NOT EXISTS files (
@@ -58,6 +98,11 @@ func (db *DB) initSchema() error {
 		index_id TEXT NOT NULL,
 		last_scanned DATETIME NOT NULL,
 		is_directory INTEGER NOT NULL DEFAULT 0,
+		link_target TEXT NOT NULL DEFAULT '',
+		first_seen DATETIME,
+		last_seen DATETIME,
+		checksum_stale INTEGER NOT NULL DEFAULT 0,
+		raw_path BLOB,
 		UNIQUE(path, index_id),
 		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
 	);
@@ -66,34 +111,252 @@ func (db *DB) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_files_index_id ON files(index_id);
 	CREATE INDEX IF NOT EXISTS idx_files_checksum ON files(checksum);
 	CREATE INDEX IF NOT EXISTS idx_files_relative_path ON files(relative_path);
+
+	CREATE TABLE IF NOT EXISTS compact_dirs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		index_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		relative_path TEXT NOT NULL,
+		UNIQUE(index_id, path),
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS compact_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		dir_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		mod_time DATETIME NOT NULL,
+		checksum TEXT,
+		index_id TEXT NOT NULL,
+		last_scanned DATETIME NOT NULL,
+		is_directory INTEGER NOT NULL DEFAULT 0,
+		link_target TEXT NOT NULL DEFAULT '',
+		first_seen DATETIME,
+		last_seen DATETIME,
+		checksum_stale INTEGER NOT NULL DEFAULT 0,
+		raw_path BLOB,
+		UNIQUE(dir_id, name),
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_compact_files_index_id ON compact_files(index_id);
+	CREATE INDEX IF NOT EXISTS idx_compact_files_checksum ON compact_files(checksum);
+
+	CREATE TABLE IF NOT EXISTS removed_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL,
+		relative_path TEXT NOT NULL,
+		index_id TEXT NOT NULL,
+		removed_at DATETIME NOT NULL,
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_removed_files_index_id ON removed_files(index_id, removed_at);
+
+	CREATE TABLE IF NOT EXISTS import_checkpoints (
+		source TEXT PRIMARY KEY,
+		lines INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS scan_checkpoints (
+		index_id TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		index_id TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		pid INTEGER NOT NULL,
+		host TEXT NOT NULL,
+		status TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		heartbeat DATETIME NOT NULL,
+		finished_at DATETIME,
+		cancel_requested INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+
+	CREATE TABLE IF NOT EXISTS backups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		checked_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS drive_health (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		index_id TEXT NOT NULL,
+		job_id INTEGER NOT NULL DEFAULT 0,
+		captured_at DATETIME NOT NULL,
+		device TEXT NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		serial TEXT NOT NULL DEFAULT '',
+		passed INTEGER NOT NULL,
+		reallocated_sectors INTEGER NOT NULL DEFAULT 0,
+		pending_sectors INTEGER NOT NULL DEFAULT 0,
+		uncorrectable_sectors INTEGER NOT NULL DEFAULT 0,
+		power_on_hours INTEGER NOT NULL DEFAULT 0,
+		temperature INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_drive_health_index_id ON drive_health(index_id, captured_at);
+
+	CREATE TABLE IF NOT EXISTS loans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		index_id TEXT NOT NULL,
+		borrower TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		checked_out_at DATETIME NOT NULL,
+		due_at DATETIME,
+		returned_at DATETIME,
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_loans_active ON loans(index_id) WHERE returned_at IS NULL;
+
+	CREATE TABLE IF NOT EXISTS pins (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		index_id TEXT NOT NULL,
+		relative_path TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		UNIQUE(index_id, relative_path),
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS scan_errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		index_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		op TEXT NOT NULL,
+		error TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		occurred_at DATETIME NOT NULL,
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_scan_errors_index_id ON scan_errors(index_id);
+
+	CREATE TABLE IF NOT EXISTS sync_history (
+		source_index_id TEXT NOT NULL,
+		target_index_id TEXT NOT NULL,
+		synced_at DATETIME NOT NULL,
+		PRIMARY KEY(source_index_id, target_index_id),
+		FOREIGN KEY(source_index_id) REFERENCES indexes(id) ON DELETE CASCADE,
+		FOREIGN KEY(target_index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_conflicts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source_index_id TEXT NOT NULL,
+		target_index_id TEXT NOT NULL,
+		relative_path TEXT NOT NULL,
+		source_path TEXT NOT NULL,
+		source_size INTEGER NOT NULL,
+		source_mod_time DATETIME NOT NULL,
+		source_checksum TEXT NOT NULL DEFAULT '',
+		target_path TEXT NOT NULL,
+		target_size INTEGER NOT NULL,
+		target_mod_time DATETIME NOT NULL,
+		target_checksum TEXT NOT NULL DEFAULT '',
+		detected_at DATETIME NOT NULL,
+		resolved_at DATETIME,
+		resolution TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(source_index_id) REFERENCES indexes(id) ON DELETE CASCADE,
+		FOREIGN KEY(target_index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_conflicts_open ON sync_conflicts(source_index_id, target_index_id, relative_path) WHERE resolved_at IS NULL;
+
+	CREATE TABLE IF NOT EXISTS nested_indexes (
+		index_id TEXT NOT NULL,
+		nested_index_id TEXT NOT NULL,
+		relative_path TEXT NOT NULL,
+		PRIMARY KEY(index_id, nested_index_id),
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE,
+		FOREIGN KEY(nested_index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		index_id TEXT NOT NULL DEFAULT '',
+		path TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT '',
+		occurred_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_events_occurred_at ON events(occurred_at);
+
+	CREATE TABLE IF NOT EXISTS thumbnails (
+		checksum TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS policy_alerts (
+		policy TEXT NOT NULL,
+		index_id TEXT NOT NULL,
+		fired_at DATETIME NOT NULL,
+		PRIMARY KEY(policy, index_id),
+		FOREIGN KEY(index_id) REFERENCES indexes(id) ON DELETE CASCADE
+	);
 	`
 
-	_, err := db.conn.Exec(schema)
-	return err
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	return db.migrate()
 }
 
-// CreateIndex creates a new index entry
+// CreateIndex creates a new index entry. Index names cannot contain
+// control characters, so that lists of names can be separated by newlines.
 func (db *DB) CreateIndex(index *models.Index) error {
+	if strings.ContainsFunc(index.Name, unicode.IsControl) {
+		return fmt.Errorf("invalid index name %q: control characters are not allowed", index.Name)
+	}
 	query := `
-	INSERT INTO indexes (id, name, root_path, created_at, last_sync, machine_id, total_files, total_size)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO indexes (id, name, root_path, created_at, last_sync, machine_id, total_files, total_size, location, skip_directories, compact)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := db.conn.Exec(query, index.ID, index.Name, index.RootPath, index.CreatedAt, index.LastSync, index.MachineID, index.TotalFiles, index.TotalSize)
+	_, err := db.conn.Exec(query, index.ID, index.Name, index.RootPath, index.CreatedAt, index.LastSync, index.MachineID, index.TotalFiles, index.TotalSize, index.Location, index.SkipDirectories, index.Compact)
+	if err == nil {
+		db.forgetCompact(index.ID)
+	}
 	return err
 }
 
 // GetIndex retrieves an index by ID
 func (db *DB) GetIndex(indexID string) (*models.Index, error) {
 	query := `
-	SELECT id, name, root_path, created_at, last_sync, machine_id, total_files, total_size
-	FROM indexes
+	SELECT ` + indexColumns + `
+	FROM ` + db.indexesTable() + `
 	WHERE id = ?
 	`
+	return scanIndex(db.conn.QueryRow(query, indexID))
+}
+
+// scanIndex reads a row of indexColumns
+func scanIndex(row rowScanner) (*models.Index, error) {
 	index := &models.Index{}
 	var createdAt, lastSync string
-	err := db.conn.QueryRow(query, indexID).Scan(
+	err := row.Scan(
 		&index.ID, &index.Name, &index.RootPath, &createdAt, &lastSync,
-		&index.MachineID, &index.TotalFiles, &index.TotalSize,
+		&index.MachineID, &index.TotalFiles, &index.TotalSize, &index.Location, &index.SkipDirectories,
+		&index.Compact,
 	)
 	if err != nil {
 		return nil, err
@@ -107,7 +370,9 @@ func (db *DB) GetIndex(indexID string) (*models.Index, error) {
 	return index, nil
 }
 
-// FindIndexByNameOrID finds an index by exact name match or partial ID match
+// FindIndexByNameOrID finds an index by exact ID, exact name, unambiguous
+// ID prefix of at least models.MinIDPrefix characters, or by a directory
+// path, see FindIndexByPath
 func (db *DB) FindIndexByNameOrID(identifier string) (*models.Index, error) {
 	// First try exact ID match
 	index, err := db.GetIndex(identifier)
@@ -117,55 +382,117 @@ func (db *DB) FindIndexByNameOrID(identifier string) (*models.Index, error) {
 
 	// Then try exact name match
 	query := `
-	SELECT id, name, root_path, created_at, last_sync, machine_id, total_files, total_size
-	FROM indexes
+	SELECT ` + indexColumns + `
+	FROM ` + db.indexesTable() + `
 	WHERE name = ?
 	LIMIT 1
 	`
-	index = &models.Index{}
-	var createdAt, lastSync string
-	err = db.conn.QueryRow(query, identifier).Scan(
-		&index.ID, &index.Name, &index.RootPath, &createdAt, &lastSync,
-		&index.MachineID, &index.TotalFiles, &index.TotalSize,
-	)
+	index, err = scanIndex(db.conn.QueryRow(query, identifier))
 	if err == nil {
-		index.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		if lastSync != "" {
-			index.LastSync, _ = time.Parse(time.RFC3339, lastSync)
-		}
 		return index, nil
 	}
 
-	// Finally try partial ID match (at least 8 characters)
-	if len(identifier) >= 8 {
+	// Finally try an ID prefix, which must match a single index
+	if len(identifier) >= models.MinIDPrefix {
 		query = `
-		SELECT id, name, root_path, created_at, last_sync, machine_id, total_files, total_size
-		FROM indexes
-		WHERE id LIKE ?
-		LIMIT 1
+		SELECT ` + indexColumns + `
+		FROM ` + db.indexesTable() + `
+		WHERE substr(id, 1, ?) = ?
+		ORDER BY id
 		`
-		index = &models.Index{}
-		err = db.conn.QueryRow(query, identifier+"%").Scan(
-			&index.ID, &index.Name, &index.RootPath, &createdAt, &lastSync,
-			&index.MachineID, &index.TotalFiles, &index.TotalSize,
-		)
-		if err == nil {
-			index.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-			if lastSync != "" {
-				index.LastSync, _ = time.Parse(time.RFC3339, lastSync)
+		rows, err := db.conn.Query(query, len(identifier), identifier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find index: %w", err)
+		}
+		defer rows.Close()
+
+		var matches []*models.Index
+		for rows.Next() {
+			index, err := scanIndex(rows)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan index: %w", err)
+			}
+			matches = append(matches, index)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to find index: %w", err)
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+		if len(matches) > 1 {
+			var candidates []string
+			for _, match := range matches {
+				candidates = append(candidates, fmt.Sprintf("%s (%s)", match.ID, match.Name))
+			}
+			return nil, fmt.Errorf("ambiguous index ID %s matches %s", identifier, strings.Join(candidates, ", "))
+		}
+	}
+
+	// Last, a path to the root of an index or a directory inside one
+	if isPath(identifier) {
+		path := identifier
+		if !paths.IsWindows(path) {
+			if path, err = filepath.Abs(path); err != nil {
+				return nil, fmt.Errorf("invalid path %s: %w", identifier, err)
 			}
-			return index, nil
 		}
+		return db.FindIndexByPath(path)
 	}
 
 	return nil, fmt.Errorf("index not found: %s", identifier)
 }
 
+// isPath reports whether an index identifier is meant as a path: it has a
+// separator, is "." or "..", or names an existing directory
+func isPath(identifier string) bool {
+	if strings.ContainsAny(identifier, `/\`) || identifier == "." || identifier == ".." {
+		return true
+	}
+	info, err := os.Stat(identifier)
+	return err == nil && info.IsDir()
+}
+
+// FindIndexByPath finds the index rooted at an absolute path, or the index
+// containing it. When indexes are nested, the innermost one is returned.
+func (db *DB) FindIndexByPath(path string) (*models.Index, error) {
+	path = paths.NormalizeRoot(path)
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	var matches []*models.Index
+	longest := -1
+	for _, index := range indexes {
+		root := paths.NormalizeRoot(index.RootPath)
+		if !paths.Contains(root, path) || len(root) < longest {
+			continue
+		}
+		if len(root) > longest {
+			matches, longest = nil, len(root)
+		}
+		matches = append(matches, index)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no index contains %s", path)
+	case 1:
+		return matches[0], nil
+	}
+	var candidates []string
+	for _, match := range matches {
+		candidates = append(candidates, fmt.Sprintf("%s (%s)", match.ID, match.Name))
+	}
+	return nil, fmt.Errorf("ambiguous path %s is indexed by %s", path, strings.Join(candidates, ", "))
+}
+
 // ListIndexes returns all indexes
 func (db *DB) ListIndexes() ([]*models.Index, error) {
 	query := `
-	SELECT id, name, root_path, created_at, last_sync, machine_id, total_files, total_size
-	FROM indexes
+	SELECT ` + indexColumns + `
+	FROM ` + db.indexesTable() + `
 	ORDER BY created_at DESC
 	`
 	rows, err := db.conn.Query(query)
@@ -176,75 +503,119 @@ func (db *DB) ListIndexes() ([]*models.Index, error) {
 
 	var indexes []*models.Index
 	for rows.Next() {
-		index := &models.Index{}
-		var createdAt, lastSync string
-		if err := rows.Scan(
-			&index.ID, &index.Name, &index.RootPath, &createdAt, &lastSync,
-			&index.MachineID, &index.TotalFiles, &index.TotalSize,
-		); err != nil {
+		index, err := scanIndex(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		index.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		if lastSync != "" {
-			index.LastSync, _ = time.Parse(time.RFC3339, lastSync)
-		}
-
 		indexes = append(indexes, index)
 	}
 
 	return indexes, rows.Err()
 }
 
-// UpsertFile inserts or updates a file entry
-func (db *DB) UpsertFile(file *models.FileEntry) error {
-	query := `
-	INSERT INTO files (path, relative_path, size, mod_time, checksum, index_id, last_scanned, is_directory)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+const upsertFileQuery = `
+	INSERT INTO files (path, relative_path, size, mod_time, checksum, index_id, last_scanned, is_directory, link_target, first_seen, last_seen, checksum_stale, raw_path)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(path, index_id) DO UPDATE SET
+		relative_path = excluded.relative_path,
 		size = excluded.size,
 		mod_time = excluded.mod_time,
 		checksum = excluded.checksum,
 		last_scanned = excluded.last_scanned,
-		is_directory = excluded.is_directory
+		is_directory = excluded.is_directory,
+		link_target = excluded.link_target,
+		last_seen = excluded.last_seen,
+		checksum_stale = excluded.checksum_stale,
+		raw_path = excluded.raw_path
 	`
-	_, err := db.conn.Exec(query,
+
+// upsertFileArgs returns the parameters of upsertFileQuery for a file.
+// first_seen is only written for new rows; both default to the scan time.
+func upsertFileArgs(file *models.FileEntry) []interface{} {
+	firstSeen, lastSeen := file.FirstSeen, file.LastSeen
+	if firstSeen.IsZero() {
+		firstSeen = file.LastScanned
+	}
+	if lastSeen.IsZero() {
+		lastSeen = file.LastScanned
+	}
+	return []interface{}{
 		file.Path, file.RelativePath, file.Size, file.ModTime, file.Checksum,
-		file.IndexID, file.LastScanned, file.IsDirectory,
-	)
-	return err
+		file.IndexID, file.LastScanned, file.IsDirectory, file.LinkTarget, firstSeen, lastSeen,
+		file.ChecksumStale, file.RawPath,
+	}
 }
 
-// GetFile retrieves a file by path and index ID
-func (db *DB) GetFile(path, indexID string) (*models.FileEntry, error) {
-	query := `
-	SELECT id, path, relative_path, size, mod_time, checksum, index_id, last_scanned, is_directory
-	FROM files
-	WHERE path = ? AND index_id = ?
-	`
+// timeCond compares a DATETIME column with a time parameter. Times are
+// stored as text in the zone they were given in, e.g.
+// "2006-01-02 15:04:05.999-07:00", so they are compared as instants through
+// julianday rather than as strings.
+func timeCond(column, op string) string {
+	return "julianday(" + column + ") " + op + " julianday(?)"
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFile reads a file selected with fileColumns, followed by any extra columns
+func scanFile(row rowScanner, extra ...interface{}) (*models.FileEntry, error) {
 	file := &models.FileEntry{}
 	var modTime, lastScanned string
-	err := db.conn.QueryRow(query, path, indexID).Scan(
+	var firstSeen, lastSeen sql.NullString
+	dest := []interface{}{
 		&file.ID, &file.Path, &file.RelativePath, &file.Size, &modTime,
-		&file.Checksum, &file.IndexID, &lastScanned, &file.IsDirectory,
-	)
-	if err != nil {
+		&file.Checksum, &file.IndexID, &lastScanned, &file.IsDirectory, &file.LinkTarget,
+		&firstSeen, &lastSeen, &file.ChecksumStale, &file.RawPath,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
 
 	file.ModTime, _ = time.Parse(time.RFC3339, modTime)
 	file.LastScanned, _ = time.Parse(time.RFC3339, lastScanned)
+	file.FirstSeen, _ = time.Parse(time.RFC3339, firstSeen.String)
+	file.LastSeen, _ = time.Parse(time.RFC3339, lastSeen.String)
 
 	return file, nil
 }
 
+// UpsertFile inserts or updates a file entry
+func (db *DB) UpsertFile(file *models.FileEntry) error {
+	if db.IsCompact(file.IndexID) {
+		return db.upsertCompactFile(db.conn, file)
+	}
+	_, err := db.conn.Exec(upsertFileQuery, upsertFileArgs(file)...)
+	return err
+}
+
+// GetFile retrieves a file by path and index ID
+func (db *DB) GetFile(path, indexID string) (*models.FileEntry, error) {
+	if db.IsCompact(indexID) {
+		return db.getCompactFile(path, indexID)
+	}
+	query := `
+	SELECT ` + fileColumns + `
+	FROM ` + db.filesTable() + `
+	WHERE path = ? AND index_id = ?
+	`
+	return scanFile(db.conn.QueryRow(query, path, indexID))
+}
+
 // ListFiles returns all files for a given index
 func (db *DB) ListFiles(indexID string) ([]*models.FileEntry, error) {
+	return db.ListFilesSorted(indexID, collation.Path)
+}
+
+// ListFilesSorted returns all files for a given index ordered by path in a
+// sort order of the collation package
+func (db *DB) ListFilesSorted(indexID, order string) ([]*models.FileEntry, error) {
 	query := `
-	SELECT id, path, relative_path, size, mod_time, checksum, index_id, last_scanned, is_directory
-	FROM files
+	SELECT ` + fileColumns + `
+	FROM ` + db.filesTable() + `
 	WHERE index_id = ?
-	ORDER BY path
+	ORDER BY path` + collate(order) + `
 	`
 	rows, err := db.conn.Query(query, indexID)
 	if err != nil {
@@ -254,33 +625,248 @@ func (db *DB) ListFiles(indexID string) ([]*models.FileEntry, error) {
 
 	var files []*models.FileEntry
 	for rows.Next() {
-		file := &models.FileEntry{}
-		var modTime, lastScanned string
-		if err := rows.Scan(
-			&file.ID, &file.Path, &file.RelativePath, &file.Size, &modTime,
-			&file.Checksum, &file.IndexID, &lastScanned, &file.IsDirectory,
-		); err != nil {
+		file, err := scanFile(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		file.ModTime, _ = time.Parse(time.RFC3339, modTime)
-		file.LastScanned, _ = time.Parse(time.RFC3339, lastScanned)
-
 		files = append(files, file)
 	}
 
 	return files, rows.Err()
 }
 
-// DeleteFile removes a file from the index
+// EachFile streams all files of an index to fn without loading them into memory.
+// Iteration stops at the first error returned by fn.
+func (db *DB) EachFile(indexID string, fn func(*models.FileEntry) error) error {
+	return db.EachFileSince(indexID, time.Time{}, fn)
+}
+
+// EachFileSince streams the files of an index that were added or changed
+// (last scanned) after since, ordered by relative path. A zero since
+// streams every file.
+func (db *DB) EachFileSince(indexID string, since time.Time, fn func(*models.FileEntry) error) error {
+	query := `
+	SELECT ` + fileColumns + `
+	FROM ` + db.filesTable() + `
+	WHERE index_id = ?
+	`
+	args := []interface{}{indexID}
+	if !since.IsZero() {
+		query += " AND " + timeCond("last_scanned", ">")
+		args = append(args, since)
+	}
+	query += " ORDER BY relative_path, path"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// UpsertFiles inserts or updates a batch of files in a single transaction
+func (db *DB) UpsertFiles(files []*models.FileEntry) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(upsertFileQuery)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, file := range files {
+		if db.IsCompact(file.IndexID) {
+			err = db.upsertCompactFile(tx, file)
+		} else {
+			_, err = stmt.Exec(upsertFileArgs(file)...)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to upsert file %s: %w", file.Path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MarkDirectories records the given files of an index as directories, with
+// no size, and returns how many were files before
+func (db *DB) MarkDirectories(indexID string, paths []string) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE files SET is_directory = 1, size = 0 WHERE path = ? AND index_id = ? AND is_directory = 0`
+	compact := db.IsCompact(indexID)
+	if compact {
+		query = `UPDATE compact_files SET is_directory = 1, size = 0 WHERE is_directory = 0 AND id IN (` + compactLookup + `)`
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var marked int64
+	for _, path := range paths {
+		args := []interface{}{path, indexID}
+		if compact {
+			args = compactKey(indexID, path)
+		}
+		result, err := stmt.Exec(args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark %s as a directory: %w", path, err)
+		}
+		n, _ := result.RowsAffected()
+		marked += n
+	}
+	return marked, tx.Commit()
+}
+
+// TouchFiles records that unchanged files of an index were seen by a scan
+func (db *DB) TouchFiles(indexID string, paths []string, seen time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE files SET last_seen = ? WHERE path = ? AND index_id = ?`
+	compact := db.IsCompact(indexID)
+	if compact {
+		query = `UPDATE compact_files SET last_seen = ? WHERE id IN (` + compactLookup + `)`
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, path := range paths {
+		args := []interface{}{seen, path, indexID}
+		if compact {
+			args = append([]interface{}{seen}, compactKey(indexID, path)...)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to touch file %s: %w", path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteFile removes a file from the index and records a tombstone so that
+// differential exports can propagate the removal
 func (db *DB) DeleteFile(path, indexID string) error {
-	query := `DELETE FROM files WHERE path = ? AND index_id = ?`
+	if db.IsCompact(indexID) {
+		return db.deleteCompactFile(path, indexID, time.Now())
+	}
+	query := `
+	INSERT INTO removed_files (path, relative_path, index_id, removed_at)
+	SELECT path, relative_path, index_id, ? FROM files WHERE path = ? AND index_id = ?
+	`
+	if _, err := db.conn.Exec(query, time.Now(), path, indexID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM files WHERE path = ? AND index_id = ?`
 	_, err := db.conn.Exec(query, path, indexID)
 	return err
 }
 
+// ListRemovedFiles returns the tombstones of files removed from an index after since
+func (db *DB) ListRemovedFiles(indexID string, since time.Time) ([]*models.FileEntry, error) {
+	query := `
+	SELECT path, relative_path, index_id, removed_at
+	FROM removed_files
+	WHERE index_id = ? AND ` + timeCond("removed_at", ">") + `
+	ORDER BY relative_path, path, removed_at
+	`
+	rows, err := db.conn.Query(query, indexID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*models.FileEntry
+	for rows.Next() {
+		file := &models.FileEntry{}
+		var removedAt string
+		if err := rows.Scan(&file.Path, &file.RelativePath, &file.IndexID, &removedAt); err != nil {
+			return nil, err
+		}
+		file.LastScanned, _ = time.Parse(time.RFC3339, removedAt)
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// SetIndexLocation sets the physical location label of an index's drive.
+// An empty location clears it.
+func (db *DB) SetIndexLocation(indexID, location string) error {
+	result, err := db.conn.Exec(`UPDATE indexes SET location = ? WHERE id = ?`, location, indexID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("index not found: %s", indexID)
+	}
+	return nil
+}
+
+// SetSkipDirectories sets whether scans of an index store directory entries.
+// Skipping them drops the entries already stored. They are not recorded as
+// removed: the directories still exist, and differential exports must not
+// delete them from other catalogs.
+func (db *DB) SetSkipDirectories(indexID string, skip bool) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE indexes SET skip_directories = ? WHERE id = ?`, skip, indexID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("index not found: %s", indexID)
+	}
+	if skip {
+		for _, table := range []string{"files", "compact_files"} {
+			if _, err := tx.Exec(`DELETE FROM `+table+` WHERE index_id = ? AND is_directory = 1`, indexID); err != nil {
+				return fmt.Errorf("failed to drop directory entries: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
 // DeleteIndex removes an index and all its files (CASCADE deletes files automatically)
 func (db *DB) DeleteIndex(indexID string) error {
+	defer db.forgetCompact(indexID)
 	query := `DELETE FROM indexes WHERE id = ?`
 	result, err := db.conn.Exec(query, indexID)
 	if err != nil {
@@ -296,27 +882,36 @@ func (db *DB) DeleteIndex(indexID string) error {
 		return fmt.Errorf("index not found: %s", indexID)
 	}
 	
-	return nil
+	return db.pruneThumbnails()
 }
 
 // UpdateIndexStats updates the statistics for an index
 func (db *DB) UpdateIndexStats(indexID string) error {
 	query := `
 	UPDATE indexes
-	SET total_files = (SELECT COUNT(*) FROM files WHERE index_id = ?),
-		total_size = (SELECT COALESCE(SUM(size), 0) FROM files WHERE index_id = ? AND is_directory = 0),
+	SET total_files = (SELECT COUNT(*) FROM files WHERE index_id = ?) +
+			(SELECT COUNT(*) FROM compact_files WHERE index_id = ?),
+		total_size = (SELECT COALESCE(SUM(size), 0) FROM files WHERE index_id = ? AND is_directory = 0) +
+			(SELECT COALESCE(SUM(size), 0) FROM compact_files WHERE index_id = ? AND is_directory = 0),
 		last_sync = ?
 	WHERE id = ?
 	`
-	_, err := db.conn.Exec(query, indexID, indexID, time.Now(), indexID)
-	return err
+	if _, err := db.conn.Exec(query, indexID, indexID, indexID, indexID, time.Now(), indexID); err != nil {
+		return err
+	}
+	if db.IsCompact(indexID) {
+		if err := db.pruneCompactDirs(indexID); err != nil {
+			return err
+		}
+	}
+	return db.pruneThumbnails()
 }
 
 // FindFilesByChecksum finds files with the same checksum across different indexes
 func (db *DB) FindFilesByChecksum(checksum string) ([]*models.FileEntry, error) {
 	query := `
-	SELECT id, path, relative_path, size, mod_time, checksum, index_id, last_scanned, is_directory
-	FROM files
+	SELECT ` + fileColumns + `
+	FROM ` + db.filesTable() + `
 	WHERE checksum = ? AND checksum != ''
 	ORDER BY index_id, path
 	`
@@ -328,37 +923,70 @@ func (db *DB) FindFilesByChecksum(checksum string) ([]*models.FileEntry, error)
 
 	var files []*models.FileEntry
 	for rows.Next() {
-		file := &models.FileEntry{}
-		var modTime, lastScanned string
-		if err := rows.Scan(
-			&file.ID, &file.Path, &file.RelativePath, &file.Size, &modTime,
-			&file.Checksum, &file.IndexID, &lastScanned, &file.IsDirectory,
-		); err != nil {
+		file, err := scanFile(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		file.ModTime, _ = time.Parse(time.RFC3339, modTime)
-		file.LastScanned, _ = time.Parse(time.RFC3339, lastScanned)
-
 		files = append(files, file)
 	}
 
 	return files, rows.Err()
 }
 
+// RedundancyStats summarises how much of an index already exists elsewhere in the catalog
+type RedundancyStats struct {
+	HashedFiles    int64
+	HashedBytes    int64
+	RedundantFiles int64
+	RedundantBytes int64
+}
+
+// GetRedundancyStats joins the checksums of an index against all other indexes
+// to compute how many of its bytes are already stored somewhere else
+func (db *DB) GetRedundancyStats(indexID string) (*RedundancyStats, error) {
+	query := `
+	SELECT COUNT(*),
+	       COALESCE(SUM(f.size), 0),
+	       COALESCE(SUM(CASE WHEN d.checksum IS NOT NULL THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN d.checksum IS NOT NULL THEN f.size ELSE 0 END), 0)
+	FROM ` + db.filesTable() + ` f
+	LEFT JOIN (
+		SELECT DISTINCT checksum FROM ` + db.filesTable() + `
+		WHERE index_id != ? AND checksum != '' AND is_directory = 0
+	) d ON d.checksum = f.checksum
+	WHERE f.index_id = ? AND f.is_directory = 0 AND f.checksum != ''
+	`
+	stats := &RedundancyStats{}
+	err := db.conn.QueryRow(query, indexID, indexID).Scan(
+		&stats.HashedFiles, &stats.HashedBytes, &stats.RedundantFiles, &stats.RedundantBytes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
 
 // FindOptions represents search criteria for finding files
 type FindOptions struct {
 	NamePattern      string
 	DirectoryPattern string
 	Checksum         string
-	MinSize          int64
-	MaxSize          int64
+	MinSize          *int64
+	MaxSize          *int64
 	IndexIDs         []string
 	OnlyDuplicates   bool
+	ExcludePinned    bool // leave out the files a pin protects
 	ModifiedSince    *time.Time
 	ModifiedUntil    *time.Time
 	FileType         string // "file", "dir", "directory", "all"
+	FirstSeenSince   *time.Time
+	// Where is a filter expression the files must also match
+	Where filter.Expr
+	// Sort orders the results by index name and path: collation.Path (the
+	// default), Natural or Locale
+	Sort string
 }
 
 // FileWithIndex represents a file entry with index metadata
@@ -366,29 +994,57 @@ type FileWithIndex struct {
 	*models.FileEntry
 	IndexName string
 	IndexPath string
+	Pinned    bool // set by FindFiles when a pin protects the file
 }
 
-// FindFiles searches for files across all indexes based on the provided options
+// FindFiles searches for files across all indexes based on the provided
+// options. With EnableQueryCache recent results are served from memory.
 func (db *DB) FindFiles(opts FindOptions) ([]*FileWithIndex, error) {
+	if db.cache != nil {
+		return db.cachedFindFiles(opts, db.findFiles)
+	}
+	return db.findFiles(opts)
+}
+
+func (db *DB) findFiles(opts FindOptions) ([]*FileWithIndex, error) {
+	var results []*FileWithIndex
+	err := db.EachFoundFile(opts, func(file *FileWithIndex) error {
+		results = append(results, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// EachFoundFile streams the files FindFiles would return to fn without
+// loading them into memory. Iteration stops at the first error returned by
+// fn. The query cache is not used.
+func (db *DB) EachFoundFile(opts FindOptions, fn func(*FileWithIndex) error) error {
 	var conditions []string
 	var args []interface{}
 
 	// Build WHERE clause conditions
 	if opts.NamePattern != "" {
-		// Convert shell-style wildcards to SQL LIKE patterns
-		pattern := convertPatternToLike(opts.NamePattern)
-		conditions = append(conditions, "f.relative_path LIKE ?")
+		// Convert shell-style wildcards to SQL LIKE patterns. Names are
+		// stored sanitized, so a pattern typed with the raw bytes of an
+		// undecodable name is sanitized the same way to match it.
+		name := models.SanitizePattern(opts.NamePattern)
+		pattern := filter.PatternToLike(name)
+		conditions = append(conditions, `f.relative_path LIKE ? ESCAPE '\'`)
 		args = append(args, pattern)
 	}
 
 	if opts.DirectoryPattern != "" {
-		dirPattern := convertPatternToLike(opts.DirectoryPattern)
+		dir := models.SanitizePattern(opts.DirectoryPattern)
+		dirPattern := filter.PatternToLike(dir)
 		// Match directory name anywhere in path
 		conditions = append(conditions, `(
-			f.relative_path LIKE ? || '/%'
-			OR f.relative_path LIKE '%/' || ? || '/%'
-			OR f.relative_path LIKE '%/' || ?
-			OR f.relative_path LIKE ?
+			f.relative_path LIKE ? || '/%' ESCAPE '\'
+			OR f.relative_path LIKE '%/' || ? || '/%' ESCAPE '\'
+			OR f.relative_path LIKE '%/' || ? ESCAPE '\'
+			OR f.relative_path LIKE ? ESCAPE '\'
 		)`)
 		args = append(args, dirPattern, dirPattern, dirPattern, dirPattern)
 	}
@@ -398,14 +1054,14 @@ func (db *DB) FindFiles(opts FindOptions) ([]*FileWithIndex, error) {
 		args = append(args, opts.Checksum)
 	}
 
-	if opts.MinSize > 0 {
+	if opts.MinSize != nil {
 		conditions = append(conditions, "f.size >= ?")
-		args = append(args, opts.MinSize)
+		args = append(args, *opts.MinSize)
 	}
 
-	if opts.MaxSize > 0 {
+	if opts.MaxSize != nil {
 		conditions = append(conditions, "f.size <= ?")
-		args = append(args, opts.MaxSize)
+		args = append(args, *opts.MaxSize)
 	}
 
 	// File type filtering
@@ -424,13 +1080,18 @@ func (db *DB) FindFiles(opts FindOptions) ([]*FileWithIndex, error) {
 	// "all" doesn't add a condition
 
 	if opts.ModifiedSince != nil {
-		conditions = append(conditions, "f.mod_time >= ?")
-		args = append(args, opts.ModifiedSince.Format(time.RFC3339))
+		conditions = append(conditions, timeCond("f.mod_time", ">="))
+		args = append(args, *opts.ModifiedSince)
 	}
 
 	if opts.ModifiedUntil != nil {
-		conditions = append(conditions, "f.mod_time <= ?")
-		args = append(args, opts.ModifiedUntil.Format(time.RFC3339))
+		conditions = append(conditions, timeCond("f.mod_time", "<="))
+		args = append(args, *opts.ModifiedUntil)
+	}
+
+	if opts.FirstSeenSince != nil {
+		conditions = append(conditions, timeCond("f.first_seen", ">="))
+		args = append(args, *opts.FirstSeenSince)
 	}
 
 	if len(opts.IndexIDs) > 0 {
@@ -445,24 +1106,37 @@ func (db *DB) FindFiles(opts FindOptions) ([]*FileWithIndex, error) {
 		conditions = append(conditions, "f.index_id IN ("+placeholders+")")
 	}
 
+	if opts.Where != nil {
+		cond, exprArgs, err := db.exprSQL(opts.Where)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, cond)
+		args = append(args, exprArgs...)
+	}
+
 	// Handle duplicates filter
 	if opts.OnlyDuplicates {
 		conditions = append(conditions, `f.checksum IN (
 			SELECT checksum 
-			FROM files 
+			FROM ` + db.filesTable() + ` 
 			WHERE checksum != '' 
 			GROUP BY checksum 
 			HAVING COUNT(*) > 1
 		)`)
 	}
 
+	if opts.ExcludePinned {
+		conditions = append(conditions, `NOT EXISTS (SELECT 1 FROM pins p WHERE `+pinCovers+`)`)
+	}
+
 	// Build query
 	query := `
-	SELECT f.id, f.path, f.relative_path, f.size, f.mod_time, f.checksum, 
-	       f.index_id, f.last_scanned, f.is_directory,
-	       i.name as index_name, i.root_path as index_path
-	FROM files f
-	JOIN indexes i ON f.index_id = i.id
+	SELECT ` + prefixColumns("f", fileColumns) + `,
+	       i.name as index_name, i.root_path as index_path,
+	       EXISTS (SELECT 1 FROM pins p WHERE ` + pinCovers + `) as pinned
+	FROM ` + db.filesTable() + ` f
+	JOIN ` + db.indexesTable() + ` i ON f.index_id = i.id` + db.catalogJoin("f", "i") + `
 	`
 
 	if len(conditions) > 0 {
@@ -472,52 +1146,33 @@ func (db *DB) FindFiles(opts FindOptions) ([]*FileWithIndex, error) {
 		}
 	}
 
-	query += " ORDER BY i.name, f.path"
+	query += " ORDER BY i.name" + collate(opts.Sort) + ", f.path" + collate(opts.Sort)
 
 	rows, err := db.conn.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query files: %w", err)
+		return fmt.Errorf("failed to query files: %w", err)
 	}
 	defer rows.Close()
 
-	var results []*FileWithIndex
 	for rows.Next() {
-		file := &models.FileEntry{}
-		var modTime, lastScanned string
 		var indexName, indexPath string
-
-		err := rows.Scan(
-			&file.ID, &file.Path, &file.RelativePath, &file.Size, &modTime,
-			&file.Checksum, &file.IndexID, &lastScanned, &file.IsDirectory,
-			&indexName, &indexPath,
-		)
+		var pinned bool
+		file, err := scanFile(rows, &indexName, &indexPath, &pinned)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan file: %w", err)
+			return fmt.Errorf("failed to scan file: %w", err)
 		}
 
-		file.ModTime, _ = time.Parse(time.RFC3339, modTime)
-		file.LastScanned, _ = time.Parse(time.RFC3339, lastScanned)
-
-		results = append(results, &FileWithIndex{
+		err = fn(&FileWithIndex{
 			FileEntry: file,
 			IndexName: indexName,
 			IndexPath: indexPath,
+			Pinned:    pinned,
 		})
+		if err != nil {
+			return err
+		}
 	}
 
-	return results, rows.Err()
+	return rows.Err()
 }
 
-// convertPatternToLike converts shell-style wildcards (*, ?) to SQL LIKE patterns
-func convertPatternToLike(pattern string) string {
-	// Escape SQL LIKE special characters first (need to escape backslash first)
-	pattern = strings.ReplaceAll(pattern, `\`, `\\`)
-	pattern = strings.ReplaceAll(pattern, `%`, `\%`)
-	pattern = strings.ReplaceAll(pattern, `_`, `\_`)
-
-	// Convert wildcards
-	pattern = strings.ReplaceAll(pattern, `*`, `%`)
-	pattern = strings.ReplaceAll(pattern, `?`, `_`)
-
-	return pattern
-}
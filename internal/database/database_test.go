@@ -1,11 +1,19 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/victor/stormindexer/internal/collation"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/noise"
+	"github.com/victor/stormindexer/internal/perf"
+	"github.com/victor/stormindexer/pkg/filter"
 )
 
 func setupTestDB(t *testing.T) (*DB, string) {
@@ -29,6 +37,81 @@ func TestNewDB(t *testing.T) {
 	}
 }
 
+func TestNewDB_Memory(t *testing.T) {
+	db, err := NewDB(Memory)
+	if err != nil {
+		t.Fatalf("Failed to open an in-memory database: %v", err)
+	}
+	defer db.Close()
+	other, err := NewDB(Memory)
+	if err != nil {
+		t.Fatalf("Failed to open an in-memory database: %v", err)
+	}
+	defer other.Close()
+
+	if !db.InMemory() {
+		t.Error("Expected the database to be in memory")
+	}
+	now := time.Now()
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Memory", RootPath: "/mem", CreatedAt: now, MachineID: "machine1"})
+
+	// Reads while a transaction is open, as UpsertFiles does, and after the
+	// pool dropped its idle connections, as Attach does
+	tx, _ := db.conn.Begin()
+	tx.Exec(`UPDATE indexes SET location = 'shelf' WHERE id = 'idx'`)
+	if _, err := db.GetIndex("idx"); err != nil {
+		t.Errorf("Expected to read during a write, got %v", err)
+	}
+	tx.Commit()
+	db.conn.SetMaxIdleConns(0)
+	db.conn.SetMaxIdleConns(2)
+	if index, err := db.GetIndex("idx"); err != nil || index.Location != "shelf" {
+		t.Errorf("Expected the index to outlive idle connections, got %v", err)
+	}
+
+	if indexes, _ := other.ListIndexes(); len(indexes) != 0 {
+		t.Errorf("Expected in-memory databases to be private, got %d indexes", len(indexes))
+	}
+
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	if err := db.BackupTo(backup); err != nil {
+		t.Fatalf("BackupTo failed: %v", err)
+	}
+	restored, err := NewDB(backup)
+	if err != nil {
+		t.Fatalf("Failed to open the backup: %v", err)
+	}
+	defer restored.Close()
+	if _, err := restored.GetIndex("idx"); err != nil {
+		t.Errorf("Expected the backup to hold the index, got %v", err)
+	}
+}
+
+func TestNewDB_SharedMemory(t *testing.T) {
+	path := SharedMemory(t.Name())
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open a shared in-memory database: %v", err)
+	}
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Shared", RootPath: "/mem", CreatedAt: time.Now(), MachineID: "machine1"})
+
+	other, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open a shared in-memory database: %v", err)
+	}
+	if _, err := other.GetIndex("idx"); err != nil {
+		t.Errorf("Expected handles of the same name to share the catalog, got %v", err)
+	}
+
+	db.Close()
+	other.Close()
+	db, _ = NewDB(path)
+	defer db.Close()
+	if indexes, _ := db.ListIndexes(); len(indexes) != 0 {
+		t.Errorf("Expected the catalog to be freed with its last handle, got %d indexes", len(indexes))
+	}
+}
+
 func TestCreateIndex(t *testing.T) {
 	db, _ := setupTestDB(t)
 	defer db.Close()
@@ -59,6 +142,11 @@ func TestCreateIndex(t *testing.T) {
 	if retrieved.RootPath != index.RootPath {
 		t.Errorf("Expected root path %s, got %s", index.RootPath, retrieved.RootPath)
 	}
+
+	invalid := &models.Index{ID: "test-index-2", Name: "two\nlines", RootPath: "/test/other", CreatedAt: time.Now()}
+	if err := db.CreateIndex(invalid); err == nil {
+		t.Error("Expected an error for a name with a newline")
+	}
 }
 
 func TestGetIndex_NotFound(t *testing.T) {
@@ -264,6 +352,41 @@ func TestDeleteFile(t *testing.T) {
 	}
 }
 
+func TestSince_MixedZones(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Index", RootPath: "/idx", CreatedAt: time.Now(), MachineID: "m"})
+
+	// Stored with their own offsets: berlin.txt before since, west.txt after
+	berlin := time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC).In(time.FixedZone("", 2*3600))
+	west := time.Date(2026, 10, 1, 1, 0, 0, 0, time.UTC).In(time.FixedZone("", -5*3600))
+	for name, scanned := range map[string]time.Time{"berlin.txt": berlin, "west.txt": west} {
+		db.UpsertFile(&models.FileEntry{Path: "/idx/" + name, RelativePath: name, IndexID: "idx", ModTime: scanned, LastScanned: scanned})
+		db.conn.Exec(`INSERT INTO removed_files (path, relative_path, index_id, removed_at) VALUES (?, ?, 'idx', ?)`,
+			"/idx/gone-"+name, "gone-"+name, scanned)
+	}
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC).In(time.FixedZone("", 9*3600))
+
+	var changed []string
+	if err := db.EachFileSince("idx", since, func(f *models.FileEntry) error {
+		changed = append(changed, f.RelativePath)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachFileSince failed: %v", err)
+	}
+	if strings.Join(changed, ",") != "west.txt" {
+		t.Errorf("Expected only west.txt to be changed since, got %v", changed)
+	}
+
+	removed, err := db.ListRemovedFiles("idx", since)
+	if err != nil {
+		t.Fatalf("ListRemovedFiles failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0].RelativePath != "gone-west.txt" {
+		t.Errorf("Expected only gone-west.txt to be removed since, got %v", removed)
+	}
+}
+
 func TestUpdateIndexStats(t *testing.T) {
 	db, _ := setupTestDB(t)
 	defer db.Close()
@@ -360,3 +483,773 @@ func TestFindFilesByChecksum(t *testing.T) {
 	}
 }
 
+
+func TestGetRedundancyStats(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "old-drive", Name: "Old", RootPath: "/old", CreatedAt: time.Now(), MachineID: "machine1"})
+	db.CreateIndex(&models.Index{ID: "nas", Name: "NAS", RootPath: "/nas", CreatedAt: time.Now(), MachineID: "machine1"})
+
+	files := []*models.FileEntry{
+		{Path: "/old/a.jpg", RelativePath: "a.jpg", Size: 300, Checksum: "aaa", IndexID: "old-drive"},
+		{Path: "/old/b.jpg", RelativePath: "b.jpg", Size: 200, Checksum: "bbb", IndexID: "old-drive"},
+		{Path: "/old/c.jpg", RelativePath: "c.jpg", Size: 50, IndexID: "old-drive"},
+		{Path: "/nas/photos/a.jpg", RelativePath: "photos/a.jpg", Size: 300, Checksum: "aaa", IndexID: "nas"},
+		{Path: "/nas/photos/a2.jpg", RelativePath: "photos/a2.jpg", Size: 300, Checksum: "aaa", IndexID: "nas"},
+	}
+	for _, f := range files {
+		f.ModTime = time.Now()
+		f.LastScanned = time.Now()
+		if err := db.UpsertFile(f); err != nil {
+			t.Fatalf("Failed to upsert file: %v", err)
+		}
+	}
+
+	stats, err := db.GetRedundancyStats("old-drive")
+	if err != nil {
+		t.Fatalf("Failed to get redundancy stats: %v", err)
+	}
+
+	if stats.HashedFiles != 2 || stats.HashedBytes != 500 {
+		t.Errorf("Expected 2 hashed files / 500 bytes, got %d / %d", stats.HashedFiles, stats.HashedBytes)
+	}
+	if stats.RedundantFiles != 1 || stats.RedundantBytes != 300 {
+		t.Errorf("Expected 1 redundant file / 300 bytes, got %d / %d", stats.RedundantFiles, stats.RedundantBytes)
+	}
+}
+
+func TestGetUniqueContent(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "old-drive", Name: "Old", RootPath: "/old", CreatedAt: time.Now(), MachineID: "machine1"})
+	db.CreateIndex(&models.Index{ID: "nas", Name: "NAS", RootPath: "/nas", CreatedAt: time.Now(), MachineID: "machine1"})
+
+	files := []*models.FileEntry{
+		{Path: "/old/a.jpg", RelativePath: "a.jpg", Size: 300, Checksum: "aaa", IndexID: "old-drive"},
+		{Path: "/old/b.jpg", RelativePath: "b.jpg", Size: 200, Checksum: "bbb", IndexID: "old-drive"},
+		{Path: "/old/c.jpg", RelativePath: "c.jpg", Size: 50, IndexID: "old-drive"},
+		{Path: "/old/link.jpg", RelativePath: "link.jpg", Size: 5, LinkTarget: "a.jpg", IndexID: "old-drive"},
+		{Path: "/nas/photos/a.jpg", RelativePath: "photos/a.jpg", Size: 300, Checksum: "aaa", IndexID: "nas"},
+		{Path: "/nas/photos/a2.jpg", RelativePath: "photos/a2.jpg", Size: 300, Checksum: "aaa", IndexID: "nas"},
+	}
+	for _, f := range files {
+		f.ModTime = time.Now()
+		f.LastScanned = time.Now()
+		if err := db.UpsertFile(f); err != nil {
+			t.Fatalf("Failed to upsert file: %v", err)
+		}
+	}
+
+	content, err := db.GetUniqueContent()
+	if err != nil {
+		t.Fatalf("Failed to get unique content: %v", err)
+	}
+	if content.UniqueFiles != 2 || content.UniqueBytes != 500 {
+		t.Errorf("Expected 2 unique files / 500 bytes, got %d / %d", content.UniqueFiles, content.UniqueBytes)
+	}
+	if content.UnknownFiles != 1 || content.UnknownBytes != 50 {
+		t.Errorf("Expected 1 unknown file / 50 bytes, got %d / %d", content.UnknownFiles, content.UnknownBytes)
+	}
+}
+
+func TestColdDirsAndAgeDistribution(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Index", RootPath: "/idx", CreatedAt: now, MachineID: "m"})
+	for rel, age := range map[string]int{
+		"archive/2015/a.raw": 9,
+		"archive/2016/b.raw": 8,
+		"projects/old.doc":   4,
+		"projects/new.doc":   0,
+		"notes.txt":          6,
+	} {
+		db.UpsertFile(&models.FileEntry{
+			Path: "/idx/" + rel, RelativePath: rel, Size: 100, ModTime: now.AddDate(-age, 0, -1),
+			IndexID: "idx", LastScanned: now,
+		})
+	}
+	// Imported from a listing without dates
+	db.UpsertFile(&models.FileEntry{Path: "/idx/undated/c.bin", RelativePath: "undated/c.bin", Size: 1000, IndexID: "idx", LastScanned: now})
+
+	dirs, err := db.ColdDirs("idx", now.AddDate(-3, 0, 0))
+	if err != nil {
+		t.Fatalf("ColdDirs failed: %v", err)
+	}
+	if len(dirs) != 3 {
+		t.Fatalf("Expected 3 cold directories, got %d", len(dirs))
+	}
+	if dirs[0].Dir != "archive" || dirs[0].Files != 2 || dirs[0].Size != 200 {
+		t.Errorf("Expected archive with 2 files / 200 bytes first, got %+v", dirs[0])
+	}
+	if dirs[1].Dir != "" || dirs[2].Dir != "projects" {
+		t.Errorf("Expected root files then projects, got %q and %q", dirs[1].Dir, dirs[2].Dir)
+	}
+
+	buckets, err := db.AgeDistribution("idx", now, []int{1, 5})
+	if err != nil {
+		t.Fatalf("AgeDistribution failed: %v", err)
+	}
+	counts := []int64{buckets[0].Files, buckets[1].Files, buckets[2].Files}
+	if counts[0] != 1 || counts[1] != 1 || counts[2] != 3 {
+		t.Errorf("Expected 1/1/3 files in < 1y, 1-5y, > 5y, got %v", counts)
+	}
+	if buckets[1].Label != "1-5y" {
+		t.Errorf("Expected label 1-5y, got %s", buckets[1].Label)
+	}
+
+	// Cutoffs compare instants, whatever zone a time was stored in
+	cutoff := now.AddDate(-3, 0, 0)
+	db.CreateIndex(&models.Index{ID: "zoned", Name: "Zoned", RootPath: "/zoned", CreatedAt: now, MachineID: "m"})
+	db.UpsertFile(&models.FileEntry{
+		Path: "/zoned/east.raw", RelativePath: "east.raw", Size: 100, IndexID: "zoned", LastScanned: now,
+		ModTime: cutoff.Add(-time.Hour).In(time.FixedZone("", 5*3600)),
+	})
+	db.UpsertFile(&models.FileEntry{
+		Path: "/zoned/west.raw", RelativePath: "west.raw", Size: 100, IndexID: "zoned", LastScanned: now,
+		ModTime: cutoff.Add(time.Hour),
+	})
+	dirs, err = db.ColdDirs("zoned", cutoff)
+	if err != nil {
+		t.Fatalf("ColdDirs failed: %v", err)
+	}
+	if len(dirs) != 1 || dirs[0].Files != 1 {
+		t.Errorf("Expected only east.raw to be cold, got %+v", dirs)
+	}
+}
+
+func TestUpsertFile_KeepsFirstSeen(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Index", RootPath: "/idx", CreatedAt: time.Now(), MachineID: "m"})
+
+	firstScan := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	file := &models.FileEntry{Path: "/idx/a", RelativePath: "a", Size: 1, ModTime: firstScan, IndexID: "idx", LastScanned: firstScan}
+	db.UpsertFile(file)
+
+	file.Size = 2
+	file.LastScanned = time.Now()
+	db.UpsertFile(file)
+
+	stored, err := db.GetFile("/idx/a", "idx")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if !stored.FirstSeen.Equal(firstScan) {
+		t.Errorf("Expected first seen %v to survive rescans, got %v", firstScan, stored.FirstSeen)
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	db.UpsertFile(&models.FileEntry{Path: "/idx/b", RelativePath: "b", ModTime: firstScan, IndexID: "idx", LastScanned: time.Now()})
+	results, err := db.FindFiles(FindOptions{FirstSeenSince: &since})
+	if err != nil {
+		t.Fatalf("FindFiles failed: %v", err)
+	}
+	if len(results) != 1 || results[0].RelativePath != "b" {
+		t.Errorf("Expected only b to be recent, got %d results", len(results))
+	}
+}
+
+func TestFindFiles_PatternsAndSizes(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "index-1", Name: "Index 1", RootPath: "/path1", CreatedAt: time.Now(), MachineID: "machine1"})
+	for rel, size := range map[string]int64{"my_file.txt": 10, "myXfile.txt": 0, "100%.txt": 5, "docs/100 percent.txt": 20} {
+		db.UpsertFile(&models.FileEntry{
+			Path: "/path1/" + rel, RelativePath: rel, Size: size, ModTime: time.Now(),
+			IndexID: "index-1", LastScanned: time.Now(),
+		})
+	}
+
+	tests := []struct {
+		opts FindOptions
+		want int
+	}{
+		{FindOptions{NamePattern: "my_file.txt"}, 1},
+		{FindOptions{NamePattern: "my?file.txt"}, 2},
+		{FindOptions{NamePattern: "100%*"}, 1},
+		{FindOptions{NamePattern: "*100*"}, 2},
+		{FindOptions{MaxSize: int64Ptr(0)}, 1},
+		{FindOptions{MinSize: int64Ptr(10)}, 2},
+	}
+	for _, tt := range tests {
+		results, err := db.FindFiles(tt.opts)
+		if err != nil {
+			t.Fatalf("FindFiles failed: %v", err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("Expected %d results for %+v, got %d", tt.want, tt.opts, len(results))
+		}
+	}
+}
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func TestSetRecorder_TimesStatements(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	recorder := perf.New()
+	db.SetRecorder(recorder)
+
+	index := &models.Index{ID: "idx", Name: "Test", RootPath: "/test", CreatedAt: time.Now(), MachineID: "m"}
+	if err := db.CreateIndex(index); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := db.UpsertFiles([]*models.FileEntry{
+		{Path: "/test/a", RelativePath: "a", ModTime: time.Now(), IndexID: "idx", LastScanned: time.Now()},
+		{Path: "/test/b", RelativePath: "b", ModTime: time.Now(), IndexID: "idx", LastScanned: time.Now()},
+	}); err != nil {
+		t.Fatalf("Failed to upsert files: %v", err)
+	}
+	if _, err := db.ListFiles("idx"); err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+
+	entry := recorder.Entry("test", nil, false)
+	if entry.Statements < 4 {
+		t.Errorf("Expected at least 4 statements, got %d", entry.Statements)
+	}
+	upserts := 0
+	for _, q := range entry.Slowest {
+		if strings.HasPrefix(q.SQL, "INSERT INTO files") {
+			upserts = q.Count
+		}
+	}
+	if upserts != 2 {
+		t.Errorf("Expected 2 timed prepared upserts, got %d", upserts)
+	}
+}
+
+func TestSetIndexLocation(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	index := &models.Index{ID: "idx", Name: "Archive", RootPath: "/archive", CreatedAt: time.Now(), MachineID: "m"}
+	if err := db.CreateIndex(index); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	if err := db.SetIndexLocation("idx", "shelf B, box 3"); err != nil {
+		t.Fatalf("SetIndexLocation failed: %v", err)
+	}
+	got, err := db.FindIndexByNameOrID("Archive")
+	if err != nil {
+		t.Fatalf("Failed to get index: %v", err)
+	}
+	if got.Location != "shelf B, box 3" {
+		t.Errorf("Expected location 'shelf B, box 3', got %q", got.Location)
+	}
+
+	if err := db.SetIndexLocation("missing", "shelf A"); err == nil {
+		t.Error("Expected error for unknown index")
+	}
+}
+
+func TestLoans(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	index := &models.Index{ID: "idx", Name: "Team Drive 1", RootPath: "/team1", CreatedAt: time.Now(), MachineID: "m"}
+	if err := db.CreateIndex(index); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	due := time.Now().Add(-time.Hour).Truncate(time.Second)
+	loan := &models.Loan{IndexID: "idx", Borrower: "Sam", CheckedOutAt: time.Now().Add(-48 * time.Hour), DueAt: due}
+	if err := db.CheckOut(loan); err != nil {
+		t.Fatalf("CheckOut failed: %v", err)
+	}
+	if err := db.CheckOut(&models.Loan{IndexID: "idx", Borrower: "Kim", CheckedOutAt: time.Now()}); !errors.Is(err, ErrCheckedOut) {
+		t.Errorf("Expected ErrCheckedOut, got %v", err)
+	}
+
+	active, err := db.ActiveLoan("idx")
+	if err != nil {
+		t.Fatalf("ActiveLoan failed: %v", err)
+	}
+	if active.Borrower != "Sam" || !active.DueAt.Equal(due) {
+		t.Errorf("Expected loan to Sam due %v, got %s due %v", due, active.Borrower, active.DueAt)
+	}
+	if !active.Overdue(time.Now()) {
+		t.Error("Expected loan to be overdue")
+	}
+
+	if _, err := db.CheckIn("idx", time.Now()); err != nil {
+		t.Fatalf("CheckIn failed: %v", err)
+	}
+	if _, err := db.CheckIn("idx", time.Now()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for a drive not checked out, got %v", err)
+	}
+
+	open, _ := db.ListLoans(false)
+	all, _ := db.ListLoans(true)
+	if len(open) != 0 || len(all) != 1 {
+		t.Errorf("Expected 0 open and 1 total loans, got %d and %d", len(open), len(all))
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+	db.EnableQueryCache(2)
+
+	db.CreateIndex(&models.Index{ID: "idx1", Name: "Index 1", RootPath: "/a", CreatedAt: time.Now()})
+	add := func(name string) {
+		db.UpsertFile(&models.FileEntry{Path: "/a/" + name, RelativePath: name, IndexID: "idx1", ModTime: time.Now(), LastScanned: time.Now()})
+	}
+	add("one.txt")
+	db.UpdateIndexStats("idx1")
+
+	find := func(opts FindOptions) int {
+		files, err := db.FindFiles(opts)
+		if err != nil {
+			t.Fatalf("FindFiles failed: %v", err)
+		}
+		return len(files)
+	}
+	if n := find(FindOptions{FileType: "file"}); n != 1 {
+		t.Fatalf("Expected 1 file, got %d", n)
+	}
+
+	// Files written during a scan are not seen until the scan completes
+	add("two.txt")
+	if n := find(FindOptions{FileType: "file"}); n != 1 {
+		t.Errorf("Expected the cached result, got %d files", n)
+	}
+	if opts := (FindOptions{FileType: "directory", IndexIDs: []string{"b", "a"}}); opts.cacheKey() != (FindOptions{FileType: "dir", IndexIDs: []string{"a", "b"}}).cacheKey() {
+		t.Errorf("Expected equivalent options to share a cache key")
+	}
+
+	db.UpdateIndexStats("idx1")
+	if n := find(FindOptions{FileType: "file"}); n != 2 {
+		t.Errorf("Expected 2 files after the scan completed, got %d", n)
+	}
+
+	add("three.txt")
+	db.InvalidateQueryCache()
+	if n := find(FindOptions{FileType: "file"}); n != 3 {
+		t.Errorf("Expected 3 files after invalidation, got %d", n)
+	}
+
+	// The least recently used query is evicted
+	find(FindOptions{NamePattern: "one*"})
+	find(FindOptions{NamePattern: "two*"})
+	if len(db.cache.entries) != 2 {
+		t.Errorf("Expected 2 cached queries, got %d", len(db.cache.entries))
+	}
+	if _, ok := db.cache.entries[(FindOptions{FileType: "file"}).cacheKey()]; ok {
+		t.Errorf("Expected the oldest query to be evicted")
+	}
+}
+
+func TestFindFiles_Where(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	old := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	db.CreateIndex(&models.Index{ID: "nas", Name: "NAS", RootPath: "/nas", CreatedAt: time.Now()})
+	db.CreateIndex(&models.Index{ID: "usb", Name: "USB1", RootPath: "/usb", CreatedAt: time.Now()})
+	db.CreateIndex(&models.Index{ID: "other", Name: "Other", RootPath: "/other", CreatedAt: time.Now()})
+	for _, f := range []*models.FileEntry{
+		{Path: "/nas/movies/big.mp4", RelativePath: "movies/big.mp4", IndexID: "nas", Size: 2 << 30, ModTime: old, Checksum: "aaa"},
+		{Path: "/usb/big.MP4", RelativePath: "big.MP4", IndexID: "usb", Size: 3 << 30, ModTime: old, Checksum: "aaa"},
+		{Path: "/usb/new.mp4", RelativePath: "new.mp4", IndexID: "usb", Size: 3 << 30, ModTime: time.Now()},
+		{Path: "/nas/small.mp4", RelativePath: "small.mp4", IndexID: "nas", Size: 10, ModTime: old},
+		{Path: "/other/big.mp4", RelativePath: "big.mp4", IndexID: "other", Size: 2 << 30, ModTime: old},
+		{Path: "/nas/mp4/notes.txt", RelativePath: "mp4/notes.txt", IndexID: "nas", Size: 2 << 30, ModTime: old},
+		// 2020-01-01 01:30 UTC, stored with its own offset
+		{Path: "/other/late.mp4", RelativePath: "late.mp4", IndexID: "other", Size: 100, ModTime: time.Date(2019, 12, 31, 23, 30, 0, 0, time.FixedZone("", -2*3600))},
+	} {
+		f.LastScanned = time.Now()
+		db.UpsertFile(f)
+	}
+
+	tests := map[string][]string{
+		"ext=mp4 and size>1G and (index=NAS or index=USB1) and mtime<2020-01-01": {"/nas/movies/big.mp4", "/usb/big.MP4"},
+		"name=big* and not index=nas":   {"/other/big.mp4", "/usb/big.MP4"},
+		"dup=true":                      {"/nas/movies/big.mp4", "/usb/big.MP4"},
+		"dup!=false":                    {"/nas/movies/big.mp4", "/usb/big.MP4"},
+		"dup!=true and index=nas":       {"/nas/mp4/notes.txt", "/nas/small.mp4"},
+		"dir=mp4 or dir=movies":         {"/nas/movies/big.mp4", "/nas/mp4/notes.txt"},
+		"size<=10 or checksum!=aaa ext=txt": {"/nas/mp4/notes.txt", "/nas/small.mp4"},
+		"index=Other and mtime<2020-01-01":  {"/other/big.mp4"},
+		"index=Other and mtime>=2020-01-01": {"/other/late.mp4"},
+	}
+	for input, want := range tests {
+		where, err := filter.ParseExpr(input, time.Now())
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) failed: %v", input, err)
+		}
+		results, err := db.FindFiles(FindOptions{Where: where})
+		if err != nil {
+			t.Fatalf("FindFiles(%q) failed: %v", input, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Path)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: Expected %v, got %v", input, want, got)
+		}
+	}
+}
+
+func TestFindFiles_Sort(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Music", RootPath: "/music", CreatedAt: time.Now(), MachineID: "machine1"})
+	db.CreateIndex(&models.Index{ID: "compact", Name: "music 2", RootPath: "/compact", CreatedAt: time.Now(), MachineID: "machine1", Compact: true})
+	var entries []*models.FileEntry
+	for _, name := range []string{"track10.mp3", "track2.mp3", "Zoo.mp3", "album.mp3"} {
+		entries = append(entries,
+			&models.FileEntry{Path: "/music/" + name, RelativePath: name, IndexID: "idx", ModTime: time.Now(), LastScanned: time.Now()},
+			&models.FileEntry{Path: "/compact/" + name, RelativePath: name, IndexID: "compact", ModTime: time.Now(), LastScanned: time.Now()})
+	}
+	db.UpsertFiles(entries)
+	db.SetLocale("en_US.UTF-8")
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{"", []string{"/music/Zoo.mp3", "/music/album.mp3", "/music/track10.mp3", "/music/track2.mp3"}},
+		{collation.Natural, []string{"/music/Zoo.mp3", "/music/album.mp3", "/music/track2.mp3", "/music/track10.mp3"}},
+		{collation.Locale, []string{"/music/album.mp3", "/music/track2.mp3", "/music/track10.mp3", "/music/Zoo.mp3"}},
+	}
+	for _, tt := range tests {
+		results, err := db.FindFiles(FindOptions{Sort: tt.order})
+		if err != nil {
+			t.Fatalf("FindFiles failed: %v", err)
+		}
+		var paths []string
+		for _, result := range results {
+			paths = append(paths, result.Path)
+		}
+		// Byte order puts "Music" before "music 2" and so does the locale
+		if len(paths) != 8 || strings.Join(paths[:4], ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("%q: expected %v first, got %v", tt.order, tt.expected, paths)
+		}
+
+		files, err := db.ListFilesSorted("compact", tt.order)
+		if err != nil {
+			t.Fatalf("ListFilesSorted failed: %v", err)
+		}
+		for i, file := range files {
+			if expected := strings.Replace(tt.expected[i], "/music/", "/compact/", 1); file.Path != expected {
+				t.Errorf("%q: expected %s at %d in the compact index, got %s", tt.order, expected, i, file.Path)
+			}
+		}
+	}
+}
+
+func TestPins(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+	db.EnableQueryCache(8)
+
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Photos", RootPath: "/photos", CreatedAt: time.Now(), MachineID: "machine1"})
+	db.CreateIndex(&models.Index{ID: "compact", Name: "Photos 2", RootPath: "/compact", CreatedAt: time.Now(), MachineID: "machine1", Compact: true})
+	var entries []*models.FileEntry
+	for _, rel := range []string{"2019/a.jpg", "2019/b.jpg", "2019-old/c.jpg", "d.jpg"} {
+		entries = append(entries,
+			&models.FileEntry{Path: "/photos/" + rel, RelativePath: rel, IndexID: "idx", ModTime: time.Now(), LastScanned: time.Now()},
+			&models.FileEntry{Path: "/compact/" + rel, RelativePath: rel, IndexID: "compact", ModTime: time.Now(), LastScanned: time.Now()})
+	}
+	db.UpsertFiles(entries)
+
+	pinned := func() []string {
+		results, err := db.FindFiles(FindOptions{})
+		if err != nil {
+			t.Fatalf("FindFiles failed: %v", err)
+		}
+		var paths []string
+		for _, result := range results {
+			if result.Pinned {
+				paths = append(paths, result.Path)
+			}
+		}
+		return paths
+	}
+	if paths := pinned(); len(paths) != 0 {
+		t.Fatalf("Expected no pinned files, got %v", paths)
+	}
+
+	for _, pin := range []*models.Pin{
+		{IndexID: "idx", RelativePath: "2019", Note: "wedding"},
+		{IndexID: "compact", RelativePath: "d.jpg"},
+		{IndexID: "idx", RelativePath: "2019", Note: "originals"},
+	} {
+		pin.CreatedAt = time.Now()
+		if err := db.AddPin(pin); err != nil {
+			t.Fatalf("AddPin failed: %v", err)
+		}
+	}
+
+	expected := "/photos/2019/a.jpg,/photos/2019/b.jpg,/compact/d.jpg"
+	if paths := strings.Join(pinned(), ","); paths != expected {
+		t.Errorf("Expected %s to be pinned, got %s", expected, paths)
+	}
+
+	pins, err := db.ListPins("idx")
+	if err != nil {
+		t.Fatalf("ListPins failed: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Note != "originals" || pins[0].CreatedAt.IsZero() {
+		t.Errorf("Expected the repinned directory with its new note, got %+v", pins)
+	}
+	if pins.Covering("2019/a.jpg") == nil || pins.Covering("2019-old/c.jpg") != nil {
+		t.Error("Expected the pin to cover the files below the directory only")
+	}
+
+	removed, err := db.RemovePin("idx", "2019")
+	if err != nil || !removed {
+		t.Fatalf("Expected the pin to be removed, got %v (%v)", removed, err)
+	}
+	if removed, _ := db.RemovePin("idx", "2019"); removed {
+		t.Error("Expected removing a missing pin to report false")
+	}
+	if paths := strings.Join(pinned(), ","); paths != "/compact/d.jpg" {
+		t.Errorf("Expected only /compact/d.jpg to stay pinned, got %s", paths)
+	}
+
+	if err := db.DeleteIndex("compact"); err != nil {
+		t.Fatalf("DeleteIndex failed: %v", err)
+	}
+	if pins, _ := db.ListPins(""); len(pins) != 0 {
+		t.Errorf("Expected the pins of a removed index to be removed, got %d", len(pins))
+	}
+}
+
+func TestFindIndexByIDPrefix(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	for _, index := range []*models.Index{
+		{ID: "f0bd0c0e1a2b3c4d", Name: "NAS", RootPath: "/nas", CreatedAt: time.Now(), MachineID: "m"},
+		{ID: "f0bd0c0e1a2b9999", Name: "USB1", RootPath: "/usb1", CreatedAt: time.Now(), MachineID: "m"},
+		{ID: "abc", Name: "Short", RootPath: "/short", CreatedAt: time.Now(), MachineID: "m"},
+	} {
+		if err := db.CreateIndex(index); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	got, err := db.FindIndexByNameOrID("f0bd0c0e1a2b3")
+	if err != nil {
+		t.Fatalf("Failed to find index by prefix: %v", err)
+	}
+	if got.Name != "NAS" {
+		t.Errorf("Expected NAS, got %s", got.Name)
+	}
+
+	_, err = db.FindIndexByNameOrID("f0bd")
+	if err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguous prefix error, got %v", err)
+	}
+
+	if got, err := db.FindIndexByNameOrID("abc"); err != nil || got.Name != "Short" {
+		t.Errorf("Expected exact short ID to find Short, got %v", err)
+	}
+
+	if _, err := db.FindIndexByNameOrID("f0b"); err == nil {
+		t.Error("Expected error for a prefix shorter than the minimum")
+	}
+}
+
+func TestFindIndexByPath(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	for _, index := range []*models.Index{
+		{ID: "backup", Name: "Backup", RootPath: "/Volumes/Backup", CreatedAt: time.Now(), MachineID: "m"},
+		{ID: "photos", Name: "Photos", RootPath: "/Volumes/Backup/photos", CreatedAt: time.Now(), MachineID: "m"},
+		{ID: "nas", Name: "NAS", RootPath: `\\nas\share`, CreatedAt: time.Now(), MachineID: "m"},
+	} {
+		if err := db.CreateIndex(index); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	tests := map[string]string{
+		"/Volumes/Backup":              "Backup",
+		"/Volumes/Backup/":             "Backup",
+		"/Volumes/Backup/docs/2024":    "Backup",
+		"/Volumes/Backup/photos/trips": "Photos",
+		`\\NAS\share\music`:            "NAS",
+	}
+	for path, want := range tests {
+		got, err := db.FindIndexByNameOrID(path)
+		if err != nil {
+			t.Errorf("Failed to find index by path %s: %v", path, err)
+			continue
+		}
+		if got.Name != want {
+			t.Errorf("Expected %s for %s, got %s", want, path, got.Name)
+		}
+	}
+
+	if _, err := db.FindIndexByNameOrID("/Volumes/BackupOld"); err == nil {
+		t.Error("Expected error for a path outside every index")
+	}
+
+	other := &models.Index{ID: "backup-2", Name: "Backup on laptop", RootPath: "/Volumes/Backup", CreatedAt: time.Now(), MachineID: "laptop"}
+	if err := db.CreateIndex(other); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if _, err := db.FindIndexByPath("/Volumes/Backup"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguous path error, got %v", err)
+	}
+}
+
+func TestCompactIndex(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "plain", Name: "Plain", RootPath: "/plain", CreatedAt: time.Now(), MachineID: "machine1"})
+	db.CreateIndex(&models.Index{ID: "compact", Name: "Compact", RootPath: "/compact", CreatedAt: time.Now(), MachineID: "machine1", Compact: true})
+	now := time.Now()
+	entries := []*models.FileEntry{
+		{Path: "/compact", RelativePath: ".", IndexID: "compact", IsDirectory: true},
+		{Path: "/compact/docs", RelativePath: "docs", IndexID: "compact", IsDirectory: true},
+		{Path: "/compact/docs/a.txt", RelativePath: "docs/a.txt", Size: 10, Checksum: "same", IndexID: "compact"},
+		{Path: "/compact/docs/b.txt", RelativePath: "docs/b.txt", Size: 20, IndexID: "compact"},
+		{Path: "/compact/top.txt", RelativePath: "top.txt", Size: 5, IndexID: "compact"},
+		{Path: "/plain/a.txt", RelativePath: "a.txt", Size: 10, Checksum: "same", IndexID: "plain"},
+	}
+	for _, entry := range entries {
+		entry.ModTime, entry.LastScanned = now, now
+	}
+	if err := db.UpsertFiles(entries); err != nil {
+		t.Fatalf("UpsertFiles failed: %v", err)
+	}
+
+	var stored int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM files WHERE index_id = 'compact'`).Scan(&stored)
+	if stored != 0 {
+		t.Errorf("Expected no rows in files for a compact index, got %d", stored)
+	}
+
+	files, err := db.ListFiles("compact")
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if len(files) != 5 {
+		t.Fatalf("Expected 5 files, got %d", len(files))
+	}
+	for i, file := range files {
+		if file.Path != entries[i].Path || file.RelativePath != entries[i].RelativePath {
+			t.Errorf("Expected %s (%s), got %s (%s)", entries[i].Path, entries[i].RelativePath, file.Path, file.RelativePath)
+		}
+	}
+
+	for _, path := range []string{"/compact", "/compact/docs/a.txt"} {
+		if file, err := db.GetFile(path, "compact"); err != nil || file.Path != path {
+			t.Errorf("Expected to get %s, got %v", path, err)
+		}
+	}
+	if matches, _ := db.FindFilesByChecksum("same"); len(matches) != 2 {
+		t.Errorf("Expected 2 files with the checksum across both indexes, got %d", len(matches))
+	}
+
+	seen := now.Add(time.Hour).Truncate(time.Second)
+	if err := db.TouchFiles("compact", []string{"/compact/top.txt"}, seen); err != nil {
+		t.Fatalf("TouchFiles failed: %v", err)
+	}
+	if file, _ := db.GetFile("/compact/top.txt", "compact"); !file.LastSeen.Equal(seen) {
+		t.Errorf("Expected last seen %v, got %v", seen, file.LastSeen)
+	}
+
+	if err := db.DeleteFile("/compact/docs/b.txt", "compact"); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	removed, _ := db.ListRemovedFiles("compact", time.Time{})
+	if len(removed) != 1 || removed[0].RelativePath != "docs/b.txt" {
+		t.Errorf("Expected the tombstone of docs/b.txt, got %v", removed)
+	}
+
+	if err := db.UpdateIndexStats("compact"); err != nil {
+		t.Fatalf("UpdateIndexStats failed: %v", err)
+	}
+	index, _ := db.GetIndex("compact")
+	if index.TotalFiles != 4 || index.TotalSize != 15 {
+		t.Errorf("Expected 4 entries of 15 bytes, got %d of %d", index.TotalFiles, index.TotalSize)
+	}
+}
+
+func TestSplitCompact(t *testing.T) {
+	tests := []struct {
+		path, rel              string
+		dir, relativeDir, name string
+	}{
+		{"/r/docs/a.txt", "docs/a.txt", "/r/docs/", "docs/", "a.txt"},
+		{"/r/a.txt", "a.txt", "/r/", "", "a.txt"},
+		{"/r", ".", "/r", ".", ""},
+		{`C:\r\docs\a.txt`, `docs\a.txt`, `C:\r\docs\`, `docs\`, "a.txt"},
+		{"/r/x/ab", "zab", "/r/x/ab", "zab", ""},
+	}
+	for _, tt := range tests {
+		dir, relativeDir, name := splitCompact(tt.path, tt.rel)
+		if dir != tt.dir || relativeDir != tt.relativeDir || name != tt.name {
+			t.Errorf("Expected %q %q %q for %s, got %q %q %q", tt.dir, tt.relativeDir, tt.name, tt.path, dir, relativeDir, name)
+		}
+	}
+}
+
+func TestExcludeNoise(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	db.CreateIndex(&models.Index{ID: "plain", Name: "Plain", RootPath: "/plain", CreatedAt: time.Now(), MachineID: "machine1"})
+	db.CreateIndex(&models.Index{ID: "compact", Name: "Compact", RootPath: "/compact", CreatedAt: time.Now(), MachineID: "machine1", Compact: true})
+	now := time.Now()
+	entries := []*models.FileEntry{
+		{Path: "/plain/a.txt", RelativePath: "a.txt", Size: 10, Checksum: "a", IndexID: "plain"},
+		{Path: "/plain/Thumbs.db", RelativePath: "Thumbs.db", Size: 100, Checksum: "t", IndexID: "plain"},
+		{Path: "/plain/app/node_modules/x.js", RelativePath: "app/node_modules/x.js", Size: 200, IndexID: "plain"},
+		{Path: "/compact/b.txt", RelativePath: "b.txt", Size: 20, Checksum: "b", IndexID: "compact"},
+		{Path: "/compact/node_modules/y.js", RelativePath: "node_modules/y.js", Size: 400, IndexID: "compact"},
+	}
+	for _, entry := range entries {
+		entry.ModTime, entry.LastScanned = now, now
+	}
+	if err := db.UpsertFiles(entries); err != nil {
+		t.Fatalf("UpsertFiles failed: %v", err)
+	}
+
+	classifier, _ := noise.New(noise.Builtin())
+	db.ExcludeNoise(classifier)
+
+	files, size, err := db.CountFiles("")
+	if err != nil {
+		t.Fatalf("CountFiles failed: %v", err)
+	}
+	if files != 2 || size != 30 {
+		t.Errorf("Expected 2 files of 30 bytes without noise, got %d of %d", files, size)
+	}
+	coverage, _ := db.GetChecksumCoverage("plain")
+	if coverage.Files != 1 || coverage.Hashed != 1 {
+		t.Errorf("Expected the coverage of 1 hashed file, got %d files, %d hashed", coverage.Files, coverage.Hashed)
+	}
+	found, _ := db.FindFiles(FindOptions{NamePattern: "*.js"})
+	if len(found) != 0 {
+		t.Errorf("Expected find to leave noise out, got %d files", len(found))
+	}
+
+	db.ExcludeNoise(nil)
+	if files, size, _ := db.CountFiles(""); files != 5 || size != 730 {
+		t.Errorf("Expected 5 files of 730 bytes with noise, got %d of %d", files, size)
+	}
+	if found, _ := db.FindFiles(FindOptions{NamePattern: "*.js"}); len(found) != 2 {
+		t.Errorf("Expected find to include noise again, got %d files", len(found))
+	}
+}
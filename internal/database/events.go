@@ -0,0 +1,125 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// EventFilter selects events from the event log
+type EventFilter struct {
+	// AfterID selects the events recorded after the event with this ID
+	AfterID int64
+	Since   time.Time
+	Kinds   []string
+	IndexID string
+	// Limit keeps only the most recent events; 0 returns all of them
+	Limit int
+}
+
+// RecordEvent appends an event to the event log and sets its ID
+func (db *DB) RecordEvent(event *models.Event) error {
+	query := `INSERT INTO events (kind, index_id, path, detail, occurred_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := db.conn.Exec(query, event.Kind, event.IndexID, event.Path, event.Detail, event.OccurredAt)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// RecordEvents appends several events to the event log in one transaction
+// and sets their IDs
+func (db *DB) RecordEvents(events []*models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO events (kind, index_id, path, detail, occurred_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, event := range events {
+		result, err := stmt.Exec(event.Kind, event.IndexID, event.Path, event.Detail, event.OccurredAt)
+		if err != nil {
+			return err
+		}
+		if event.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListEvents returns the events matching filter, oldest first
+func (db *DB) ListEvents(filter EventFilter) ([]*models.Event, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.AfterID > 0 {
+		conditions = append(conditions, `id > ?`)
+		args = append(args, filter.AfterID)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, timeCond("occurred_at", ">="))
+		args = append(args, filter.Since)
+	}
+	if len(filter.Kinds) > 0 {
+		conditions = append(conditions, `kind IN (?`+strings.Repeat(`, ?`, len(filter.Kinds)-1)+`)`)
+		for _, kind := range filter.Kinds {
+			args = append(args, kind)
+		}
+	}
+	if filter.IndexID != "" {
+		conditions = append(conditions, `index_id = ?`)
+		args = append(args, filter.IndexID)
+	}
+
+	query := `SELECT id, kind, index_id, path, detail, occurred_at FROM events`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	// Take the most recent events, then put them back in order
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		e := &models.Event{}
+		var occurredAt string
+		if err := rows.Scan(&e.ID, &e.Kind, &e.IndexID, &e.Path, &e.Detail, &occurredAt); err != nil {
+			return nil, err
+		}
+		e.OccurredAt, _ = time.Parse(time.RFC3339, occurredAt)
+		events = append(events, e)
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, rows.Err()
+}
+
+// PruneEvents deletes the events that occurred before a point in time and
+// returns how many were deleted
+func (db *DB) PruneEvents(before time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM events WHERE `+timeCond("occurred_at", "<"), before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/filter"
+)
+
+// baseName is registered as the SQL function base_name on every connection,
+// so expressions can match the last component of a relative path
+func baseName(p string) string {
+	return path.Base(p)
+}
+
+// exprSQL compiles a filter expression into a condition on the files table
+// aliased f joined with the indexes table aliased i
+func (db *DB) exprSQL(e filter.Expr) (string, []interface{}, error) {
+	switch e := e.(type) {
+	case *filter.And:
+		return db.binarySQL(e.Left, e.Right, "AND")
+	case *filter.Or:
+		return db.binarySQL(e.Left, e.Right, "OR")
+	case *filter.Not:
+		cond, args, err := db.exprSQL(e.Expr)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + cond + ")", args, nil
+	case *filter.Cond:
+		return db.condSQL(e)
+	}
+	return "", nil, fmt.Errorf("unsupported filter expression %T", e)
+}
+
+func (db *DB) binarySQL(left, right filter.Expr, op string) (string, []interface{}, error) {
+	l, largs, err := db.exprSQL(left)
+	if err != nil {
+		return "", nil, err
+	}
+	r, rargs, err := db.exprSQL(right)
+	if err != nil {
+		return "", nil, err
+	}
+	return "(" + l + " " + op + " " + r + ")", append(largs, rargs...), nil
+}
+
+func (db *DB) condSQL(c *filter.Cond) (string, []interface{}, error) {
+	like := func(pattern string) string {
+		return filter.PatternToLike(models.SanitizePattern(pattern))
+	}
+
+	var cond string
+	var args []interface{}
+	switch c.Field {
+	case "name":
+		cond, args = `base_name(f.relative_path) LIKE ? ESCAPE '\'`, []interface{}{like(c.Value)}
+	case "path":
+		cond, args = `f.relative_path LIKE ? ESCAPE '\'`, []interface{}{like(c.Value)}
+	case "dir":
+		pattern := like(c.Value)
+		cond = `(f.relative_path LIKE ? || '/%' ESCAPE '\'
+			OR f.relative_path LIKE '%/' || ? || '/%' ESCAPE '\'
+			OR f.relative_path LIKE '%/' || ? ESCAPE '\'
+			OR f.relative_path LIKE ? ESCAPE '\')`
+		args = []interface{}{pattern, pattern, pattern, pattern}
+	case "ext":
+		cond, args = `base_name(f.relative_path) LIKE ? ESCAPE '\'`, []interface{}{"%." + like(strings.TrimPrefix(c.Value, "."))}
+	case "index":
+		cond, args = `(i.name LIKE ? ESCAPE '\' OR i.id = ?)`, []interface{}{like(c.Value), c.Value}
+	case "checksum":
+		cond, args = "f.checksum = ?", []interface{}{strings.ToLower(c.Value)}
+	case "size":
+		return "f.size " + c.Op + " ?", []interface{}{c.Size}, nil
+	case "mtime":
+		return timeCond("f.mod_time", c.Op), []interface{}{c.Time}, nil
+	case "seen":
+		return timeCond("f.first_seen", c.Op), []interface{}{c.Time}, nil
+	case "type":
+		cond = map[string]string{
+			"file": "(f.is_directory = 0 AND f.link_target = '')",
+			"dir":  "f.is_directory = 1",
+			"link": "f.link_target != ''",
+		}[c.Value]
+	case "dup":
+		cond = `f.checksum IN (
+			SELECT checksum FROM ` + db.filesTable() + `
+			WHERE checksum != '' GROUP BY checksum HAVING COUNT(*) > 1
+		)`
+		if c.Value == "false" {
+			cond = "NOT " + cond
+		}
+	default:
+		return "", nil, fmt.Errorf("unsupported filter field %q", c.Field)
+	}
+
+	if c.Op == "!=" {
+		cond = "NOT (" + cond + ")"
+	}
+	return cond, args, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+const driveHealthColumns = "id, index_id, job_id, captured_at, device, model, serial, passed, reallocated_sectors, pending_sectors, uncorrectable_sectors, power_on_hours, temperature"
+
+// RecordDriveHealth stores a SMART capture and sets its ID
+func (db *DB) RecordDriveHealth(health *models.DriveHealth) error {
+	query := `
+	INSERT INTO drive_health (index_id, job_id, captured_at, device, model, serial, passed,
+		reallocated_sectors, pending_sectors, uncorrectable_sectors, power_on_hours, temperature)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.conn.Exec(query, health.IndexID, health.JobID, health.CapturedAt, health.Device,
+		health.Model, health.Serial, health.Passed, health.ReallocatedSectors, health.PendingSectors,
+		health.UncorrectableSectors, health.PowerOnHours, health.Temperature)
+	if err != nil {
+		return err
+	}
+	health.ID, err = result.LastInsertId()
+	return err
+}
+
+// LatestDriveHealth returns the most recent SMART capture of an index.
+// It returns sql.ErrNoRows when the drive was never captured.
+func (db *DB) LatestDriveHealth(indexID string) (*models.DriveHealth, error) {
+	query := `SELECT ` + driveHealthColumns + ` FROM drive_health WHERE index_id = ? ORDER BY captured_at DESC, id DESC LIMIT 1`
+	return scanDriveHealth(db.conn.QueryRow(query, indexID))
+}
+
+// FirstDriveHealth returns the earliest SMART capture of a drive, identified
+// by its serial number, for an index
+func (db *DB) FirstDriveHealth(indexID, serial string) (*models.DriveHealth, error) {
+	query := `SELECT ` + driveHealthColumns + ` FROM drive_health WHERE index_id = ? AND serial = ? ORDER BY captured_at, id LIMIT 1`
+	return scanDriveHealth(db.conn.QueryRow(query, indexID, serial))
+}
+
+func scanDriveHealth(row rowScanner) (*models.DriveHealth, error) {
+	health := &models.DriveHealth{}
+	var capturedAt string
+	err := row.Scan(&health.ID, &health.IndexID, &health.JobID, &capturedAt, &health.Device, &health.Model,
+		&health.Serial, &health.Passed, &health.ReallocatedSectors, &health.PendingSectors,
+		&health.UncorrectableSectors, &health.PowerOnHours, &health.Temperature)
+	if err != nil {
+		return nil, err
+	}
+
+	health.CapturedAt, _ = time.Parse(time.RFC3339, capturedAt)
+	return health, nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+const jobColumns = "id, kind, index_id, description, pid, host, status, started_at, heartbeat, finished_at, cancel_requested, error"
+
+// CreateJob records a new running job and sets its ID
+func (db *DB) CreateJob(job *models.Job) error {
+	query := `
+	INSERT INTO jobs (kind, index_id, description, pid, host, status, started_at, heartbeat)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.conn.Exec(query, job.Kind, job.IndexID, job.Description, job.PID, job.Host,
+		job.Status, job.StartedAt, job.Heartbeat)
+	if err != nil {
+		return err
+	}
+	job.ID, err = result.LastInsertId()
+	return err
+}
+
+// TouchJob refreshes the heartbeat of a running job and reports whether
+// its cancellation was requested
+func (db *DB) TouchJob(id int64, heartbeat time.Time) (bool, error) {
+	if _, err := db.conn.Exec(`UPDATE jobs SET heartbeat = ? WHERE id = ?`, heartbeat, id); err != nil {
+		return false, err
+	}
+	var cancelRequested bool
+	err := db.conn.QueryRow(`SELECT cancel_requested FROM jobs WHERE id = ?`, id).Scan(&cancelRequested)
+	return cancelRequested, err
+}
+
+// RequestJobCancel flags a running or queued job to stop at its next
+// checkpoint
+func (db *DB) RequestJobCancel(id int64) error {
+	query := `UPDATE jobs SET cancel_requested = 1 WHERE id = ? AND status IN (?, ?)`
+	_, err := db.conn.Exec(query, id, models.JobRunning, models.JobQueued)
+	return err
+}
+
+// ClaimJobSlot starts a queued job when fewer than limit jobs run on its
+// host and no job of the host was queued before it, and reports whether it
+// did. Jobs whose IDs are listed in dead are not counted. The check and the
+// update are one statement, so processes queued together cannot both take
+// the last slot.
+func (db *DB) ClaimJobSlot(id int64, host string, limit int, dead []int64, now time.Time) (bool, error) {
+	notDead := ""
+	args := []interface{}{models.JobRunning, now, now, id, models.JobQueued, host, models.JobRunning}
+	if len(dead) > 0 {
+		notDead = ` AND id NOT IN (?` + strings.Repeat(", ?", len(dead)-1) + `)`
+	}
+	deadArgs := make([]interface{}, len(dead))
+	for i, deadID := range dead {
+		deadArgs[i] = deadID
+	}
+	args = append(args, deadArgs...)
+	args = append(args, limit, host, models.JobQueued, id)
+	args = append(args, deadArgs...)
+
+	query := `
+	UPDATE jobs SET status = ?, started_at = ?, heartbeat = ?
+	WHERE id = ? AND status = ?
+	AND (SELECT COUNT(*) FROM jobs WHERE host = ? AND status = ?` + notDead + `) < ?
+	AND NOT EXISTS (SELECT 1 FROM jobs WHERE host = ? AND status = ? AND id < ?` + notDead + `)
+	`
+	result, err := db.conn.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// FinishJob records the final status of a job
+func (db *DB) FinishJob(id int64, status, errMsg string, finishedAt time.Time) error {
+	query := `UPDATE jobs SET status = ?, error = ?, finished_at = ?, heartbeat = ? WHERE id = ?`
+	_, err := db.conn.Exec(query, status, errMsg, finishedAt, finishedAt, id)
+	return err
+}
+
+// GetJob retrieves a job by ID
+func (db *DB) GetJob(id int64) (*models.Job, error) {
+	row := db.conn.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id)
+	return scanJob(row)
+}
+
+// ListJobs returns the running and queued jobs, or every recorded job when
+// all is set, newest first
+func (db *DB) ListJobs(all bool) ([]*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	var args []interface{}
+	if !all {
+		query += ` WHERE status IN (?, ?)`
+		args = append(args, models.JobRunning, models.JobQueued)
+	}
+	query += ` ORDER BY id DESC`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	job := &models.Job{}
+	var startedAt, heartbeat string
+	var finishedAt sql.NullString
+	err := row.Scan(&job.ID, &job.Kind, &job.IndexID, &job.Description, &job.PID, &job.Host,
+		&job.Status, &startedAt, &heartbeat, &finishedAt, &job.CancelRequested, &job.Error)
+	if err != nil {
+		return nil, err
+	}
+
+	job.StartedAt, _ = time.Parse(time.RFC3339, startedAt)
+	job.Heartbeat, _ = time.Parse(time.RFC3339, heartbeat)
+	if finishedAt.Valid {
+		job.FinishedAt, _ = time.Parse(time.RFC3339, finishedAt.String)
+	}
+	return job, nil
+}
+
+// LastScan returns when the last index or reindex of an index finished
+// successfully, or the zero time when the job history has none
+func (db *DB) LastScan(indexID string) (time.Time, error) {
+	query := `
+	SELECT finished_at FROM jobs
+	WHERE index_id = ? AND kind IN ('index', 'reindex') AND status = ? AND finished_at IS NOT NULL
+	ORDER BY finished_at DESC LIMIT 1`
+	var finishedAt string
+	err := db.conn.QueryRow(query, indexID, models.JobFinished).Scan(&finishedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	t, _ := time.Parse(time.RFC3339, finishedAt)
+	return t, nil
+}
+
+// HasEndedScan reports whether the job history has an index or reindex of
+// an index that ended, complete or not
+func (db *DB) HasEndedScan(indexID string) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM jobs
+	WHERE index_id = ? AND kind IN ('index', 'reindex') AND status NOT IN (?, ?))`
+	var found bool
+	err := db.conn.QueryRow(query, indexID, models.JobRunning, models.JobQueued).Scan(&found)
+	return found, err
+}
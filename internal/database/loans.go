@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+const loanColumns = "id, index_id, borrower, note, checked_out_at, due_at, returned_at"
+
+// ErrCheckedOut is returned when checking out a drive that is already out
+var ErrCheckedOut = errors.New("drive is already checked out")
+
+// CheckOut records a drive as checked out and sets the loan ID
+func (db *DB) CheckOut(loan *models.Loan) error {
+	if _, err := db.ActiveLoan(loan.IndexID); err == nil {
+		return ErrCheckedOut
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var dueAt interface{}
+	if !loan.DueAt.IsZero() {
+		dueAt = loan.DueAt
+	}
+	query := `INSERT INTO loans (index_id, borrower, note, checked_out_at, due_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := db.conn.Exec(query, loan.IndexID, loan.Borrower, loan.Note, loan.CheckedOutAt, dueAt)
+	if err != nil {
+		return err
+	}
+	loan.ID, err = result.LastInsertId()
+	return err
+}
+
+// CheckIn closes the active loan of a drive and returns it. It returns
+// sql.ErrNoRows when the drive is not checked out.
+func (db *DB) CheckIn(indexID string, returnedAt time.Time) (*models.Loan, error) {
+	loan, err := db.ActiveLoan(indexID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.conn.Exec(`UPDATE loans SET returned_at = ? WHERE id = ?`, returnedAt, loan.ID); err != nil {
+		return nil, fmt.Errorf("failed to check in: %w", err)
+	}
+	loan.ReturnedAt = returnedAt
+	return loan, nil
+}
+
+// ActiveLoan returns the open loan of a drive, or sql.ErrNoRows
+func (db *DB) ActiveLoan(indexID string) (*models.Loan, error) {
+	query := `SELECT ` + loanColumns + ` FROM loans WHERE index_id = ? AND returned_at IS NULL`
+	return scanLoan(db.conn.QueryRow(query, indexID))
+}
+
+// ListLoans returns the open loans, or every loan when all is set, most
+// recent first
+func (db *DB) ListLoans(all bool) ([]*models.Loan, error) {
+	query := `SELECT ` + loanColumns + ` FROM loans`
+	if !all {
+		query += ` WHERE returned_at IS NULL`
+	}
+	query += ` ORDER BY checked_out_at DESC, id DESC`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loans []*models.Loan
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, loan)
+	}
+	return loans, rows.Err()
+}
+
+func scanLoan(row rowScanner) (*models.Loan, error) {
+	loan := &models.Loan{}
+	var checkedOutAt string
+	var dueAt, returnedAt sql.NullString
+	err := row.Scan(&loan.ID, &loan.IndexID, &loan.Borrower, &loan.Note, &checkedOutAt, &dueAt, &returnedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.CheckedOutAt, _ = time.Parse(time.RFC3339, checkedOutAt)
+	if dueAt.Valid {
+		loan.DueAt, _ = time.Parse(time.RFC3339, dueAt.String)
+	}
+	if returnedAt.Valid {
+		loan.ReturnedAt, _ = time.Parse(time.RFC3339, returnedAt.String)
+	}
+	return loan, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Memory is the path NewDB opens a private in-memory catalog at. Nothing
+// touches the disk and the catalog is gone once the DB is closed.
+const Memory = ":memory:"
+
+var memoryCount atomic.Int64
+
+// SharedMemory returns the path of an in-memory catalog shared by every DB
+// of this process opened with the same name, for tests running a command
+// and its checks against separate handles. The catalog lives until the
+// last of them is closed.
+func SharedMemory(name string) string {
+	return "file:" + url.PathEscape(name) + "?mode=memory&cache=shared"
+}
+
+// dataSourceName turns the path given to NewDB into the DSN of the driver
+// and reports whether the catalog lives in memory. Memory opens a uniquely
+// named shared-cache database rather than a plain ":memory:" one, which
+// every connection of the pool would see as a separate, empty catalog.
+func dataSourceName(dbPath string) (string, bool) {
+	if dbPath == Memory {
+		name := fmt.Sprintf("stormindexer-%d-%d", os.Getpid(), memoryCount.Add(1))
+		dbPath = SharedMemory(name)
+	}
+	if !strings.HasPrefix(dbPath, "file:") {
+		return dbPath + "?_foreign_keys=1", false
+	}
+
+	memory := strings.Contains(dbPath, "mode=memory")
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return dbPath + separator + "_foreign_keys=1", memory
+}
+
+// keepAlive holds a connection of an in-memory catalog for the lifetime of
+// the DB, as SQLite frees the catalog with its last connection and the pool
+// closes idle ones
+func (db *DB) keepAlive() error {
+	conn, err := db.conn.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	db.held = conn
+	return nil
+}
+
+// InMemory reports whether the catalog lives in memory
+func (db *DB) InMemory() bool {
+	return db.inMemory
+}
+
+// shareMemory lets the connections to an in-memory catalog read while
+// another one writes, which shared-cache connections otherwise fail with
+// "database table is locked". Unlike with a file, readers then see the
+// uncommitted writes of open transactions, so tests relying on isolation
+// need a catalog on disk.
+func shareMemory(conn *sqlite3.SQLiteConn) error {
+	if _, err := conn.Exec("PRAGMA read_uncommitted = 1", nil); err != nil {
+		return fmt.Errorf("failed to share the in-memory catalog: %w", err)
+	}
+	return nil
+}
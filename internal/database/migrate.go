@@ -0,0 +1,107 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addedColumn is a column introduced after its table was first released
+type addedColumn struct {
+	table      string
+	name       string
+	definition string
+	// fallback is the SQL expression read in place of the column from
+	// attached catalogs that predate it
+	fallback string
+	// backfill optionally initializes the column for existing rows
+	backfill string
+}
+
+// addedColumns are added to existing databases when they are opened. New
+// columns must also be listed in the CREATE TABLE statements and, for
+// files and indexes, in fileColumns / indexColumns.
+var addedColumns = []addedColumn{
+	{"files", "link_target", "TEXT NOT NULL DEFAULT ''", "''", ""},
+	{"files", "first_seen", "DATETIME", "last_scanned", "UPDATE files SET first_seen = last_scanned"},
+	{"files", "last_seen", "DATETIME", "last_scanned", "UPDATE files SET last_seen = last_scanned"},
+	{"files", "checksum_stale", "INTEGER NOT NULL DEFAULT 0", "0", ""},
+	{"files", "raw_path", "BLOB", "NULL", ""},
+	{"indexes", "location", "TEXT NOT NULL DEFAULT ''", "''", ""},
+	{"indexes", "skip_directories", "INTEGER NOT NULL DEFAULT 0", "0", ""},
+	{"indexes", "compact", "INTEGER NOT NULL DEFAULT 0", "0", ""},
+}
+
+// tableColumns returns the column names of a table in the given schema
+func (db *DB) tableColumns(schema, table string) (map[string]bool, error) {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue interface{}
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// migrate adds the columns missing from a database created by an older version
+func (db *DB) migrate() error {
+	for _, column := range addedColumns {
+		existing, err := db.tableColumns("main", column.table)
+		if err != nil {
+			return err
+		}
+		if existing[column.name] {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, column.definition)
+		if _, err := db.conn.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", column.table, column.name, err)
+		}
+		if column.backfill != "" {
+			if _, err := db.conn.Exec(column.backfill); err != nil {
+				return fmt.Errorf("failed to initialize column %s.%s: %w", column.table, column.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// missingColumns records which added columns an attached catalog lacks
+func (db *DB) missingColumns(schema string) error {
+	for _, column := range addedColumns {
+		existing, err := db.tableColumns(schema, column.table)
+		if err != nil {
+			return err
+		}
+		if !existing[column.name] {
+			db.missing[schema+"."+column.table+"."+column.name] = true
+		}
+	}
+	return nil
+}
+
+// selectColumns lists columns of a table for reading from schema, replacing
+// those the schema lacks with their fallback value
+func (db *DB) selectColumns(schema, table, columns string) string {
+	names := strings.Split(columns, ", ")
+	for i, name := range names {
+		if !db.missing[schema+"."+table+"."+name] {
+			continue
+		}
+		for _, column := range addedColumns {
+			if column.table == table && column.name == name {
+				names[i] = column.fallback + " AS " + name
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
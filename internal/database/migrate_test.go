@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// createLegacyCatalog writes a catalog with the original files schema
+func createLegacyCatalog(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`
+	CREATE TABLE indexes (
+		id TEXT PRIMARY KEY, name TEXT NOT NULL, root_path TEXT NOT NULL, created_at DATETIME NOT NULL,
+		last_sync DATETIME, machine_id TEXT NOT NULL, total_files INTEGER DEFAULT 0, total_size INTEGER DEFAULT 0
+	);
+	CREATE TABLE files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, path TEXT NOT NULL, relative_path TEXT NOT NULL,
+		size INTEGER NOT NULL, mod_time DATETIME NOT NULL, checksum TEXT, index_id TEXT NOT NULL,
+		last_scanned DATETIME NOT NULL, is_directory INTEGER NOT NULL DEFAULT 0, UNIQUE(path, index_id)
+	);
+	INSERT INTO indexes VALUES ('legacy', 'Legacy', '/legacy', '2020-01-01T00:00:00Z', NULL, 'm', 1, 3);
+	INSERT INTO files (path, relative_path, size, mod_time, checksum, index_id, last_scanned)
+	VALUES ('/legacy/a.txt', 'a.txt', 3, '2020-01-01T00:00:00Z', 'abc', 'legacy', '2020-01-01T00:00:00Z');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	return path
+}
+
+func TestMigrate_AddsColumns(t *testing.T) {
+	path := createLegacyCatalog(t)
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy catalog: %v", err)
+	}
+	defer db.Close()
+
+	file, err := db.GetFile("/legacy/a.txt", "legacy")
+	if err != nil {
+		t.Fatalf("Failed to read legacy file: %v", err)
+	}
+	if file.LinkTarget != "" {
+		t.Errorf("Expected empty link target, got %s", file.LinkTarget)
+	}
+	if !file.FirstSeen.Equal(file.LastScanned) {
+		t.Errorf("Expected first seen to be backfilled from the last scan, got %v", file.FirstSeen)
+	}
+
+	link := &models.FileEntry{Path: "/legacy/b", RelativePath: "b", ModTime: time.Now(), IndexID: "legacy", LastScanned: time.Now(), LinkTarget: "a.txt"}
+	if err := db.UpsertFile(link); err != nil {
+		t.Fatalf("Failed to upsert after migration: %v", err)
+	}
+	stored, _ := db.GetFile("/legacy/b", "legacy")
+	if stored == nil || stored.LinkTarget != "a.txt" {
+		t.Errorf("Expected link target a.txt, got %v", stored)
+	}
+}
+
+func TestAttach_LegacyCatalog(t *testing.T) {
+	db, _ := setupTestDB(t)
+	defer db.Close()
+
+	if err := db.Attach(createLegacyCatalog(t)); err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+
+	files, err := db.ListFiles("legacy")
+	if err != nil {
+		t.Fatalf("Failed to list files of a legacy catalog: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(files))
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// ReplaceNestedIndexes stores the nested index roots the latest scan of an
+// index skipped, replacing those of the previous scan
+func (db *DB) ReplaceNestedIndexes(indexID string, nested []*models.NestedIndex) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM nested_indexes WHERE index_id = ?`, indexID); err != nil {
+		return fmt.Errorf("failed to clear nested indexes: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO nested_indexes (index_id, nested_index_id, relative_path) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, n := range nested {
+		if _, err := stmt.Exec(indexID, n.NestedIndexID, n.RelativePath); err != nil {
+			return fmt.Errorf("failed to record nested index %s: %w", n.RelativePath, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListNestedIndexes returns the cross-references of an index: the nested
+// indexes its scans skipped and the indexes whose scans skipped it
+func (db *DB) ListNestedIndexes(indexID string) ([]*models.NestedIndex, error) {
+	rows, err := db.conn.Query(`
+	SELECT index_id, nested_index_id, relative_path FROM nested_indexes
+	WHERE index_id = ? OR nested_index_id = ?
+	ORDER BY index_id, relative_path`, indexID, indexID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nested []*models.NestedIndex
+	for rows.Next() {
+		n := &models.NestedIndex{}
+		if err := rows.Scan(&n.IndexID, &n.NestedIndexID, &n.RelativePath); err != nil {
+			return nil, err
+		}
+		nested = append(nested, n)
+	}
+	return nested, rows.Err()
+}
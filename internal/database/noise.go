@@ -0,0 +1,41 @@
+package database
+
+import "github.com/victor/stormindexer/internal/noise"
+
+// ExcludeNoise leaves the files c classifies as noise out of the read
+// queries (find, statistics, reports) of this connection, so they reflect
+// the data users keep. Scans are not affected: they must see every stored
+// entry. A nil classifier includes noise again.
+func (db *DB) ExcludeNoise(c *noise.Classifier) {
+	db.noise = c
+}
+
+// noiseClass is registered as the noise_class SQL function
+func (db *DB) noiseClass(relativePath string) string {
+	if db.noise == nil {
+		return ""
+	}
+	return db.noise.Classify(relativePath)
+}
+
+// filesTable returns the table expression to read files from, spanning
+// attached catalogs and compact indexes, without noise when excluded
+func (db *DB) filesTable() string {
+	table := db.storedFilesTable()
+	if db.noise == nil {
+		return table
+	}
+	return "(SELECT * FROM " + table + " WHERE noise_class(relative_path) = '')"
+}
+
+// CountFiles counts the entries of an index, or of the whole catalog when
+// indexID is empty, and sums the size of its files, as UpdateIndexStats
+// does but leaving out noise when it is excluded
+func (db *DB) CountFiles(indexID string) (entries, size int64, err error) {
+	query := `
+	SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_directory = 0 THEN size ELSE 0 END), 0)
+	FROM ` + db.filesTable() + `
+	WHERE ? = '' OR index_id = ?`
+	err = db.conn.QueryRow(query, indexID, indexID).Scan(&entries, &size)
+	return entries, size, err
+}
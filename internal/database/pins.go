@@ -0,0 +1,80 @@
+package database
+
+import (
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+const pinColumns = "id, index_id, relative_path, note, created_at"
+
+// pinCovers is the condition that a pin p protects a file f
+const pinCovers = `p.index_id = f.index_id AND (p.relative_path = '' OR p.relative_path = f.relative_path
+	OR substr(f.relative_path, 1, length(p.relative_path) + 1) = p.relative_path || '/')`
+
+// AddPin pins a path and sets the pin ID. Pinning a path again replaces
+// its note.
+func (db *DB) AddPin(pin *models.Pin) error {
+	query := `
+	INSERT INTO pins (index_id, relative_path, note, created_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT(index_id, relative_path) DO UPDATE SET note = excluded.note
+	RETURNING id, created_at`
+	var createdAt string
+	err := db.conn.QueryRow(query, pin.IndexID, pin.RelativePath, pin.Note, pin.CreatedAt).Scan(&pin.ID, &createdAt)
+	if err != nil {
+		return err
+	}
+	pin.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	db.InvalidateQueryCache()
+	return nil
+}
+
+// RemovePin unpins a path and reports whether it was pinned. Pins of the
+// directories above it are kept.
+func (db *DB) RemovePin(indexID, relativePath string) (bool, error) {
+	result, err := db.conn.Exec(`DELETE FROM pins WHERE index_id = ? AND relative_path = ?`, indexID, relativePath)
+	if err != nil {
+		return false, err
+	}
+	db.InvalidateQueryCache()
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListPins returns the pins of an index, or of every index when indexID is
+// empty, by path
+func (db *DB) ListPins(indexID string) (models.Pins, error) {
+	query := `SELECT ` + pinColumns + ` FROM pins`
+	var args []interface{}
+	if indexID != "" {
+		query += ` WHERE index_id = ?`
+		args = append(args, indexID)
+	}
+	query += ` ORDER BY index_id, relative_path`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins models.Pins
+	for rows.Next() {
+		pin, err := scanPin(rows)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+func scanPin(row rowScanner) (*models.Pin, error) {
+	pin := &models.Pin{}
+	var createdAt string
+	if err := row.Scan(&pin.ID, &pin.IndexID, &pin.RelativePath, &pin.Note, &createdAt); err != nil {
+		return nil, err
+	}
+	pin.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	return pin, nil
+}
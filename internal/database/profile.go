@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/victor/stormindexer/internal/perf"
+)
+
+// SetRecorder times every statement run on the database into r for the
+// performance log. A nil recorder turns timing off.
+func (db *DB) SetRecorder(r *perf.Recorder) {
+	db.recorder = r
+}
+
+// timedConn wraps an SQLite connection to report statement times to the
+// recorder of its database. A query is timed until its rows are closed,
+// counting only the time spent in SQLite, not in the caller's loop.
+type timedConn struct {
+	*sqlite3.SQLiteConn
+	db *DB
+}
+
+type sqliteStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+func (c *timedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{sqliteStmt: stmt.(sqliteStmt), query: query, db: c.db}, nil
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	c.db.recorder.Record(query, time.Since(start))
+	return result, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.db.recorder == nil {
+		return c.SQLiteConn.QueryContext(ctx, query, args)
+	}
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		c.db.recorder.Record(query, time.Since(start))
+		return nil, err
+	}
+	return &timedRows{Rows: rows, query: query, db: c.db, elapsed: time.Since(start)}, nil
+}
+
+type timedStmt struct {
+	sqliteStmt
+	query string
+	db    *DB
+}
+
+func (s *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.sqliteStmt.ExecContext(ctx, args)
+	s.db.recorder.Record(s.query, time.Since(start))
+	return result, err
+}
+
+func (s *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.db.recorder == nil {
+		return s.sqliteStmt.QueryContext(ctx, args)
+	}
+	start := time.Now()
+	rows, err := s.sqliteStmt.QueryContext(ctx, args)
+	if err != nil {
+		s.db.recorder.Record(s.query, time.Since(start))
+		return nil, err
+	}
+	return &timedRows{Rows: rows, query: s.query, db: s.db, elapsed: time.Since(start)}, nil
+}
+
+type timedRows struct {
+	driver.Rows
+	query   string
+	db      *DB
+	elapsed time.Duration
+	closed  bool
+}
+
+func (r *timedRows) Next(dest []driver.Value) error {
+	start := time.Now()
+	err := r.Rows.Next(dest)
+	r.elapsed += time.Since(start)
+	return err
+}
+
+func (r *timedRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.db.recorder.Record(r.query, r.elapsed)
+	}
+	return r.Rows.Close()
+}
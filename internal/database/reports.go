@@ -0,0 +1,336 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// DirUsage aggregates files below a top-level directory of an index
+type DirUsage struct {
+	Dir   string // "" for files in the index root
+	Files int64
+	Size  int64
+}
+
+// AgeBucket counts the files whose modification time falls in [From, To)
+type AgeBucket struct {
+	Label    string
+	From, To time.Time
+	Files    int64
+	Size     int64
+}
+
+// topLevelDir extracts the first component of relative_path
+const topLevelDir = `CASE WHEN instr(relative_path, '/') > 0
+	THEN substr(relative_path, 1, instr(relative_path, '/') - 1) ELSE '' END`
+
+// knownModTime is the condition that a file has a modification time. Files
+// imported from listings without dates have the zero time, which would
+// otherwise count as the oldest of all.
+const knownModTime = `mod_time > '0001-01-01 00:00:00+00:00'`
+
+// ColdDirs sums the files of an index last modified before the given time,
+// grouped by top-level directory and sorted by size. Files without a known
+// modification time are left out.
+func (db *DB) ColdDirs(indexID string, before time.Time) ([]*DirUsage, error) {
+	query := `
+	SELECT ` + topLevelDir + ` AS dir, COUNT(*), COALESCE(SUM(size), 0)
+	FROM ` + db.filesTable() + `
+	WHERE index_id = ? AND is_directory = 0 AND ` + timeCond("mod_time", "<") + ` AND ` + knownModTime + `
+	GROUP BY dir
+	ORDER BY SUM(size) DESC, dir
+	`
+	rows, err := db.conn.Query(query, indexID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dirs []*DirUsage
+	for rows.Next() {
+		dir := &DirUsage{}
+		if err := rows.Scan(&dir.Dir, &dir.Files, &dir.Size); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, rows.Err()
+}
+
+// AgeDistribution counts the files of an index per modification age. The
+// bucket boundaries are given in years before now, in increasing order.
+// Files without a known modification time are in no bucket.
+func (db *DB) AgeDistribution(indexID string, now time.Time, years []int) ([]*AgeBucket, error) {
+	var buckets []*AgeBucket
+	to := now.AddDate(100, 0, 0) // include files with a modification time in the future
+	for i := 0; i <= len(years); i++ {
+		bucket := &AgeBucket{To: to}
+		switch {
+		case i == len(years):
+			bucket.Label = fmt.Sprintf("> %dy", years[i-1])
+		case i == 0:
+			bucket.From = now.AddDate(-years[i], 0, 0)
+			bucket.Label = fmt.Sprintf("< %dy", years[i])
+		default:
+			bucket.From = now.AddDate(-years[i], 0, 0)
+			bucket.Label = fmt.Sprintf("%d-%dy", years[i-1], years[i])
+		}
+		buckets = append(buckets, bucket)
+		to = bucket.From
+	}
+
+	query := `
+	SELECT COUNT(*), COALESCE(SUM(size), 0)
+	FROM ` + db.filesTable() + `
+	WHERE index_id = ? AND is_directory = 0
+		AND ` + timeCond("mod_time", ">=") + ` AND ` + timeCond("mod_time", "<") + ` AND ` + knownModTime + `
+	`
+	for _, bucket := range buckets {
+		if err := db.conn.QueryRow(query, indexID, bucket.From, bucket.To).Scan(&bucket.Files, &bucket.Size); err != nil {
+			return nil, err
+		}
+	}
+	return buckets, nil
+}
+
+// ChecksumCoverage counts how many regular files have a usable checksum
+type ChecksumCoverage struct {
+	Files   int64
+	Hashed  int64
+	Stale   int64 // checksum dropped after a change, waiting for a rehash
+	Missing int64 // never hashed
+}
+
+// Percent returns the share of files with a valid checksum
+func (c *ChecksumCoverage) Percent() float64 {
+	if c.Files == 0 {
+		return 100
+	}
+	return float64(c.Hashed) * 100 / float64(c.Files)
+}
+
+// GetChecksumCoverage computes the checksum coverage of an index, or of the
+// whole catalog when indexID is empty. Directories and symlinks are not counted.
+func (db *DB) GetChecksumCoverage(indexID string) (*ChecksumCoverage, error) {
+	query := `
+	SELECT COUNT(*),
+	       COALESCE(SUM(CASE WHEN checksum != '' THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN checksum = '' AND checksum_stale = 1 THEN 1 ELSE 0 END), 0)
+	FROM ` + db.filesTable() + `
+	WHERE is_directory = 0 AND link_target = '' AND (? = '' OR index_id = ?)
+	`
+	coverage := &ChecksumCoverage{}
+	if err := db.conn.QueryRow(query, indexID, indexID).Scan(&coverage.Files, &coverage.Hashed, &coverage.Stale); err != nil {
+		return nil, err
+	}
+	coverage.Missing = coverage.Files - coverage.Hashed - coverage.Stale
+	return coverage, nil
+}
+
+// UniqueContent measures the distinct content of the catalog. Files with
+// the same checksum count once, wherever and however often they are
+// stored. Files without a checksum cannot be compared and are counted
+// separately as unknown.
+type UniqueContent struct {
+	UniqueFiles  int64
+	UniqueBytes  int64
+	UnknownFiles int64
+	UnknownBytes int64
+}
+
+// GetUniqueContent computes the distinct content of the whole catalog.
+// Directories and symlinks are not counted.
+func (db *DB) GetUniqueContent() (*UniqueContent, error) {
+	files := db.filesTable()
+	query := `
+	SELECT COUNT(*), COALESCE(SUM(size), 0)
+	FROM (
+		SELECT MAX(size) AS size FROM ` + files + `
+		WHERE is_directory = 0 AND link_target = '' AND checksum != ''
+		GROUP BY checksum
+	)`
+	content := &UniqueContent{}
+	if err := db.conn.QueryRow(query).Scan(&content.UniqueFiles, &content.UniqueBytes); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT COUNT(*), COALESCE(SUM(size), 0)
+	FROM ` + files + `
+	WHERE is_directory = 0 AND link_target = '' AND checksum = ''`
+	if err := db.conn.QueryRow(query).Scan(&content.UnknownFiles, &content.UnknownBytes); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// Activity sums the files of an index first seen in a period, and those
+// among them whose content exists more than once in the catalog
+type Activity struct {
+	NewFiles       int64
+	NewSize        int64
+	DuplicateFiles int64
+	DuplicateSize  int64
+}
+
+// GetActivity computes the activity of an index since the given time
+func (db *DB) GetActivity(indexID string, since time.Time) (*Activity, error) {
+	files := db.filesTable()
+	query := `
+	SELECT COUNT(*), COALESCE(SUM(f.size), 0),
+	       COALESCE(SUM(CASE WHEN d.checksum IS NOT NULL THEN 1 ELSE 0 END), 0),
+	       COALESCE(SUM(CASE WHEN d.checksum IS NOT NULL THEN f.size ELSE 0 END), 0)
+	FROM ` + files + ` f
+	LEFT JOIN (
+		SELECT checksum FROM ` + files + `
+		WHERE checksum != '' GROUP BY checksum HAVING COUNT(*) > 1
+	) d ON d.checksum = f.checksum
+	WHERE f.index_id = ? AND f.is_directory = 0 AND ` + timeCond("f.first_seen", ">=") + `
+	`
+	activity := &Activity{}
+	err := db.conn.QueryRow(query, indexID, since).Scan(
+		&activity.NewFiles, &activity.NewSize, &activity.DuplicateFiles, &activity.DuplicateSize)
+	if err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// IndexOverlap is the content two indexes share, matched by checksum.
+// Content stored several times within one index counts once.
+type IndexOverlap struct {
+	IndexA, IndexB string
+	// BytesA and BytesB are the distinct hashed content of each index
+	BytesA, BytesB int64
+	SharedFiles    int64
+	SharedBytes    int64
+}
+
+// CoverageA returns the percentage of A's content also present in B
+func (o *IndexOverlap) CoverageA() float64 {
+	if o.BytesA == 0 {
+		return 0
+	}
+	return float64(o.SharedBytes) * 100 / float64(o.BytesA)
+}
+
+// CoverageB returns the percentage of B's content also present in A
+func (o *IndexOverlap) CoverageB() float64 {
+	if o.BytesB == 0 {
+		return 0
+	}
+	return float64(o.SharedBytes) * 100 / float64(o.BytesB)
+}
+
+// distinctContent lists each content of every index once
+const distinctContent = `SELECT DISTINCT index_id, checksum, size FROM %s
+	WHERE checksum != '' AND is_directory = 0`
+
+// GetIndexOverlaps returns every pair of indexes sharing content, largest
+// overlap first. IndexA sorts before IndexB.
+func (db *DB) GetIndexOverlaps() ([]*IndexOverlap, error) {
+	content := fmt.Sprintf(distinctContent, db.filesTable())
+
+	totals := make(map[string]int64)
+	rows, err := db.conn.Query(`SELECT index_id, SUM(size) FROM (` + content + `) GROUP BY index_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var indexID string
+		var size int64
+		if err := rows.Scan(&indexID, &size); err != nil {
+			return nil, err
+		}
+		totals[indexID] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT a.index_id, b.index_id, COUNT(*), COALESCE(SUM(a.size), 0)
+	FROM (` + content + `) a
+	JOIN (` + content + `) b ON b.checksum = a.checksum AND b.index_id > a.index_id
+	GROUP BY a.index_id, b.index_id
+	ORDER BY SUM(a.size) DESC, a.index_id, b.index_id
+	`
+	rows, err = db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overlaps []*IndexOverlap
+	for rows.Next() {
+		o := &IndexOverlap{}
+		if err := rows.Scan(&o.IndexA, &o.IndexB, &o.SharedFiles, &o.SharedBytes); err != nil {
+			return nil, err
+		}
+		o.BytesA, o.BytesB = totals[o.IndexA], totals[o.IndexB]
+		overlaps = append(overlaps, o)
+	}
+	return overlaps, rows.Err()
+}
+
+// GetDoubleCountedBytes returns how many bytes of the catalog totals are
+// content already counted in another index: every content held by n
+// indexes is counted n-1 times too often.
+func (db *DB) GetDoubleCountedBytes() (int64, error) {
+	query := `
+	SELECT COALESCE(SUM((indexes - 1) * size), 0)
+	FROM (
+		SELECT COUNT(*) AS indexes, MAX(size) AS size
+		FROM (` + fmt.Sprintf(distinctContent, db.filesTable()) + `)
+		GROUP BY checksum
+	)
+	WHERE indexes > 1
+	`
+	var bytes int64
+	if err := db.conn.QueryRow(query).Scan(&bytes); err != nil {
+		return 0, err
+	}
+	return bytes, nil
+}
+
+// DuplicateCopy is a file whose content is stored more than once in the
+// catalog
+type DuplicateCopy struct {
+	IndexID      string
+	RelativePath string
+	Checksum     string
+	Size         int64
+	Copies       int64 // copies of the content in the whole catalog
+}
+
+// GetDuplicateCopies returns every copy of the content stored more than
+// once in the catalog. Directories, symlinks and empty files are left out.
+func (db *DB) GetDuplicateCopies() ([]*DuplicateCopy, error) {
+	files := db.filesTable()
+	query := `
+	SELECT f.index_id, f.relative_path, f.checksum, f.size, d.copies
+	FROM ` + files + ` f
+	JOIN (
+		SELECT checksum, COUNT(*) AS copies FROM ` + files + `
+		WHERE checksum != '' AND is_directory = 0 AND link_target = '' AND size > 0
+		GROUP BY checksum HAVING COUNT(*) > 1
+	) d ON d.checksum = f.checksum
+	WHERE f.is_directory = 0 AND f.link_target = '' AND f.size > 0
+	`
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var copies []*DuplicateCopy
+	for rows.Next() {
+		c := &DuplicateCopy{}
+		if err := rows.Scan(&c.IndexID, &c.RelativePath, &c.Checksum, &c.Size, &c.Copies); err != nil {
+			return nil, err
+		}
+		copies = append(copies, c)
+	}
+	return copies, rows.Err()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// ReplaceScanErrors stores the paths the latest scan of an index could not
+// read, replacing the errors of the previous scan
+func (db *DB) ReplaceScanErrors(indexID string, scanErrors []*models.ScanError) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM scan_errors WHERE index_id = ?`, indexID); err != nil {
+		return fmt.Errorf("failed to clear scan errors: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO scan_errors (index_id, path, op, error, attempts, occurred_at) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range scanErrors {
+		if _, err := stmt.Exec(indexID, e.Path, e.Op, e.Error, e.Attempts, e.OccurredAt); err != nil {
+			return fmt.Errorf("failed to record scan error of %s: %w", e.Path, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListScanErrors returns the errors of the latest scan of an index, or of
+// every index when indexID is empty, ordered by index and path
+func (db *DB) ListScanErrors(indexID string) ([]*models.ScanError, error) {
+	query := `SELECT index_id, path, op, error, attempts, occurred_at FROM scan_errors`
+	var args []interface{}
+	if indexID != "" {
+		query += ` WHERE index_id = ?`
+		args = append(args, indexID)
+	}
+	query += ` ORDER BY index_id, path`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scanErrors []*models.ScanError
+	for rows.Next() {
+		e := &models.ScanError{}
+		var occurredAt string
+		if err := rows.Scan(&e.IndexID, &e.Path, &e.Op, &e.Error, &e.Attempts, &occurredAt); err != nil {
+			return nil, err
+		}
+		e.OccurredAt, _ = time.Parse(time.RFC3339, occurredAt)
+		scanErrors = append(scanErrors, e)
+	}
+	return scanErrors, rows.Err()
+}
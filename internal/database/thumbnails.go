@@ -0,0 +1,65 @@
+package database
+
+import "time"
+
+// PutThumbnail stores the thumbnail of the content with a checksum
+func (db *DB) PutThumbnail(checksum string, data []byte) error {
+	_, err := db.conn.Exec(`
+	INSERT INTO thumbnails (checksum, data, created_at) VALUES (?, ?, ?)
+	ON CONFLICT(checksum) DO UPDATE SET data = excluded.data, created_at = excluded.created_at`,
+		checksum, data, time.Now())
+	return err
+}
+
+// GetThumbnail returns the thumbnail of the content with a checksum, or
+// sql.ErrNoRows when there is none
+func (db *DB) GetThumbnail(checksum string) ([]byte, error) {
+	var data []byte
+	err := db.conn.QueryRow(`SELECT data FROM thumbnails WHERE checksum = ?`, checksum).Scan(&data)
+	return data, err
+}
+
+// HasThumbnail reports whether the content with a checksum has a thumbnail
+func (db *DB) HasThumbnail(checksum string) (bool, error) {
+	var found bool
+	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM thumbnails WHERE checksum = ?)`, checksum).Scan(&found)
+	return found, err
+}
+
+// ListDuplicateThumbnails returns the checksums of up to limit contents
+// stored more than once that have a thumbnail, those wasting the most
+// space first
+func (db *DB) ListDuplicateThumbnails(limit int) ([]string, error) {
+	rows, err := db.conn.Query(`
+	SELECT f.checksum
+	FROM `+db.filesTable()+` f
+	JOIN thumbnails t ON t.checksum = f.checksum
+	WHERE f.is_directory = 0
+	GROUP BY f.checksum
+	HAVING COUNT(*) > 1
+	ORDER BY (COUNT(*) - 1) * MAX(f.size) DESC, f.checksum
+	LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checksums []string
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+	return checksums, rows.Err()
+}
+
+// pruneThumbnails deletes the thumbnails of contents no index holds anymore
+func (db *DB) pruneThumbnails() error {
+	_, err := db.conn.Exec(`
+	DELETE FROM thumbnails
+	WHERE NOT EXISTS (SELECT 1 FROM files WHERE files.checksum = thumbnails.checksum)
+	  AND NOT EXISTS (SELECT 1 FROM compact_files WHERE compact_files.checksum = thumbnails.checksum)`)
+	return err
+}
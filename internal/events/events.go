@@ -0,0 +1,153 @@
+// Package events publishes changes to the catalog: scans starting and
+// finishing, files changing, duplicates being detected and drives being
+// mounted. Every event is appended to the event log in the database, so
+// other processes, and automations on other machines sharing the database,
+// can follow it.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// PollInterval is how often Follow checks the event log for new events
+var PollInterval = time.Second
+
+// Bus records events in the event log and passes them to the subscribers of
+// the current process. A nil Bus drops every event.
+type Bus struct {
+	db          *database.DB
+	mu          sync.Mutex
+	subscribers []func(*models.Event)
+}
+
+// New creates a bus recording events in db
+func New(db *database.DB) *Bus {
+	return &Bus{db: db}
+}
+
+// Subscribe calls fn with every event published on the bus from now on
+func (b *Bus) Subscribe(fn func(*models.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish records an event and passes it to the subscribers. Subscribers
+// are called even when recording fails, and the error is returned.
+func (b *Bus) Publish(kind, indexID, path, detail string) error {
+	if b == nil {
+		return nil
+	}
+	event := newEvent(kind, indexID, path, detail)
+	err := b.db.RecordEvent(event)
+	b.notify([]*models.Event{event})
+	return err
+}
+
+func newEvent(kind, indexID, path, detail string) *models.Event {
+	return &models.Event{
+		Kind:       kind,
+		IndexID:    indexID,
+		Path:       path,
+		Detail:     detail,
+		OccurredAt: time.Now(),
+	}
+}
+
+// notify passes recorded events to the subscribers
+func (b *Bus) notify(events []*models.Event) {
+	b.mu.Lock()
+	subscribers := append([]func(*models.Event){}, b.subscribers...)
+	b.mu.Unlock()
+	for _, event := range events {
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
+
+// BatchSize is how many events a Batch holds before recording them
+var BatchSize = 500
+
+// Batch collects the events of a scan and records them BatchSize at a time
+// in one transaction, so a scan changing many files does not write the log
+// once per file. A nil Batch drops every event.
+type Batch struct {
+	bus     *Bus
+	mu      sync.Mutex
+	pending []*models.Event
+}
+
+// Batch creates a batch publishing on the bus. It returns nil for a nil bus.
+func (b *Bus) Batch() *Batch {
+	if b == nil {
+		return nil
+	}
+	return &Batch{bus: b}
+}
+
+// Publish queues an event, recording the queue once it is full
+func (b *Batch) Publish(kind, indexID, path, detail string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, newEvent(kind, indexID, path, detail))
+	if len(b.pending) < BatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+// Flush records the queued events and passes them to the subscribers of
+// the bus. Subscribers are called even when recording fails, and the error
+// is returned.
+func (b *Batch) Flush() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+func (b *Batch) flush() error {
+	events := b.pending
+	b.pending = nil
+	err := b.bus.db.RecordEvents(events)
+	b.bus.notify(events)
+	return err
+}
+
+// Follow polls the event log and calls fn with every event matching filter,
+// in order, until ctx is cancelled or fn fails. It starts after the event
+// with ID filter.AfterID. filter.Limit is ignored.
+func Follow(ctx context.Context, db *database.DB, filter database.EventFilter, fn func(*models.Event) error) error {
+	filter.Limit = 0
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		events, err := db.ListEvents(filter)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := fn(event); err != nil {
+				return err
+			}
+			filter.AfterID = event.ID
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
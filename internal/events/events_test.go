@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+func TestPublish(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	bus := New(db)
+
+	var received []*models.Event
+	bus.Subscribe(func(e *models.Event) { received = append(received, e) })
+
+	if err := bus.Publish(models.EventScanStarted, "idx", "/data", "reindex"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := bus.Publish(models.EventFileChanged, "idx", "/data/a.txt", "added"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if len(received) != 2 || received[1].Path != "/data/a.txt" {
+		t.Fatalf("Expected 2 events delivered to the subscriber, got %v", received)
+	}
+
+	logged, err := db.ListEvents(database.EventFilter{Kinds: []string{models.EventFileChanged}})
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(logged) != 1 || logged[0].ID != received[1].ID || logged[0].Detail != "added" {
+		t.Errorf("Expected the file event in the log, got %v", logged)
+	}
+
+	latest, err := db.ListEvents(database.EventFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(latest) != 1 || latest[0].Kind != models.EventFileChanged {
+		t.Errorf("Expected the most recent event, got %v", latest)
+	}
+
+	var nilBus *Bus
+	if err := nilBus.Publish(models.EventScanStarted, "", "", ""); err != nil {
+		t.Errorf("Expected a nil bus to drop events, got %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	bus := New(db)
+	defer func(size int) { BatchSize = size }(BatchSize)
+	BatchSize = 2
+
+	var received []*models.Event
+	bus.Subscribe(func(e *models.Event) { received = append(received, e) })
+
+	batch := bus.Batch()
+	batch.Publish(models.EventFileChanged, "idx", "/data/a.txt", "added")
+	if logged, _ := db.ListEvents(database.EventFilter{}); len(logged) != 0 || len(received) != 0 {
+		t.Fatalf("Expected the event to be queued, got %d logged and %d delivered", len(logged), len(received))
+	}
+	batch.Publish(models.EventFileChanged, "idx", "/data/b.txt", "added")
+	batch.Publish(models.EventFileChanged, "idx", "/data/c.txt", "removed")
+	if logged, _ := db.ListEvents(database.EventFilter{}); len(logged) != 2 {
+		t.Errorf("Expected a full batch to be recorded, got %d events", len(logged))
+	}
+	if err := batch.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	logged, _ := db.ListEvents(database.EventFilter{})
+	if len(logged) != 3 || logged[2].Path != "/data/c.txt" {
+		t.Fatalf("Expected 3 events in order, got %v", logged)
+	}
+	if len(received) != 3 || received[2].ID != logged[2].ID {
+		t.Errorf("Expected the subscriber to get the recorded events, got %v", received)
+	}
+
+	var nilBus *Bus
+	if err := nilBus.Batch().Publish(models.EventScanStarted, "", "", ""); err != nil {
+		t.Errorf("Expected a nil batch to drop events, got %v", err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	bus := New(db)
+	PollInterval = 10 * time.Millisecond
+
+	bus.Publish(models.EventScanStarted, "idx", "/data", "index")
+	first, _ := db.ListEvents(database.EventFilter{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var followed []string
+	done := make(chan error)
+	go func() {
+		done <- Follow(ctx, db, database.EventFilter{AfterID: first[0].ID}, func(e *models.Event) error {
+			followed = append(followed, e.Kind)
+			if len(followed) == 2 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	bus.Publish(models.EventDuplicateDetected, "idx", "/data/b.txt", "already on usb")
+	bus.Publish(models.EventScanFinished, "idx", "/data", "index finished")
+	if err := <-done; err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+	if len(followed) != 2 || followed[0] != models.EventDuplicateDetected || followed[1] != models.EventScanFinished {
+		t.Errorf("Expected the 2 events published after the first, got %v", followed)
+	}
+}
+
+func TestPruneEvents(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+
+	old := &models.Event{Kind: models.EventScanStarted, OccurredAt: time.Now().Add(-48 * time.Hour)}
+	// Older than the cutoff, but recorded in a zone ahead of it
+	zoned := &models.Event{Kind: models.EventScanStarted, OccurredAt: time.Now().Add(-25 * time.Hour).In(time.FixedZone("", 14*3600))}
+	recent := &models.Event{Kind: models.EventScanFinished, OccurredAt: time.Now()}
+	for _, e := range []*models.Event{old, zoned, recent} {
+		if err := db.RecordEvent(e); err != nil {
+			t.Fatalf("RecordEvent failed: %v", err)
+		}
+	}
+
+	pruned, err := db.PruneEvents(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("PruneEvents failed: %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("Expected 2 pruned events, got %d", pruned)
+	}
+	left, _ := db.ListEvents(database.EventFilter{})
+	if len(left) != 1 || left[0].Kind != models.EventScanFinished {
+		t.Errorf("Expected only the recent event left, got %v", left)
+	}
+}
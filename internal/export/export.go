@@ -0,0 +1,172 @@
+// Package export streams catalogs to and from NDJSON so indexes can be moved
+// between machines without loading them into memory.
+//
+// An export is a sequence of JSON records, one per line. Each index record is
+// followed by the file records that belong to it:
+//
+//	{"type":"index","index":{...}}
+//	{"type":"file","file":{...}}
+//
+// Differential exports only carry the files added or changed after a point in
+// time, plus "removed" records for files deleted since then.
+//
+// Exports are deterministic: files are written in the order of their
+// relative paths, and file records carry a key derived from the index ID and
+// relative path instead of the database row ID, so two exports of the same
+// index can be compared with diff.
+package export
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Record types
+const (
+	RecordIndex   = "index"
+	RecordFile    = "file"
+	RecordRemoved = "removed"
+)
+
+// Record is a single line of an NDJSON export
+type Record struct {
+	Type  string        `json:"type"`
+	Index *models.Index `json:"index,omitempty"`
+	// Key identifies the file of file and removed records, see RowKey
+	Key  string            `json:"key,omitempty"`
+	File *models.FileEntry `json:"file,omitempty"`
+	// Since is set on index records of differential exports
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Exporter writes indexes as NDJSON records
+type Exporter struct {
+	db *database.DB
+	// OnFile is called after each file record is written (e.g. to drive a progress bar)
+	OnFile func()
+	// Since limits the export to changes after this time. Zero exports everything.
+	Since time.Time
+	// SinceIndex overrides Since per index ID, e.g. with the scan times of a previous export
+	SinceIndex map[string]time.Time
+	// OmitLastSeen leaves out when scans last saw each file, which changes
+	// with every scan even for unchanged files
+	OmitLastSeen bool
+}
+
+// recordWithoutLastSeen is a file record written with OmitLastSeen
+type recordWithoutLastSeen struct {
+	Record
+	File fileWithoutLastSeen `json:"file"`
+}
+
+// fileWithoutLastSeen leaves last_seen out of the JSON form of a file: the
+// nil field hides the one of the embedded entry
+type fileWithoutLastSeen struct {
+	*models.FileEntry
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// RowKey returns the stable identifier of a file in exports: the same for
+// every export of the index, unlike the database row ID
+func RowKey(indexID, relativePath string) string {
+	sum := sha256.Sum256([]byte(indexID + "\x00" + relativePath))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NewExporter creates a new exporter
+func NewExporter(db *database.DB) *Exporter {
+	return &Exporter{db: db}
+}
+
+// Export streams the given indexes to w and returns the number of file records written
+func (e *Exporter) Export(w io.Writer, indexIDs []string) (int64, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	var count int64
+	for _, indexID := range indexIDs {
+		index, err := e.db.GetIndex(indexID)
+		if err != nil {
+			return count, fmt.Errorf("failed to get index %s: %w", indexID, err)
+		}
+
+		since := e.Since
+		if t, ok := e.SinceIndex[indexID]; ok {
+			since = t
+		}
+
+		rec := Record{Type: RecordIndex, Index: index}
+		if !since.IsZero() {
+			rec.Since = &since
+		}
+		if err := enc.Encode(rec); err != nil {
+			return count, err
+		}
+
+		if !since.IsZero() {
+			removed, err := e.db.ListRemovedFiles(indexID, since)
+			if err != nil {
+				return count, fmt.Errorf("failed to list removed files of %s: %w", index.Name, err)
+			}
+			for _, file := range removed {
+				if err := enc.Encode(Record{Type: RecordRemoved, Key: RowKey(indexID, file.RelativePath), File: file}); err != nil {
+					return count, err
+				}
+			}
+		}
+
+		err = e.db.EachFileSince(indexID, since, func(file *models.FileEntry) error {
+			file.ID = 0
+			var rec interface{} = Record{Type: RecordFile, Key: RowKey(indexID, file.RelativePath), File: file}
+			if e.OmitLastSeen {
+				rec = recordWithoutLastSeen{Record: rec.(Record), File: fileWithoutLastSeen{FileEntry: file}}
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			count++
+			if e.OnFile != nil {
+				e.OnFile()
+			}
+			return nil
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to export files of %s: %w", index.Name, err)
+		}
+	}
+
+	return count, bw.Flush()
+}
+
+// ReadSnapshot reads the index records of a previous export and returns the
+// time each index was last scanned, for use as Exporter.SinceIndex
+func ReadSnapshot(r io.Reader) (map[string]time.Time, error) {
+	snapshot := make(map[string]time.Time)
+	br := bufio.NewReader(r)
+	for {
+		data, readErr := br.ReadBytes('\n')
+		if len(data) > 0 {
+			var rec Record
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return nil, fmt.Errorf("invalid snapshot record: %w", err)
+			}
+			if rec.Type == RecordIndex && rec.Index != nil {
+				snapshot[rec.Index.ID] = rec.Index.LastSync
+			}
+		}
+		if readErr == io.EOF {
+			return snapshot, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
@@ -0,0 +1,698 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/output"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+func seedIndex(t *testing.T, db *database.DB, id string, files int) {
+	index := &models.Index{ID: id, Name: "Index " + id, RootPath: "/" + id, CreatedAt: time.Now(), MachineID: "machine1"}
+	if err := db.CreateIndex(index); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for i := 0; i < files; i++ {
+		rel := fmt.Sprintf("dir/file%03d.txt", i)
+		db.UpsertFile(&models.FileEntry{
+			Path:         "/" + id + "/" + rel,
+			RelativePath: rel,
+			Size:         int64(i),
+			ModTime:      time.Now(),
+			Checksum:     fmt.Sprintf("sum%d", i),
+			IndexID:      id,
+			LastScanned:  time.Now(),
+		})
+	}
+	db.UpdateIndexStats(id)
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	src := testutil.NewCatalog(t).DB
+	defer src.Close()
+	seedIndex(t, src, "idx-a", 25)
+	seedIndex(t, src, "idx-b", 3)
+
+	var buf bytes.Buffer
+	count, err := NewExporter(src).Export(&buf, []string{"idx-a", "idx-b"})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if count != 28 {
+		t.Errorf("Expected 28 file records, got %d", count)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 30 {
+		t.Errorf("Expected 30 lines (2 index + 28 file records), got %d", lines)
+	}
+
+	dst := testutil.NewCatalog(t).DB
+	defer dst.Close()
+
+	im := NewImporter(dst)
+	im.ChunkSize = 7
+	result, err := im.Import(&buf)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result.Files != 28 || len(result.Indexes) != 2 {
+		t.Errorf("Expected 28 files in 2 indexes, got %d in %d", result.Files, len(result.Indexes))
+	}
+
+	index, err := dst.GetIndex("idx-a")
+	if err != nil {
+		t.Fatalf("Imported index not found: %v", err)
+	}
+	if index.TotalFiles != 25 {
+		t.Errorf("Expected 25 files in imported index, got %d", index.TotalFiles)
+	}
+
+	file, err := dst.GetFile("/idx-a/dir/file007.txt", "idx-a")
+	if err != nil {
+		t.Fatalf("Imported file not found: %v", err)
+	}
+	if file.Checksum != "sum7" || file.Size != 7 {
+		t.Errorf("Unexpected imported file: %+v", file)
+	}
+}
+
+func TestExport_Deterministic(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+	seedIndex(t, db, "idx-a", 12)
+
+	exporter := NewExporter(db)
+	exporter.OmitLastSeen = true
+	var first bytes.Buffer
+	if _, err := exporter.Export(&first, []string{"idx-a"}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// A scan that finds the files unchanged only updates when they were
+	// last seen
+	var paths []string
+	db.EachFile("idx-a", func(f *models.FileEntry) error {
+		paths = append(paths, f.Path)
+		return nil
+	})
+	if err := db.TouchFiles("idx-a", paths, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("TouchFiles failed: %v", err)
+	}
+	var second bytes.Buffer
+	if _, err := exporter.Export(&second, []string{"idx-a"}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("Expected identical exports, got\n%s\nand\n%s", first.String(), second.String())
+	}
+
+	var previous string
+	for i, line := range strings.Split(strings.TrimSpace(first.String()), "\n")[1:] {
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Invalid record %q: %v", line, err)
+		}
+		if rec.Key != RowKey("idx-a", rec.File.RelativePath) || rec.File.ID != 0 {
+			t.Errorf("Expected the stable key and no row ID, got %s", line)
+		}
+		if strings.Contains(line, "last_seen") {
+			t.Errorf("Expected no last seen time, got %s", line)
+		}
+		if i > 0 && rec.File.RelativePath <= previous {
+			t.Errorf("Expected files ordered by relative path, got %s after %s", rec.File.RelativePath, previous)
+		}
+		previous = rec.File.RelativePath
+	}
+
+	// Importing the export over a diverged row keeps when it was last seen
+	lastSeen := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	db.UpsertFile(&models.FileEntry{
+		Path:         "/idx-a/dir/file003.txt",
+		RelativePath: "dir/file003.txt",
+		Checksum:     "changed",
+		IndexID:      "idx-a",
+		LastScanned:  time.Now().Add(-time.Hour),
+		LastSeen:     lastSeen,
+	})
+	result, err := NewImporter(db).Import(&first)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result.Merge.Updated != 1 {
+		t.Fatalf("Expected 1 updated row, got %+v", result.Merge)
+	}
+	file, err := db.GetFile("/idx-a/dir/file003.txt", "idx-a")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Checksum != "sum3" || !file.LastSeen.Equal(lastSeen) {
+		t.Errorf("Expected the imported checksum and the local last seen time %v, got %s and %v", lastSeen, file.Checksum, file.LastSeen)
+	}
+}
+
+func TestImport_Resume(t *testing.T) {
+	src := testutil.NewCatalog(t).DB
+	defer src.Close()
+	seedIndex(t, src, "idx-a", 10)
+
+	var buf bytes.Buffer
+	if _, err := NewExporter(src).Export(&buf, []string{"idx-a"}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	dst := testutil.NewCatalog(t).DB
+	defer dst.Close()
+
+	// Pretend a previous run committed the index record and the first 4 files
+	dst.SaveImportCheckpoint("export.ndjson", 5)
+
+	im := NewImporter(dst)
+	im.Source = "export.ndjson"
+	im.Resume = true
+	result, err := im.Import(&buf)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result.SkippedLines != 4 || result.Files != 6 {
+		t.Errorf("Expected 4 skipped and 6 imported, got %d skipped and %d imported", result.SkippedLines, result.Files)
+	}
+
+	if lines, _ := dst.GetImportCheckpoint("export.ndjson"); lines != 0 {
+		t.Errorf("Expected checkpoint to be cleared, got %d", lines)
+	}
+}
+
+func TestImport_ResumeKeepsCheckpoint(t *testing.T) {
+	src := testutil.NewCatalog(t).DB
+	defer src.Close()
+	seedIndex(t, src, "idx-a", 10)
+
+	var buf bytes.Buffer
+	if _, err := NewExporter(src).Export(&buf, []string{"idx-a"}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	// The export was cut in the middle of its eighth record
+	lines := strings.SplitAfter(buf.String(), "\n")
+	partial := strings.Join(lines[:7], "") + lines[7][:len(lines[7])/2]
+
+	dst := testutil.NewCatalog(t).DB
+	defer dst.Close()
+	dst.SaveImportCheckpoint("export.ndjson", 5)
+
+	im := NewImporter(dst)
+	im.Source = "export.ndjson"
+	im.Resume = true
+	if _, err := im.Import(strings.NewReader(partial)); err == nil {
+		t.Fatal("Expected an error for the partial record")
+	}
+	// Re-applying the index record must not move the checkpoint back
+	if lines, _ := dst.GetImportCheckpoint("export.ndjson"); lines != 5 {
+		t.Errorf("Expected the checkpoint to stay at 5, got %d", lines)
+	}
+}
+
+func TestImport_InvalidRecord(t *testing.T) {
+	dst := testutil.NewCatalog(t).DB
+	defer dst.Close()
+
+	_, err := NewImporter(dst).Import(strings.NewReader(`{"type":"file","file":{"path":"/x"}}` + "\n"))
+	if err == nil {
+		t.Error("Expected error for file record before index record")
+	}
+}
+
+func TestExport_Since(t *testing.T) {
+	src := testutil.NewCatalog(t).DB
+	defer src.Close()
+	seedIndex(t, src, "idx-a", 5)
+
+	// Full export acts as the snapshot the other machine already has
+	var snapshot bytes.Buffer
+	if _, err := NewExporter(src).Export(&snapshot, []string{"idx-a"}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	dst := testutil.NewCatalog(t).DB
+	defer dst.Close()
+	if _, err := NewImporter(dst).Import(bytes.NewReader(snapshot.Bytes())); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	since, err := ReadSnapshot(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSnapshot failed: %v", err)
+	}
+
+	// Changes after the snapshot: one new file, one updated, one removed
+	time.Sleep(10 * time.Millisecond)
+	src.UpsertFile(&models.FileEntry{Path: "/idx-a/new.txt", RelativePath: "new.txt", Size: 42, ModTime: time.Now(), IndexID: "idx-a", LastScanned: time.Now()})
+	src.UpsertFile(&models.FileEntry{Path: "/idx-a/dir/file001.txt", RelativePath: "dir/file001.txt", Size: 99, ModTime: time.Now(), IndexID: "idx-a", LastScanned: time.Now()})
+	src.DeleteFile("/idx-a/dir/file002.txt", "idx-a")
+
+	exporter := NewExporter(src)
+	exporter.SinceIndex = since
+	var delta bytes.Buffer
+	count, err := exporter.Export(&delta, []string{"idx-a"})
+	if err != nil {
+		t.Fatalf("Differential export failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 changed files in delta, got %d", count)
+	}
+
+	result, err := NewImporter(dst).Import(&delta)
+	if err != nil {
+		t.Fatalf("Delta import failed: %v", err)
+	}
+	if result.Removed != 1 {
+		t.Errorf("Expected 1 removal, got %d", result.Removed)
+	}
+
+	if _, err := dst.GetFile("/idx-a/dir/file002.txt", "idx-a"); err == nil {
+		t.Error("Removed file should be deleted on the receiving side")
+	}
+	if f, err := dst.GetFile("/idx-a/dir/file001.txt", "idx-a"); err != nil || f.Size != 99 {
+		t.Errorf("Updated file should be applied, got %+v (%v)", f, err)
+	}
+	if _, err := dst.GetFile("/idx-a/new.txt", "idx-a"); err != nil {
+		t.Error("New file should be imported")
+	}
+}
+
+func TestImport_ConflictPolicies(t *testing.T) {
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+
+	tests := []struct {
+		policy     ConflictPolicy
+		localScan  time.Time
+		remoteScan time.Time
+		wantSize   int64
+	}{
+		{PolicyNewest, older, newer, 200},
+		{PolicyNewest, newer, older, 100},
+		{PolicyLocal, older, newer, 100},
+		{PolicyRemote, newer, older, 200},
+	}
+
+	for _, tt := range tests {
+		dst := testutil.NewCatalog(t).DB
+		index := &models.Index{ID: "idx", Name: "Shared", RootPath: "/shared", CreatedAt: time.Now(), MachineID: "m"}
+		dst.CreateIndex(index)
+		dst.UpsertFile(&models.FileEntry{Path: "/shared/doc.txt", RelativePath: "doc.txt", Size: 100, ModTime: older, IndexID: "idx", LastScanned: tt.localScan})
+		dst.UpsertFile(&models.FileEntry{Path: "/shared/same.txt", RelativePath: "same.txt", Size: 5, ModTime: older, IndexID: "idx", LastScanned: tt.localScan})
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.Encode(Record{Type: RecordIndex, Index: index})
+		enc.Encode(Record{Type: RecordFile, File: &models.FileEntry{Path: "/shared/doc.txt", RelativePath: "doc.txt", Size: 200, ModTime: newer, LastScanned: tt.remoteScan}})
+		enc.Encode(Record{Type: RecordFile, File: &models.FileEntry{Path: "/shared/same.txt", RelativePath: "same.txt", Size: 5, ModTime: older, LastScanned: tt.remoteScan}})
+		enc.Encode(Record{Type: RecordFile, File: &models.FileEntry{Path: "/shared/extra.txt", RelativePath: "extra.txt", Size: 1, ModTime: newer, LastScanned: tt.remoteScan}})
+
+		im := NewImporter(dst)
+		im.Policy = tt.policy
+		result, err := im.Import(&buf)
+		if err != nil {
+			t.Fatalf("%s: Import failed: %v", tt.policy, err)
+		}
+
+		report := result.Merge
+		if len(report.Conflicts) != 1 || report.ConflictCount != 1 || report.Unchanged != 1 || report.Added != 1 {
+			t.Errorf("%s: Expected 1 conflict, 1 unchanged, 1 added, got %+v", tt.policy, report)
+		}
+
+		file, _ := dst.GetFile("/shared/doc.txt", "idx")
+		if file.Size != tt.wantSize {
+			t.Errorf("%s: Expected size %d after merge, got %d", tt.policy, tt.wantSize, file.Size)
+		}
+		dst.Close()
+	}
+}
+
+func TestMergeReport_CapsConflicts(t *testing.T) {
+	im := &Importer{Policy: PolicyLocal}
+	report := &MergeReport{}
+	for i := 0; i < reportedConflicts+5; i++ {
+		im.resolve(&Conflict{Local: &models.FileEntry{}, Remote: &models.FileEntry{}}, report)
+	}
+	if report.ConflictCount != reportedConflicts+5 || report.KeptLocal != reportedConflicts+5 {
+		t.Errorf("Expected every conflict to be counted, got %d (%d kept local)", report.ConflictCount, report.KeptLocal)
+	}
+	if len(report.Conflicts) != reportedConflicts {
+		t.Errorf("Expected %d conflicts kept, got %d", reportedConflicts, len(report.Conflicts))
+	}
+}
+
+func TestImport_InteractiveResolver(t *testing.T) {
+	dst := testutil.NewCatalog(t).DB
+	defer dst.Close()
+
+	index := &models.Index{ID: "idx", Name: "Shared", RootPath: "/shared", CreatedAt: time.Now(), MachineID: "m"}
+	dst.CreateIndex(index)
+	dst.UpsertFile(&models.FileEntry{Path: "/shared/doc.txt", RelativePath: "doc.txt", Size: 100, ModTime: time.Now(), IndexID: "idx", LastScanned: time.Now()})
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(Record{Type: RecordIndex, Index: index})
+	enc.Encode(Record{Type: RecordRemoved, File: &models.FileEntry{Path: "/shared/doc.txt", RelativePath: "doc.txt", LastScanned: time.Now()}})
+
+	var asked *Conflict
+	im := NewImporter(dst)
+	im.Policy = PolicyInteractive
+	im.Resolver = func(c *Conflict) (bool, error) {
+		asked = c
+		return false, nil
+	}
+	if _, err := im.Import(&buf); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	if asked == nil || !asked.Removal {
+		t.Fatal("Expected the resolver to be asked about the removal")
+	}
+	if _, err := dst.GetFile("/shared/doc.txt", "idx"); err != nil {
+		t.Error("Local file should be kept when the resolver prefers local")
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	if p, err := ParseConflictPolicy("newest-scan-wins"); err != nil || p != PolicyNewest {
+		t.Errorf("Expected newest policy, got %q (%v)", p, err)
+	}
+	if p, err := ParseConflictPolicy("prefer-local"); err != nil || p != PolicyLocal {
+		t.Errorf("Expected local policy, got %q (%v)", p, err)
+	}
+	if _, err := ParseConflictPolicy("coin-flip"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestWriteLocateDB(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+	seedIndex(t, db, "idx-a", 2)
+
+	var buf bytes.Buffer
+	if err := WriteLocateDB(db, &buf, "idx-a"); err != nil {
+		t.Fatalf("WriteLocateDB failed: %v", err)
+	}
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("\x00mlocate\x00\x00\x00\x00\x00")) {
+		t.Fatalf("Unexpected header: %q", data[:16])
+	}
+	rest := data[16:]
+	root := string(rest[:bytes.IndexByte(rest, 0)])
+	if root != "/idx-a" {
+		t.Errorf("Expected root /idx-a, got %s", root)
+	}
+	rest = rest[len(root)+1:]
+
+	// Walk the directory blocks and rebuild the full paths
+	var paths []string
+	for len(rest) > 0 {
+		rest = rest[16:]
+		dir := string(rest[:bytes.IndexByte(rest, 0)])
+		rest = rest[len(dir)+1:]
+		for rest[0] != mlocateEnd {
+			entryType := rest[0]
+			name := string(rest[1 : 1+bytes.IndexByte(rest[1:], 0)])
+			rest = rest[len(name)+2:]
+			if entryType == mlocateDirectory {
+				name += "/"
+			}
+			paths = append(paths, dir+"/"+name)
+		}
+		rest = rest[1:]
+	}
+
+	expected := []string{"/idx-a/dir/", "/idx-a/dir/file000.txt", "/idx-a/dir/file001.txt"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+}
+
+func TestReadManifest_Formats(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name, input, format, path string
+		size                      int64
+	}{
+		{"hashdeep", "%%%% HASHDEEP-1.0\n%%%% size,md5,sha256,filename\n## Invoked from: /home/me\n## $ hashdeep -r photos\n##\n12,00112233445566778899aabbccddeeff," + hash + ",/home/me/photos/a,b.jpg\n",
+			ManifestHashdeep, "/home/me/photos/a,b.jpg", 12},
+		{"gnu", hash + "  ./photos/a.jpg\n", ManifestChecksum, "./photos/a.jpg", -1},
+		{"gnu binary", hash + " *photos/a.jpg\n", ManifestChecksum, "photos/a.jpg", -1},
+		{"bsd", "SHA256 (photos/a.jpg) = " + strings.ToUpper(hash) + "\n", ManifestChecksum, "photos/a.jpg", -1},
+		{"sfv", "; rhash\nphotos/a.jpg " + hash + "\n", ManifestChecksum, "photos/a.jpg", -1},
+		{"escaped", "\\" + hash + "  back\\\\slash\n", ManifestChecksum, "back\\slash", -1},
+	}
+	for _, tt := range tests {
+		manifest, err := ReadManifest(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s: ReadManifest failed: %v", tt.name, err)
+			continue
+		}
+		if manifest.Format != tt.format || len(manifest.Entries) != 1 {
+			t.Errorf("%s: Expected 1 %s entry, got %d %s entries", tt.name, tt.format, len(manifest.Entries), manifest.Format)
+			continue
+		}
+		entry := manifest.Entries[0]
+		if entry.Path != tt.path || entry.SHA256 != hash || entry.Size != tt.size {
+			t.Errorf("%s: Expected %s (%d) %s, got %+v", tt.name, tt.path, tt.size, hash, entry)
+		}
+	}
+
+	if _, err := ReadManifest(strings.NewReader("d41d8cd98f00b204e9800998ecf8427e  md5only\n")); err == nil {
+		t.Errorf("Expected an error for a manifest without SHA-256 hashes")
+	}
+}
+
+func TestCompareManifest(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+	seedIndex(t, db, "idx-a", 3)
+	db.UpsertFile(&models.FileEntry{Path: "/idx-a/unhashed.txt", RelativePath: "unhashed.txt", IndexID: "idx-a", ModTime: time.Now(), LastScanned: time.Now()})
+
+	// sum0 matches, sum1 differs, file002 is not listed, gone.txt is not indexed
+	manifest := &Manifest{
+		InvokedFrom: "/mnt",
+		Entries: []ManifestEntry{
+			{Path: "/mnt/old/dir/file000.txt", SHA256: "sum0"},
+			{Path: "old/dir/file001.txt", SHA256: "changed"},
+			{Path: "/mnt/old/gone.txt", SHA256: "sum9"},
+			{Path: "/mnt/old/unhashed.txt", SHA256: "sum8"},
+			{Path: "/elsewhere/file.txt", SHA256: "sum7"},
+			{Path: "/mnt/old/.DS_Store", SHA256: "sum6"},
+			{Path: "/mnt/old/dir/node_modules/x.js", SHA256: "sum5"},
+			{Path: "/mnt/old/nested/a.txt", SHA256: "sum4"},
+		},
+	}
+	db.CreateIndex(&models.Index{ID: "idx-n", Name: "Nested", RootPath: "/idx-a/nested", CreatedAt: time.Now()})
+	db.ReplaceNestedIndexes("idx-a", []*models.NestedIndex{{IndexID: "idx-a", NestedIndexID: "idx-n", RelativePath: "nested"}})
+	result, err := CompareManifest(db, "idx-a", manifest, "/mnt/old", []string{"node_modules"})
+	if err != nil {
+		t.Fatalf("CompareManifest failed: %v", err)
+	}
+	if result.Matched != 1 {
+		t.Errorf("Expected 1 match, got %d", result.Matched)
+	}
+	if len(result.Mismatched) != 1 || result.Mismatched[0].File.RelativePath != "dir/file001.txt" {
+		t.Errorf("Expected dir/file001.txt to mismatch, got %+v", result.Mismatched)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].Path != "/mnt/old/gone.txt" {
+		t.Errorf("Expected gone.txt to be missing, got %+v", result.Missing)
+	}
+	if len(result.Unhashed) != 1 {
+		t.Errorf("Expected 1 unhashed file, got %d", len(result.Unhashed))
+	}
+	if len(result.Extra) != 1 || result.Extra[0].RelativePath != "dir/file002.txt" {
+		t.Errorf("Expected dir/file002.txt to be extra, got %+v", result.Extra)
+	}
+	if result.Outside != 1 {
+		t.Errorf("Expected 1 entry outside the base, got %d", result.Outside)
+	}
+	if len(result.NotIndexed) != 3 {
+		t.Errorf("Expected the hidden, excluded and nested entries not to be indexed, got %+v", result.NotIndexed)
+	}
+}
+
+func TestWriteLinkFarm(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a", "photos"), 0755)
+	os.MkdirAll(filepath.Join(root, "b"), 0755)
+	os.WriteFile(filepath.Join(root, "a", "photos", "img.jpg"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(root, "b", "img.jpg"), []byte("same"), 0644)
+
+	copyOf := func(index, rel string) *database.FileWithIndex {
+		return &database.FileWithIndex{
+			FileEntry: &models.FileEntry{Path: filepath.Join(root, index, rel), RelativePath: rel, Checksum: "0123456789abcdef0123"},
+			IndexName: index,
+		}
+	}
+	sets := []output.DuplicateSet{{
+		Checksum: "0123456789abcdef0123",
+		Files:    []*database.FileWithIndex{copyOf("a", "photos/img.jpg"), copyOf("b", "img.jpg"), copyOf("c", "img.jpg")},
+	}}
+
+	dir := filepath.Join(t.TempDir(), "farm")
+	result, err := WriteLinkFarm(dir, sets)
+	if err != nil {
+		t.Fatalf("WriteLinkFarm failed: %v", err)
+	}
+	if result.Sets != 1 || result.Links != 2 || result.Offline != 1 {
+		t.Errorf("Expected 1 set, 2 links and 1 offline copy, got %+v", result)
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "0123456789abcdef", "a__photos_img.jpg"))
+	if err != nil || target != filepath.Join(root, "a", "photos", "img.jpg") {
+		t.Errorf("Expected link to the copy on a, got %q (%v)", target, err)
+	}
+
+	if _, err := WriteLinkFarm(dir, sets); err == nil {
+		t.Errorf("Expected an error for a non-empty directory")
+	}
+}
+
+func TestImportListing(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		root    string
+		listing string
+		// expected maps relative paths to size and whether they are directories
+		expected map[string]string
+		outside  int64
+	}{
+		{
+			name:    "locate -0",
+			format:  ListingLocate,
+			root:    "/mnt/archive",
+			listing: "/mnt/archive\x00/mnt/archive/photos\x00/mnt/archive/photos/a.jpg\x00/mnt/archive/notes.txt\x00/home/me/b\x00",
+			expected: map[string]string{
+				"photos": "dir", "photos/a.jpg": "0", "notes.txt": "0",
+			},
+			outside: 1,
+		},
+		{
+			name:   "everything efu",
+			format: ListingEverything,
+			root:   `e:\`,
+			listing: "Filename,Size,Date Modified,Date Created,Attributes\r\n" +
+				"\"E:\\Photos\",,133400000000000000,,16\r\n" +
+				"\"E:\\Photos\\img 1.jpg\",12345,133400000000000000,,32\r\n" +
+				"\"D:\\Other\\c.txt\",5,133400000000000000,,32\r\n",
+			expected: map[string]string{"Photos": "dir", "Photos/img 1.jpg": "12345"},
+			outside:  1,
+		},
+		{
+			name:   "wincatalog csv with semicolons",
+			format: ListingWinCatalog,
+			root:   "/media/disk7",
+			listing: "\ufeffName;Location;Size;Date modified\n" +
+				"report.doc;Docs;1.234;31.12.2010 10:00\n" +
+				"Docs;;;31.12.2010 10:00\n",
+			expected: map[string]string{"Docs": "dir", "Docs/report.doc": "1234"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewCatalog(t).DB
+			defer db.Close()
+
+			index := &models.Index{ID: "archive", Name: "archive", RootPath: tt.root, CreatedAt: time.Now()}
+			result, err := ImportListing(db, index, tt.format, "", strings.NewReader(tt.listing), 2)
+			if err != nil {
+				t.Fatalf("ImportListing failed: %v", err)
+			}
+			if result.Outside != tt.outside {
+				t.Errorf("Expected %d entries outside the root, got %d", tt.outside, result.Outside)
+			}
+
+			got := make(map[string]string)
+			err = db.EachFile(index.ID, func(f *models.FileEntry) error {
+				if f.IsDirectory {
+					got[f.RelativePath] = "dir"
+				} else {
+					got[f.RelativePath] = fmt.Sprint(f.Size)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("EachFile failed: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+			dirs := int64(0)
+			for _, v := range tt.expected {
+				if v == "dir" {
+					dirs++
+				}
+			}
+			if result.Directories != dirs || result.Files != int64(len(tt.expected))-dirs {
+				t.Errorf("Expected %d files and %d directories, got %d and %d",
+					int64(len(tt.expected))-dirs, dirs, result.Files, result.Directories)
+			}
+		})
+	}
+}
+
+func TestParseListingTime(t *testing.T) {
+	// 2023-09-24 03:33:20 UTC as a Windows FILETIME
+	if got, _ := parseListingTime("133400000000000000", ""); !got.Equal(time.Date(2023, 9, 24, 3, 33, 20, 0, time.UTC)) {
+		t.Errorf("Expected 2023-09-24 03:33:20 UTC, got %v", got)
+	}
+	if got, _ := parseListingTime("12/31/2010 10:00", ""); got.Month() != time.December || got.Day() != 31 {
+		t.Errorf("Expected December 31, got %v", got)
+	}
+	if got, _ := parseListingTime("31/12/2010 10:00", ""); got.Month() != time.December || got.Day() != 31 {
+		t.Errorf("Expected December 31 read day first, got %v", got)
+	}
+	if got, _ := parseListingTime("yesterday", ""); !got.IsZero() {
+		t.Errorf("Expected the zero time, got %v", got)
+	}
+
+	if _, err := parseListingTime("03/04/2010", ""); err == nil {
+		t.Error("Expected an error for an ambiguous date")
+	}
+	if got, _ := parseListingTime("03/04/2010", DateOrderDMY); got.Month() != time.April || got.Day() != 3 {
+		t.Errorf("Expected 3 April with dmy, got %v", got)
+	}
+	if got, _ := parseListingTime("03/04/2010", DateOrderMDY); got.Month() != time.March || got.Day() != 4 {
+		t.Errorf("Expected March 4 with mdy, got %v", got)
+	}
+	if _, err := parseListingTime("05/05/2010", ""); err != nil {
+		t.Errorf("Expected a date reading the same either way to be accepted, got %v", err)
+	}
+}
+
+func TestParseListingSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"12345", 12345},
+		{"1,234,567", 1234567},
+		{"1.234", 1234},
+		{"1 234 567", 1234567},
+		{"1\u00a0234", 1234},
+		{"1.5", 0},
+		{"12.34", 0},
+		{"1.234,567", 0},
+		{"1.5 MB", 1572864},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseListingSize(tt.in); got != tt.want {
+			t.Errorf("parseListingSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// DefaultChunkSize is the number of file records committed per transaction
+const DefaultChunkSize = 1000
+
+// ImportResult summarises an import
+type ImportResult struct {
+	Indexes      []*models.Index
+	Files        int64
+	Removed      int64
+	SkippedLines int64
+	// Merge describes how rows of indexes that already existed locally were merged
+	Merge MergeReport
+}
+
+// Importer reads NDJSON records and writes them to the database in chunks.
+// After every chunk the number of consumed lines is checkpointed under Source,
+// so an interrupted import can resume where it stopped.
+//
+// When an imported index already exists locally, rows are merged: identical
+// rows are skipped and diverged rows are settled by Policy.
+type Importer struct {
+	db *database.DB
+	// Source identifies the input for checkpointing. Empty disables checkpoints.
+	Source string
+	// Resume skips the lines committed by a previous, interrupted import of Source
+	Resume bool
+	// ChunkSize is the number of file records per transaction
+	ChunkSize int
+	// OnChunk is called after each committed chunk with the total lines consumed
+	OnChunk func(lines int64)
+	// Policy settles conflicts with rows of existing indexes
+	Policy ConflictPolicy
+	// Resolver is consulted for each conflict under PolicyInteractive
+	Resolver Resolver
+}
+
+// NewImporter creates a new importer
+func NewImporter(db *database.DB) *Importer {
+	return &Importer{db: db, ChunkSize: DefaultChunkSize, Policy: PolicyNewest}
+}
+
+// Import reads records from r until EOF
+func (im *Importer) Import(r io.Reader) (*ImportResult, error) {
+	result := &ImportResult{}
+
+	var skip int64
+	if im.Resume && im.Source != "" {
+		var err error
+		skip, err = im.db.GetImportCheckpoint(im.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read import checkpoint: %w", err)
+		}
+	}
+
+	chunkSize := im.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	var (
+		current  *models.Index
+		touched  = make(map[string]bool)
+		existing = make(map[string]bool)
+		chunk   []*models.FileEntry
+		line    int64
+	)
+
+	// flush writes the pending chunk and checkpoints the lines up to done,
+	// whose records are then all written. The checkpoint never goes back
+	// below the lines a resumed import skipped.
+	flush := func(done int64) error {
+		if len(chunk) > 0 {
+			if err := im.db.UpsertFiles(chunk); err != nil {
+				return err
+			}
+			result.Files += int64(len(chunk))
+			chunk = chunk[:0]
+		}
+		if im.Source != "" && done > skip {
+			if err := im.db.SaveImportCheckpoint(im.Source, done); err != nil {
+				return fmt.Errorf("failed to save import checkpoint: %w", err)
+			}
+		}
+		if im.OnChunk != nil {
+			im.OnChunk(done)
+		}
+		return nil
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		data, readErr := br.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+
+			var rec Record
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return result, fmt.Errorf("line %d: invalid record: %w", line, err)
+			}
+
+			switch rec.Type {
+			case RecordIndex:
+				if rec.Index == nil {
+					return result, fmt.Errorf("line %d: index record without index", line)
+				}
+				// Index records are always applied, even when resuming, so
+				// that the following file records know where they belong
+				if err := flush(line - 1); err != nil {
+					return result, err
+				}
+				current = rec.Index
+				if !touched[current.ID] {
+					existed, err := im.ensureIndex(rec.Index)
+					if err != nil {
+						return result, fmt.Errorf("line %d: %w", line, err)
+					}
+					existing[current.ID] = existed
+					touched[current.ID] = true
+					result.Indexes = append(result.Indexes, current)
+				}
+
+			case RecordFile:
+				if line <= skip {
+					result.SkippedLines++
+					continue
+				}
+				if rec.File == nil {
+					return result, fmt.Errorf("line %d: file record without file", line)
+				}
+				if current == nil {
+					return result, fmt.Errorf("line %d: file record before any index record", line)
+				}
+				rec.File.ID = 0
+				rec.File.IndexID = current.ID
+				if existing[current.ID] {
+					apply, err := im.mergeFile(rec.File, &result.Merge)
+					if err != nil {
+						return result, fmt.Errorf("line %d: %w", line, err)
+					}
+					if !apply {
+						continue
+					}
+				}
+				chunk = append(chunk, rec.File)
+				if len(chunk) >= chunkSize {
+					if err := flush(line); err != nil {
+						return result, err
+					}
+				}
+
+			case RecordRemoved:
+				if line <= skip {
+					result.SkippedLines++
+					continue
+				}
+				if rec.File == nil || current == nil {
+					return result, fmt.Errorf("line %d: removed record without file or index", line)
+				}
+				rec.File.IndexID = current.ID
+				if existing[current.ID] {
+					apply, err := im.mergeRemoval(rec.File, &result.Merge)
+					if err != nil {
+						return result, fmt.Errorf("line %d: %w", line, err)
+					}
+					if !apply {
+						continue
+					}
+				}
+				if err := im.db.DeleteFile(rec.File.Path, current.ID); err != nil {
+					return result, fmt.Errorf("line %d: %w", line, err)
+				}
+				result.Removed++
+
+			default:
+				return result, fmt.Errorf("line %d: unknown record type %q", line, rec.Type)
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return result, readErr
+		}
+	}
+
+	if err := flush(line); err != nil {
+		return result, err
+	}
+
+	for _, index := range result.Indexes {
+		if err := im.db.UpdateIndexStats(index.ID); err != nil {
+			return result, fmt.Errorf("failed to update stats of %s: %w", index.Name, err)
+		}
+	}
+
+	if im.Source != "" {
+		if err := im.db.ClearImportCheckpoint(im.Source); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// ensureIndex creates the index if it does not exist yet and reports whether it already existed
+func (im *Importer) ensureIndex(index *models.Index) (bool, error) {
+	if _, err := im.db.GetIndex(index.ID); err == nil {
+		return true, nil
+	}
+	if err := im.db.CreateIndex(index); err != nil {
+		return false, fmt.Errorf("failed to create index %s: %w", index.Name, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/output"
+)
+
+// LinkFarmResult summarizes a link farm
+type LinkFarmResult struct {
+	Sets  int // folders created
+	Links int
+	// Offline counts copies left out because they are not on disk, e.g. on
+	// a drive that is not mounted
+	Offline int
+}
+
+// WriteLinkFarm creates one folder per duplicate set below dir, named after
+// the checksum, holding a symlink to every copy that is on disk. Link names
+// are the index name and the flattened relative path, so the extension is
+// kept and file browsers show thumbnails. dir must be empty or not exist.
+func WriteLinkFarm(dir string, sets []output.DuplicateSet) (*LinkFarmResult, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", dir)
+	}
+
+	result := &LinkFarmResult{}
+	for _, set := range sets {
+		setDir := filepath.Join(dir, linkFarmSetName(set.Checksum))
+		created := false
+		used := make(map[string]bool)
+		for _, file := range set.Files {
+			target := file.DiskPath()
+			if _, err := os.Stat(target); err != nil {
+				result.Offline++
+				continue
+			}
+			if !created {
+				if err := os.MkdirAll(setDir, 0755); err != nil {
+					return result, err
+				}
+				created = true
+				result.Sets++
+			}
+
+			// Attached catalogs may hold an index of the same name
+			base := linkFarmName(file.IndexName, file.RelativePath)
+			ext := filepath.Ext(base)
+			name := base
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(base, ext), i, ext)
+			}
+			used[name] = true
+
+			if err := os.Symlink(target, filepath.Join(setDir, name)); err != nil {
+				return result, err
+			}
+			result.Links++
+		}
+	}
+	return result, nil
+}
+
+// linkFarmSetName names the folder of a duplicate set
+func linkFarmSetName(checksum string) string {
+	if len(checksum) > 16 {
+		return checksum[:16]
+	}
+	return checksum
+}
+
+// linkFarmName flattens the location of a copy into one file name,
+// e.g. "Backup__photos_2019_img.jpg"
+func linkFarmName(indexName, relativePath string) string {
+	replacer := strings.NewReplacer("/", "_", "\\", "_")
+	return replacer.Replace(indexName) + "__" + replacer.Replace(relativePath)
+}
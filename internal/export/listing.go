@@ -0,0 +1,459 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/pkg/filter"
+)
+
+// Listing formats read by ReadListing
+const (
+	ListingEverything = "everything" // Everything file lists (EFU) and CSV exports
+	ListingLocate     = "locate"     // locate output, one path per line or NUL separated with -0
+	ListingWinCatalog = "wincatalog" // WinCatalog CSV exports
+)
+
+// ListingFormats lists the formats ReadListing reads
+var ListingFormats = []string{ListingEverything, ListingLocate, ListingWinCatalog}
+
+// fileAttributeDirectory is the Windows attribute bit of directories
+const fileAttributeDirectory = 0x10
+
+// filetimeUnixOffset is the number of seconds from 1601, where Windows
+// FILETIME values start counting 100ns intervals, to the Unix epoch
+const filetimeUnixOffset = 11644473600
+
+// Orders of the day and month in dates written with slashes, which
+// ReadListing cannot always tell apart: 03/04/2010 is March 4 in the US and
+// 3 April in Europe
+const (
+	DateOrderMDY = "mdy"
+	DateOrderDMY = "dmy"
+)
+
+// listingDateLayouts are the unambiguous date formats accepted in CSV
+// exports. Dotted dates are always written day first.
+var listingDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+// slashDateLayouts are the dates with slashes accepted in CSV exports, by
+// the order of their day and month
+var slashDateLayouts = map[string][]string{
+	DateOrderMDY: {
+		"01/02/2006 15:04:05",
+		"01/02/2006 15:04",
+		"1/2/2006 3:04:05 PM",
+		"1/2/2006 3:04 PM",
+		"01/02/2006",
+	},
+	DateOrderDMY: {
+		"02/01/2006 15:04:05",
+		"02/01/2006 15:04",
+		"2/1/2006 3:04:05 PM",
+		"2/1/2006 3:04 PM",
+		"02/01/2006",
+	},
+}
+
+// thousandsSize matches sizes in bytes written with thousands separators
+var thousandsSize = regexp.MustCompile(`^\d{1,3}(?:[,.' \x{00a0}]\d{3})+$`)
+
+// listingColumns maps the lower-cased CSV column names of Everything and
+// WinCatalog exports to the field they hold
+var listingColumns = map[string]string{
+	"filename":           "full",
+	"full path":          "full",
+	"full name":          "full",
+	"fullpath":           "full",
+	"name":               "name",
+	"file name":          "name",
+	"path":               "dir",
+	"folder":             "dir",
+	"location":           "dir",
+	"directory":          "dir",
+	"size":               "size",
+	"size (bytes)":       "size",
+	"size in bytes":      "size",
+	"date modified":      "mtime",
+	"modified":           "mtime",
+	"last modified":      "mtime",
+	"modification date":  "mtime",
+	"date/time modified": "mtime",
+	"attributes":         "attributes",
+	"type":               "type",
+	"kind":               "type",
+}
+
+// ListingEntry is a file or directory listed by another cataloging tool
+type ListingEntry struct {
+	// Path is absolute, or relative to the root of the drive
+	Path    string
+	Size    int64     // 0 when the listing has no sizes
+	ModTime time.Time // zero when the listing has no dates
+	IsDir   bool
+}
+
+// ReadListing reads the export of another cataloging tool in format and
+// calls fn with every entry. Listings without a type column tell
+// directories from files only by the entries below them, see ImportListing.
+// dateOrder is DateOrderMDY or DateOrderDMY for listings with dates written
+// with slashes; when it is empty, dates that read differently either way
+// are an error.
+func ReadListing(r io.Reader, format, dateOrder string, fn func(ListingEntry) error) error {
+	if dateOrder != "" && slashDateLayouts[dateOrder] == nil {
+		return fmt.Errorf("unknown date order %q, expected %s or %s", dateOrder, DateOrderMDY, DateOrderDMY)
+	}
+	switch format {
+	case ListingLocate:
+		return readLocateListing(r, fn)
+	case ListingEverything, ListingWinCatalog:
+		return readCSVListing(r, dateOrder, fn)
+	}
+	return fmt.Errorf("unknown listing format %q, expected one of %s", format, strings.Join(ListingFormats, ", "))
+}
+
+// readLocateListing reads one path per line, or NUL separated paths when
+// the input holds a NUL
+func readLocateListing(r io.Reader, fn func(ListingEntry) error) error {
+	br := bufio.NewReader(r)
+	sep := byte('\n')
+	if peek, _ := br.Peek(64 * 1024); bytes.IndexByte(peek, 0) >= 0 {
+		sep = 0
+	}
+	for {
+		data, err := br.ReadBytes(sep)
+		path := strings.TrimRight(string(bytes.TrimSuffix(data, []byte{sep})), "\r")
+		if path != "" {
+			if fnErr := fn(ListingEntry{Path: path}); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readCSVListing reads a CSV export with a header row naming its columns.
+// The delimiter is a comma or, for exports made with a European locale, a
+// semicolon.
+func readCSVListing(r io.Reader, dateOrder string, fn func(ListingEntry) error) error {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(4096)
+	if len(header) == 0 && err != nil {
+		return fmt.Errorf("empty listing")
+	}
+	if i := bytes.IndexByte(header, '\n'); i >= 0 {
+		header = header[:i]
+	}
+
+	reader := csv.NewReader(br)
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	names, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read the header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := listingColumns[name]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	_, hasFull := columns["full"]
+	_, hasName := columns["name"]
+	if !hasFull && !hasName {
+		return fmt.Errorf("no file name column in the header %q", strings.Join(names, ","))
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		line++
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := ListingEntry{Path: value("full")}
+		if entry.Path == "" {
+			entry.Path = joinListingPath(value("dir"), value("name"))
+		}
+		if entry.Path == "" {
+			continue
+		}
+		entry.Size = parseListingSize(value("size"))
+		if entry.ModTime, err = parseListingTime(value("mtime"), dateOrder); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if attributes, err := strconv.ParseInt(value("attributes"), 10, 64); err == nil {
+			entry.IsDir = attributes&fileAttributeDirectory != 0
+		}
+		switch strings.ToLower(value("type")) {
+		case "folder", "directory", "dir", "<dir>", "file folder":
+			entry.IsDir = true
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// joinListingPath joins the folder and name columns with the separator the
+// folder uses
+func joinListingPath(dir, name string) string {
+	if dir == "" || name == "" {
+		return dir + name
+	}
+	sep := "/"
+	if strings.Contains(dir, `\`) || paths.IsWindows(dir) {
+		sep = `\`
+	}
+	return strings.TrimRight(dir, `\/`) + sep + name
+}
+
+// parseListingSize reads a size in bytes, with or without thousands
+// separators, or a size with a unit such as "1.5 MB". Unreadable sizes,
+// including fractions of a byte, are 0.
+func parseListingSize(s string) int64 {
+	if thousandsSize.MatchString(s) {
+		digits := strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, s)
+		// Every group has the same separator, "1.234,567" is not a size
+		separator, _ := utf8.DecodeLastRuneInString(s[:len(s)-3])
+		if strings.Count(s, string(separator)) == (len(digits)-1)/3 {
+			s = digits
+		}
+	}
+	if size, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return size
+	}
+	if strings.IndexFunc(s, unicode.IsLetter) < 0 {
+		return 0
+	}
+	if size, err := filter.ParseBytes(strings.ReplaceAll(s, " ", "")); err == nil {
+		return size
+	}
+	return 0
+}
+
+// parseListingTime reads a Windows FILETIME, as written by Everything, or a
+// date in one of listingDateLayouts or slashDateLayouts. Dates with slashes
+// are read in dateOrder, or when it is empty in the only order they make
+// sense in; they are an error when both orders give different dates.
+// Unreadable dates are zero.
+func parseListingTime(s, dateOrder string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ticks, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ticks/10_000_000-filetimeUnixOffset, ticks%10_000_000*100), nil
+	}
+	for _, layout := range listingDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	orders := []string{DateOrderMDY, DateOrderDMY}
+	if dateOrder != "" {
+		orders = []string{dateOrder}
+	}
+	var found time.Time
+	for _, order := range orders {
+		for _, layout := range slashDateLayouts[order] {
+			t, err := time.ParseInLocation(layout, s, time.Local)
+			if err != nil {
+				continue
+			}
+			if !found.IsZero() && !found.Equal(t) {
+				return time.Time{}, fmt.Errorf("ambiguous date %q, give the order of day and month (%s or %s)", s, DateOrderMDY, DateOrderDMY)
+			}
+			found = t
+			break
+		}
+	}
+	return found, nil
+}
+
+// ListingResult summarises the import of a listing
+type ListingResult struct {
+	Files       int64
+	Directories int64
+	// Outside counts the entries that are not below the root
+	Outside int64
+}
+
+// ImportListing adds the entries of a listing below the root of index to
+// the index, creating it when it does not exist. Paths are made relative to
+// the root; relative paths are taken as relative to it already. Entries
+// with other entries below them are recorded as directories, whatever the
+// listing says. Files have no checksums; rehash the index once its drive is
+// mounted to compute them. Entries without a date keep the zero
+// modification time, which reports treat as unknown. See ReadListing for
+// dateOrder.
+func ImportListing(db *database.DB, index *models.Index, format, dateOrder string, r io.Reader, chunkSize int) (*ListingResult, error) {
+	if _, err := db.GetIndex(index.ID); err != nil {
+		if err := db.CreateIndex(index); err != nil {
+			return nil, fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	root := paths.NormalizeRoot(index.RootPath)
+	windows := paths.IsWindows(root)
+	result := &ListingResult{}
+	now := time.Now()
+	// parents holds the relative paths with entries below them, and
+	// listedDirs the ones the listing marked as directories
+	parents := make(map[string]bool)
+	listedDirs := make(map[string]bool)
+	var chunk []*models.FileEntry
+
+	err := ReadListing(r, format, dateOrder, func(entry ListingEntry) error {
+		rel, ok := listingRelPath(root, windows, entry.Path)
+		if !ok {
+			result.Outside++
+			return nil
+		}
+		if rel == "" {
+			return nil
+		}
+		rel, _ = models.SanitizePath(rel)
+		for dir := parentOf(rel); dir != "" && !parents[dir]; dir = parentOf(dir) {
+			parents[dir] = true
+		}
+
+		path := paths.Join(root, rel)
+		file := &models.FileEntry{
+			Path:         path,
+			RelativePath: rel,
+			Size:         entry.Size,
+			ModTime:      entry.ModTime,
+			IndexID:      index.ID,
+			LastScanned:  now,
+			IsDirectory:  entry.IsDir,
+			FirstSeen:    now,
+			LastSeen:     now,
+		}
+		if entry.IsDir {
+			file.Size = 0
+			listedDirs[rel] = true
+		} else {
+			result.Files++
+		}
+		chunk = append(chunk, file)
+		if len(chunk) >= chunkSize {
+			if err := db.UpsertFiles(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+		return nil
+	})
+	if err == nil && len(chunk) > 0 {
+		err = db.UpsertFiles(chunk)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	var unmarked []string
+	for dir := range parents {
+		if !listedDirs[dir] {
+			unmarked = append(unmarked, paths.Join(root, dir))
+		}
+	}
+	marked, err := db.MarkDirectories(index.ID, unmarked)
+	if err != nil {
+		return result, fmt.Errorf("failed to mark directories: %w", err)
+	}
+	result.Files -= marked
+	result.Directories = int64(len(listedDirs)) + marked
+
+	if err := db.UpdateIndexStats(index.ID); err != nil {
+		return result, fmt.Errorf("failed to update index stats: %w", err)
+	}
+	return result, nil
+}
+
+// listingRelPath returns the path of a listing entry relative to root with
+// forward slashes, and false when it is not below root
+func listingRelPath(root string, windows bool, path string) (string, bool) {
+	absolute := paths.IsWindows(path) || strings.HasPrefix(path, "/")
+	if !absolute {
+		rel := strings.Trim(path, `/`)
+		if windows {
+			rel = strings.Trim(strings.ReplaceAll(path, `\`, "/"), "/")
+		}
+		return rel, true
+	}
+	if paths.IsWindows(path) != windows {
+		return "", false
+	}
+
+	path = paths.NormalizeRoot(path)
+	if !paths.Contains(root, path) {
+		return "", false
+	}
+	rel := strings.TrimLeft(path[len(root):], `\/`)
+	if windows {
+		rel = strings.ReplaceAll(rel, `\`, "/")
+	}
+	return rel, true
+}
+
+// parentOf returns the parent of a relative path, or "" at the top
+func parentOf(rel string) string {
+	i := strings.LastIndexByte(rel, '/')
+	if i < 0 {
+		return ""
+	}
+	return rel[:i]
+}
@@ -0,0 +1,299 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/indexer"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+)
+
+// Manifest formats recognized by ReadManifest
+const (
+	ManifestHashdeep = "hashdeep"
+	ManifestChecksum = "checksum" // sha256sum, rhash and BSD style lines
+)
+
+var (
+	sha256Pattern  = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	gnuLinePattern = regexp.MustCompile(`^([0-9a-fA-F]{64}) [ *](.+)$`)
+	bsdLinePattern = regexp.MustCompile(`^SHA-?256 \((.+)\) = ([0-9a-fA-F]{64})$`)
+	sfvLinePattern = regexp.MustCompile(`^(.+) ([0-9a-fA-F]{64})$`)
+)
+
+// ManifestEntry is one file listed in a manifest
+type ManifestEntry struct {
+	Path   string
+	Size   int64 // -1 when the manifest has no sizes
+	SHA256 string
+}
+
+// Manifest is an audit manifest written by another tool. Only SHA-256 hashes
+// are kept, since those are the checksums of the catalog.
+type Manifest struct {
+	Format string
+	// InvokedFrom is the directory hashdeep ran in; relative paths start there
+	InvokedFrom string
+	Entries     []ManifestEntry
+	// Skipped counts lines without a SHA-256 hash, e.g. MD5-only entries
+	Skipped int
+}
+
+// ReadManifest parses a hashdeep manifest, or sha256sum/rhash output in GNU
+// ("hash  path"), BSD ("SHA256 (path) = hash") or SFV ("path hash") style.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	manifest := &Manifest{Format: ManifestChecksum}
+	var columns []string
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+			if strings.HasPrefix(line, "%%%% HASHDEEP-") {
+				manifest.Format = ManifestHashdeep
+				continue
+			}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if manifest.Format == ManifestHashdeep {
+			switch {
+			case strings.HasPrefix(line, "%%%% "):
+				columns = strings.Split(strings.TrimPrefix(line, "%%%% "), ",")
+			case strings.HasPrefix(line, "## Invoked from: "):
+				manifest.InvokedFrom = strings.TrimSpace(strings.TrimPrefix(line, "## Invoked from: "))
+			case strings.HasPrefix(line, "##"):
+			default:
+				if columns == nil {
+					return nil, fmt.Errorf("line %d: hashdeep entry before the column header", lineNo)
+				}
+				entry, ok, err := parseHashdeepLine(line, columns)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				if !ok {
+					manifest.Skipped++
+					continue
+				}
+				manifest.Entries = append(manifest.Entries, entry)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, ok := parseChecksumLine(line)
+		if !ok {
+			manifest.Skipped++
+			continue
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(manifest.Entries) == 0 {
+		return nil, fmt.Errorf("no SHA-256 entries found (only SHA-256 manifests can be compared)")
+	}
+	return manifest, nil
+}
+
+// parseHashdeepLine reads one data line of a hashdeep manifest. The file name
+// is always the last column and may itself contain commas.
+func parseHashdeepLine(line string, columns []string) (ManifestEntry, bool, error) {
+	fields := strings.SplitN(line, ",", len(columns))
+	if len(fields) != len(columns) {
+		return ManifestEntry{}, false, fmt.Errorf("expected %d columns, got %d", len(columns), len(fields))
+	}
+
+	entry := ManifestEntry{Size: -1}
+	for i, column := range columns {
+		switch column {
+		case "size":
+			size, err := strconv.ParseInt(fields[i], 10, 64)
+			if err != nil {
+				return ManifestEntry{}, false, fmt.Errorf("invalid size %q", fields[i])
+			}
+			entry.Size = size
+		case "sha256":
+			entry.SHA256 = strings.ToLower(fields[i])
+		case "filename":
+			entry.Path = fields[i]
+		}
+	}
+	if !sha256Pattern.MatchString(entry.SHA256) || entry.Path == "" {
+		return ManifestEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// parseChecksumLine reads one line of sha256sum or rhash output
+func parseChecksumLine(line string) (ManifestEntry, bool) {
+	// sha256sum escapes names holding a backslash or newline and marks
+	// such lines with a leading backslash
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	var hash, name string
+	if m := gnuLinePattern.FindStringSubmatch(line); m != nil {
+		hash, name = m[1], m[2]
+	} else if m := bsdLinePattern.FindStringSubmatch(line); m != nil {
+		name, hash = m[1], m[2]
+	} else if m := sfvLinePattern.FindStringSubmatch(line); m != nil {
+		name, hash = m[1], m[2]
+	} else {
+		return ManifestEntry{}, false
+	}
+
+	if escaped {
+		name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+	}
+	return ManifestEntry{Path: name, Size: -1, SHA256: strings.ToLower(hash)}, true
+}
+
+// ManifestDiff pairs a manifest entry with the indexed file at its path
+type ManifestDiff struct {
+	Entry ManifestEntry
+	File  *models.FileEntry
+}
+
+// ManifestComparison is the result of comparing an index with a manifest
+type ManifestComparison struct {
+	Matched    int
+	Mismatched []ManifestDiff
+	// Missing lists manifest entries with no file in the index
+	Missing []ManifestEntry
+	// Unhashed lists entries whose indexed file has no checksum yet
+	Unhashed []ManifestDiff
+	// NotIndexed lists entries the indexer never records: hidden, excluded
+	// or below a nested index root
+	NotIndexed []ManifestEntry
+	// Extra lists indexed files the manifest does not mention
+	Extra []*models.FileEntry
+	// Outside counts entries that are not below the manifest base
+	Outside int
+}
+
+// CompareManifest compares the files of an index with a manifest. base is
+// the directory of the manifest that corresponds to the index root; empty
+// means the index root itself. Relative manifest paths are read from the
+// directory hashdeep ran in, or from base when it is unknown. Entries the
+// indexer skips, given the exclude patterns it ran with, are not counted as
+// missing.
+func CompareManifest(db *database.DB, indexID string, manifest *Manifest, base string, excludes []string) (*ManifestComparison, error) {
+	index, err := db.GetIndex(indexID)
+	if err != nil {
+		return nil, err
+	}
+	if base == "" {
+		base = index.RootPath
+	}
+	base = manifestPath(base)
+
+	nested, err := db.ListNestedIndexes(indexID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nested indexes: %w", err)
+	}
+	var nestedRoots []string
+	for _, n := range nested {
+		if n.IndexID == indexID {
+			nestedRoots = append(nestedRoots, n.RelativePath)
+		}
+	}
+
+	files := make(map[string]*models.FileEntry)
+	err = db.EachFile(indexID, func(file *models.FileEntry) error {
+		if !file.IsDirectory && !file.IsSymlink() {
+			files[file.RelativePath] = file
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files: %w", err)
+	}
+
+	result := &ManifestComparison{}
+	listed := make(map[string]bool)
+	for _, entry := range manifest.Entries {
+		rel, ok := manifestRelative(entry.Path, manifest.InvokedFrom, base)
+		if !ok {
+			result.Outside++
+			continue
+		}
+		listed[rel] = true
+
+		file, found := files[rel]
+		switch {
+		case !found && indexer.SkippedPath(rel, excludes, nestedRoots):
+			result.NotIndexed = append(result.NotIndexed, entry)
+		case !found:
+			result.Missing = append(result.Missing, entry)
+		case file.Checksum == "":
+			result.Unhashed = append(result.Unhashed, ManifestDiff{Entry: entry, File: file})
+		case file.Checksum != entry.SHA256:
+			result.Mismatched = append(result.Mismatched, ManifestDiff{Entry: entry, File: file})
+		default:
+			result.Matched++
+		}
+	}
+
+	for rel, file := range files {
+		if !listed[rel] {
+			result.Extra = append(result.Extra, file)
+		}
+	}
+	sort.Slice(result.Extra, func(i, j int) bool {
+		return result.Extra[i].RelativePath < result.Extra[j].RelativePath
+	})
+	return result, nil
+}
+
+// manifestPath converts a manifest path to slash form. Windows paths written
+// by hashdeep use backslashes.
+func manifestPath(p string) string {
+	if paths.IsWindows(p) {
+		p = strings.ReplaceAll(p, `\`, "/")
+	}
+	return paths.ToSlash(p)
+}
+
+// manifestRelative maps a manifest path to a relative path of the index.
+// It returns false for paths outside base.
+func manifestRelative(p, invokedFrom, base string) (string, bool) {
+	p = manifestPath(p)
+	absolute := path.IsAbs(p) || paths.IsWindows(p)
+	if !absolute && invokedFrom == "" {
+		p = path.Clean(p)
+		return p, p != ".." && !strings.HasPrefix(p, "../")
+	}
+	if !absolute {
+		p = path.Join(manifestPath(invokedFrom), p)
+	}
+
+	p = path.Clean(p)
+	if p == base {
+		return "", false
+	}
+	prefix := strings.TrimSuffix(base, "/") + "/"
+	if !strings.HasPrefix(p, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(p, prefix), true
+}
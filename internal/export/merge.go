@@ -0,0 +1,149 @@
+package export
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// ConflictPolicy decides which side wins when an imported row diverges from
+// the row already stored for the same index and path
+type ConflictPolicy string
+
+const (
+	// PolicyNewest keeps whichever row was scanned most recently
+	PolicyNewest ConflictPolicy = "newest"
+	// PolicyLocal always keeps the local row
+	PolicyLocal ConflictPolicy = "local"
+	// PolicyRemote always takes the imported row
+	PolicyRemote ConflictPolicy = "remote"
+	// PolicyInteractive asks the Resolver for every conflict
+	PolicyInteractive ConflictPolicy = "interactive"
+)
+
+// ParseConflictPolicy validates a policy name. "newest-scan-wins" and
+// "prefer-local"/"prefer-remote" are accepted as aliases.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "newest", "newest-scan-wins":
+		return PolicyNewest, nil
+	case "local", "prefer-local":
+		return PolicyLocal, nil
+	case "remote", "prefer-remote":
+		return PolicyRemote, nil
+	case "interactive":
+		return PolicyInteractive, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy: %s (expected newest, local, remote or interactive)", name)
+}
+
+// Conflict describes a row that differs between the local catalog and the import.
+// Remote is a tombstone (only path fields set) when the import removes the file.
+type Conflict struct {
+	Local      *models.FileEntry
+	Remote     *models.FileEntry
+	Removal    bool
+	TookRemote bool
+}
+
+// Resolver is asked to settle a conflict under PolicyInteractive.
+// It returns true to take the imported row.
+type Resolver func(c *Conflict) (takeRemote bool, err error)
+
+// reportedConflicts caps the conflicts kept in a merge report, so merging a
+// diverged catalog does not hold every conflicting row in memory
+const reportedConflicts = 100
+
+// MergeReport summarises how an import was merged into existing indexes
+type MergeReport struct {
+	Added         int64
+	Updated       int64
+	Unchanged     int64
+	KeptLocal     int64
+	ConflictCount int64
+	// Conflicts holds the first conflicts, up to reportedConflicts
+	Conflicts []*Conflict
+}
+
+// sameContent reports whether two rows describe the same file version
+func sameContent(a, b *models.FileEntry) bool {
+	return a.Size == b.Size &&
+		a.ModTime.Unix() == b.ModTime.Unix() &&
+		a.Checksum == b.Checksum &&
+		a.IsDirectory == b.IsDirectory
+}
+
+// resolve applies the policy to a conflict and records it in the report
+func (im *Importer) resolve(c *Conflict, report *MergeReport) (bool, error) {
+	switch im.Policy {
+	case PolicyLocal:
+		c.TookRemote = false
+	case PolicyRemote:
+		c.TookRemote = true
+	case PolicyInteractive:
+		if im.Resolver == nil {
+			return false, fmt.Errorf("interactive conflict policy requires a resolver")
+		}
+		takeRemote, err := im.Resolver(c)
+		if err != nil {
+			return false, err
+		}
+		c.TookRemote = takeRemote
+	default:
+		// Remote timestamps are the scan time, or the removal time for tombstones
+		c.TookRemote = c.Remote.LastScanned.After(c.Local.LastScanned)
+	}
+
+	report.ConflictCount++
+	if len(report.Conflicts) < reportedConflicts {
+		report.Conflicts = append(report.Conflicts, c)
+	}
+	if !c.TookRemote {
+		report.KeptLocal++
+	}
+	return c.TookRemote, nil
+}
+
+// mergeFile decides whether an imported row should be written to an index
+// that already existed before the import
+func (im *Importer) mergeFile(remote *models.FileEntry, report *MergeReport) (bool, error) {
+	local, err := im.db.GetFile(remote.Path, remote.IndexID)
+	if errors.Is(err, sql.ErrNoRows) {
+		report.Added++
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", remote.Path, err)
+	}
+
+	if sameContent(local, remote) {
+		report.Unchanged++
+		return false, nil
+	}
+
+	apply, err := im.resolve(&Conflict{Local: local, Remote: remote}, report)
+	if apply {
+		report.Updated++
+		// Exports made with --no-last-seen carry no last seen time; keep
+		// the local one rather than resetting it
+		if remote.LastSeen.IsZero() {
+			remote.LastSeen = local.LastSeen
+		}
+	}
+	return apply, err
+}
+
+// mergeRemoval decides whether an imported removal should delete a local row
+func (im *Importer) mergeRemoval(remote *models.FileEntry, report *MergeReport) (bool, error) {
+	local, err := im.db.GetFile(remote.Path, remote.IndexID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", remote.Path, err)
+	}
+	return im.resolve(&Conflict{Local: local, Remote: remote, Removal: true}, report)
+}
@@ -0,0 +1,123 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// mlocateMagic starts every mlocate database
+const mlocateMagic = "\x00mlocate"
+
+// Entry types of the mlocate directory format
+const (
+	mlocateFile      = 0
+	mlocateDirectory = 1
+	mlocateEnd       = 2
+)
+
+// locateDir collects the entries of one directory of an index
+type locateDir struct {
+	modTime time.Time
+	entries map[string]bool // name -> is directory
+}
+
+// WriteLocateDB writes an index as an mlocate database, the format read by
+// locate(1) and converted by plocate-build(8). Paths are written under the
+// index root path, so the files show up in locate results even while the
+// drive is not mounted.
+func WriteLocateDB(db *database.DB, w io.Writer, indexID string) error {
+	index, err := db.GetIndex(indexID)
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Clean(index.RootPath)
+	dirs := map[string]*locateDir{root: {entries: map[string]bool{}}}
+	dirFor := func(path string) *locateDir {
+		d, ok := dirs[path]
+		if !ok {
+			d = &locateDir{entries: map[string]bool{}}
+			dirs[path] = d
+		}
+		return d
+	}
+
+	err = db.EachFile(indexID, func(file *models.FileEntry) error {
+		if file.RelativePath == "" || file.RelativePath == "." {
+			return nil
+		}
+		path := filepath.Join(root, file.RelativePath)
+		if file.IsDirectory {
+			dirFor(path).modTime = file.ModTime
+		}
+
+		// Register the entry with its parent and every ancestor up to the root
+		isDir := file.IsDirectory
+		for path != root {
+			parent := filepath.Dir(path)
+			if parent == path {
+				break
+			}
+			dirFor(parent).entries[filepath.Base(path)] = isDir
+			isDir = true
+			path = parent
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read files: %w", err)
+	}
+
+	paths := make([]string, 0, len(dirs))
+	for path := range dirs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+
+	// Header: magic, configuration block size, version, visibility check, padding, root
+	bw.WriteString(mlocateMagic)
+	binary.Write(bw, binary.BigEndian, uint32(0))
+	bw.Write([]byte{0, 0, 0, 0})
+	bw.WriteString(root + "\x00")
+
+	for _, path := range paths {
+		d := dirs[path]
+
+		var sec uint64
+		var nsec uint32
+		if !d.modTime.IsZero() {
+			sec, nsec = uint64(d.modTime.Unix()), uint32(d.modTime.Nanosecond())
+		}
+		binary.Write(bw, binary.BigEndian, sec)
+		binary.Write(bw, binary.BigEndian, nsec)
+		bw.Write([]byte{0, 0, 0, 0})
+		bw.WriteString(path + "\x00")
+
+		names := make([]string, 0, len(d.entries))
+		for name := range d.entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entryType := byte(mlocateFile)
+			if d.entries[name] {
+				entryType = mlocateDirectory
+			}
+			bw.WriteByte(entryType)
+			bw.WriteString(name + "\x00")
+		}
+		bw.WriteByte(mlocateEnd)
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,82 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/events"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// ServeEvents streams the event log as server-sent events on GET /events.
+// Every event is sent with its ID as the event ID, its kind as the event
+// type and its JSON form as data. A stream starts after the event given by
+// the Last-Event-ID header, so reconnecting clients miss nothing, or by the
+// after query parameter; otherwise it only sends new events. The kind
+// (repeatable) and index query parameters narrow the stream.
+func (s *Server) ServeEvents() {
+	s.mux.HandleFunc("GET /events", s.serveEvents)
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.EventFilter{Kinds: query["kind"]}
+	if index := query.Get("index"); index != "" {
+		found, err := s.db.FindIndexByNameOrID(index)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		filter.IndexID = found.ID
+	}
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = query.Get("after")
+	}
+	if after != "" {
+		id, err := strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid event ID %q", after), http.StatusBadRequest)
+			return
+		}
+		filter.AfterID = id
+	} else {
+		latest, err := s.db.ListEvents(database.EventFilter{Limit: 1})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(latest) > 0 {
+			filter.AfterID = latest[0].ID
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Follow polls the database, so events of scans run by other processes
+	// are streamed too. It returns once the client goes away.
+	events.Follow(r.Context(), s.db, filter, func(event *models.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Kind, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
@@ -0,0 +1,112 @@
+// Package fileserver serves the files of indexed drives that are online on
+// this machine over HTTP, read-only
+package fileserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/hooks"
+	"github.com/victor/stormindexer/internal/paths"
+)
+
+// Server serves the catalog over HTTP to the clients holding its token. What
+// it serves is added with ServeFiles and ServeThumbnails.
+type Server struct {
+	db        *database.DB
+	machineID string
+	token     string
+	mux       *http.ServeMux
+	// files is set once ServeFiles was called
+	files bool
+}
+
+// New creates a server for the indexes of machineID, serving nothing yet.
+// Every request must carry token, see ServeHTTP.
+func New(db *database.DB, machineID, token string) *Server {
+	return &Server{db: db, machineID: machineID, token: token, mux: http.NewServeMux()}
+}
+
+// ServeFiles serves GET and HEAD requests for /files/<index>/<relative
+// path>, where index is an index ID, unambiguous ID prefix or name. Only
+// regular files recorded in the catalog are served, from indexes of this
+// machine whose root is online. Range requests are supported, so players
+// can seek in videos and interrupted downloads can resume.
+func (s *Server) ServeFiles() {
+	s.mux.HandleFunc("GET /files/{index}/{path...}", s.serveFile)
+	s.files = true
+}
+
+// ServeHTTP checks the token, given as a bearer token, as the password of
+// basic authentication or in the token query parameter for players that
+// cannot set headers, and serves the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="stormindexer"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	given := r.URL.Query().Get("token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		given = bearer
+	} else if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	index, err := s.db.FindIndexByNameOrID(r.PathValue("index"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if index.MachineID != s.machineID || !hooks.IsOnline(index) {
+		http.Error(w, fmt.Sprintf("%s is not online on this machine", index.Name), http.StatusServiceUnavailable)
+		return
+	}
+
+	// The relative path is looked up in the catalog, so nothing outside the
+	// indexed files can be reached, whatever the path holds
+	rel := path.Clean("/" + r.PathValue("path"))[1:]
+	file, err := s.db.GetFile(paths.Join(index.RootPath, rel), index.ID)
+	if err != nil || file.IsDirectory || file.LinkTarget != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(file.DiskPath())
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "file no longer exists on the drive; reindex "+index.Name, http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if file.Checksum != "" && info.Size() == file.Size && info.ModTime().Unix() == file.ModTime.Unix() {
+		w.Header().Set("ETag", `"`+file.Checksum+`"`)
+	}
+	if r.URL.Query().Has("download") {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(info.Name())))
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,231 @@
+package fileserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/events"
+	"github.com/victor/stormindexer/internal/jobs"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+func setupServer(t *testing.T) (*Server, string) {
+	tmpDir := t.TempDir()
+	db := testutil.NewCatalog(t).DB
+
+	root := filepath.Join(tmpDir, "drive")
+	os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "a b.txt"), []byte("0123456789"), 0644)
+	os.WriteFile(filepath.Join(root, "secret.txt"), []byte("not indexed"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "outside.txt"), []byte("outside"), 0644)
+
+	now := time.Now()
+	db.CreateIndex(&models.Index{ID: "drive-id", Name: "drive", RootPath: root, CreatedAt: now, MachineID: "here"})
+	db.CreateIndex(&models.Index{ID: "other-id", Name: "other", RootPath: root, CreatedAt: now, MachineID: "elsewhere"})
+	for _, id := range []string{"drive-id", "other-id"} {
+		db.UpsertFile(&models.FileEntry{
+			Path: filepath.Join(root, "docs", "a b.txt"), RelativePath: "docs/a b.txt", Size: 10,
+			ModTime: now, IndexID: id, LastScanned: now,
+		})
+		db.UpsertFile(&models.FileEntry{
+			Path: filepath.Join(root, "docs"), RelativePath: "docs", IndexID: id, IsDirectory: true,
+			ModTime: now, LastScanned: now,
+		})
+	}
+
+	server := New(db, "here", "s3cret")
+	server.ServeFiles()
+	return server, root
+}
+
+func TestServer(t *testing.T) {
+	server, _ := setupServer(t)
+
+	tests := []struct {
+		name   string
+		url    string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{"no token", "/files/drive/docs/a%20b.txt", nil, http.StatusUnauthorized, ""},
+		{"wrong token", "/files/drive/docs/a%20b.txt?token=nope", nil, http.StatusUnauthorized, ""},
+		{"query token", "/files/drive/docs/a%20b.txt?token=s3cret", nil, http.StatusOK, "0123456789"},
+		{"bearer", "/files/drive-id/docs/a%20b.txt", map[string]string{"Authorization": "Bearer s3cret"}, http.StatusOK, "0123456789"},
+		{"range", "/files/drive/docs/a%20b.txt?token=s3cret", map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "234"},
+		{"directory", "/files/drive/docs?token=s3cret", nil, http.StatusNotFound, ""},
+		{"not in catalog", "/files/drive/secret.txt?token=s3cret", nil, http.StatusNotFound, ""},
+		{"traversal", "/files/drive/docs/..%2f..%2foutside.txt?token=s3cret", nil, http.StatusNotFound, ""},
+		{"other machine", "/files/other/docs/a%20b.txt?token=s3cret", nil, http.StatusServiceUnavailable, ""},
+		{"unknown index", "/files/nope/docs/a%20b.txt?token=s3cret", nil, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.name, tt.body, rec.Body.String())
+		}
+	}
+}
+
+func TestServer_BasicAuthAndRemovedFiles(t *testing.T) {
+	server, root := setupServer(t)
+
+	req := httptest.NewRequest(http.MethodHead, "/files/drive/docs/a%20b.txt", nil)
+	req.SetBasicAuth("anyone", "s3cret")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected 200 with Accept-Ranges, got %d %q", rec.Code, rec.Header().Get("Accept-Ranges"))
+	}
+
+	os.Remove(filepath.Join(root, "docs", "a b.txt"))
+	req = httptest.NewRequest(http.MethodGet, "/files/drive/docs/a%20b.txt?token=s3cret", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGone {
+		t.Errorf("Expected status %d for a file removed from the drive, got %d", http.StatusGone, rec.Code)
+	}
+}
+
+func TestServer_Thumbnails(t *testing.T) {
+	server, root := setupServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/thumbs/abc?token=s3cret", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d before ServeThumbnails, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	server.ServeThumbnails()
+	now := time.Now()
+	for _, id := range []string{"drive-id", "other-id"} {
+		server.db.UpsertFile(&models.FileEntry{
+			Path: filepath.Join(root, "photo.jpg"), RelativePath: "photo.jpg", Size: 4, Checksum: "abc",
+			ModTime: now, IndexID: id, LastScanned: now,
+		})
+	}
+	server.db.PutThumbnail("abc", []byte("jpeg"))
+
+	req = httptest.NewRequest(http.MethodGet, "/thumbs/abc?token=s3cret", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "jpeg" || rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("Expected the JPEG thumbnail, got %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/duplicates?token=s3cret", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	page := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	for _, want := range []string{`src="/thumbs/abc?token=s3cret"`, `href="/files/drive-id/photo.jpg?token=s3cret"`, "other"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected the duplicates page to contain %q", want)
+		}
+	}
+	if strings.Contains(page, "/files/other-id/") {
+		t.Error("Expected no link to a copy on another machine")
+	}
+}
+
+func TestServer_Events(t *testing.T) {
+	server, _ := setupServer(t)
+	server.ServeEvents()
+	events.PollInterval = 10 * time.Millisecond
+	bus := events.New(server.db)
+	bus.Publish(models.EventScanStarted, "drive-id", "/drive", "before the stream")
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/events?token=s3cret&kind=" + models.EventScanFinished)
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	bus.Publish(models.EventScanStarted, "drive-id", "/drive", "filtered out")
+	bus.Publish(models.EventScanFinished, "drive-id", "/drive", "index finished")
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Reading the stream failed: %v", err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if !strings.HasPrefix(lines[0], "id: ") || lines[1] != "event: "+models.EventScanFinished || !strings.Contains(lines[2], `"detail":"index finished"`) {
+		t.Errorf("Expected only the new scan.finished event, got %q", lines)
+	}
+}
+
+func TestServer_Jobs(t *testing.T) {
+	server, _ := setupServer(t)
+	server.ServeJobs()
+
+	tracker, err := jobs.Start(server.db, "reindex", "drive-id", "/drive")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer tracker.Finish(nil)
+
+	request := func(method, url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(method, url+"?token=s3cret", nil))
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/jobs")
+	var list []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0]["status"] != "running" {
+		t.Fatalf("Expected the running job, got %d %s (%v)", rec.Code, rec.Body.String(), err)
+	}
+
+	id := strconv.FormatInt(tracker.Job.ID, 10)
+	if rec := request(http.MethodPost, "/jobs/"+id+"/cancel"); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	if job, _ := server.db.GetJob(tracker.Job.ID); job == nil || !job.CancelRequested {
+		t.Errorf("Expected the cancellation to be requested")
+	}
+
+	tracker.Finish(nil)
+	tests := map[string]int{
+		"/jobs/" + id + "/cancel": http.StatusConflict,
+		"/jobs/999/cancel":        http.StatusNotFound,
+		"/jobs/abc/cancel":        http.StatusBadRequest,
+	}
+	for url, status := range tests {
+		if rec := request(http.MethodPost, url); rec.Code != status {
+			t.Errorf("%s: expected status %d, got %d", url, status, rec.Code)
+		}
+	}
+	if rec := request(http.MethodGet, "/jobs/"+id+"/cancel"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected cancelling to require POST, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/victor/stormindexer/internal/jobs"
+)
+
+// ServeJobs serves the running and queued jobs as JSON on GET /jobs, and
+// cancels one on POST /jobs/<id>/cancel. Cancellation is cooperative, as
+// with the cancel command: the job stops at its next safe checkpoint, on
+// whichever machine it runs.
+func (s *Server) ServeJobs() {
+	s.mux.HandleFunc("GET /jobs", s.serveJobs)
+	s.mux.HandleFunc("POST /jobs/{id}/cancel", s.cancelJob)
+}
+
+func (s *Server) serveJobs(w http.ResponseWriter, r *http.Request) {
+	list, err := s.db.ListJobs(false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Report the state the jobs command shows, so dead jobs are told apart
+	now := time.Now()
+	for _, job := range list {
+		job.Status = jobs.State(job, now)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid job ID %q", r.PathValue("id")), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetJob(id); err != nil {
+		http.Error(w, fmt.Sprintf("job %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	job, err := jobs.Cancel(s.db, id, false)
+	if errors.Is(err, jobs.ErrNotRunning) {
+		http.Error(w, fmt.Sprintf("job %d is not running (%s)", id, jobs.State(job, time.Now())), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job.CancelRequested = true
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,139 @@
+package fileserver
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/hooks"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// duplicatesLimit is the number of duplicate groups the duplicates page shows
+const duplicatesLimit = 200
+
+// ServeThumbnails adds the thumbnails stored by index --thumbnails and a
+// page browsing the duplicates that have one:
+//
+//	GET /thumbs/<checksum>
+//	GET /duplicates
+func (s *Server) ServeThumbnails() {
+	s.mux.HandleFunc("GET /thumbs/{checksum}", s.serveThumbnail)
+	s.mux.HandleFunc("GET /duplicates", s.serveDuplicates)
+}
+
+func (s *Server) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	data, err := s.db.GetThumbnail(r.PathValue("checksum"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// A checksum always names the same content, so is its thumbnail
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Write(data)
+}
+
+type duplicateCopy struct {
+	Index string
+	Path  string
+	Size  string
+	// Link is the URL of the copy under /files, empty when files are not
+	// served or its index is not online on this machine
+	Link string
+}
+
+type duplicateGroup struct {
+	Thumbnail string
+	Copies    []duplicateCopy
+}
+
+var duplicatesPage = template.Must(template.New("duplicates").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Duplicates - stormindexer</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+.group { display: flex; gap: 1em; align-items: flex-start; border-bottom: 1px solid #ddd; padding: .5em 0; }
+.group img { width: 160px; flex: none; object-fit: contain; }
+td { padding: 0 .5em; }
+</style>
+</head>
+<body>
+<h1>Duplicates</h1>
+{{if not .}}<p>No duplicates with a thumbnail. Index with --checksums --thumbnails to add some.</p>{{end}}
+{{range .}}<div class="group">
+<img src="{{.Thumbnail}}" alt="" loading="lazy">
+<table>
+{{range .Copies}}<tr><td>{{.Index}}</td><td>{{if .Link}}<a href="{{.Link}}">{{.Path}}</a>{{else}}{{.Path}}{{end}}</td><td>{{.Size}}</td></tr>
+{{end}}</table>
+</div>
+{{end}}</body>
+</html>
+`))
+
+// serveDuplicates lists the content stored more than once, the groups
+// wasting the most space first, with its thumbnail and copies
+func (s *Server) serveDuplicates(w http.ResponseWriter, r *http.Request) {
+	checksums, err := s.db.ListDuplicateThumbnails(duplicatesLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	indexes, err := s.db.ListIndexes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	online := make(map[string]bool)
+	for _, index := range indexes {
+		online[index.ID] = s.files && index.MachineID == s.machineID && hooks.IsOnline(index)
+	}
+
+	// Images load without the headers of the page, so a token given in the
+	// query is passed on to the links
+	suffix := ""
+	if token := r.URL.Query().Get("token"); token != "" {
+		suffix = "?token=" + url.QueryEscape(token)
+	}
+
+	groups := make([]duplicateGroup, 0, len(checksums))
+	for _, checksum := range checksums {
+		copies, err := s.db.FindFiles(database.FindOptions{Checksum: checksum, FileType: "file"})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		group := duplicateGroup{Thumbnail: "/thumbs/" + url.PathEscape(checksum) + suffix}
+		for _, c := range copies {
+			entry := duplicateCopy{Index: c.IndexName, Path: c.RelativePath, Size: humanize.Bytes(c.Size)}
+			if online[c.IndexID] {
+				entry.Link = "/files/" + url.PathEscape(c.IndexID) + "/" + escapePath(c.RelativePath) + suffix
+			}
+			group.Copies = append(group.Copies, entry)
+		}
+		groups = append(groups, group)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	duplicatesPage.Execute(w, groups)
+}
+
+// escapePath escapes each element of a slash separated relative path
+func escapePath(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,90 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// DefaultMountTimeout bounds how long a mount hook may take to bring a drive online
+const DefaultMountTimeout = 2 * time.Minute
+
+// ErrOffline is returned when an index root is not reachable and no hook is configured
+var ErrOffline = errors.New("index root is offline")
+
+// pollInterval is how often the index root is checked after the hook returned
+var pollInterval = 500 * time.Millisecond
+
+// MountHook runs a user command that brings an offline index online, e.g. a
+// script that asks to plug in a drive or mounts a network share
+type MountHook struct {
+	Command string
+	Timeout time.Duration
+}
+
+// NewMountHook creates a mount hook for a shell command
+func NewMountHook(command string, timeout time.Duration) *MountHook {
+	if timeout <= 0 {
+		timeout = DefaultMountTimeout
+	}
+	return &MountHook{Command: command, Timeout: timeout}
+}
+
+// IsOnline reports whether the root of an index is reachable
+func IsOnline(index *models.Index) bool {
+	info, err := os.Stat(index.RootPath)
+	return err == nil && info.IsDir()
+}
+
+// EnsureOnline runs the hook when the root of the index is offline and waits
+// until the root appears or the timeout expires. The command runs through
+// sh with the index name, root path and ID as $1, $2 and $3, and the same
+// values in STORMINDEXER_INDEX_NAME, STORMINDEXER_INDEX_ROOT and
+// STORMINDEXER_INDEX_ID.
+func (h *MountHook) EnsureOnline(index *models.Index) error {
+	if IsOnline(index) {
+		return nil
+	}
+	if h == nil || h.Command == "" {
+		return fmt.Errorf("%s (%s): %w", index.Name, index.RootPath, ErrOffline)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command, "stormindexer", index.Name, index.RootPath, index.ID)
+	cmd.Env = append(os.Environ(),
+		"STORMINDEXER_INDEX_NAME="+index.Name,
+		"STORMINDEXER_INDEX_ROOT="+index.RootPath,
+		"STORMINDEXER_INDEX_ID="+index.ID,
+	)
+	// Hooks may prompt the user; keep stdout free for command output
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("mount hook for %s timed out after %s", index.Name, h.Timeout)
+		}
+		return fmt.Errorf("mount hook for %s failed: %w", index.Name, err)
+	}
+
+	// The hook may return before the drive is mounted (e.g. after a prompt)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for !IsOnline(index) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s (%s) still offline %s after the mount hook: %w", index.Name, index.RootPath, h.Timeout, ErrOffline)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+func TestEnsureOnline_AlreadyOnline(t *testing.T) {
+	index := &models.Index{ID: "id", Name: "Online", RootPath: t.TempDir()}
+
+	if err := NewMountHook("exit 1", time.Second).EnsureOnline(index); err != nil {
+		t.Errorf("Expected online index to skip the hook, got %v", err)
+	}
+}
+
+func TestEnsureOnline_NoHook(t *testing.T) {
+	index := &models.Index{ID: "id", Name: "Offline", RootPath: filepath.Join(t.TempDir(), "missing")}
+
+	var hook *MountHook
+	if err := hook.EnsureOnline(index); !errors.Is(err, ErrOffline) {
+		t.Errorf("Expected ErrOffline, got %v", err)
+	}
+}
+
+func TestEnsureOnline_HookMounts(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "drive")
+	index := &models.Index{ID: "id", Name: "WD Red 4TB", RootPath: root}
+
+	hook := NewMountHook(`test "$1" = "WD Red 4TB" && mkdir -p "$STORMINDEXER_INDEX_ROOT"`, 5*time.Second)
+	if err := hook.EnsureOnline(index); err != nil {
+		t.Fatalf("EnsureOnline failed: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("Expected hook to create %s: %v", root, err)
+	}
+}
+
+func TestEnsureOnline_Timeout(t *testing.T) {
+	index := &models.Index{ID: "id", Name: "Slow", RootPath: filepath.Join(t.TempDir(), "missing")}
+
+	start := time.Now()
+	err := NewMountHook("exec sleep 10", 200*time.Millisecond).EnsureOnline(index)
+	if err == nil {
+		t.Fatal("Expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected hook to be killed at the timeout, took %s", elapsed)
+	}
+
+	// A hook that succeeds without mounting anything waits until the timeout
+	err = NewMountHook("true", 200*time.Millisecond).EnsureOnline(index)
+	if !errors.Is(err, ErrOffline) {
+		t.Errorf("Expected ErrOffline, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package indexer
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// HashAlgorithm is a hash function measured by BenchHash
+type HashAlgorithm struct {
+	Name string
+	// Secure algorithms are collision resistant, so matching checksums can
+	// be trusted to mean matching content
+	Secure bool
+	New    func() hash.Hash
+}
+
+// HashAlgorithms lists the algorithms BenchHash measures. The catalog
+// stores SHA-256; the others are measured for comparison.
+var HashAlgorithms = []HashAlgorithm{
+	{Name: "sha256", Secure: true, New: sha256.New},
+	{Name: "sha512", Secure: true, New: sha512.New},
+	{Name: "sha1", New: sha1.New},
+	{Name: "md5", New: md5.New},
+	{Name: "crc32c", New: func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }},
+	{Name: "fnv1a-64", New: func() hash.Hash { return fnv.New64a() }},
+}
+
+// minHashTime is how long each algorithm hashes the samples, repeating
+// them when they are small, so short samples still give stable rates
+const minHashTime = 200 * time.Millisecond
+
+// HashResult is the measured speed of one algorithm
+type HashResult struct {
+	Algorithm HashAlgorithm
+	Bytes     int64
+	Duration  time.Duration
+}
+
+// Rate returns the hashing speed in bytes per second
+func (r HashResult) Rate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// HashBenchmark compares hash algorithms on sample files of a drive
+type HashBenchmark struct {
+	Files     int
+	ReadBytes int64
+	ReadTime  time.Duration
+	// Results are sorted from fastest to slowest
+	Results []HashResult
+}
+
+// ReadRate returns the speed the samples were read from the drive in bytes
+// per second. Files already in the page cache read faster than the drive.
+func (b *HashBenchmark) ReadRate() float64 {
+	if b.ReadTime <= 0 {
+		return 0
+	}
+	return float64(b.ReadBytes) / b.ReadTime.Seconds()
+}
+
+// Recommend picks the algorithm for an index on this drive and hardware:
+// the fastest secure algorithm, unless SHA-256 already hashes faster than
+// the drive reads, in which case the drive is the bottleneck anyway. It
+// also reports whether hashing is bound by the drive.
+func (b *HashBenchmark) Recommend() (HashResult, bool) {
+	var sha256Result, fastest HashResult
+	for _, r := range b.Results {
+		if r.Algorithm.Name == "sha256" {
+			sha256Result = r
+		}
+		if r.Algorithm.Secure && r.Rate() > fastest.Rate() {
+			fastest = r
+		}
+	}
+	if sha256Result.Rate() >= b.ReadRate() {
+		return sha256Result, true
+	}
+	return fastest, fastest.Rate() >= b.ReadRate()
+}
+
+// BenchHash reads up to sampleBytes of the files below the root path, with
+// the same rules as Index, and measures how fast each of HashAlgorithms
+// hashes them. The samples are held in memory, so hashing is timed
+// separately from reading.
+func (idx *Indexer) BenchHash(sampleBytes int64) (*HashBenchmark, error) {
+	bench := &HashBenchmark{}
+	var samples [][]byte
+
+	err := filepath.Walk(idx.rootPath, func(path string, info os.FileInfo, err error) error {
+		if err := idx.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return nil
+		}
+		if idx.skip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			return nil
+		}
+		if bench.ReadBytes >= sampleBytes {
+			return filepath.SkipAll
+		}
+
+		start := time.Now()
+		data, err := readSample(path, sampleBytes-bench.ReadBytes)
+		if err != nil {
+			return nil
+		}
+		bench.ReadTime += time.Since(start)
+		bench.ReadBytes += int64(len(data))
+		bench.Files++
+		samples = append(samples, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bench.ReadBytes == 0 {
+		return bench, nil
+	}
+
+	for _, algorithm := range HashAlgorithms {
+		result := HashResult{Algorithm: algorithm}
+		start := time.Now()
+		for result.Duration < minHashTime {
+			for _, data := range samples {
+				h := algorithm.New()
+				h.Write(data)
+				h.Sum(nil)
+				result.Bytes += int64(len(data))
+			}
+			result.Duration = time.Since(start)
+		}
+		bench.Results = append(bench.Results, result)
+	}
+	sort.SliceStable(bench.Results, func(i, j int) bool {
+		return bench.Results[i].Rate() > bench.Results[j].Rate()
+	})
+	return bench, nil
+}
+
+// readSample reads up to limit bytes of a file
+func readSample(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// ErrTimeLimit is returned by scans stopped at the limit set with
+// SetMaxDuration. What was indexed is kept, and the next scan resumes after
+// the last path processed.
+var ErrTimeLimit = errors.New("scan reached its time limit")
+
+// SetMaxDuration makes Index and Reindex stop cleanly once d has elapsed,
+// e.g. so a scheduled scan on a laptop is done before it is packed. 0 means
+// no limit.
+func (idx *Indexer) SetMaxDuration(d time.Duration) {
+	idx.maxDuration = d
+}
+
+// SetRestart makes Index and Reindex walk the whole tree again, ignoring
+// where an earlier scan stopped
+func (idx *Indexer) SetRestart(restart bool) {
+	idx.restart = restart
+}
+
+// beginPass loads the checkpoint the scan resumes from and applies the time
+// limit. The returned function releases the time limit.
+func (idx *Indexer) beginPass(start time.Time) (func(), error) {
+	idx.resume, idx.lastPath, idx.passStart = "", "", start
+	if idx.restart {
+		if err := idx.db.ClearScanCheckpoint(idx.indexID); err != nil {
+			return nil, fmt.Errorf("failed to clear checkpoint: %w", err)
+		}
+	} else {
+		checkpoint, err := idx.db.GetScanCheckpoint(idx.indexID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		if checkpoint != nil {
+			idx.resume, idx.passStart = checkpoint.Path, checkpoint.StartedAt
+			fmt.Printf("Resuming after %s, where the scan stopped on %s\n",
+				checkpoint.Path, checkpoint.UpdatedAt.Local().Format("2006-01-02 15:04"))
+		}
+	}
+
+	if idx.maxDuration <= 0 {
+		return func() {}, nil
+	}
+	parent := idx.ctx
+	ctx, cancel := context.WithTimeout(parent, idx.maxDuration)
+	idx.ctx = ctx
+	return func() {
+		cancel()
+		idx.ctx = parent
+	}, nil
+}
+
+// timeLimit returns ErrTimeLimit for the walk error of a scan stopped by
+// the limit of SetMaxDuration
+func (idx *Indexer) timeLimit(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && idx.maxDuration > 0 {
+		return ErrTimeLimit
+	}
+	return err
+}
+
+// endPass records where a stopped scan resumes, or clears the checkpoint
+// once the pass walked the whole tree
+func (idx *Indexer) endPass(stopped bool) error {
+	if !stopped {
+		return idx.db.ClearScanCheckpoint(idx.indexID)
+	}
+	path := idx.resume
+	if idx.lastPath != "" {
+		path = idx.relativeSlash(idx.lastPath)
+	}
+	if path == "" {
+		return nil
+	}
+	return idx.db.SaveScanCheckpoint(&database.ScanCheckpoint{IndexID: idx.indexID, Path: path, StartedAt: idx.passStart})
+}
+
+// resumed reports whether a walked path was processed by the scans before
+// the checkpoint: it comes earlier in walk order, which is lexical per
+// directory, and is not one of the directories holding the checkpoint
+func (idx *Indexer) resumed(path string) bool {
+	rel := idx.relativeSlash(path)
+	if idx.resume == "" || rel == "." {
+		return false
+	}
+	a, b := strings.Split(rel, "/"), strings.Split(idx.resume, "/")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// seenThisPass reports whether an entry Reindex did not walk was found by
+// the scans before the checkpoint; those they did not see are gone. Unchanged
+// files are only touched, so this goes by last_seen rather than last_scanned.
+func (idx *Indexer) seenThisPass(file *models.FileEntry) bool {
+	return idx.resumed(file.DiskPath()) && !file.LastSeen.Before(idx.passStart.Truncate(time.Second))
+}
+
+func (idx *Indexer) relativeSlash(path string) string {
+	rel, err := filepath.Rel(idx.rootPath, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
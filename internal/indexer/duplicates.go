@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/progress"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// DuplicateMatch records a freshly hashed file whose content already exists
+// in another index of the catalog
+type DuplicateMatch struct {
+	File     *models.FileEntry
+	Existing []*database.FileWithIndex
+}
+
+// Duplicates returns the duplicates discovered during the last Index or Reindex run
+func (idx *Indexer) Duplicates() []DuplicateMatch {
+	return idx.duplicates
+}
+
+// checkDuplicate looks up the checksum of a freshly hashed file in the other
+// indexes and records a match. In verbose mode the match is printed right away.
+func (idx *Indexer) checkDuplicate(file *models.FileEntry, bar *progress.Bar) {
+	if file.Checksum == "" || file.IsDirectory {
+		return
+	}
+
+	copies, err := idx.db.FindFiles(database.FindOptions{Checksum: file.Checksum, FileType: "file"})
+	if err != nil {
+		return
+	}
+
+	var existing []*database.FileWithIndex
+	for _, c := range copies {
+		if c.IndexID != idx.indexID {
+			existing = append(existing, c)
+		}
+	}
+	if len(existing) == 0 {
+		return
+	}
+
+	idx.duplicates = append(idx.duplicates, DuplicateMatch{File: file, Existing: existing})
+	detail := fmt.Sprintf("already on %s at %s", existing[0].IndexName, existing[0].Path)
+	if len(existing) > 1 {
+		detail += fmt.Sprintf(" (+%d more)", len(existing)-1)
+	}
+	idx.events.Publish(models.EventDuplicateDetected, idx.indexID, file.Path, detail)
+
+	if idx.verbose {
+		bar.Clear()
+		fmt.Fprintf(os.Stderr, "= %s already exists on %s at %s\n",
+			file.RelativePath, existing[0].IndexName, existing[0].Path)
+	}
+}
+
+// printDuplicateSummary reports the duplicates found during a run. Without
+// verbose mode only the first few are listed.
+func (idx *Indexer) printDuplicateSummary() {
+	if len(idx.duplicates) == 0 {
+		return
+	}
+
+	var size int64
+	for _, d := range idx.duplicates {
+		size += d.File.Size
+	}
+	fmt.Printf("\n%d scanned file(s) (%s) already exist elsewhere in the catalog:\n",
+		len(idx.duplicates), humanize.Bytes(size))
+
+	limit := len(idx.duplicates)
+	if !idx.verbose && limit > 10 {
+		limit = 10
+	}
+	for _, d := range idx.duplicates[:limit] {
+		first := d.Existing[0]
+		fmt.Printf("  = %s → %s: %s", d.File.RelativePath, first.IndexName, first.Path)
+		if len(d.Existing) > 1 {
+			fmt.Printf(" (+%d more)", len(d.Existing)-1)
+		}
+		fmt.Println()
+	}
+	if limit < len(idx.duplicates) {
+		fmt.Printf("  ... and %d more (use --verbose to list all)\n", len(idx.duplicates)-limit)
+	}
+}
+
+// printDedupeSavings prints how many bytes of the index already exist in other
+// indexes, which tells whether a drive is worth keeping at all
+func (idx *Indexer) printDedupeSavings() {
+	stats, err := idx.db.GetRedundancyStats(idx.indexID)
+	if err != nil || stats.HashedBytes == 0 {
+		return
+	}
+
+	percent := float64(stats.RedundantBytes) * 100 / float64(stats.HashedBytes)
+	fmt.Printf("Dedupe savings: %s of %s hashed (%.0f%%, %d files) already exist elsewhere in the catalog\n",
+		humanize.Bytes(stats.RedundantBytes), humanize.Bytes(stats.HashedBytes), percent, stats.RedundantFiles)
+}
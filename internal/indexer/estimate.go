@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Rough costs used to project an index from an estimate
+const (
+	rowWriteTime  = 600 * time.Microsecond // one file upserted into the database
+	rowBytes      = 290                    // timestamps, IDs and index entries of a file row
+	checksumBytes = 130                    // checksum column and its index entry
+	pageOverhead  = 1.15                   // database pages are not full
+)
+
+// Estimate is the result of a dry-run scan: what indexing a path would
+// cover, without writing anything
+type Estimate struct {
+	Files       int64
+	Directories int64
+	Bytes       int64
+	PathBytes   int64 // total length of absolute and relative paths
+	WalkTime    time.Duration
+	HashedBytes int64 // bytes read to measure the hashing speed
+	HashTime    time.Duration
+}
+
+// HashRate returns the measured hashing speed in bytes per second, or 0
+// when nothing was sampled
+func (e *Estimate) HashRate() float64 {
+	if e.HashedBytes == 0 || e.HashTime <= 0 {
+		return 0
+	}
+	return float64(e.HashedBytes) / e.HashTime.Seconds()
+}
+
+// IndexTime projects how long indexing would take, with or without checksums
+func (e *Estimate) IndexTime(checksums bool) time.Duration {
+	total := e.WalkTime + time.Duration(e.Files+e.Directories)*rowWriteTime
+	if checksums {
+		if rate := e.HashRate(); rate > 0 {
+			total += time.Duration(float64(e.Bytes) / rate * float64(time.Second))
+		}
+	}
+	return total
+}
+
+// DBGrowth projects how many bytes the index would add to the database
+func (e *Estimate) DBGrowth(checksums bool) int64 {
+	perRow := int64(rowBytes)
+	if checksums {
+		perRow += checksumBytes
+	}
+	// Each path is stored in the row and in its indexes
+	raw := (e.Files+e.Directories)*perRow + e.PathBytes*2
+	return int64(float64(raw) * pageOverhead)
+}
+
+// Estimate walks the root path with the same rules as Index (hidden files
+// and excludes are skipped) and only counts and sizes what it finds. Up to
+// sampleBytes of file content are hashed to measure the hashing speed of
+// the drive. Nothing is written to the database.
+func (idx *Indexer) Estimate(sampleBytes int64) (*Estimate, error) {
+	estimate := &Estimate{}
+	start := time.Now()
+
+	err := filepath.Walk(idx.rootPath, func(path string, info os.FileInfo, err error) error {
+		if err := idx.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			return nil
+		}
+		if idx.skip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relativePath, _ := filepath.Rel(idx.rootPath, path)
+		estimate.PathBytes += int64(len(path) + len(relativePath))
+
+		if info.IsDir() {
+			estimate.Directories++
+			return nil
+		}
+		estimate.Files++
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		estimate.Bytes += info.Size()
+
+		if estimate.HashedBytes < sampleBytes {
+			hashStart := time.Now()
+			n, err := hashSample(path, sampleBytes-estimate.HashedBytes)
+			if err == nil {
+				estimate.HashedBytes += n
+				estimate.HashTime += time.Since(hashStart)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hashing is not part of the walk that indexing would do
+	estimate.WalkTime = time.Since(start) - estimate.HashTime
+	return estimate, nil
+}
+
+// hashSample hashes up to limit bytes of a file and returns how many were read
+func hashSample(path string, limit int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(sha256.New(), io.LimitReader(f, limit))
+}
@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateExcludes checks that every exclude pattern is a valid glob
+func ValidateExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether a path relative to an index root matches one of
+// the exclude patterns. Patterns without a slash match any file or directory
+// with that name (e.g. "node_modules", "*.tmp"); patterns with a slash match
+// the whole relative path (e.g. "build/cache"). An excluded directory is
+// skipped with everything below it.
+func Excluded(relativePath string, patterns []string) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	name := relativePath[strings.LastIndex(relativePath, "/")+1:]
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = relativePath
+		}
+		if ok, _ := path.Match(strings.Trim(pattern, "/"), target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skip reports whether a walked path is left out of the index: hidden
+// files and directories, those matching an exclude pattern, and the roots
+// of nested indexes
+func (idx *Indexer) skip(walked string) bool {
+	if filepath.Base(walked)[0] == '.' || idx.isNestedRoot(walked) {
+		return true
+	}
+	if len(idx.excludes) == 0 || walked == idx.rootPath {
+		return false
+	}
+	relativePath, err := filepath.Rel(idx.rootPath, walked)
+	if err != nil {
+		return false
+	}
+	return Excluded(relativePath, idx.excludes)
+}
+
+// SkippedPath reports whether a scan leaves a path relative to the index
+// root out, because it or a directory above it is hidden, excluded or the
+// root of a nested index (given relative to the index root)
+func SkippedPath(relativePath string, excludes, nestedRoots []string) bool {
+	parts := strings.Split(filepath.ToSlash(relativePath), "/")
+	for i, part := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		if strings.HasPrefix(part, ".") || Excluded(prefix, excludes) {
+			return true
+		}
+		for _, root := range nestedRoots {
+			if prefix == filepath.ToSlash(root) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,20 +1,58 @@
 package indexer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
-	"github.com/schollz/progressbar/v3"
 	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/events"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/internal/progress"
+	"github.com/victor/stormindexer/pkg/humanize"
 )
 
 type Indexer struct {
 	db      *database.DB
 	indexID string
 	rootPath string
+	verbose bool
+	ctx     context.Context
+	excludes []string
+	workers  int
+	retries    int
+	retryDelay time.Duration
+
+	duplicates []DuplicateMatch
+	// scanErrors lists the paths the current scan could not read, and
+	// unreadablePaths the files and directories among them it could not
+	// stat or list
+	scanErrors      []*models.ScanError
+	unreadablePaths []string
+	// nestedRoots maps the roots of other indexes below the root path to
+	// their IDs, and nested lists those the current scan skipped
+	nestedRoots map[string]string
+	nested      []*models.NestedIndex
+	// rootInfo is the root directory as the current scan found it
+	rootInfo os.FileInfo
+	// events queues the events of the current scan, see SetEvents
+	events   *events.Batch
+	// skipDirectories descends into directories without storing them
+	skipDirectories bool
+	// thumbnails stores previews of the images and videos hashed
+	thumbnails bool
+	// maxDuration stops scans cleanly, see SetMaxDuration. resume is the
+	// checkpoint the scan resumes after, lastPath the last path it
+	// processed and passStart when the pass over the tree started.
+	maxDuration time.Duration
+	restart     bool
+	resume      string
+	lastPath    string
+	passStart   time.Time
 }
 
 // NewIndexer creates a new indexer instance
@@ -23,13 +61,64 @@ func NewIndexer(db *database.DB, indexID, rootPath string) *Indexer {
 		db:       db,
 		indexID:  indexID,
 		rootPath: rootPath,
+		ctx:      context.Background(),
+		retries:    DefaultRetries,
+		retryDelay: DefaultRetryDelay,
 	}
 }
 
+// SetVerbose enables printing of per-file details (such as duplicates) while scanning
+func (idx *Indexer) SetVerbose(verbose bool) {
+	idx.verbose = verbose
+}
+
+// SetExcludes sets glob patterns for files and directories to leave out of
+// the index (see Excluded)
+func (idx *Indexer) SetExcludes(patterns []string) {
+	idx.excludes = patterns
+}
+
+// SetWorkers sets the number of files Rehash hashes in parallel. Parallel
+// reads help on SSDs and arrays but slow down a single spinning disk.
+func (idx *Indexer) SetWorkers(workers int) {
+	idx.workers = workers
+}
+
+// SetContext sets a context whose cancellation stops a scan at the next
+// file. Files indexed so far are kept.
+func (idx *Indexer) SetContext(ctx context.Context) {
+	idx.ctx = ctx
+}
+
+// SetEvents sets the bus Reindex publishes file changes on, and Index and
+// Reindex the duplicates they detect. Events are recorded in batches and
+// the rest when the scan ends.
+func (idx *Indexer) SetEvents(bus *events.Bus) {
+	idx.events = bus.Batch()
+}
+
+// SetSkipDirectories makes Index and Reindex leave directories out of the
+// index, which keeps the database smaller and scans faster on trees with
+// many directories. database.DB.SetSkipDirectories drops the directory
+// entries stored before.
+func (idx *Indexer) SetSkipDirectories(skip bool) {
+	idx.skipDirectories = skip
+}
+
 // Index scans the root path and indexes all files
 func (idx *Indexer) Index(calculateChecksums bool) error {
 	startTime := time.Now()
+	idx.duplicates = nil
+	idx.nested = nil
+	idx.resetScanErrors()
+	idx.markRoot()
 	fmt.Printf("Starting index of: %s\n", idx.rootPath)
+	release, err := idx.beginPass(startTime)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer idx.events.Flush()
 
 	// First, count total files for progress bar (with 1 minute timeout)
 	totalFiles := int64(0)
@@ -41,7 +130,7 @@ func (idx *Indexer) Index(calculateChecksums bool) error {
 			if err != nil {
 				return nil
 			}
-			if filepath.Base(path)[0] == '.' {
+			if idx.skip(path) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
@@ -71,109 +160,70 @@ func (idx *Indexer) Index(calculateChecksums bool) error {
 		size        int64
 	}{}
 
-	// Create progress bar
-	var bar *progressbar.ProgressBar
+	// Create progress bar, indeterminate when we don't know the total
+	var bar *progress.Bar
 	if countingTimedOut {
-		// Use indeterminate progress bar when we don't know the total
-		bar = progressbar.NewOptions64(
-			-1, // -1 means indeterminate
-			progressbar.OptionSetDescription("Indexing files"),
-			progressbar.OptionSetWidth(60),
-			progressbar.OptionShowBytes(false),
-			progressbar.OptionShowCount(),
-			progressbar.OptionSetWriter(os.Stderr),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "=",
-				SaucerHead:    ">",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionThrottle(100*time.Millisecond),
-		)
+		bar = progress.New("Indexing files", -1)
 		defer bar.Close()
 	} else if totalFiles > 0 {
-		// Use determinate progress bar when we know the total
-		bar = progressbar.NewOptions64(
-			totalFiles,
-			progressbar.OptionSetDescription("Indexing files"),
-			progressbar.OptionSetWidth(60),
-			progressbar.OptionShowBytes(false),
-			progressbar.OptionShowCount(),
-			progressbar.OptionSetWriter(os.Stderr),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "=",
-				SaucerHead:    ">",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionThrottle(100*time.Millisecond),
-		)
+		bar = progress.New("Indexing files", totalFiles)
 		defer bar.Close()
 	} else {
 		fmt.Fprintf(os.Stderr, "No files found to index.\n")
 	}
 
 	var currentFile string
-	err := filepath.Walk(idx.rootPath, func(path string, info os.FileInfo, err error) error {
+	err = idx.walk(func(path string, info os.FileInfo, err error) error {
+		if err := idx.ctx.Err(); err != nil {
+			return err
+		}
 		if err != nil {
 			return nil // Continue despite errors
 		}
 
-		// Skip hidden files and directories
-		if filepath.Base(path)[0] == '.' {
+		// Skip hidden and excluded files and directories, and nested indexes
+		if idx.skip(path) {
 			if info.IsDir() {
+				idx.recordNested(path)
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
+		if info.IsDir() && idx.skipDirectories {
+			stats.directories++
+			return nil
+		}
+
 		relativePath, err := filepath.Rel(idx.rootPath, path)
 		if err != nil {
 			relativePath = path
 		}
 
-		fileEntry := &models.FileEntry{
-			Path:         path,
-			RelativePath: relativePath,
-			Size:         info.Size(),
-			ModTime:      info.ModTime(),
-			IndexID:      idx.indexID,
-			LastScanned:  time.Now(),
-			IsDirectory:  info.IsDir(),
-		}
+		fileEntry := idx.newFileEntry(path, relativePath, info)
 
-		// Calculate checksum for files (not directories)
-		if !info.IsDir() && calculateChecksums {
-			checksum, err := models.CalculateChecksum(path)
+		// Calculate checksum for regular files (not directories or symlinks)
+		if info.Mode().IsRegular() && calculateChecksums {
+			checksum, err := idx.checksum(path)
 			if err != nil {
-				// Don't print warning during progress bar, just continue
+				// Recorded in the scan errors, reported at the end
 			} else {
 				fileEntry.Checksum = checksum
+				idx.checkDuplicate(fileEntry, bar)
+				idx.thumbnail(fileEntry, bar)
 			}
 		}
 
 		if err := idx.db.UpsertFile(fileEntry); err != nil {
-			if bar != nil {
-				bar.Close()
-			}
-			return fmt.Errorf("failed to upsert file %s: %w", path, err)
+			bar.Close()
+			return fmt.Errorf("failed to upsert file %s: %w", fileEntry.Path, err)
 		}
 
 		if info.IsDir() {
 			stats.directories++
 		} else {
 			stats.files++
-			stats.size += info.Size()
+			stats.size += fileEntry.Size
 			
 			// Update progress bar with current file and stats
 			if bar != nil {
@@ -182,34 +232,120 @@ func (idx *Indexer) Index(calculateChecksums bool) error {
 					currentFile = "..." + currentFile[len(currentFile)-37:]
 				}
 				bar.Describe(fmt.Sprintf("Indexing: %s | %d files | %s", 
-					currentFile, stats.files, formatBytes(stats.size)))
-				_ = bar.Add64(1) // Ignore error, just update progress
+					currentFile, stats.files, humanize.Bytes(stats.size)))
+				bar.Add(1)
 			}
 		}
 
 		return nil
 	})
+	if err == nil && idx.rootGone() {
+		err = ErrRootGone
+	}
 
-	if err != nil {
+	// A cancelled scan, one stopped at its time limit and one whose drive
+	// was unmounted keep what they indexed so far
+	err = idx.timeLimit(err)
+	cancelled := errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeLimit) || errors.Is(err, ErrRootGone)
+	if err != nil && !cancelled {
 		return fmt.Errorf("walk error: %w", err)
 	}
+	if err := idx.endPass(cancelled); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
 
 	// Update index statistics
 	if err := idx.db.UpdateIndexStats(idx.indexID); err != nil {
 		return fmt.Errorf("failed to update index stats: %w", err)
 	}
+	if err := idx.saveScanErrors(); err != nil {
+		return fmt.Errorf("failed to save scan errors: %w", err)
+	}
+
+	if cancelled {
+		fmt.Printf("✗ Indexing %s: %d files, %d directories kept\n", stopReason(err), stats.files, stats.directories)
+		return err
+	}
+	if err := idx.saveNestedAfterPass(); err != nil {
+		return fmt.Errorf("failed to save nested indexes: %w", err)
+	}
 
 	elapsed := time.Since(startTime)
 	fmt.Printf("✓ Indexing complete: %d files, %d directories, %s total size (completed in %s)\n",
-		stats.files, stats.directories, formatBytes(stats.size), formatDuration(elapsed))
+		stats.files, stats.directories, humanize.Bytes(stats.size), humanize.Duration(elapsed))
+	idx.printNestedSummary()
+	idx.printScanErrorSummary()
+	idx.printDuplicateSummary()
+	if calculateChecksums {
+		idx.printDedupeSavings()
+	}
 
 	return nil
 }
 
+// newFileEntry builds the entry for a walked path. Symlinks are recorded
+// with their target and no size, and are never hashed. Names that are not
+// printable UTF-8 are stored escaped, with the raw path kept for disk access.
+func (idx *Indexer) newFileEntry(path, relativePath string, info os.FileInfo) *models.FileEntry {
+	sanitizedPath, printable := models.SanitizePath(path)
+	relativePath, _ = models.SanitizePath(relativePath)
+	relativePath = paths.ToSlash(relativePath)
+	fileEntry := &models.FileEntry{
+		Path:         sanitizedPath,
+		RelativePath: relativePath,
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+		IndexID:      idx.indexID,
+		LastScanned:  time.Now(),
+		IsDirectory:  info.IsDir(),
+	}
+
+	if !printable {
+		fileEntry.RawPath = []byte(path)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		fileEntry.Size = 0
+		fileEntry.LinkTarget, _ = os.Readlink(path)
+	}
+
+	return fileEntry
+}
+
+// movedFrom returns the indexed file a new file was moved or renamed from:
+// an entry with the same content whose path no longer exists. Each old
+// entry is matched at most once.
+func movedFrom(file *models.FileEntry, existingByChecksum map[string][]*models.FileEntry) *models.FileEntry {
+	if file.Checksum == "" {
+		return nil
+	}
+	candidates := existingByChecksum[file.Checksum]
+	for i, candidate := range candidates {
+		if candidate.Size != file.Size {
+			continue
+		}
+		if _, err := os.Lstat(candidate.DiskPath()); os.IsNotExist(err) {
+			existingByChecksum[file.Checksum] = append(candidates[:i:i], candidates[i+1:]...)
+			return candidate
+		}
+	}
+	return nil
+}
+
 // Reindex updates the index by scanning for changes
 func (idx *Indexer) Reindex(calculateChecksums bool) error {
 	startTime := time.Now()
+	idx.duplicates = nil
+	idx.nested = nil
+	idx.resetScanErrors()
+	idx.markRoot()
 	fmt.Printf("Reindexing: %s\n", idx.rootPath)
+	release, err := idx.beginPass(startTime)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer idx.events.Flush()
 
 	// Get existing files from database
 	existingFiles, err := idx.db.ListFiles(idx.indexID)
@@ -218,8 +354,12 @@ func (idx *Indexer) Reindex(calculateChecksums bool) error {
 	}
 
 	existingMap := make(map[string]*models.FileEntry)
+	existingByChecksum := make(map[string][]*models.FileEntry)
 	for _, file := range existingFiles {
-		existingMap[file.Path] = file
+		existingMap[file.DiskPath()] = file
+		if file.Checksum != "" && !file.IsDirectory {
+			existingByChecksum[file.Checksum] = append(existingByChecksum[file.Checksum], file)
+		}
 	}
 
 	// Count total files for progress bar (with 1 minute timeout)
@@ -232,7 +372,7 @@ func (idx *Indexer) Reindex(calculateChecksums bool) error {
 			if err != nil {
 				return nil
 			}
-			if filepath.Base(path)[0] == '.' {
+			if idx.skip(path) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
@@ -260,74 +400,47 @@ func (idx *Indexer) Reindex(calculateChecksums bool) error {
 		added      int64
 		updated    int64
 		removed    int64
+		moved      int64
 		size       int64
 		processed  int64
 	}{}
 
 	// Track files found during scan
 	foundPaths := make(map[string]bool)
+	var unchangedPaths []string
 
-	// Create progress bar
-	var bar *progressbar.ProgressBar
+	// Create progress bar, indeterminate when we don't know the total
+	var bar *progress.Bar
 	if countingTimedOut {
-		// Use indeterminate progress bar when we don't know the total
-		bar = progressbar.NewOptions64(
-			-1, // -1 means indeterminate
-			progressbar.OptionSetDescription("Reindexing files"),
-			progressbar.OptionSetWidth(60),
-			progressbar.OptionShowCount(),
-			progressbar.OptionSetWriter(os.Stderr),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "=",
-				SaucerHead:    ">",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionThrottle(100*time.Millisecond),
-		)
+		bar = progress.New("Reindexing files", -1)
 		defer bar.Close()
 	} else if totalFiles > 0 {
-		// Use determinate progress bar when we know the total
-		bar = progressbar.NewOptions64(
-			totalFiles,
-			progressbar.OptionSetDescription("Reindexing files"),
-			progressbar.OptionSetWidth(60),
-			progressbar.OptionShowCount(),
-			progressbar.OptionSetWriter(os.Stderr),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "=",
-				SaucerHead:    ">",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionThrottle(100*time.Millisecond),
-		)
+		bar = progress.New("Reindexing files", totalFiles)
 		defer bar.Close()
 	}
 
 	var currentFile string
-	err = filepath.Walk(idx.rootPath, func(path string, info os.FileInfo, err error) error {
+	err = idx.walk(func(path string, info os.FileInfo, err error) error {
+		if err := idx.ctx.Err(); err != nil {
+			return err
+		}
 		if err != nil {
 			return nil
 		}
 
-		if filepath.Base(path)[0] == '.' {
+		if idx.skip(path) {
 			if info.IsDir() {
+				idx.recordNested(path)
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
+		// Directory entries stored before were dropped, see SetSkipDirectories
+		if info.IsDir() && idx.skipDirectories {
+			return nil
+		}
+
 		foundPaths[path] = true
 
 		relativePath, err := filepath.Rel(idx.rootPath, path)
@@ -335,39 +448,42 @@ func (idx *Indexer) Reindex(calculateChecksums bool) error {
 			relativePath = path
 		}
 
+		fileEntry := idx.newFileEntry(path, relativePath, info)
 		existing, exists := existingMap[path]
 		needsUpdate := !exists ||
-			existing.Size != info.Size() ||
-			existing.ModTime.Unix() != info.ModTime().Unix()
+			existing.Size != fileEntry.Size ||
+			existing.ModTime.Unix() != fileEntry.ModTime.Unix() ||
+			existing.LinkTarget != fileEntry.LinkTarget ||
+			(calculateChecksums && info.Mode().IsRegular() && existing.Checksum == "")
 
 		if needsUpdate {
-			fileEntry := &models.FileEntry{
-				Path:         path,
-				RelativePath: relativePath,
-				Size:         info.Size(),
-				ModTime:      info.ModTime(),
-				IndexID:      idx.indexID,
-				LastScanned:  time.Now(),
-				IsDirectory:  info.IsDir(),
-			}
-
-			// Calculate checksum if needed
-			if !info.IsDir() && (calculateChecksums || !exists || existing.Checksum == "") {
-				checksum, err := models.CalculateChecksum(path)
+			// Rehash regular files whenever size or mtime changed, so an old
+			// checksum is never kept for new content
+			if info.Mode().IsRegular() {
+				checksum, err := idx.checksum(path)
 				if err != nil {
-					// Don't print warning during progress bar
+					// Unreadable right now: drop the old checksum and mark it stale
+					fileEntry.ChecksumStale = exists && (existing.Checksum != "" || existing.ChecksumStale)
 				} else {
 					fileEntry.Checksum = checksum
+					idx.checkDuplicate(fileEntry, bar)
+					idx.thumbnail(fileEntry, bar)
 				}
-			} else if exists {
-				fileEntry.Checksum = existing.Checksum
 			}
 
-			if err := idx.db.UpsertFile(fileEntry); err != nil {
-				if bar != nil {
-					bar.Close()
+			change := "modified"
+			if !exists {
+				change = "added"
+				if previous := movedFrom(fileEntry, existingByChecksum); previous != nil {
+					fileEntry.FirstSeen = previous.FirstSeen
+					stats.moved++
+					change = "moved from " + previous.RelativePath
 				}
-				return fmt.Errorf("failed to upsert file %s: %w", path, err)
+			}
+
+			if err := idx.db.UpsertFile(fileEntry); err != nil {
+				bar.Close()
+				return fmt.Errorf("failed to upsert file %s: %w", fileEntry.Path, err)
 			}
 
 			if exists {
@@ -375,10 +491,17 @@ func (idx *Indexer) Reindex(calculateChecksums bool) error {
 			} else {
 				stats.added++
 			}
+			if !info.IsDir() {
+				idx.events.Publish(models.EventFileChanged, idx.indexID, fileEntry.Path, change)
+			}
+		} else {
+			unchangedPaths = append(unchangedPaths, fileEntry.Path)
+			// Content hashed by earlier scans gets its missing preview
+			idx.thumbnail(existing, bar)
 		}
 
 		if !info.IsDir() {
-			stats.size += info.Size()
+			stats.size += fileEntry.Size
 			stats.processed++
 			
 			// Update progress bar
@@ -389,67 +512,76 @@ func (idx *Indexer) Reindex(calculateChecksums bool) error {
 				}
 				bar.Describe(fmt.Sprintf("Reindexing: %s | +%d ~%d", 
 					currentFile, stats.added, stats.updated))
-				_ = bar.Add64(1) // Ignore error, just update progress
+				bar.Add(1)
 			}
 		}
 
 		return nil
 	})
+	if err == nil && idx.rootGone() {
+		err = ErrRootGone
+	}
 
-	if err != nil {
+	// A cancelled scan, one stopped at its time limit and one whose drive
+	// was unmounted keep what they indexed so far
+	err = idx.timeLimit(err)
+	cancelled := errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeLimit) || errors.Is(err, ErrRootGone)
+	if err != nil && !cancelled {
 		return fmt.Errorf("walk error: %w", err)
 	}
 
-	// Remove files that no longer exist
-	for path := range existingMap {
-		if !foundPaths[path] {
-			if err := idx.db.DeleteFile(path, idx.indexID); err != nil {
+	if err := idx.db.TouchFiles(idx.indexID, unchangedPaths, time.Now()); err != nil {
+		return fmt.Errorf("failed to update last seen times: %w", err)
+	}
+
+	// Remove files that no longer exist. A cancelled scan has not seen
+	// every path, so it cannot tell what was removed.
+	for path, file := range existingMap {
+		if cancelled {
+			break
+		}
+		if !foundPaths[path] && !idx.unreadable(path) && !idx.seenThisPass(file) {
+			if err := idx.db.DeleteFile(file.Path, idx.indexID); err != nil {
 				// Don't print warning, just continue
 			} else {
 				stats.removed++
+				if !file.IsDirectory {
+					idx.events.Publish(models.EventFileChanged, idx.indexID, file.Path, "removed")
+				}
 			}
 		}
 	}
 
+	if err := idx.endPass(cancelled); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
 	// Update index statistics
 	if err := idx.db.UpdateIndexStats(idx.indexID); err != nil {
 		return fmt.Errorf("failed to update index stats: %w", err)
 	}
-
-	elapsed := time.Since(startTime)
-	fmt.Printf("✓ Reindexing complete: %d added, %d updated, %d removed (completed in %s)\n",
-		stats.added, stats.updated, stats.removed, formatDuration(elapsed))
-
-	return nil
-}
-
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+	if err := idx.saveScanErrors(); err != nil {
+		return fmt.Errorf("failed to save scan errors: %w", err)
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
 
-func formatDuration(d time.Duration) string {
-	if d < time.Second {
-		return fmt.Sprintf("%dms", d.Milliseconds())
+	if cancelled {
+		fmt.Printf("✗ Reindexing %s: %d added, %d updated, %d moved kept; removals skipped\n",
+			stopReason(err), stats.added, stats.updated, stats.moved)
+		return err
 	}
-	if d < time.Minute {
-		return fmt.Sprintf("%.1fs", d.Seconds())
+	if err := idx.saveNestedAfterPass(); err != nil {
+		return fmt.Errorf("failed to save nested indexes: %w", err)
 	}
-	minutes := int(d.Minutes())
-	seconds := int(d.Seconds()) % 60
-	if minutes < 60 {
-		return fmt.Sprintf("%dm %ds", minutes, seconds)
+
+	elapsed := time.Since(startTime)
+	fmt.Printf("✓ Reindexing complete: %d added, %d updated, %d removed, %d moved (completed in %s)\n",
+		stats.added, stats.updated, stats.removed, stats.moved, humanize.Duration(elapsed))
+	idx.printNestedSummary()
+	idx.printScanErrorSummary()
+	idx.printDuplicateSummary()
+	if calculateChecksums {
+		idx.printDedupeSavings()
 	}
-	hours := minutes / 60
-	minutes = minutes % 60
-	return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
-}
 
+	return nil
+}
@@ -1,23 +1,27 @@
 package indexer
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/victor/stormindexer/internal/database"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+	"github.com/victor/stormindexer/pkg/fixture"
 )
 
 func setupTestIndexer(t *testing.T) (*Indexer, *database.DB, string) {
 	tmpDir := t.TempDir()
-	dbPath := filepath.Join(tmpDir, "test.db")
-
-	db, err := database.NewDB(dbPath)
-	if err != nil {
-		t.Fatalf("Failed to create test database: %v", err)
-	}
+	catalog := testutil.NewCatalog(t)
 
 	testRoot := filepath.Join(tmpDir, "testroot")
 	if err := os.MkdirAll(testRoot, 0755); err != nil {
@@ -25,21 +29,11 @@ func setupTestIndexer(t *testing.T) (*Indexer, *database.DB, string) {
 	}
 
 	indexID := "test-index"
-	index := &models.Index{
-		ID:        indexID,
-		Name:      "Test Index",
-		RootPath:  testRoot,
-		CreatedAt: time.Now(),
-		MachineID: "test-machine",
-	}
-
-	if err := db.CreateIndex(index); err != nil {
-		t.Fatalf("Failed to create index: %v", err)
-	}
+	catalog.AddIndex(&models.Index{ID: indexID, Name: "Test Index", RootPath: testRoot, MachineID: "test-machine"})
 
-	idxr := NewIndexer(db, indexID, testRoot)
+	idxr := NewIndexer(catalog.DB, indexID, testRoot)
 
-	return idxr, db, testRoot
+	return idxr, catalog.DB, testRoot
 }
 
 func TestNewIndexer(t *testing.T) {
@@ -264,3 +258,813 @@ func TestReindex_DeleteFile(t *testing.T) {
 	}
 }
 
+
+func TestIndex_ReportsDuplicatesFromOtherIndexes(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	os.WriteFile(filepath.Join(testRoot, "photo.jpg"), []byte("same bytes"), 0644)
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if len(idxr.Duplicates()) != 0 {
+		t.Errorf("Expected no duplicates in a single index, got %d", len(idxr.Duplicates()))
+	}
+
+	// Second drive holding a copy of the same file
+	otherRoot := filepath.Join(t.TempDir(), "other")
+	os.MkdirAll(otherRoot, 0755)
+	os.WriteFile(filepath.Join(otherRoot, "copy.jpg"), []byte("same bytes"), 0644)
+	os.WriteFile(filepath.Join(otherRoot, "unique.txt"), []byte("unique"), 0644)
+
+	db.CreateIndex(&models.Index{ID: "other-index", Name: "Other", RootPath: otherRoot, CreatedAt: time.Now(), MachineID: "test-machine"})
+	other := NewIndexer(db, "other-index", otherRoot)
+	if err := other.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	dups := other.Duplicates()
+	if len(dups) != 1 {
+		t.Fatalf("Expected 1 duplicate, got %d", len(dups))
+	}
+	if dups[0].File.RelativePath != "copy.jpg" {
+		t.Errorf("Expected copy.jpg, got %s", dups[0].File.RelativePath)
+	}
+	if dups[0].Existing[0].IndexName != "Test Index" {
+		t.Errorf("Expected existing copy on 'Test Index', got %s", dups[0].Existing[0].IndexName)
+	}
+}
+
+func TestIndex_RecordsSymlinks(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	os.WriteFile(filepath.Join(testRoot, "target.txt"), []byte("content"), 0644)
+	link := filepath.Join(testRoot, "link.txt")
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	os.Symlink("missing.txt", filepath.Join(testRoot, "dangling.txt"))
+
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	file, err := db.GetFile(link, "test-index")
+	if err != nil {
+		t.Fatalf("Symlink not indexed: %v", err)
+	}
+	if file.LinkTarget != "target.txt" {
+		t.Errorf("Expected link target 'target.txt', got '%s'", file.LinkTarget)
+	}
+	if file.Checksum != "" || file.Size != 0 {
+		t.Errorf("Expected symlink not to be followed, got checksum %q size %d", file.Checksum, file.Size)
+	}
+
+	if _, err := db.GetFile(filepath.Join(testRoot, "dangling.txt"), "test-index"); err != nil {
+		t.Errorf("Dangling symlink should be indexed: %v", err)
+	}
+}
+
+func TestReindex_TracksSeenTimesAndMoves(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	keep := filepath.Join(testRoot, "keep.txt")
+	old := filepath.Join(testRoot, "old-name.txt")
+	os.WriteFile(keep, []byte("unchanged"), 0644)
+	os.WriteFile(old, []byte("moved content"), 0644)
+
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	before, _ := db.GetFile(old, "test-index")
+	keepBefore, _ := db.GetFile(keep, "test-index")
+
+	time.Sleep(1100 * time.Millisecond)
+	newPath := filepath.Join(testRoot, "sub", "new-name.txt")
+	os.MkdirAll(filepath.Dir(newPath), 0755)
+	os.Rename(old, newPath)
+
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	moved, err := db.GetFile(newPath, "test-index")
+	if err != nil {
+		t.Fatalf("Moved file not indexed: %v", err)
+	}
+	if !moved.FirstSeen.Equal(before.FirstSeen) {
+		t.Errorf("Expected moved file to keep first seen %v, got %v", before.FirstSeen, moved.FirstSeen)
+	}
+
+	keepAfter, _ := db.GetFile(keep, "test-index")
+	if !keepAfter.LastSeen.After(keepBefore.LastSeen) {
+		t.Errorf("Expected last seen of an unchanged file to advance, got %v then %v", keepBefore.LastSeen, keepAfter.LastSeen)
+	}
+	if !keepAfter.LastScanned.Equal(keepBefore.LastScanned) {
+		t.Error("Expected unchanged file not to be rewritten")
+	}
+}
+
+func TestReindex_RehashesWhenModTimeChanges(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	testFile := filepath.Join(testRoot, "test.txt")
+	os.WriteFile(testFile, []byte("original"), 0644)
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	// Same size, new content and mtime
+	os.WriteFile(testFile, []byte("modified"), 0644)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(testFile, later, later)
+
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	file, _ := db.GetFile(testFile, "test-index")
+	expected, _ := models.CalculateChecksum(testFile)
+	if file.Checksum != expected {
+		t.Errorf("Expected checksum %s after mtime change, got %s", expected, file.Checksum)
+	}
+	if file.ChecksumStale {
+		t.Error("Expected rehashed checksum not to be stale")
+	}
+}
+
+func TestReindex_MarksUnreadableChangesStale(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("Permissions are not enforced for root")
+	}
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	testFile := filepath.Join(testRoot, "test.txt")
+	os.WriteFile(testFile, []byte("original"), 0644)
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	os.WriteFile(testFile, []byte("modified!"), 0644)
+	os.Chmod(testFile, 0000)
+	defer os.Chmod(testFile, 0644)
+
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	file, _ := db.GetFile(testFile, "test-index")
+	if file.Checksum != "" || !file.ChecksumStale {
+		t.Errorf("Expected old checksum to be dropped and marked stale, got %q stale=%v", file.Checksum, file.ChecksumStale)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	stale := filepath.Join(testRoot, "stale.txt")
+	unhashed := filepath.Join(testRoot, "unhashed.txt")
+	os.WriteFile(stale, []byte("stale"), 0644)
+	os.WriteFile(unhashed, []byte("unhashed"), 0644)
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	file, _ := db.GetFile(stale, "test-index")
+	file.ChecksumStale = true
+	db.UpsertFile(file)
+
+	coverage, _ := db.GetChecksumCoverage("test-index")
+	if coverage.Stale != 1 || coverage.Missing != 1 {
+		t.Errorf("Expected 1 stale and 1 missing checksum, got %+v", coverage)
+	}
+
+	result, err := idxr.Rehash(true)
+	if err != nil {
+		t.Fatalf("Rehash failed: %v", err)
+	}
+	if result.Hashed != 1 {
+		t.Errorf("Expected only the stale file to be rehashed, got %d", result.Hashed)
+	}
+	file, _ = db.GetFile(stale, "test-index")
+	if file.Checksum == "" || file.ChecksumStale {
+		t.Errorf("Expected fresh checksum, got %q stale=%v", file.Checksum, file.ChecksumStale)
+	}
+
+	result, _ = idxr.Rehash(false)
+	if result.Hashed != 1 {
+		t.Errorf("Expected the never hashed file to be hashed, got %d", result.Hashed)
+	}
+	coverage, _ = db.GetChecksumCoverage("test-index")
+	if coverage.Percent() != 100 {
+		t.Errorf("Expected full coverage, got %.1f%%", coverage.Percent())
+	}
+}
+
+func TestRehash_Workers(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		os.WriteFile(filepath.Join(testRoot, fmt.Sprintf("file%02d.txt", i)), []byte(fmt.Sprintf("content %d", i)), 0644)
+	}
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	idxr.SetWorkers(4)
+	result, err := idxr.Rehash(false)
+	if err != nil {
+		t.Fatalf("Rehash failed: %v", err)
+	}
+	if result.Hashed != 20 {
+		t.Errorf("Expected 20 files hashed, got %d", result.Hashed)
+	}
+
+	file, _ := db.GetFile(filepath.Join(testRoot, "file07.txt"), "test-index")
+	expected, _ := models.CalculateChecksum(filepath.Join(testRoot, "file07.txt"))
+	if file.Checksum != expected {
+		t.Errorf("Expected checksum %s, got %s", expected, file.Checksum)
+	}
+}
+
+func TestReindex_CancelledKeepsRemovedFiles(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	testFile := filepath.Join(testRoot, "test.txt")
+	os.WriteFile(testFile, []byte("content"), 0644)
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Initial index failed: %v", err)
+	}
+	os.Remove(testFile)
+
+	// A cancelled scan has not seen every path, so it must not remove any
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	idxr.SetContext(ctx)
+
+	if err := idxr.Reindex(false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := db.GetFile(testFile, "test-index"); err != nil {
+		t.Error("Cancelled reindex should not remove files")
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	patterns := []string{"node_modules", "*.tmp", "build/cache"}
+	tests := []struct {
+		path     string
+		excluded bool
+	}{
+		{"node_modules", true},
+		{"src/node_modules", true},
+		{"a.tmp", true},
+		{"docs/b.tmp", true},
+		{"build/cache", true},
+		{"src/build/cache", false},
+		{"build/output", false},
+		{"main.go", false},
+	}
+	for _, tt := range tests {
+		if got := Excluded(tt.path, patterns); got != tt.excluded {
+			t.Errorf("Excluded(%q) = %v, expected %v", tt.path, got, tt.excluded)
+		}
+	}
+
+	if err := ValidateExcludes([]string{"[a-"}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+func TestIndex_SkipsExcludedFiles(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	os.MkdirAll(filepath.Join(testRoot, "node_modules", "pkg"), 0755)
+	os.WriteFile(filepath.Join(testRoot, "node_modules", "pkg", "index.js"), []byte("js"), 0644)
+	os.WriteFile(filepath.Join(testRoot, "scratch.tmp"), []byte("tmp"), 0644)
+	os.WriteFile(filepath.Join(testRoot, "keep.txt"), []byte("keep"), 0644)
+
+	idxr.SetExcludes([]string{"node_modules", "*.tmp"})
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	files, _ := db.ListFiles("test-index")
+	for _, file := range files {
+		if file.RelativePath != "." && file.RelativePath != "keep.txt" {
+			t.Errorf("Expected %s to be excluded", file.RelativePath)
+		}
+	}
+
+	estimate, err := idxr.Estimate(1024)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	if estimate.Files != 1 || estimate.Bytes != 4 {
+		t.Errorf("Expected 1 file of 4 bytes, got %d files of %d bytes", estimate.Files, estimate.Bytes)
+	}
+	if estimate.HashedBytes != 4 {
+		t.Errorf("Expected 4 sampled bytes, got %d", estimate.HashedBytes)
+	}
+	if estimate.DBGrowth(true) <= estimate.DBGrowth(false) {
+		t.Error("Expected checksums to increase the projected database growth")
+	}
+}
+
+func TestReindex_SkipsNestedIndexes(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	photos := filepath.Join(testRoot, "photos")
+	os.MkdirAll(photos, 0755)
+	os.WriteFile(filepath.Join(photos, "a.jpg"), []byte("jpg"), 0644)
+	os.WriteFile(filepath.Join(testRoot, "keep.txt"), []byte("keep"), 0644)
+
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	nested := &models.Index{ID: "photos-index", Name: "Photos", RootPath: photos, CreatedAt: time.Now(), MachineID: "test-machine"}
+	if err := db.CreateIndex(nested); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	idxr.SetNestedRoots(map[string]string{photos: nested.ID})
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	files, _ := db.ListFiles("test-index")
+	for _, file := range files {
+		if file.RelativePath != "." && file.RelativePath != "keep.txt" {
+			t.Errorf("Expected nested %s to be removed from the parent index", file.RelativePath)
+		}
+	}
+
+	refs, err := db.ListNestedIndexes(nested.ID)
+	if err != nil {
+		t.Fatalf("ListNestedIndexes failed: %v", err)
+	}
+	if len(refs) != 1 || refs[0].IndexID != "test-index" || refs[0].RelativePath != "photos" {
+		t.Errorf("Expected a cross-reference from test-index at photos, got %+v", refs)
+	}
+}
+
+func TestWalk_StopsWhenRootGone(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	for _, dir := range []string{"a", "b", "c"} {
+		os.MkdirAll(filepath.Join(testRoot, dir), 0755)
+		os.WriteFile(filepath.Join(testRoot, dir, "file.txt"), []byte(dir), 0644)
+	}
+
+	// Simulate an eject after the first directory: the mount point is left
+	// behind as an empty directory
+	idxr.markRoot()
+	ejected := false
+	err := idxr.walk(func(path string, info os.FileInfo, err error) error {
+		if !ejected && info != nil && info.IsDir() && path != testRoot {
+			os.Rename(testRoot, testRoot+".ejected")
+			os.Mkdir(testRoot, 0755)
+			ejected = true
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrRootGone) {
+		t.Errorf("Expected ErrRootGone, got %v", err)
+	}
+	if len(idxr.ScanErrors()) != 0 {
+		t.Errorf("Expected no scan errors for an ejected drive, got %d", len(idxr.ScanErrors()))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+	idxr.SetRetries(3, time.Millisecond)
+
+	transient := &os.PathError{Op: "read", Path: "flaky", Err: syscall.EIO}
+	calls := 0
+	attempts, err := idxr.retry(func() error {
+		calls++
+		if calls < 3 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, got %d attempts: %v", attempts, err)
+	}
+
+	attempts, err = idxr.retry(func() error { return transient })
+	if !errors.Is(err, syscall.EIO) || attempts != 4 {
+		t.Errorf("Expected EIO after 4 attempts, got %d attempts: %v", attempts, err)
+	}
+
+	attempts, _ = idxr.retry(func() error { return os.ErrPermission })
+	if attempts != 1 {
+		t.Errorf("Expected permanent errors not to be retried, got %d attempts", attempts)
+	}
+
+	// Failed paths are reported and their entries kept by Reindex
+	dir := filepath.Join(testRoot, "share")
+	idxr.recordScanError(dir, "readdir", transient, 4)
+	idxr.recordScanError(filepath.Join(testRoot, "gone.txt"), "read", os.ErrNotExist, 1)
+	if !idxr.unreadable(filepath.Join(dir, "a.txt")) || idxr.unreadable(testRoot) {
+		t.Error("Expected only paths below the unreadable directory to be unreadable")
+	}
+	if err := idxr.saveScanErrors(); err != nil {
+		t.Fatalf("saveScanErrors failed: %v", err)
+	}
+	scanErrors, err := db.ListScanErrors("test-index")
+	if err != nil {
+		t.Fatalf("ListScanErrors failed: %v", err)
+	}
+	if len(scanErrors) != 1 || scanErrors[0].Path != dir || scanErrors[0].Attempts != 4 {
+		t.Errorf("Expected one readdir error for %s, got %+v", dir, scanErrors)
+	}
+
+	os.WriteFile(filepath.Join(testRoot, "ok.txt"), []byte("ok"), 0644)
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if scanErrors, _ := db.ListScanErrors("test-index"); len(scanErrors) != 0 {
+		t.Errorf("Expected a clean scan to clear the scan errors, got %d", len(scanErrors))
+	}
+}
+
+func TestWalk_RetriesDirectoryOnce(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+	idxr.SetRetries(3, time.Millisecond)
+
+	flaky := filepath.Join(testRoot, "share")
+	os.MkdirAll(filepath.Join(flaky, "sub"), 0755)
+	os.WriteFile(filepath.Join(flaky, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(flaky, "sub", "b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(testRoot, "c.txt"), []byte("c"), 0644)
+
+	// Reading the share fails twice, as filepath.Walk reports it: the
+	// directory with the error and none of its entries
+	failures := 2
+	defer func() { walkTree = filepath.Walk }()
+	walkTree = func(root string, fn filepath.WalkFunc) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if path == flaky && err == nil && failures > 0 {
+				failures--
+				if err := fn(path, info, &os.PathError{Op: "readdirent", Path: path, Err: syscall.EIO}); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return fn(path, info, err)
+		})
+	}
+
+	visits := make(map[string]int)
+	err := idxr.walk(func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			t.Errorf("Expected the retries to hide the error of %s, got %v", path, err)
+		}
+		visits[path]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	for _, path := range []string{testRoot, flaky, filepath.Join(flaky, "a.txt"), filepath.Join(flaky, "sub"), filepath.Join(flaky, "sub", "b.txt"), filepath.Join(testRoot, "c.txt")} {
+		if visits[path] != 1 {
+			t.Errorf("Expected %s to be visited once, got %d", path, visits[path])
+		}
+	}
+	// The retried share is walked last, and its nested walk moves the checkpoint
+	if idxr.lastPath != filepath.Join(flaky, "sub", "b.txt") {
+		t.Errorf("Expected the checkpoint at the last path walked, got %s", idxr.lastPath)
+	}
+	if len(idxr.ScanErrors()) != 0 {
+		t.Errorf("Expected no scan errors once the retry succeeded, got %d", len(idxr.ScanErrors()))
+	}
+}
+
+func TestBenchHash(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	os.WriteFile(filepath.Join(testRoot, "a.bin"), make([]byte, 3000), 0644)
+	os.WriteFile(filepath.Join(testRoot, "b.bin"), make([]byte, 3000), 0644)
+	os.WriteFile(filepath.Join(testRoot, "skip.tmp"), make([]byte, 3000), 0644)
+	idxr.SetExcludes([]string{"*.tmp"})
+
+	bench, err := idxr.BenchHash(4000)
+	if err != nil {
+		t.Fatalf("BenchHash failed: %v", err)
+	}
+	if bench.Files != 2 || bench.ReadBytes != 4000 {
+		t.Errorf("Expected 2 files of 4000 bytes sampled, got %d files of %d bytes", bench.Files, bench.ReadBytes)
+	}
+	if len(bench.Results) != len(HashAlgorithms) {
+		t.Fatalf("Expected %d results, got %d", len(HashAlgorithms), len(bench.Results))
+	}
+	for i := 1; i < len(bench.Results); i++ {
+		if bench.Results[i].Rate() > bench.Results[i-1].Rate() {
+			t.Error("Expected results sorted from fastest to slowest")
+		}
+	}
+
+	best, _ := bench.Recommend()
+	if !best.Algorithm.Secure {
+		t.Errorf("Expected a collision resistant recommendation, got %s", best.Algorithm.Name)
+	}
+}
+
+func BenchmarkIndex(b *testing.B) {
+	tmpDir := b.TempDir()
+	root := filepath.Join(tmpDir, "fixture")
+	if _, err := fixture.Generate(root, fixture.Options{Files: 2000, Depth: 4, DupRatio: 0.2}); err != nil {
+		b.Fatalf("Failed to generate fixture: %v", err)
+	}
+
+	for _, checksums := range []bool{false, true} {
+		b.Run(fmt.Sprintf("checksums=%v", checksums), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				db, err := database.NewDB(filepath.Join(b.TempDir(), "bench.db"))
+				if err != nil {
+					b.Fatalf("Failed to create database: %v", err)
+				}
+				db.CreateIndex(&models.Index{ID: "bench", Name: "bench", RootPath: root, CreatedAt: time.Now()})
+
+				idxr := NewIndexer(db, "bench", root)
+				if err := idxr.Index(checksums); err != nil {
+					b.Fatalf("Index failed: %v", err)
+				}
+				db.Close()
+			}
+		})
+	}
+}
+
+func TestIndex_NonUTF8Names(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	rawName := "caf\xe9.txt"
+	if err := os.WriteFile(filepath.Join(testRoot, rawName), []byte("latin1"), 0644); err != nil {
+		t.Skipf("File system does not accept non-UTF-8 names: %v", err)
+	}
+
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	stored := filepath.Join(testRoot, `caf\xe9.txt`)
+	file, err := db.GetFile(stored, "test-index")
+	if err != nil {
+		t.Fatalf("Expected the file under its escaped name: %v", err)
+	}
+	if file.RelativePath != `caf\xe9.txt` {
+		t.Errorf("Expected escaped relative path, got %q", file.RelativePath)
+	}
+	if file.DiskPath() != filepath.Join(testRoot, rawName) {
+		t.Errorf("Expected raw disk path, got %q", file.DiskPath())
+	}
+	if file.Checksum == "" {
+		t.Error("Expected the file to be hashed")
+	}
+
+	// Both the escaped and the raw spelling find it
+	for _, pattern := range []string{"caf*", `caf\xe9.txt`, rawName} {
+		results, err := db.FindFiles(database.FindOptions{NamePattern: pattern})
+		if err != nil || len(results) != 1 {
+			t.Errorf("Expected 1 result for %q, got %d (%v)", pattern, len(results), err)
+		}
+	}
+
+	// Reindexing recognizes the file instead of removing and re-adding it
+	if err := idxr.Reindex(true); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	files, _ := db.ListFiles("test-index")
+	if len(files) != 2 {
+		t.Errorf("Expected root and 1 file after reindex, got %d entries", len(files))
+	}
+}
+
+func TestIndex_SkipDirectories(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	subDir := filepath.Join(testRoot, "sub")
+	os.MkdirAll(filepath.Join(subDir, "deeper"), 0755)
+	os.WriteFile(filepath.Join(subDir, "deeper", "a.txt"), []byte("a"), 0644)
+
+	// Stored with directories first, then reindexed without them
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if _, err := db.GetFile(subDir, "test-index"); err != nil {
+		t.Fatalf("Expected directory entry, got %v", err)
+	}
+
+	if err := db.SetSkipDirectories("test-index", true); err != nil {
+		t.Fatalf("SetSkipDirectories failed: %v", err)
+	}
+	idxr.SetSkipDirectories(true)
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	if removed, _ := db.ListRemovedFiles("test-index", time.Time{}); len(removed) != 0 {
+		t.Errorf("Expected the dropped directories not to be recorded as removed, got %d", len(removed))
+	}
+
+	files, err := db.ListFiles("test-index")
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(files))
+	}
+	if files[0].IsDirectory || files[0].RelativePath != "sub/deeper/a.txt" {
+		t.Errorf("Expected file sub/deeper/a.txt, got %s", files[0].RelativePath)
+	}
+}
+
+func TestIndex_Thumbnails(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 320, 200)))
+	photo := filepath.Join(testRoot, "photo.png")
+	os.WriteFile(photo, buf.Bytes(), 0644)
+	os.WriteFile(filepath.Join(testRoot, "notes.txt"), []byte("notes"), 0644)
+
+	// Indexed earlier without thumbnails; reindexing adds the missing one
+	if err := idxr.Index(true); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	file, _ := db.GetFile(photo, "test-index")
+	if found, _ := db.HasThumbnail(file.Checksum); found {
+		t.Fatal("Expected no thumbnail without SetThumbnails")
+	}
+
+	idxr.SetThumbnails(true)
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	if found, _ := db.HasThumbnail(file.Checksum); !found {
+		t.Error("Expected a thumbnail for the photo")
+	}
+	notes, _ := db.GetFile(filepath.Join(testRoot, "notes.txt"), "test-index")
+	if found, _ := db.HasThumbnail(notes.Checksum); found {
+		t.Error("Expected no thumbnail for a text file")
+	}
+
+	// The thumbnail goes with the last copy of its content
+	os.Remove(photo)
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	if found, _ := db.HasThumbnail(file.Checksum); found {
+		t.Error("Expected the thumbnail of a removed photo to be pruned")
+	}
+
+	// Names stored escaped are read by their raw path
+	buf.Reset()
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 40)))
+	os.WriteFile(filepath.Join(testRoot, "caf\xe9.png"), buf.Bytes(), 0644)
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	escaped, err := db.GetFile(filepath.Join(testRoot, `caf\xe9.png`), "test-index")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if found, _ := db.HasThumbnail(escaped.Checksum); !found {
+		t.Error("Expected a thumbnail for a photo whose name is not UTF-8")
+	}
+}
+
+func TestReindex_ResumesFromCheckpoint(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	for _, rel := range []string{"a/1.txt", "b/2.txt", "c/3.txt"} {
+		os.MkdirAll(filepath.Join(testRoot, filepath.Dir(rel)), 0755)
+		os.WriteFile(filepath.Join(testRoot, rel), []byte(rel), 0644)
+	}
+	passStart := time.Now().Add(-time.Minute)
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	// Gone before the pass started, in the part walked before the checkpoint
+	stale := filepath.Join(testRoot, "a", "0.txt")
+	db.UpsertFile(&models.FileEntry{Path: stale, RelativePath: "a/0.txt", IndexID: "test-index",
+		ModTime: passStart, LastScanned: passStart.Add(-time.Hour)})
+	db.SaveScanCheckpoint(&database.ScanCheckpoint{IndexID: "test-index", Path: "b", StartedAt: passStart})
+
+	os.WriteFile(filepath.Join(testRoot, "a", "new.txt"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(testRoot, "c", "4.txt"), []byte("4"), 0644)
+	os.Remove(filepath.Join(testRoot, "c", "3.txt"))
+
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"a/0.txt", false},   // not seen by the pass
+		{"a/1.txt", true},    // seen before the checkpoint
+		{"a/new.txt", false}, // before the checkpoint, found by the next pass
+		{"b/2.txt", true},
+		{"c/3.txt", false},
+		{"c/4.txt", true},
+	}
+	for _, tt := range tests {
+		_, err := db.GetFile(filepath.Join(testRoot, tt.rel), "test-index")
+		if (err == nil) != tt.want {
+			t.Errorf("%s: expected indexed %v, got %v", tt.rel, tt.want, err == nil)
+		}
+	}
+	if checkpoint, _ := db.GetScanCheckpoint("test-index"); checkpoint != nil {
+		t.Errorf("Expected the checkpoint to be cleared, got %+v", checkpoint)
+	}
+}
+
+func TestReindex_ResumeKeepsUnchangedFiles(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(testRoot, name), []byte(name), 0644)
+	}
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	// Indexed an hour before a pass that stopped after b.txt and only
+	// touched the unchanged a.txt and b.txt
+	indexed := time.Now().Add(-time.Hour)
+	passStart := time.Now().Add(-time.Minute)
+	files, _ := db.ListFiles("test-index")
+	for _, file := range files {
+		file.LastScanned, file.LastSeen = indexed, indexed
+		db.UpsertFile(file)
+	}
+	db.TouchFiles("test-index", []string{filepath.Join(testRoot, "a.txt"), filepath.Join(testRoot, "b.txt")}, passStart)
+	db.SaveScanCheckpoint(&database.ScanCheckpoint{IndexID: "test-index", Path: "b.txt", StartedAt: passStart})
+
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := db.GetFile(filepath.Join(testRoot, name), "test-index"); err != nil {
+			t.Errorf("Expected %s to stay indexed after the resumed reindex", name)
+		}
+	}
+	if checkpoint, _ := db.GetScanCheckpoint("test-index"); checkpoint != nil {
+		t.Errorf("Expected the checkpoint to be cleared, got %+v", checkpoint)
+	}
+
+	// The next full pass keeps them too
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := db.GetFile(filepath.Join(testRoot, name), "test-index"); err != nil {
+			t.Errorf("Expected %s to stay indexed after the next reindex", name)
+		}
+	}
+}
+
+func TestReindex_MaxDuration(t *testing.T) {
+	idxr, db, testRoot := setupTestIndexer(t)
+	defer db.Close()
+
+	os.WriteFile(filepath.Join(testRoot, "a.txt"), []byte("a"), 0644)
+	if err := idxr.Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	idxr.SetMaxDuration(time.Nanosecond)
+	if err := idxr.Reindex(false); !errors.Is(err, ErrTimeLimit) {
+		t.Fatalf("Expected ErrTimeLimit, got %v", err)
+	}
+	if _, err := db.GetFile(filepath.Join(testRoot, "a.txt"), "test-index"); err != nil {
+		t.Error("Expected a stopped reindex to keep the index")
+	}
+
+	// The limit only applies to the scans it was set for
+	idxr.SetMaxDuration(0)
+	if err := idxr.Reindex(false); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+}
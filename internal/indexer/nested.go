@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// SetNestedRoots sets the roots of other indexes below the root path,
+// mapped to their index IDs. Scans skip them, like excluded directories, so
+// their files are only counted in their own index, and record a
+// cross-reference to the nested index instead.
+func (idx *Indexer) SetNestedRoots(roots map[string]string) {
+	idx.nestedRoots = roots
+}
+
+// isNestedRoot reports whether a walked path is the root of another index
+func (idx *Indexer) isNestedRoot(walked string) bool {
+	_, nested := idx.nestedRoots[walked]
+	return nested && walked != idx.rootPath
+}
+
+// recordNested adds a cross-reference when a skipped path is the root of a
+// nested index
+func (idx *Indexer) recordNested(walked string) {
+	if !idx.isNestedRoot(walked) {
+		return
+	}
+	relativePath, err := filepath.Rel(idx.rootPath, walked)
+	if err != nil {
+		return
+	}
+	idx.nested = append(idx.nested, &models.NestedIndex{
+		IndexID:       idx.indexID,
+		NestedIndexID: idx.nestedRoots[walked],
+		RelativePath:  filepath.ToSlash(relativePath),
+	})
+}
+
+// NestedIndexes returns the nested index roots the last scan skipped
+func (idx *Indexer) NestedIndexes() []*models.NestedIndex {
+	return idx.nested
+}
+
+// saveNested stores the cross-references of the scan
+func (idx *Indexer) saveNested() error {
+	return idx.db.ReplaceNestedIndexes(idx.indexID, idx.nested)
+}
+
+// saveNestedAfterPass saves the nested index roots of a scan that walked
+// the whole tree. A scan resumed from a checkpoint did not see those of
+// the part walked before, so the records of the last full scan are kept.
+func (idx *Indexer) saveNestedAfterPass() error {
+	if idx.resume != "" {
+		return nil
+	}
+	return idx.saveNested()
+}
+
+// printNestedSummary reports the nested index roots the scan skipped
+func (idx *Indexer) printNestedSummary() {
+	for _, n := range idx.nested {
+		fmt.Printf("  Skipped %s: indexed separately\n", n.RelativePath)
+	}
+}
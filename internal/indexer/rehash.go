@@ -0,0 +1,170 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/progress"
+)
+
+// RehashResult summarizes a rehash run
+type RehashResult struct {
+	Hashed  int64
+	Changed int64 // files whose size or mtime differed from the index
+	Missing int64 // files no longer on disk
+	Failed  int64
+}
+
+// Rehash computes the checksums an index is missing. With onlyStale just
+// the checksums dropped after a change are refreshed; otherwise files that
+// were never hashed are included too. Files are hashed by the number of
+// workers set with SetWorkers. When the context is cancelled, or the drive
+// is unmounted, the checksums computed so far are kept and the partial
+// result is returned with the context error or ErrRootGone.
+func (idx *Indexer) Rehash(onlyStale bool) (*RehashResult, error) {
+	idx.duplicates = nil
+	idx.markRoot()
+	defer idx.events.Flush()
+
+	var pending []*models.FileEntry
+	err := idx.db.EachFile(idx.indexID, func(file *models.FileEntry) error {
+		if file.IsDirectory || file.IsSymlink() || file.Checksum != "" {
+			return nil
+		}
+		if onlyStale && !file.ChecksumStale {
+			return nil
+		}
+		pending = append(pending, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	result := &RehashResult{}
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	workers := idx.workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+
+	// One overall bar plus one bar per worker showing the file being hashed
+	group := progress.NewGroup()
+	overall := group.Add("Rehashing", int64(len(pending)))
+
+	var (
+		mu        sync.Mutex // guards result, the database and idx.duplicates
+		updateErr error
+		wg        sync.WaitGroup
+	)
+	queue := make(chan *models.FileEntry)
+	for w := 0; w < workers; w++ {
+		bar := group.AddBytes(fmt.Sprintf("worker %d", w+1), 0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				err := idx.rehashFile(file, bar, result, &mu)
+				overall.Add(1)
+				if err != nil {
+					mu.Lock()
+					if updateErr == nil {
+						updateErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var cancelled error
+feed:
+	for _, file := range pending {
+		if cancelled = idx.ctx.Err(); cancelled != nil {
+			break
+		}
+		mu.Lock()
+		failed := updateErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		select {
+		case queue <- file:
+		case <-idx.ctx.Done():
+			cancelled = idx.ctx.Err()
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	group.Close()
+	if updateErr != nil {
+		return result, updateErr
+	}
+
+	if err := idx.db.UpdateIndexStats(idx.indexID); err != nil {
+		return result, fmt.Errorf("failed to update index stats: %w", err)
+	}
+	idx.printDuplicateSummary()
+	return result, cancelled
+}
+
+// rehashFile hashes one file of a rehash run and stores the checksum,
+// retrying transient read errors. The bytes read are reported to bar. mu is held while the result and the
+// database are updated.
+func (idx *Indexer) rehashFile(file *models.FileEntry, bar *progress.Bar, result *RehashResult, mu *sync.Mutex) error {
+	info, err := os.Lstat(file.DiskPath())
+	if err != nil && idx.rootGone() {
+		return ErrRootGone
+	}
+	if err != nil {
+		mu.Lock()
+		result.Missing++
+		mu.Unlock()
+		return nil
+	}
+	var checksum string
+	_, err = idx.retry(func() error {
+		bar.Reset(file.RelativePath, file.Size)
+		var err error
+		checksum, err = models.CalculateChecksumProgress(file.DiskPath(), bar)
+		return err
+	})
+	if err != nil && idx.rootGone() {
+		return ErrRootGone
+	}
+	if err != nil {
+		mu.Lock()
+		result.Failed++
+		mu.Unlock()
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if info.Size() != file.Size || info.ModTime().Unix() != file.ModTime.Unix() {
+		result.Changed++
+		file.Size = info.Size()
+		file.ModTime = info.ModTime()
+	}
+	file.Checksum = checksum
+	file.ChecksumStale = false
+	file.LastScanned = time.Now()
+	file.LastSeen = file.LastScanned
+	if err := idx.db.UpsertFile(file); err != nil {
+		return fmt.Errorf("failed to update %s: %w", file.Path, err)
+	}
+	result.Hashed++
+	idx.checkDuplicate(file, bar)
+	return nil
+}
@@ -0,0 +1,222 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Default retry settings for transient IO errors, see SetRetries
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+)
+
+// transientErrors are the errors network shares and flaky USB drives return
+// for operations that may succeed when tried again
+var transientErrors = []error{
+	syscall.EIO, syscall.EAGAIN, syscall.EBUSY, syscall.EINTR, syscall.ETIMEDOUT,
+	syscall.ESTALE, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.ENOTCONN, syscall.EHOSTDOWN,
+}
+
+// isTransient reports whether an IO error is worth retrying
+func isTransient(err error) bool {
+	if os.IsTimeout(err) {
+		return true
+	}
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRetries sets how often stat, directory reads and hashing are retried
+// after a transient IO error, and the delay before the first retry. The
+// delay doubles with every further retry. 0 retries gives up on the first
+// error.
+func (idx *Indexer) SetRetries(retries int, delay time.Duration) {
+	idx.retries = retries
+	idx.retryDelay = delay
+}
+
+// backoff waits before retry number attempt (1 for the first retry). It
+// returns early with the context error when the scan is cancelled.
+func (idx *Indexer) backoff(attempt int) error {
+	delay := idx.retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-idx.ctx.Done():
+		return idx.ctx.Err()
+	}
+}
+
+// retry runs op until it succeeds, fails with an error that is not
+// transient or runs out of retries. It returns the number of attempts made
+// and the last error.
+func (idx *Indexer) retry(op func() error) (int, error) {
+	attempts := 1
+	err := op()
+	for err != nil && isTransient(err) && attempts <= idx.retries {
+		if cancelled := idx.backoff(attempts); cancelled != nil {
+			return attempts, err
+		}
+		attempts++
+		err = op()
+	}
+	return attempts, err
+}
+
+// checksum hashes a file, retrying transient read errors. A file that still
+// cannot be read is recorded in the scan errors.
+func (idx *Indexer) checksum(path string) (string, error) {
+	var checksum string
+	attempts, err := idx.retry(func() error {
+		var err error
+		checksum, err = models.CalculateChecksum(path)
+		return err
+	})
+	if err != nil {
+		idx.recordScanError(path, "read", err, attempts)
+	}
+	return checksum, err
+}
+
+// walkTree is filepath.Walk; tests replace it to inject IO errors
+var walkTree = filepath.Walk
+
+// walk is filepath.Walk over the root path that retries transient errors
+// before fn sees them: a failed stat is repeated and a directory that could
+// not be read is walked again. filepath.Walk reads a directory before it
+// passes the directory or anything below it to fn, so only the failed entry
+// is retried and no path reaches fn twice. Paths that still fail are
+// recorded in the scan errors and passed to fn with the error, like
+// filepath.Walk does.
+func (idx *Indexer) walk(fn filepath.WalkFunc) error {
+	attempts := make(map[string]int)
+	var walkFn, visit filepath.WalkFunc
+	walkFn = func(path string, info os.FileInfo, err error) error {
+		// A drive ejected during the scan fails every further path: stop
+		// instead of recording them all, or retrying
+		if err != nil && idx.rootGone() {
+			return ErrRootGone
+		}
+		for err != nil && isTransient(err) && attempts[path] < idx.retries {
+			attempts[path]++
+			if cancelled := idx.backoff(attempts[path]); cancelled != nil {
+				return cancelled
+			}
+			if info == nil {
+				info, err = os.Lstat(path)
+				if err != nil || !info.IsDir() {
+					continue
+				}
+			}
+			// Reading the directory failed, or its stat did and
+			// filepath.Walk will not descend into it: walk it again.
+			// The nested walk handles any further failure.
+			if err := walkTree(path, visit); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		if err != nil && !os.IsNotExist(err) {
+			op := "stat"
+			if info != nil && info.IsDir() {
+				op = "readdir"
+			}
+			idx.recordScanError(path, op, err, attempts[path]+1)
+		}
+		return fn(path, info, err)
+	}
+	// Paths processed before the checkpoint are passed over, see beginPass
+	visit = func(path string, info os.FileInfo, err error) error {
+		if idx.resumed(path) {
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		result := walkFn(path, info, err)
+		// A retried directory was walked again by a nested walk, which
+		// already moved lastPath past it
+		if result == nil || (result == filepath.SkipDir && attempts[path] == 0) {
+			idx.lastPath = path
+		}
+		return result
+	}
+	return walkTree(idx.rootPath, visit)
+}
+
+// recordScanError adds a path that could not be read to the scan errors.
+// Files removed during the scan are not errors.
+func (idx *Indexer) recordScanError(path, op string, err error, attempts int) {
+	if os.IsNotExist(err) {
+		return
+	}
+	if op != "read" {
+		idx.unreadablePaths = append(idx.unreadablePaths, path)
+	}
+	sanitizedPath, _ := models.SanitizePath(path)
+	idx.scanErrors = append(idx.scanErrors, &models.ScanError{
+		IndexID:    idx.indexID,
+		Path:       sanitizedPath,
+		Op:         op,
+		Error:      err.Error(),
+		Attempts:   attempts,
+		OccurredAt: time.Now(),
+	})
+}
+
+// ScanErrors returns the paths the last scan could not read
+func (idx *Indexer) ScanErrors() []*models.ScanError {
+	return idx.scanErrors
+}
+
+// unreadable reports whether path is, or is below, a path the scan could
+// not read. The index entries of such paths are kept, since the scan could
+// not tell whether they still exist.
+func (idx *Indexer) unreadable(path string) bool {
+	for _, unreadable := range idx.unreadablePaths {
+		if path == unreadable || strings.HasPrefix(path, unreadable+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resetScanErrors clears the scan errors before a new scan
+func (idx *Indexer) resetScanErrors() {
+	idx.scanErrors = nil
+	idx.unreadablePaths = nil
+}
+
+// printScanErrorSummary reports the paths the scan could not read
+func (idx *Indexer) printScanErrorSummary() {
+	if len(idx.scanErrors) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "⚠ %d path(s) could not be read; run 'report scan-errors' for the list\n", len(idx.scanErrors))
+}
+
+// saveScanErrors stores the scan errors as the error report of the index
+func (idx *Indexer) saveScanErrors() error {
+	return idx.db.ReplaceScanErrors(idx.indexID, idx.scanErrors)
+}
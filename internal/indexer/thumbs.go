@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/progress"
+	"github.com/victor/stormindexer/internal/thumbs"
+)
+
+// SetThumbnails makes Index and Reindex store a small preview of the images
+// and videos they hash, keyed by checksum so copies share one thumbnail
+func (idx *Indexer) SetThumbnails(enabled bool) {
+	idx.thumbnails = enabled
+}
+
+// thumbnail stores the preview of a freshly hashed file unless its content
+// already has one. A file that cannot be previewed is still indexed; the
+// failure is only printed in verbose mode.
+func (idx *Indexer) thumbnail(file *models.FileEntry, bar *progress.Bar) {
+	if !idx.thumbnails || file.Checksum == "" || file.IsDirectory || !thumbs.Supported(file.DiskPath()) {
+		return
+	}
+	if found, err := idx.db.HasThumbnail(file.Checksum); err != nil || found {
+		return
+	}
+
+	// Escaped names only exist in the catalog; read the file by its raw path
+	data, err := thumbs.Generate(idx.ctx, file.DiskPath())
+	if err == nil {
+		err = idx.db.PutThumbnail(file.Checksum, data)
+	}
+	if err != nil && idx.verbose {
+		bar.Clear()
+		fmt.Fprintf(os.Stderr, "! no thumbnail for %s: %v\n", file.RelativePath, err)
+	}
+}
@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrRootGone is returned by scans whose root was unmounted or removed
+// while they ran. What was indexed before is kept.
+var ErrRootGone = errors.New("index root was unmounted during the scan")
+
+// markRoot remembers the directory the scan starts on, so rootGone can tell
+// when a drive is ejected from under the scan
+func (idx *Indexer) markRoot() {
+	idx.rootInfo, _ = os.Stat(idx.rootPath)
+}
+
+// rootGone reports whether the root path is no longer the directory the
+// scan started on. After an unmount the mount point is still there, but it
+// is a different directory on the parent file system.
+func (idx *Indexer) rootGone() bool {
+	if idx.rootInfo == nil {
+		return false
+	}
+	info, err := os.Stat(idx.rootPath)
+	return err != nil || !os.SameFile(idx.rootInfo, info)
+}
+
+// stopReason describes why a scan stopped early
+func stopReason(err error) string {
+	if errors.Is(err, ErrRootGone) {
+		return "stopped, the drive was unmounted"
+	}
+	if errors.Is(err, ErrTimeLimit) {
+		return "stopped at its time limit"
+	}
+	return "cancelled"
+}
@@ -0,0 +1,267 @@
+// Package jobs records long running operations in the database so other
+// processes can list them, tell live jobs from crashed ones and cancel them.
+//
+// Jobs can also be queued so no more than a given number run at once on a
+// machine: Enqueue records the job as queued and Wait starts it once a slot
+// is free, in the order the jobs were queued.
+//
+// Cancellation is cooperative: Cancel flags the job in the database, the
+// running process notices the flag on its next heartbeat and cancels the
+// context returned by Tracker.Context. Long running code checks that context
+// at safe checkpoints and keeps the work done so far.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// HeartbeatInterval is how often a running job refreshes its heartbeat
+var HeartbeatInterval = 5 * time.Second
+
+// StaleAfter is how long a job may go without a heartbeat before it is
+// considered dead
+var StaleAfter = 30 * time.Second
+
+// PollInterval is how often a queued job checks for a free slot
+var PollInterval = time.Second
+
+// ErrNotRunning is returned when cancelling a job that already ended
+var ErrNotRunning = errors.New("job is not running")
+
+// Tracker keeps the record of a job of the current process up to date
+type Tracker struct {
+	db     *database.DB
+	Job    *models.Job
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// Start records a new running job for this process and keeps its heartbeat
+// fresh until Finish is called
+func Start(db *database.DB, kind, indexID, description string) (*Tracker, error) {
+	return start(db, kind, indexID, description, models.JobRunning)
+}
+
+// Enqueue records a new job of this process waiting in the queue of this
+// machine, and keeps its heartbeat fresh so it can be cancelled while it
+// waits. Call Wait before doing the work.
+func Enqueue(db *database.DB, kind, indexID, description string) (*Tracker, error) {
+	return start(db, kind, indexID, description, models.JobQueued)
+}
+
+func start(db *database.DB, kind, indexID, description, status string) (*Tracker, error) {
+	host, _ := os.Hostname()
+	now := time.Now()
+	job := &models.Job{
+		Kind:        kind,
+		IndexID:     indexID,
+		Description: description,
+		PID:         os.Getpid(),
+		Host:        host,
+		Status:      status,
+		StartedAt:   now,
+		Heartbeat:   now,
+	}
+	if err := db.CreateJob(job); err != nil {
+		return nil, fmt.Errorf("failed to record job: %w", err)
+	}
+
+	t := &Tracker{db: db, Job: job, stop: make(chan struct{})}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	go t.heartbeat()
+	return t, nil
+}
+
+func (t *Tracker) heartbeat() {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			// A missed heartbeat only matters if it keeps failing, which
+			// shows up as a stale job
+			if cancelRequested, err := t.db.TouchJob(t.Job.ID, now); err == nil && cancelRequested {
+				t.cancel()
+			}
+		}
+	}
+}
+
+// Wait blocks until fewer than limit jobs run on this machine and the jobs
+// queued before this one have started, then records the job as running.
+// Dead jobs do not hold a slot. Whenever the number of running jobs or of
+// jobs ahead changes while waiting, waiting is called with them. Wait
+// returns the context error when the job is cancelled before it starts.
+func (t *Tracker) Wait(limit int, waiting func(running, ahead int)) error {
+	reported := false
+	lastRunning, lastAhead := 0, 0
+	for {
+		list, err := t.db.ListJobs(false)
+		if err != nil {
+			return fmt.Errorf("failed to list jobs: %w", err)
+		}
+		now := time.Now()
+		running, ahead, dead := queue(list, t.Job, now)
+		if running < limit && ahead == 0 {
+			started, err := t.db.ClaimJobSlot(t.Job.ID, t.Job.Host, limit, dead, now)
+			if err != nil {
+				return fmt.Errorf("failed to start job: %w", err)
+			}
+			if started {
+				t.Job.Status = models.JobRunning
+				t.Job.StartedAt, t.Job.Heartbeat = now, now
+				return nil
+			}
+		}
+		if waiting != nil && (!reported || running != lastRunning || ahead != lastAhead) {
+			waiting(running, ahead)
+			reported, lastRunning, lastAhead = true, running, ahead
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return t.ctx.Err()
+		case <-time.After(PollInterval):
+		}
+	}
+}
+
+// QueuePosition returns the place of a queued job in the queue of its
+// machine, 1 for the next job to start, given the running and queued jobs
+func QueuePosition(list []*models.Job, job *models.Job, now time.Time) int {
+	_, ahead, _ := queue(list, job, now)
+	return ahead + 1
+}
+
+// queue counts the live jobs running on the machine of a job and those
+// queued before it, and lists the dead ones
+func queue(list []*models.Job, job *models.Job, now time.Time) (running, ahead int, dead []int64) {
+	for _, other := range list {
+		if other.ID == job.ID || other.Host != job.Host {
+			continue
+		}
+		switch State(other, now) {
+		case models.JobRunning:
+			running++
+		case models.JobQueued:
+			if other.ID < job.ID {
+				ahead++
+			}
+		case "dead":
+			dead = append(dead, other.ID)
+		}
+	}
+	return running, ahead, dead
+}
+
+// Context is cancelled once the job is asked to stop
+func (t *Tracker) Context() context.Context {
+	return t.ctx
+}
+
+// Interrupt cancels the job from within the current process
+func (t *Tracker) Interrupt() {
+	t.cancel()
+}
+
+// Finish stops the heartbeat and records how the job ended. Only the first
+// call has an effect.
+func (t *Tracker) Finish(err error) {
+	t.FinishWithStatus(statusFor(err), err)
+}
+
+// FinishWithStatus is like Finish with an explicit status
+func (t *Tracker) FinishWithStatus(status string, err error) {
+	t.once.Do(func() {
+		close(t.stop)
+		t.cancel()
+		var msg string
+		if err != nil {
+			msg = err.Error()
+		}
+		t.Job.Status = status
+		t.Job.Error = msg
+		t.Job.FinishedAt = time.Now()
+		t.db.FinishJob(t.Job.ID, status, msg, t.Job.FinishedAt)
+	})
+}
+
+func statusFor(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return models.JobCancelled
+	}
+	if err != nil {
+		return models.JobFailed
+	}
+	return models.JobFinished
+}
+
+// State returns the status of a job as seen now. Running and queued jobs
+// whose process is gone, or that stopped sending heartbeats, are reported
+// as "dead".
+func State(job *models.Job, now time.Time) string {
+	if job.Status != models.JobRunning && job.Status != models.JobQueued {
+		return job.Status
+	}
+	if isLocal(job) && !processAlive(job.PID) {
+		return "dead"
+	}
+	if now.Sub(job.Heartbeat) > StaleAfter {
+		return "dead"
+	}
+	return job.Status
+}
+
+// Cancel asks a running or queued job to stop at its next checkpoint, or
+// before it starts. Any host sharing the database can request it. With kill
+// the process is killed right away instead, which only works on the host it
+// runs on and loses the work of the current checkpoint.
+func Cancel(db *database.DB, id int64, kill bool) (*models.Job, error) {
+	job, err := db.GetJob(id)
+	if err != nil {
+		return nil, fmt.Errorf("job %d not found", id)
+	}
+	if state := State(job, time.Now()); state != models.JobRunning && state != models.JobQueued {
+		return job, ErrNotRunning
+	}
+
+	if !kill {
+		if err := db.RequestJobCancel(id); err != nil {
+			return job, fmt.Errorf("failed to request cancellation: %w", err)
+		}
+		return job, nil
+	}
+
+	if !isLocal(job) {
+		return job, fmt.Errorf("job %d runs on %s", id, job.Host)
+	}
+	p, err := os.FindProcess(job.PID)
+	if err == nil {
+		err = p.Kill()
+	}
+	if err != nil {
+		return job, fmt.Errorf("failed to kill process %d: %w", job.PID, err)
+	}
+	if err := db.FinishJob(id, models.JobCancelled, "killed", time.Now()); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// isLocal reports whether the job runs on this host
+func isLocal(job *models.Job) bool {
+	host, _ := os.Hostname()
+	return job.Host == host
+}
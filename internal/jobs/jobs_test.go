@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+func TestStartAndFinish(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+
+	tracker, err := Start(db, "reindex", "idx", "/data")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	running, err := db.ListJobs(false)
+	if err != nil {
+		t.Fatalf("ListJobs failed: %v", err)
+	}
+	if len(running) != 1 || running[0].Kind != "reindex" {
+		t.Fatalf("Expected 1 running reindex job, got %v", running)
+	}
+	if state := State(running[0], time.Now()); state != models.JobRunning {
+		t.Errorf("Expected running, got %s", state)
+	}
+
+	tracker.Finish(errors.New("disk full"))
+	tracker.Finish(nil) // only the first call counts
+
+	running, _ = db.ListJobs(false)
+	if len(running) != 0 {
+		t.Errorf("Expected no running jobs, got %d", len(running))
+	}
+
+	job, err := db.GetJob(tracker.Job.ID)
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if job.Status != models.JobFailed || job.Error != "disk full" {
+		t.Errorf("Expected failed job with error, got %s %q", job.Status, job.Error)
+	}
+	if job.FinishedAt.IsZero() {
+		t.Error("Expected finished_at to be set")
+	}
+}
+
+func TestState_DetectsDeadJobs(t *testing.T) {
+	job := &models.Job{Status: models.JobRunning, Host: "some-other-host", Heartbeat: time.Now()}
+
+	if state := State(job, time.Now()); state != models.JobRunning {
+		t.Errorf("Expected running for a fresh remote job, got %s", state)
+	}
+	if state := State(job, time.Now().Add(StaleAfter+time.Second)); state != "dead" {
+		t.Errorf("Expected dead after a missed heartbeat, got %s", state)
+	}
+}
+
+func TestCancel_NotRunning(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+
+	tracker, err := Start(db, "sync", "", "a -> b")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	tracker.Finish(nil)
+
+	if _, err := Cancel(db, tracker.Job.ID, false); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning, got %v", err)
+	}
+	if _, err := Cancel(db, 999, false); err == nil {
+		t.Error("Expected error for unknown job")
+	}
+}
+
+func TestCancel_StopsAtNextHeartbeat(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+
+	interval := HeartbeatInterval
+	HeartbeatInterval = 10 * time.Millisecond
+	defer func() { HeartbeatInterval = interval }()
+
+	tracker, err := Start(db, "reindex", "idx", "/data")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if _, err := Cancel(db, tracker.Job.ID, false); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	select {
+	case <-tracker.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the job context to be cancelled")
+	}
+
+	tracker.Finish(tracker.Context().Err())
+	job, _ := db.GetJob(tracker.Job.ID)
+	if job.Status != models.JobCancelled {
+		t.Errorf("Expected cancelled, got %s", job.Status)
+	}
+}
+
+func TestWait_StartsQueuedJobsInOrder(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+
+	interval := PollInterval
+	PollInterval = 10 * time.Millisecond
+	defer func() { PollInterval = interval }()
+
+	running, err := Start(db, "reindex", "a", "/a")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	first, _ := Enqueue(db, "reindex", "b", "/b")
+	second, _ := Enqueue(db, "sync", "c", "b -> c")
+
+	list, _ := db.ListJobs(false)
+	if len(list) != 3 {
+		t.Fatalf("Expected the queued jobs to be listed, got %d jobs", len(list))
+	}
+	if pos := QueuePosition(list, second.Job, time.Now()); pos != 2 {
+		t.Errorf("Expected the second queued job at position 2, got %d", pos)
+	}
+
+	started := make(chan *Tracker, 2)
+	var waits []int
+	go func() {
+		second.Wait(1, nil)
+		started <- second
+	}()
+	go func() {
+		first.Wait(1, func(running, ahead int) { waits = append(waits, running, ahead) })
+		started <- first
+	}()
+
+	select {
+	case tracker := <-started:
+		t.Fatalf("Expected no job to start while the slot is taken, job %d started", tracker.Job.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	running.Finish(nil)
+	if tracker := <-started; tracker != first {
+		t.Fatalf("Expected the first queued job to start first, got job %d", tracker.Job.ID)
+	}
+	if len(waits) < 2 || waits[0] != 1 || waits[1] != 0 {
+		t.Errorf("Expected to be told of 1 running job and none ahead, got %v", waits)
+	}
+	select {
+	case <-started:
+		t.Fatal("Expected the second queued job to wait for the first")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	first.Finish(nil)
+	<-started
+	job, _ := db.GetJob(second.Job.ID)
+	if job.Status != models.JobRunning {
+		t.Errorf("Expected the second job to be running, got %s", job.Status)
+	}
+	second.Finish(nil)
+}
+
+func TestWait_CancelWhileQueued(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+
+	interval := HeartbeatInterval
+	HeartbeatInterval = 10 * time.Millisecond
+	defer func() { HeartbeatInterval = interval }()
+
+	running, _ := Start(db, "reindex", "a", "/a")
+	defer running.Finish(nil)
+	queued, _ := Enqueue(db, "reindex", "b", "/b")
+
+	if _, err := Cancel(db, queued.Job.ID, false); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if err := queued.Wait(1, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the queued job to be cancelled, got %v", err)
+	}
+	queued.Finish(context.Canceled)
+	if job, _ := db.GetJob(queued.Job.ID); job.Status != models.JobCancelled {
+		t.Errorf("Expected cancelled, got %s", job.Status)
+	}
+}
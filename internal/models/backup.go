@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Backup records a verified copy of the catalog database so it can be
+// checked again later
+type Backup struct {
+	ID        int64     `json:"id"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CheckedAt time.Time `json:"checked_at"` // last successful check
+}
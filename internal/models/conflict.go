@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Conflict resolutions, see Conflict.Resolution
+const (
+	PreferSource = "source"
+	PreferTarget = "target"
+	PreferNewest = "newest"
+)
+
+// Conflict records a file a sync did not copy because the target copy was
+// changed since the last sync, so copying would overwrite it. Both sides'
+// metadata are kept as they were when the conflict was detected.
+type Conflict struct {
+	ID             int64     `json:"id"`
+	SourceIndexID  string    `json:"source_index_id"`
+	TargetIndexID  string    `json:"target_index_id"`
+	RelativePath   string    `json:"relative_path"`
+	SourcePath     string    `json:"source_path"`
+	SourceSize     int64     `json:"source_size"`
+	SourceModTime  time.Time `json:"source_mod_time"`
+	SourceChecksum string    `json:"source_checksum,omitempty"`
+	TargetPath     string    `json:"target_path"`
+	TargetSize     int64     `json:"target_size"`
+	TargetModTime  time.Time `json:"target_mod_time"`
+	TargetChecksum string    `json:"target_checksum,omitempty"`
+	DetectedAt     time.Time `json:"detected_at"`
+	ResolvedAt     time.Time `json:"resolved_at,omitempty"` // zero while open
+	Resolution     string    `json:"resolution,omitempty"`  // source or target
+}
+
+// Newest returns the side whose copy was modified last, the target when
+// both have the same modification time
+func (c *Conflict) Newest() string {
+	if c.SourceModTime.After(c.TargetModTime) {
+		return PreferSource
+	}
+	return PreferTarget
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Event kinds
+const (
+	EventScanStarted       = "scan.started"
+	EventScanFinished      = "scan.finished"
+	EventFileChanged       = "file.changed"
+	EventDuplicateDetected = "duplicate.detected"
+	EventDriveMounted      = "drive.mounted"
+	EventPolicyTriggered   = "policy.triggered"
+)
+
+// EventKinds lists every event kind
+var EventKinds = []string{
+	EventScanStarted, EventScanFinished, EventFileChanged, EventDuplicateDetected, EventDriveMounted, EventPolicyTriggered,
+}
+
+// Event records a change to the catalog in the event log, for automations
+// to react to
+type Event struct {
+	ID      int64  `json:"id"`
+	Kind    string `json:"kind"`
+	IndexID string `json:"index_id,omitempty"`
+	// Path is the file of file and duplicate events, and the index root of
+	// scan, mount and policy events
+	Path string `json:"path,omitempty"`
+	// Detail describes the event: the scan kind and outcome, how a file
+	// changed (added, modified, moved or removed), where the duplicate
+	// already exists, or which policy triggered
+	Detail     string    `json:"detail,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
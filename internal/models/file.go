@@ -3,13 +3,17 @@ package models
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // FileEntry represents a file in the index
 type FileEntry struct {
-	ID           int64     `json:"id"`
+	ID           int64     `json:"id,omitempty"`
 	Path         string    `json:"path"`
 	Size         int64     `json:"size"`
 	ModTime      time.Time `json:"mod_time"`
@@ -18,6 +22,84 @@ type FileEntry struct {
 	LastScanned  time.Time `json:"last_scanned"`
 	IsDirectory  bool      `json:"is_directory"`
 	RelativePath string    `json:"relative_path"` // Path relative to the indexed root
+	LinkTarget   string    `json:"link_target,omitempty"` // Target of a symlink, as stored in the link
+	FirstSeen    time.Time `json:"first_seen"`            // When the file was first added to the index
+	LastSeen     time.Time `json:"last_seen"`             // When a scan last found the file, changed or not
+	// ChecksumStale marks a checksum that was dropped because the file changed
+	// without being rehashed
+	ChecksumStale bool `json:"checksum_stale,omitempty"`
+	// RawPath holds the exact bytes of Path when the name on disk is not
+	// printable UTF-8 and Path only stores its escaped form
+	RawPath []byte `json:"raw_path,omitempty"`
+}
+
+// IsSymlink reports whether the entry records a symbolic link
+func (f *FileEntry) IsSymlink() bool {
+	return f.LinkTarget != ""
+}
+
+// DiskPath returns the path to use for file system access
+func (f *FileEntry) DiskPath() string {
+	if len(f.RawPath) > 0 {
+		return string(f.RawPath)
+	}
+	return f.Path
+}
+
+// SanitizePath returns a printable form of a path: bytes that are not valid
+// UTF-8 and control characters (newlines, escape sequences...) are replaced
+// by \xNN escapes. The result is safe to store, print and search. ok is
+// false when the path had to be changed.
+//
+// Backslashes of changed paths are written \\, so a name holding a literal
+// "\x01" never reads like one holding the byte 0x01. Printable paths are
+// only changed when they hold "\x", so Windows paths keep their separators.
+func SanitizePath(path string) (sanitized string, ok bool) {
+	if printable(path) && !strings.Contains(path, `\x`) {
+		return path, true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); {
+		r, size := utf8.DecodeRuneInString(path[i:])
+		if (r == utf8.RuneError && size <= 1) || r < 0x20 || r == 0x7f {
+			fmt.Fprintf(&b, "\\x%02x", path[i])
+			i++
+			continue
+		}
+		if r == '\\' {
+			b.WriteString(`\\`)
+		} else {
+			b.WriteString(path[i : i+size])
+		}
+		i += size
+	}
+	return b.String(), false
+}
+
+// SanitizePattern returns a search pattern in the form paths are stored:
+// a pattern typed with the raw bytes of an undecodable name is sanitized
+// like the name, while a printable one, possibly typed with the \xNN
+// escapes shown for the name, is kept as typed.
+func SanitizePattern(pattern string) string {
+	if printable(pattern) {
+		return pattern
+	}
+	sanitized, _ := SanitizePath(pattern)
+	return sanitized
+}
+
+// printable reports whether s is valid UTF-8 without control characters
+func printable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f {
+			return false
+		}
+	}
+	return true
 }
 
 // FileInfo wraps os.FileInfo with additional metadata
@@ -28,12 +110,27 @@ type FileInfo struct {
 
 // CalculateChecksum computes SHA256 hash of file contents
 func CalculateChecksum(filePath string) (string, error) {
-	data, err := os.ReadFile(filePath)
+	return CalculateChecksumProgress(filePath, nil)
+}
+
+// CalculateChecksumProgress computes the SHA256 hash of file contents and
+// also writes the contents to progress, when set, to report the bytes read
+func CalculateChecksumProgress(filePath string, progress io.Writer) (string, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:]), nil
+	defer f.Close()
+
+	hash := sha256.New()
+	var w io.Writer = hash
+	if progress != nil {
+		w = io.MultiWriter(hash, progress)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // Index represents a collection of files from a specific location
@@ -46,5 +143,16 @@ type Index struct {
 	MachineID   string    `json:"machine_id"`
 	TotalFiles  int64     `json:"total_files"`
 	TotalSize   int64     `json:"total_size"`
+	// Location is the physical label of the drive, e.g. "shelf B, box 3"
+	Location string `json:"location,omitempty"`
+	// SkipDirectories leaves directories out of the index: they are derived
+	// from the file paths when needed, and empty ones are not recorded
+	SkipDirectories bool `json:"skip_directories,omitempty"`
+	// Compact stores the files with their names only, sharing the paths of
+	// their directories, to keep catalogs of many millions of files small
+	Compact bool `json:"compact,omitempty"`
+	// Loan is the active check-out of the drive. It is not stored with the
+	// index and only set by commands that show it.
+	Loan *Loan `json:"loan,omitempty"`
 }
 
@@ -3,6 +3,8 @@ package models
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -74,3 +76,114 @@ func TestCalculateChecksum_DifferentContent(t *testing.T) {
 	}
 }
 
+
+func TestSanitizePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"/data/photo.jpg", "/data/photo.jpg", true},
+		{"/data/café.txt", "/data/café.txt", true},
+		{"/data/�.txt", "/data/�.txt", true},
+		{"/data/caf\xe9.txt", `/data/caf\xe9.txt`, false},
+		{"/data/line\nbreak", `/data/line\x0abreak`, false},
+		{"/data/\x1b[31mred", `/data/\x1b[31mred`, false},
+		{`C:\Users\photo.jpg`, `C:\Users\photo.jpg`, true},
+		{`/data/a\x01`, `/data/a\\x01`, false},
+		{"/data/a\x01", `/data/a\x01`, false},
+		{"C:\\caf\xe9", `C:\\caf\xe9`, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := SanitizePath(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("SanitizePath(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSanitizePath_RoundTrip(t *testing.T) {
+	// unescape reverses the escapes of a changed path
+	unescape := func(s string) string {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			switch {
+			case strings.HasPrefix(s[i:], `\\`):
+				b.WriteByte('\\')
+				i++
+			case strings.HasPrefix(s[i:], `\x`):
+				n, _ := strconv.ParseUint(s[i+2:i+4], 16, 8)
+				b.WriteByte(byte(n))
+				i += 3
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		return b.String()
+	}
+
+	seen := make(map[string]string)
+	for _, in := range []string{
+		"/data/a\x01", `/data/a\x01`, `/data/a\\x01`, "/data/a\\\x01", "/data/caf\xe9", `/data/caf\xe9`,
+		`C:\dir\x.txt`, "C:\\dir\\\x7f", `/data/end\`, "/data/end\\\n", `\\server\share\a.txt`,
+	} {
+		got, ok := SanitizePath(in)
+		if other, dup := seen[got]; dup {
+			t.Errorf("SanitizePath(%q) and SanitizePath(%q) both give %q", in, other, got)
+		}
+		seen[got] = in
+		if !ok && unescape(got) != in {
+			t.Errorf("SanitizePath(%q) = %q, which unescapes to %q", in, got, unescape(got))
+		}
+	}
+}
+
+func TestSanitizePattern(t *testing.T) {
+	if got := SanitizePattern(`caf\xe9*`); got != `caf\xe9*` {
+		t.Errorf("Expected an escaped pattern to be kept, got %q", got)
+	}
+	if got := SanitizePattern("caf\xe9*"); got != `caf\xe9*` {
+		t.Errorf("Expected a raw pattern to be sanitized, got %q", got)
+	}
+}
+
+func TestDiskPath(t *testing.T) {
+	file := &FileEntry{Path: `/data/caf\xe9.txt`, RawPath: []byte("/data/caf\xe9.txt")}
+	if file.DiskPath() != "/data/caf\xe9.txt" {
+		t.Errorf("Expected raw path, got %q", file.DiskPath())
+	}
+
+	file = &FileEntry{Path: "/data/plain.txt"}
+	if file.DiskPath() != "/data/plain.txt" {
+		t.Errorf("Expected path, got %q", file.DiskPath())
+	}
+}
+
+func TestShortIDs(t *testing.T) {
+	ids := []string{
+		"f0bd0c0e1a2b3c4d",
+		"f0bd0c0e1a2b9999",
+		"0123456789abcdef",
+		"usb1",
+	}
+	short := ShortIDs(ids, 12)
+
+	tests := map[string]string{
+		"f0bd0c0e1a2b3c4d": "f0bd0c0e1a2b3",
+		"f0bd0c0e1a2b9999": "f0bd0c0e1a2b9",
+		"0123456789abcdef": "0123456789ab",
+		"usb1":             "usb1",
+	}
+	for id, want := range tests {
+		if short[id] != want {
+			t.Errorf("Expected %s to be shortened to %s, got %s", id, want, short[id])
+		}
+	}
+
+	// An ID that is a prefix of another is kept whole
+	short = ShortIDs([]string{"abcd", "abcdef"}, 2)
+	if short["abcd"] != "abcd" || short["abcdef"] != "abcde" {
+		t.Errorf("Expected abcd and abcde, got %s and %s", short["abcd"], short["abcdef"])
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// DriveHealth is the SMART health of the drive holding an index, captured
+// by smartctl during a scan
+type DriveHealth struct {
+	ID         int64     `json:"id"`
+	IndexID    string    `json:"index_id"`
+	JobID      int64     `json:"job_id,omitempty"` // scan run the capture belongs to
+	CapturedAt time.Time `json:"captured_at"`
+	Device     string    `json:"device"`
+	Model      string    `json:"model"`
+	Serial     string    `json:"serial"`
+	Passed     bool      `json:"passed"` // overall self-assessment
+	// Sector counters that only grow as a drive wears out
+	ReallocatedSectors   int64 `json:"reallocated_sectors"`
+	PendingSectors       int64 `json:"pending_sectors"`
+	UncorrectableSectors int64 `json:"uncorrectable_sectors"` // media errors on NVMe
+	PowerOnHours         int64 `json:"power_on_hours"`
+	Temperature          int64 `json:"temperature"`
+}
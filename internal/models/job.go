@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Job statuses
+const (
+	JobQueued    = "queued" // waiting for a free slot, see max_concurrent_jobs
+	JobRunning   = "running"
+	JobFinished  = "finished"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+	JobStopped   = "stopped" // reached --max-duration, the next scan resumes it
+)
+
+// Job records a long running operation (scan, sync, rehash...) so other
+// processes can see what is using the database
+type Job struct {
+	ID              int64     `json:"id"`
+	Kind            string    `json:"kind"`     // index, reindex, rehash, sync, restore
+	IndexID         string    `json:"index_id"` // Index the job works on, if any
+	Description     string    `json:"description"`
+	PID             int       `json:"pid"`
+	Host            string    `json:"host"`
+	Status          string    `json:"status"`
+	StartedAt       time.Time `json:"started_at"`
+	Heartbeat       time.Time `json:"heartbeat"`
+	FinishedAt      time.Time `json:"finished_at"`
+	CancelRequested bool      `json:"cancel_requested"`
+	Error           string    `json:"error,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Loan records an indexed drive checked out of the drive library to a
+// person or place
+type Loan struct {
+	ID           int64     `json:"id"`
+	IndexID      string    `json:"index_id"`
+	Borrower     string    `json:"borrower"`
+	Note         string    `json:"note,omitempty"`
+	CheckedOutAt time.Time `json:"checked_out_at"`
+	DueAt        time.Time `json:"due_at,omitempty"`      // zero when open-ended
+	ReturnedAt   time.Time `json:"returned_at,omitempty"` // zero while checked out
+}
+
+// Overdue reports whether the drive is still out after its due date
+func (l *Loan) Overdue(now time.Time) bool {
+	return l.ReturnedAt.IsZero() && !l.DueAt.IsZero() && now.After(l.DueAt)
+}
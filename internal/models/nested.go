@@ -0,0 +1,11 @@
+package models
+
+// NestedIndex records that the root of one index lies inside another. The
+// parent scan skips the nested root, whose files belong to the nested index
+// only, so they are not counted twice.
+type NestedIndex struct {
+	IndexID       string `json:"index_id"`
+	NestedIndexID string `json:"nested_index_id"`
+	// RelativePath is the nested root relative to the root of the parent
+	RelativePath string `json:"relative_path"`
+}
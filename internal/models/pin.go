@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Pin protects a file or directory of an index, and everything below a
+// directory, from being deleted by stormindexer
+type Pin struct {
+	ID           int64     `json:"id"`
+	IndexID      string    `json:"index_id"`
+	RelativePath string    `json:"relative_path"` // empty pins the whole index
+	Note         string    `json:"note,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Covers reports whether the pin protects a slash-separated path relative
+// to the root of its index
+func (p *Pin) Covers(relativePath string) bool {
+	return p.RelativePath == "" || relativePath == p.RelativePath ||
+		strings.HasPrefix(relativePath, p.RelativePath+"/")
+}
+
+// Pins are the pins of one index
+type Pins []*Pin
+
+// Covering returns the pin protecting a path, or nil
+func (ps Pins) Covering(relativePath string) *Pin {
+	for _, p := range ps {
+		if p.Covers(relativePath) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Within reports whether a path is protected or holds a protected path,
+// so that removing it as a whole would remove a pinned file
+func (ps Pins) Within(relativePath string) bool {
+	for _, p := range ps {
+		if p.Covers(relativePath) || relativePath == "" ||
+			strings.HasPrefix(p.RelativePath, relativePath+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ScanError records a path a scan could not read, after retrying transient
+// errors
+type ScanError struct {
+	IndexID    string    `json:"index_id"`
+	Path       string    `json:"path"`
+	Op         string    `json:"op"` // stat, readdir or read
+	Error      string    `json:"error"`
+	Attempts   int       `json:"attempts"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
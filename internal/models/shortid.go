@@ -0,0 +1,40 @@
+package models
+
+import "sort"
+
+// MinIDPrefix is the shortest ID prefix accepted in place of a full index ID
+const MinIDPrefix = 4
+
+// ShortIDs abbreviates index IDs for display, like git abbreviates commit
+// hashes: every ID is cut to at least minLength characters, and longer
+// where needed so that no abbreviation is a prefix of another ID. IDs
+// shorter than minLength are kept whole. The result maps each ID to its
+// abbreviation.
+func ShortIDs(ids []string, minLength int) map[string]string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+
+	short := make(map[string]string, len(sorted))
+	for i, id := range sorted {
+		length := minLength
+		// In sorted order, the IDs sharing the longest prefix with id are
+		// its neighbours
+		if i > 0 && sorted[i-1] != id {
+			length = max(length, commonPrefix(id, sorted[i-1])+1)
+		}
+		if i+1 < len(sorted) && sorted[i+1] != id {
+			length = max(length, commonPrefix(id, sorted[i+1])+1)
+		}
+		short[id] = id[:min(length, len(id))]
+	}
+	return short
+}
+
+// commonPrefix returns the length of the common prefix of a and b
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
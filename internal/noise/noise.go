@@ -0,0 +1,106 @@
+// Package noise classifies the files that operating systems, caches and
+// package managers leave on drives, so statistics can leave them out and
+// reflect the data users actually keep.
+package noise
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Categories of the built-in rules
+const (
+	OS       = "os"
+	Cache    = "cache"
+	Packages = "packages"
+	// Custom is the category of the rules of the noise setting
+	Custom = "custom"
+)
+
+// Rule classifies the files matching Pattern as Category
+type Rule struct {
+	Category string
+	Pattern  string
+}
+
+// Builtin returns the rules applied unless the noise_builtin setting turns
+// them off. Scans never index hidden files, so there are no rules for
+// .DS_Store, .cache or .npm.
+func Builtin() []Rule {
+	var rules []Rule
+	add := func(category string, patterns ...string) {
+		for _, pattern := range patterns {
+			rules = append(rules, Rule{Category: category, Pattern: pattern})
+		}
+	}
+	add(OS, "Thumbs.db", "ehthumbs.db", "desktop.ini", "$RECYCLE.BIN", "System Volume Information", "lost+found")
+	add(Cache, "Library/Caches", "__pycache__")
+	add(Packages, "node_modules", "bower_components", "site-packages", "go/pkg/mod")
+	return rules
+}
+
+// Classifier tells which category of noise a file belongs to
+type Classifier struct {
+	rules []compiled
+}
+
+type compiled struct {
+	category string
+	anchored bool
+	parts    []string
+}
+
+// New creates a classifier applying rules in order. A pattern is a glob
+// matched against consecutive components of the relative path, case
+// insensitively: "node_modules" matches that directory and everything
+// below it anywhere in an index, "Library/Caches" any Caches directory
+// inside a Library directory. A leading slash anchors the pattern at the
+// index root.
+func New(rules []Rule) (*Classifier, error) {
+	c := &Classifier{}
+	for _, rule := range rules {
+		pattern := strings.ToLower(filepath.ToSlash(rule.Pattern))
+		anchored := strings.HasPrefix(pattern, "/")
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("empty noise pattern %q", rule.Pattern)
+		}
+		parts := strings.Split(pattern, "/")
+		for _, part := range parts {
+			if _, err := path.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("invalid noise pattern %q: %w", rule.Pattern, err)
+			}
+		}
+		c.rules = append(c.rules, compiled{category: rule.Category, anchored: anchored, parts: parts})
+	}
+	return c, nil
+}
+
+// Classify returns the category of the first rule matching a path relative
+// to an index root, or "" when the file is not noise
+func (c *Classifier) Classify(relativePath string) string {
+	components := strings.Split(strings.ToLower(filepath.ToSlash(relativePath)), "/")
+	for _, rule := range c.rules {
+		last := len(components) - len(rule.parts)
+		if rule.anchored {
+			last = min(last, 0)
+		}
+		for start := 0; start <= last; start++ {
+			if matchAt(components[start:], rule.parts) {
+				return rule.category
+			}
+		}
+	}
+	return ""
+}
+
+func matchAt(components, parts []string) bool {
+	for i, part := range parts {
+		if ok, _ := path.Match(part, components[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package noise
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	c, err := New(append(Builtin(), Rule{Category: Custom, Pattern: "/scratch"}, Rule{Category: Custom, Pattern: "*.bak"}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"photos/2019/IMG_0001.jpg", ""},
+		{"photos/Thumbs.db", OS},
+		{"photos/THUMBS.DB", OS},
+		{"photos/desktop.ini", OS},
+		{"photos/.DS_Store", ""},
+		{"$RECYCLE.BIN/S-1-5-21/file.doc", OS},
+		{"code/app/node_modules/left-pad/index.js", Packages},
+		{"node_modules", Packages},
+		{"me/Library/Caches/com.apple.Safari/cache.db", Cache},
+		{"me/Library/Preferences/caches.plist", ""},
+		{"home/go/pkg/mod/github.com/x/y.go", Packages},
+		{"projects/go/pkg/main.go", ""},
+		{"scratch/tmp.txt", Custom},
+		{"work/scratch/tmp.txt", ""},
+		{"work/report.doc.bak", Custom},
+	}
+	for _, tt := range tests {
+		if got := c.Classify(tt.path); got != tt.want {
+			t.Errorf("Classify(%q): expected %q, got %q", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New([]Rule{{Category: Custom, Pattern: "[abc"}}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if _, err := New([]Rule{{Category: Custom, Pattern: "/"}}); err == nil {
+		t.Error("Expected an error for an empty pattern")
+	}
+}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// CSV renders results as comma-separated values with a header row
+type CSV struct{}
+
+var csvFileHeader = []string{"index", "path", "relative_path", "size", "mod_time", "checksum", "is_directory", "pinned"}
+
+func csvFileRow(f *database.FileWithIndex) []string {
+	return []string{
+		f.IndexName,
+		f.Path,
+		f.RelativePath,
+		strconv.FormatInt(f.Size, 10),
+		f.ModTime.Format(time.RFC3339),
+		f.Checksum,
+		strconv.FormatBool(f.IsDirectory),
+		strconv.FormatBool(f.Pinned),
+	}
+}
+
+func (CSV) Files(w io.Writer, list FileList) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvFileHeader)
+	for _, f := range list.Files {
+		cw.Write(csvFileRow(f))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (CSV) Duplicates(w io.Writer, sets []DuplicateSet) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"set"}, csvFileHeader...))
+	for i, set := range sets {
+		for _, f := range set.Files {
+			cw.Write(append([]string{strconv.Itoa(i + 1)}, csvFileRow(f)...))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (CSV) Indexes(w io.Writer, indexes []*models.Index) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "name", "root_path", "machine_id", "total_files", "total_size", "last_sync", "location", "checked_out_to", "due"})
+	for _, index := range indexes {
+		lastSync := ""
+		if !index.LastSync.IsZero() {
+			lastSync = index.LastSync.Format(time.RFC3339)
+		}
+		var borrower, due string
+		if index.Loan != nil {
+			borrower = index.Loan.Borrower
+			if !index.Loan.DueAt.IsZero() {
+				due = index.Loan.DueAt.Format(time.RFC3339)
+			}
+		}
+		cw.Write([]string{
+			index.ID,
+			index.Name,
+			index.RootPath,
+			index.MachineID,
+			strconv.FormatInt(index.TotalFiles, 10),
+			strconv.FormatInt(index.TotalSize, 10),
+			lastSync,
+			index.Location,
+			borrower,
+			due,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,46 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Exec delegates rendering to an external program. The program receives the
+// JSON rendering on stdin and the kind of data as its first argument.
+type Exec struct {
+	Command string
+	Args    []string
+}
+
+func (e *Exec) run(w io.Writer, kind string, render func(io.Writer) error) error {
+	var input bytes.Buffer
+	if err := render(&input); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(e.Command, append(append([]string{}, e.Args...), kind)...)
+	cmd.Stdin = &input
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("output plugin %s failed: %w", e.Command, err)
+	}
+	return nil
+}
+
+func (e *Exec) Files(w io.Writer, list FileList) error {
+	return e.run(w, "files", func(in io.Writer) error { return JSON{}.Files(in, list) })
+}
+
+func (e *Exec) Duplicates(w io.Writer, sets []DuplicateSet) error {
+	return e.run(w, "duplicates", func(in io.Writer) error { return JSON{}.Duplicates(in, sets) })
+}
+
+func (e *Exec) Indexes(w io.Writer, indexes []*models.Index) error {
+	return e.run(w, "indexes", func(in io.Writer) error { return JSON{}.Indexes(in, indexes) })
+}
@@ -0,0 +1,92 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// JSON renders results as indented JSON documents. Sizes are annotated with a
+// human-readable "size_human" field formatted by the humanize package.
+type JSON struct{}
+
+type jsonFile struct {
+	*models.FileEntry
+	SizeHuman string `json:"size_human"`
+	IndexName string `json:"index_name"`
+	IndexPath string `json:"index_path"`
+	Pinned    bool   `json:"pinned,omitempty"`
+}
+
+type jsonDuplicateSet struct {
+	Checksum  string     `json:"checksum"`
+	Copies    int        `json:"copies"`
+	Size      int64      `json:"size"`
+	SizeHuman string     `json:"size_human"`
+	Files     []jsonFile `json:"files"`
+}
+
+type jsonIndex struct {
+	*models.Index
+	TotalSizeHuman string     `json:"total_size_human"`
+	LastSync       *time.Time `json:"last_sync,omitempty"`
+}
+
+func toJSONFiles(files []*database.FileWithIndex) []jsonFile {
+	out := make([]jsonFile, 0, len(files))
+	for _, f := range files {
+		out = append(out, jsonFile{
+			FileEntry: f.FileEntry,
+			SizeHuman: humanize.Bytes(f.Size),
+			IndexName: f.IndexName,
+			IndexPath: f.IndexPath,
+			Pinned:    f.Pinned,
+		})
+	}
+	return out
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (JSON) Files(w io.Writer, list FileList) error {
+	return writeJSON(w, toJSONFiles(list.Files))
+}
+
+func (JSON) Duplicates(w io.Writer, sets []DuplicateSet) error {
+	out := make([]jsonDuplicateSet, 0, len(sets))
+	for _, set := range sets {
+		var size int64
+		if len(set.Files) > 0 {
+			size = set.Files[0].Size
+		}
+		out = append(out, jsonDuplicateSet{
+			Checksum:  set.Checksum,
+			Copies:    len(set.Files),
+			Size:      size,
+			SizeHuman: humanize.Bytes(size),
+			Files:     toJSONFiles(set.Files),
+		})
+	}
+	return writeJSON(w, out)
+}
+
+func (JSON) Indexes(w io.Writer, indexes []*models.Index) error {
+	out := make([]jsonIndex, 0, len(indexes))
+	for _, index := range indexes {
+		entry := jsonIndex{Index: index, TotalSizeHuman: humanize.Bytes(index.TotalSize)}
+		if !index.LastSync.IsZero() {
+			lastSync := index.LastSync
+			entry.LastSync = &lastSync
+		}
+		out = append(out, entry)
+	}
+	return writeJSON(w, out)
+}
@@ -0,0 +1,123 @@
+// Package output renders command results in pluggable formats.
+//
+// Built-in formats are "table", "json" and "csv". Additional formats can be
+// registered with Register, or provided by external programs: a format named
+// "xml" resolves to an executable called stormindexer-format-xml on the PATH,
+// and "exec:<command>" runs an arbitrary command. External formatters receive
+// the JSON rendering on stdin and the kind of data ("files", "duplicates" or
+// "indexes") as their first argument; whatever they print becomes the output.
+package output
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// FileList is a set of file results with an optional human-readable title
+type FileList struct {
+	Title string
+	Files []*database.FileWithIndex
+}
+
+// DuplicateSet groups files sharing the same checksum
+type DuplicateSet struct {
+	Checksum string
+	Files    []*database.FileWithIndex
+}
+
+// Formatter renders command results
+type Formatter interface {
+	Files(w io.Writer, list FileList) error
+	Duplicates(w io.Writer, sets []DuplicateSet) error
+	Indexes(w io.Writer, indexes []*models.Index) error
+}
+
+// PluginPrefix is the executable name prefix used to discover external formatters
+const PluginPrefix = "stormindexer-format-"
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Formatter{}
+)
+
+func init() {
+	Register("table", Table{})
+	Register("json", JSON{})
+	Register("csv", CSV{})
+}
+
+// Register makes a formatter available under name, replacing any previous one
+func Register(name string, f Formatter) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[strings.ToLower(name)] = f
+}
+
+// Names returns the registered format names in sorted order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the formatter for name. Unknown names fall back to an external
+// plugin on the PATH; "exec:<command>" always runs the given command.
+func Get(name string) (Formatter, error) {
+	if name == "" {
+		name = "table"
+	}
+
+	if command, ok := strings.CutPrefix(name, "exec:"); ok {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("exec format requires a command")
+		}
+		return &Exec{Command: fields[0], Args: fields[1:]}, nil
+	}
+
+	mu.RLock()
+	f, ok := registry[strings.ToLower(name)]
+	mu.RUnlock()
+	if ok {
+		return f, nil
+	}
+
+	if path, err := exec.LookPath(PluginPrefix + name); err == nil {
+		return &Exec{Command: path}, nil
+	}
+
+	return nil, fmt.Errorf("unknown output format: %s (available: %s, or a %s%s plugin on PATH)",
+		name, strings.Join(Names(), ", "), PluginPrefix, name)
+}
+
+// GroupDuplicates groups results by checksum, keeping the order in which
+// checksums first appear. Files without a checksum are dropped.
+func GroupDuplicates(files []*database.FileWithIndex) []DuplicateSet {
+	var sets []DuplicateSet
+	positions := make(map[string]int)
+	for _, file := range files {
+		if file.Checksum == "" {
+			continue
+		}
+		pos, ok := positions[file.Checksum]
+		if !ok {
+			pos = len(sets)
+			positions[file.Checksum] = pos
+			sets = append(sets, DuplicateSet{Checksum: file.Checksum})
+		}
+		sets[pos].Files = append(sets[pos].Files, file)
+	}
+	return sets
+}
@@ -0,0 +1,135 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+func testFiles() []*database.FileWithIndex {
+	mk := func(rel, checksum, index string, size int64) *database.FileWithIndex {
+		return &database.FileWithIndex{
+			FileEntry: &models.FileEntry{Path: "/" + index + "/" + rel, RelativePath: rel, Size: size, Checksum: checksum, ModTime: time.Now()},
+			IndexName: index,
+			IndexPath: "/" + index,
+		}
+	}
+	return []*database.FileWithIndex{
+		mk("b.jpg", "bbb", "nas", 2048),
+		mk("a.jpg", "aaa", "nas", 1024),
+		mk("copy/b.jpg", "bbb", "usb", 2048),
+		mk("notes.txt", "", "usb", 10),
+	}
+}
+
+func TestGet_BuiltinFormats(t *testing.T) {
+	for _, name := range []string{"table", "json", "csv", "JSON", ""} {
+		if _, err := Get(name); err != nil {
+			t.Errorf("Expected built-in format %q, got error: %v", name, err)
+		}
+	}
+
+	if _, err := Get("does-not-exist"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+type upperFormatter struct{ Table }
+
+func (upperFormatter) Indexes(w io.Writer, indexes []*models.Index) error {
+	for _, index := range indexes {
+		io.WriteString(w, strings.ToUpper(index.Name)+"\n")
+	}
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	Register("upper", upperFormatter{})
+	f, err := Get("upper")
+	if err != nil {
+		t.Fatalf("Expected registered format: %v", err)
+	}
+
+	var buf bytes.Buffer
+	f.Indexes(&buf, []*models.Index{{Name: "nas"}})
+	if buf.String() != "NAS\n" {
+		t.Errorf("Expected NAS, got %q", buf.String())
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	sets := GroupDuplicates(testFiles())
+	if len(sets) != 2 {
+		t.Fatalf("Expected 2 sets (files without checksum dropped), got %d", len(sets))
+	}
+	if sets[0].Checksum != "bbb" || len(sets[0].Files) != 2 {
+		t.Errorf("Expected first set bbb with 2 files, got %s with %d", sets[0].Checksum, len(sets[0].Files))
+	}
+}
+
+func TestJSON_Files(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (JSON{}).Files(&buf, FileList{Title: "ignored", Files: testFiles()}); err != nil {
+		t.Fatalf("JSON output failed: %v", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if len(decoded) != 4 {
+		t.Fatalf("Expected 4 files, got %d", len(decoded))
+	}
+	if decoded[0]["size_human"] != "2.0 KB" || decoded[0]["index_name"] != "nas" {
+		t.Errorf("Unexpected annotations: %v", decoded[0])
+	}
+}
+
+func TestTable_Files(t *testing.T) {
+	var buf bytes.Buffer
+	(Table{}).Files(&buf, FileList{Title: "Found 4 items", Files: testFiles()})
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "Found 4 items\n\n") {
+		t.Errorf("Expected title first, got %q", out)
+	}
+	if !strings.Contains(out, "copy/b.jpg") || !strings.Contains(out, "2.0 KB") {
+		t.Errorf("Expected file rows in table, got %q", out)
+	}
+}
+
+func TestGet_ExecPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell plugin not available on Windows")
+	}
+
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, PluginPrefix+"count")
+	script := "#!/bin/sh\necho \"$1\"\ngrep -c '\"relative_path\"'\n"
+	if err := os.WriteFile(plugin, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	f, err := Get("count")
+	if err != nil {
+		t.Fatalf("Expected plugin to be discovered: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Files(&buf, FileList{Files: testFiles()}); err != nil {
+		t.Fatalf("Plugin failed: %v", err)
+	}
+	if buf.String() != "files\n4\n" {
+		t.Errorf("Expected plugin output %q, got %q", "files\n4\n", buf.String())
+	}
+}
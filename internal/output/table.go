@@ -0,0 +1,157 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// Table renders aligned, human-readable tables
+type Table struct{}
+
+// shortChecksum truncates a checksum for display
+func shortChecksum(checksum string) string {
+	if checksum == "" {
+		return "-"
+	}
+	if len(checksum) > 12 {
+		return checksum[:12] + "..."
+	}
+	return checksum
+}
+
+func (Table) Files(w io.Writer, list FileList) error {
+	if list.Title != "" {
+		fmt.Fprintf(w, "%s\n\n", list.Title)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tSIZE\tMODIFIED\tCHECKSUM\tDRIVE")
+	fmt.Fprintln(tw, "----\t----\t--------\t--------\t-----")
+
+	for _, result := range list.Files {
+		sizeStr := "-"
+		if !result.IsDirectory {
+			sizeStr = humanize.Bytes(result.Size)
+		}
+
+		path := result.RelativePath
+		if result.Pinned {
+			path += " (pinned)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			path,
+			sizeStr,
+			result.ModTime.Format("2006-01-02 15:04:05"),
+			shortChecksum(result.Checksum),
+			result.IndexName,
+		)
+	}
+
+	return tw.Flush()
+}
+
+func (Table) Duplicates(w io.Writer, sets []DuplicateSet) error {
+	totalFiles := 0
+	for _, set := range sets {
+		totalFiles += len(set.Files)
+	}
+
+	fmt.Fprintf(w, "Found %d duplicate set(s) (%d files total)\n\n", len(sets), totalFiles)
+
+	for i, set := range sets {
+		fmt.Fprintln(w, "========================================")
+		fmt.Fprintf(w, "Checksum: %s (%d copies)\n", shortChecksum(set.Checksum), len(set.Files))
+		fmt.Fprintln(w, "========================================")
+
+		// Group by drive/index, keeping the order of first appearance
+		var drives []string
+		driveGroups := make(map[string][]*database.FileWithIndex)
+		for _, file := range set.Files {
+			if _, ok := driveGroups[file.IndexName]; !ok {
+				drives = append(drives, file.IndexName)
+			}
+			driveGroups[file.IndexName] = append(driveGroups[file.IndexName], file)
+		}
+
+		for _, driveName := range drives {
+			driveFiles := driveGroups[driveName]
+			fmt.Fprintf(w, "\n📁 Drive: %s (%s)\n", driveName, driveFiles[0].IndexPath)
+
+			for _, file := range driveFiles {
+				pinned := ""
+				if file.Pinned {
+					pinned = ", pinned"
+				}
+				fmt.Fprintf(w, "  • %s (%s, %s%s)\n",
+					file.RelativePath,
+					humanize.Bytes(file.Size),
+					file.ModTime.Format("2006-01-02 15:04:05"),
+					pinned,
+				)
+			}
+		}
+
+		if i < len(sets)-1 {
+			fmt.Fprintln(w)
+		}
+	}
+
+	return nil
+}
+
+// tableLocation describes where the drive of an index is: with its
+// borrower while checked out, on its shelf otherwise
+func tableLocation(index *models.Index) string {
+	if index.Loan == nil {
+		return index.Location
+	}
+	location := "with " + index.Loan.Borrower
+	if !index.Loan.DueAt.IsZero() {
+		location += ", due " + index.Loan.DueAt.Local().Format("2006-01-02")
+	}
+	if index.Loan.Overdue(time.Now()) {
+		location += " (OVERDUE)"
+	}
+	return location
+}
+
+// IDLength is the minimum length index IDs are shortened to in tables
+var IDLength = 12
+
+func (Table) Indexes(w io.Writer, indexes []*models.Index) error {
+	ids := make([]string, len(indexes))
+	for i, index := range indexes {
+		ids[i] = index.ID
+	}
+	shortIDs := models.ShortIDs(ids, IDLength)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPATH\tFILES\tSIZE\tLAST SYNC\tLOCATION")
+	fmt.Fprintln(tw, "---\t----\t----\t-----\t----\t---------\t--------")
+
+	for _, index := range indexes {
+		lastSync := "Never"
+		if !index.LastSync.IsZero() {
+			lastSync = index.LastSync.Format("2006-01-02 15:04:05")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			shortIDs[index.ID],
+			index.Name,
+			index.RootPath,
+			index.TotalFiles,
+			humanize.Bytes(index.TotalSize),
+			lastSync,
+			tableLocation(index),
+		)
+	}
+
+	return tw.Flush()
+}
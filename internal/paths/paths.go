@@ -0,0 +1,96 @@
+// Package paths handles index root and relative paths the same way on every
+// platform, so a catalog written on Windows can be read on Linux and the
+// other way round.
+//
+// Relative paths are always stored with forward slashes. Root paths keep the
+// style of the machine that indexed them: "/mnt/photos", "D:\Photos" or the
+// UNC share "\\nas\photos". Functions here are lexical and recognize Windows
+// roots by their shape, whatever the current platform.
+package paths
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IsWindows reports whether p is a Windows path: it starts with a drive
+// letter ("C:") or is a UNC path ("\\server\share")
+func IsWindows(p string) bool {
+	return hasDriveLetter(p) || isUNC(p)
+}
+
+func hasDriveLetter(p string) bool {
+	if len(p) < 2 || p[1] != ':' {
+		return false
+	}
+	c := p[0] | 0x20 // lower case
+	return c >= 'a' && c <= 'z'
+}
+
+func isUNC(p string) bool {
+	return len(p) > 2 && (p[0] == '\\' || p[0] == '/') && (p[1] == '\\' || p[1] == '/') &&
+		p[2] != '\\' && p[2] != '/'
+}
+
+// NormalizeRoot returns the canonical spelling of an index root: cleaned,
+// with Windows separators as backslashes and an upper case drive letter, so
+// "d:/Photos/" and "D:\Photos" name the same index
+func NormalizeRoot(root string) string {
+	if !IsWindows(root) {
+		return filepath.Clean(root)
+	}
+
+	p := strings.ReplaceAll(root, "/", `\`)
+	prefix := ""
+	if isUNC(p) {
+		prefix, p = `\\`, p[2:]
+	} else {
+		prefix, p = strings.ToUpper(p[:1])+":", p[2:]
+		if strings.HasPrefix(p, `\`) {
+			prefix += `\`
+		}
+	}
+
+	// Clean the rest with slash semantics, then restore backslashes
+	cleaned := path.Clean("/" + strings.ReplaceAll(p, `\`, "/"))
+	cleaned = strings.TrimPrefix(strings.ReplaceAll(cleaned, "/", `\`), `\`)
+	return prefix + cleaned
+}
+
+// ToSlash returns a relative path with forward slashes. On Windows the
+// native backslashes are converted; elsewhere a backslash is a valid name
+// character and is kept.
+func ToSlash(rel string) string {
+	return filepath.ToSlash(rel)
+}
+
+// Join returns the path of rel below root in the style of root. rel uses
+// forward slashes as stored in the catalog.
+func Join(root, rel string) string {
+	if rel == "" || rel == "." {
+		return root
+	}
+	if !IsWindows(root) {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+	rel = strings.ReplaceAll(path.Clean(strings.ReplaceAll(rel, `\`, "/")), "/", `\`)
+	if strings.HasSuffix(root, `\`) || strings.HasSuffix(root, "/") {
+		return root + rel
+	}
+	return root + `\` + rel
+}
+
+// Contains reports whether p is root or a path below it. Both must be
+// normalized with NormalizeRoot. Windows paths compare case-insensitively,
+// like the file systems they come from.
+func Contains(root, p string) bool {
+	if !IsWindows(root) {
+		return p == root || root == "/" && strings.HasPrefix(p, "/") ||
+			strings.HasPrefix(p, root+string(filepath.Separator))
+	}
+	if !IsWindows(p) || len(p) < len(root) || !strings.EqualFold(p[:len(root)], root) {
+		return false
+	}
+	return len(p) == len(root) || strings.HasSuffix(root, `\`) || p[len(root)] == '\\'
+}
@@ -0,0 +1,79 @@
+package paths
+
+import "testing"
+
+func TestIsWindows(t *testing.T) {
+	tests := map[string]bool{
+		`C:\Users`:        true,
+		`d:/photos`:       true,
+		`\\nas\share`:     true,
+		`//nas/share`:     true,
+		`/mnt/photos`:     false,
+		`relative/path`:   false,
+		`\\`:              false,
+		`1:\not-a-letter`: false,
+	}
+	for p, want := range tests {
+		if got := IsWindows(p); got != want {
+			t.Errorf("IsWindows(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestNormalizeRoot(t *testing.T) {
+	tests := map[string]string{
+		`d:/Photos/`:            `D:\Photos`,
+		`D:\Photos\2024\..`:     `D:\Photos`,
+		`c:\`:                   `C:\`,
+		`\\nas\share\`:          `\\nas\share`,
+		`//nas/share/photos/.`:  `\\nas\share\photos`,
+		`/mnt/photos/`:          `/mnt/photos`,
+		`/mnt/photos/../videos`: `/mnt/videos`,
+	}
+	for in, want := range tests {
+		if got := NormalizeRoot(in); got != want {
+			t.Errorf("NormalizeRoot(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		root, rel, want string
+	}{
+		{`D:\Photos`, "2024/img.jpg", `D:\Photos\2024\img.jpg`},
+		{`D:\`, "img.jpg", `D:\img.jpg`},
+		{`\\nas\share`, "a/b.txt", `\\nas\share\a\b.txt`},
+		{`D:\Photos`, `2024\img.jpg`, `D:\Photos\2024\img.jpg`},
+		{"/mnt/photos", "2024/img.jpg", "/mnt/photos/2024/img.jpg"},
+		{"/mnt/photos", ".", "/mnt/photos"},
+	}
+	for _, tt := range tests {
+		if got := Join(tt.root, tt.rel); got != tt.want {
+			t.Errorf("Join(%q, %q) = %q, want %q", tt.root, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		root, p string
+		want    bool
+	}{
+		{"/mnt/photos", "/mnt/photos", true},
+		{"/mnt/photos", "/mnt/photos/2024", true},
+		{"/mnt/photos", "/mnt/photos2", false},
+		{"/mnt/photos", "/mnt", false},
+		{"/", "/mnt", true},
+		{`D:\Photos`, `d:\photos\2024`, true},
+		{`D:\Photos`, `D:\Photos2`, false},
+		{`D:\`, `D:\Photos`, true},
+		{`\\nas\share`, `\\NAS\share\a`, true},
+		{`D:\Photos`, "/mnt/photos", false},
+	}
+	for _, tt := range tests {
+		if got := Contains(tt.root, tt.p); got != tt.want {
+			t.Errorf("Contains(%q, %q) = %v, want %v", tt.root, tt.p, got, tt.want)
+		}
+	}
+}
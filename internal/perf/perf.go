@@ -0,0 +1,147 @@
+// Package perf records how long a command and its SQL statements take, for
+// the opt-in performance log users attach to "this is slow" reports.
+package perf
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowestQueries is the number of statements kept in a log entry
+const SlowestQueries = 10
+
+// Recorder collects the statements run during one invocation. A nil
+// Recorder records nothing.
+type Recorder struct {
+	mu      sync.Mutex
+	start   time.Time
+	queries map[string]*query
+}
+
+type query struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+// New returns a Recorder whose command duration starts now
+func New() *Recorder {
+	return &Recorder{start: time.Now(), queries: make(map[string]*query)}
+}
+
+// Record adds one execution of a statement. Statements are grouped by their
+// redacted text.
+func (r *Recorder) Record(sql string, elapsed time.Duration) {
+	if r == nil {
+		return
+	}
+	sql = Redact(sql)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q, ok := r.queries[sql]
+	if !ok {
+		q = &query{}
+		r.queries[sql] = q
+	}
+	q.count++
+	q.total += elapsed
+	if elapsed > q.max {
+		q.max = elapsed
+	}
+}
+
+// Query is the timing of one statement in a log entry
+type Query struct {
+	SQL     string  `json:"sql"`
+	Count   int     `json:"count"`
+	TotalMS float64 `json:"total_ms"`
+	MaxMS   float64 `json:"max_ms"`
+}
+
+// Entry is one line of the performance log. It holds no arguments, flag
+// values or parameters, which may contain private paths.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Flags      []string  `json:"flags,omitempty"`
+	Failed     bool      `json:"failed"`
+	DurationMS float64   `json:"duration_ms"`
+	Statements int       `json:"statements"`
+	SQLMS      float64   `json:"sql_ms"`
+	Slowest    []Query   `json:"slowest"`
+}
+
+// Entry summarizes the invocation so far, with the statements that took the
+// longest in total
+func (r *Recorder) Entry(command string, flags []string, failed bool) Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := Entry{
+		Time:       r.start,
+		Command:    command,
+		Flags:      flags,
+		Failed:     failed,
+		DurationMS: ms(time.Since(r.start)),
+		Slowest:    []Query{},
+	}
+	for sql, q := range r.queries {
+		entry.Statements += q.count
+		entry.SQLMS += ms(q.total)
+		entry.Slowest = append(entry.Slowest, Query{SQL: sql, Count: q.count, TotalMS: ms(q.total), MaxMS: ms(q.max)})
+	}
+	sort.Slice(entry.Slowest, func(i, j int) bool {
+		if entry.Slowest[i].TotalMS != entry.Slowest[j].TotalMS {
+			return entry.Slowest[i].TotalMS > entry.Slowest[j].TotalMS
+		}
+		return entry.Slowest[i].SQL < entry.Slowest[j].SQL
+	})
+	if len(entry.Slowest) > SlowestQueries {
+		entry.Slowest = entry.Slowest[:SlowestQueries]
+	}
+	return entry
+}
+
+// Append writes an entry as one JSON line at the end of the log file
+func Append(path string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	placeholders  = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// Redact returns a statement with its literals replaced by "?" and its
+// whitespace collapsed. Parameters are never recorded, but queries built
+// with inline values would otherwise leak names and paths into the log.
+func Redact(sql string) string {
+	sql = stringLiteral.ReplaceAllString(sql, "?")
+	sql = numberLiteral.ReplaceAllString(sql, "?")
+	sql = placeholders.ReplaceAllString(sql, "?, ...")
+	return strings.TrimSpace(whitespace.ReplaceAllString(sql, " "))
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,73 @@
+package perf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM files WHERE path = '/home/me/secret.txt'": "SELECT * FROM files WHERE path = ?",
+		"SELECT 1 FROM t WHERE name LIKE 'it''s' ESCAPE '\\'":    "SELECT ? FROM t WHERE name LIKE ? ESCAPE ?",
+		"SELECT *\n\tFROM files\n\tWHERE id IN (?, ?, ?)":        "SELECT * FROM files WHERE id IN (?, ...)",
+		"SELECT * FROM attached0.files LIMIT 100":                "SELECT * FROM attached0.files LIMIT ?",
+	}
+	for in, want := range tests {
+		if got := Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRecorder_Entry(t *testing.T) {
+	r := New()
+	r.Record("SELECT * FROM files WHERE path = ?", 3*time.Millisecond)
+	r.Record("SELECT * FROM files   WHERE path = ?", 5*time.Millisecond)
+	r.Record("SELECT * FROM indexes", time.Millisecond)
+
+	entry := r.Entry("stormindexer find", []string{"name"}, false)
+	if entry.Statements != 3 {
+		t.Errorf("Expected 3 statements, got %d", entry.Statements)
+	}
+	if len(entry.Slowest) != 2 {
+		t.Fatalf("Expected 2 distinct statements, got %d", len(entry.Slowest))
+	}
+	first := entry.Slowest[0]
+	if first.Count != 2 || first.TotalMS != 8 || first.MaxMS != 5 {
+		t.Errorf("Expected 2 runs, 8ms total, 5ms max, got %+v", first)
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.Record("SELECT 1", time.Second)
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perf.log")
+	for i := 0; i < 2; i++ {
+		if err := Append(path, New().Entry("stormindexer list", nil, false)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON line: %v", err)
+	}
+	if entry.Command != "stormindexer list" {
+		t.Errorf("Expected command stormindexer list, got %s", entry.Command)
+	}
+}
@@ -0,0 +1,184 @@
+// Package policy evaluates the rules of the policies setting against the
+// files of an index, e.g. "videos older than 2 years on the laptop" or "more
+// than 500 GB of content that exists nowhere else", and runs the action of
+// the rules an index meets.
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/victor/stormindexer/internal/config"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/pkg/filter"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// CommandTimeout bounds how long the command of an exec action may run
+var CommandTimeout = 10 * time.Minute
+
+// Trigger is a policy whose conditions an index meets
+type Trigger struct {
+	Policy config.Policy
+	Index  *models.Index
+	Files  int
+	Size   int64
+
+	db   *database.DB
+	find database.FindOptions
+}
+
+// Summary describes the trigger in one line
+func (t *Trigger) Summary() string {
+	return fmt.Sprintf("%s: %d files (%s) on %s match %s",
+		t.Policy.Name, t.Files, humanize.Bytes(t.Size), t.Index.Name, t.Policy.Where)
+}
+
+// Evaluate checks every policy against the files of an index and returns
+// those it meets. Relative dates in the expressions are resolved against
+// now. Pinned files never match, so no action can delete them.
+func Evaluate(db *database.DB, policies []config.Policy, index *models.Index, now time.Time) ([]*Trigger, error) {
+	var triggers []*Trigger
+	for _, p := range policies {
+		where, err := filter.ParseExpr(p.Where, now)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		t := &Trigger{Policy: p, Index: index, db: db,
+			find: database.FindOptions{IndexIDs: []string{index.ID}, FileType: "file", Where: where, ExcludePinned: true}}
+		err = db.EachFoundFile(t.find, func(f *database.FileWithIndex) error {
+			t.Files++
+			t.Size += f.Size
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		if met, err := t.met(); err != nil {
+			return nil, err
+		} else if met {
+			triggers = append(triggers, t)
+		}
+	}
+	return triggers, nil
+}
+
+// met reports whether the matching files reach the thresholds of the policy
+func (t *Trigger) met() (bool, error) {
+	if t.Files == 0 {
+		return false, nil
+	}
+	if t.Policy.MinFiles == 0 && t.Policy.MinSize == "" {
+		return true, nil
+	}
+	if t.Policy.MinFiles > 0 && t.Files >= t.Policy.MinFiles {
+		return true, nil
+	}
+	if t.Policy.MinSize != "" {
+		minSize, err := filter.ParseBytes(t.Policy.MinSize)
+		if err != nil {
+			return false, fmt.Errorf("policy %s: invalid min_size: %w", t.Policy.Name, err)
+		}
+		return t.Size >= minSize, nil
+	}
+	return false, nil
+}
+
+// Unfired records the alerts among the triggers and returns the triggers
+// without the alerts that already fired for the index. The alerts of the
+// policies the index no longer meets are forgotten, so that they fire
+// again once it meets them anew. Exec actions run on every trigger.
+func Unfired(db *database.DB, policies []config.Policy, index *models.Index, triggers []*Trigger, now time.Time) ([]*Trigger, error) {
+	met := make(map[string]bool)
+	var unfired []*Trigger
+	for _, t := range triggers {
+		met[t.Policy.Name] = true
+		if t.Policy.Action != config.PolicyAlert {
+			unfired = append(unfired, t)
+			continue
+		}
+		fresh, err := db.RecordPolicyAlert(t.Policy.Name, index.ID, now)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", t.Policy.Name, err)
+		}
+		if fresh {
+			unfired = append(unfired, t)
+		}
+	}
+	for _, p := range policies {
+		if met[p.Name] || p.Action != config.PolicyAlert {
+			continue
+		}
+		if err := db.ClearPolicyAlert(p.Name, index.ID); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+	}
+	return unfired, nil
+}
+
+// Run runs the command of an exec action through sh, with the policy name,
+// index name and index root as $1, $2 and $3 and the paths of the matching
+// files on stdin, each followed by a NUL byte as for xargs -0, since names
+// may contain newlines. The environment also holds STORMINDEXER_POLICY,
+// STORMINDEXER_INDEX_NAME, STORMINDEXER_INDEX_ROOT, STORMINDEXER_INDEX_ID,
+// STORMINDEXER_MATCHED_FILES and STORMINDEXER_MATCHED_BYTES. Alerts have
+// nothing to run.
+func (t *Trigger) Run() error {
+	if t.Policy.Action != config.PolicyExec {
+		return nil
+	}
+
+	// The paths are spooled to a file rather than piped, so that the
+	// catalog is not read while the command runs and may update it
+	paths, err := os.CreateTemp("", "stormindexer-policy-*")
+	if err != nil {
+		return fmt.Errorf("policy %s: %w", t.Policy.Name, err)
+	}
+	defer os.Remove(paths.Name())
+	defer paths.Close()
+	w := bufio.NewWriter(paths)
+	err = t.db.EachFoundFile(t.find, func(f *database.FileWithIndex) error {
+		w.WriteString(f.Path)
+		return w.WriteByte(0)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		_, err = paths.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("policy %s: failed to list the matching files: %w", t.Policy.Name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.Policy.Command, "stormindexer", t.Policy.Name, t.Index.Name, t.Index.RootPath)
+	cmd.Env = append(os.Environ(),
+		"STORMINDEXER_POLICY="+t.Policy.Name,
+		"STORMINDEXER_INDEX_NAME="+t.Index.Name,
+		"STORMINDEXER_INDEX_ROOT="+t.Index.RootPath,
+		"STORMINDEXER_INDEX_ID="+t.Index.ID,
+		"STORMINDEXER_MATCHED_FILES="+strconv.Itoa(t.Files),
+		"STORMINDEXER_MATCHED_BYTES="+strconv.FormatInt(t.Size, 10),
+	)
+	cmd.Stdin = paths
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("policy %s: command timed out after %s", t.Policy.Name, CommandTimeout)
+		}
+		return fmt.Errorf("policy %s: command failed: %w", t.Policy.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/config"
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+func setupTestIndex(t *testing.T) (*database.DB, *models.Index) {
+	catalog := testutil.NewCatalog(t)
+	index := catalog.Index("laptop", "/laptop").
+		Add(&models.FileEntry{RelativePath: "old.mov", Size: 3000, ModTime: time.Now().AddDate(-3, 0, 0)}).
+		File("new.mov", 2000, "").
+		File("notes.txt", 10, "")
+	return catalog.DB, index.Index
+}
+
+func TestEvaluate(t *testing.T) {
+	db, index := setupTestIndex(t)
+
+	policies := []config.Policy{
+		{Name: "cold-videos", Where: "ext=mov and mtime<2y", Action: config.PolicyAlert},
+		{Name: "other-index", Where: "index=nas", Action: config.PolicyAlert},
+		{Name: "many-videos", Where: "ext=mov", MinFiles: 3, Action: config.PolicyAlert},
+		{Name: "big-videos", Where: "ext=mov", MinFiles: 3, MinSize: "5000", Action: config.PolicyAlert},
+		{Name: "huge-videos", Where: "ext=mov", MinSize: "1M", Action: config.PolicyAlert},
+	}
+	triggers, err := Evaluate(db, policies, index, time.Now())
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+
+	var names []string
+	for _, trigger := range triggers {
+		names = append(names, trigger.Policy.Name)
+	}
+	if strings.Join(names, ",") != "cold-videos,big-videos" {
+		t.Fatalf("Expected cold-videos and big-videos to trigger, got %v", names)
+	}
+	if triggers[0].Files != 1 || triggers[0].Size != 3000 {
+		t.Errorf("Expected 1 file of 3000 bytes for cold-videos, got %d files of %d bytes", triggers[0].Files, triggers[0].Size)
+	}
+	if triggers[1].Size != 5000 {
+		t.Errorf("Expected 5000 bytes for big-videos, got %d", triggers[1].Size)
+	}
+}
+
+func TestRun(t *testing.T) {
+	db, index := setupTestIndex(t)
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	policies := []config.Policy{{
+		Name:    "videos",
+		Where:   "ext=mov",
+		Action:  config.PolicyExec,
+		Command: `{ echo "$1 $2 $STORMINDEXER_MATCHED_FILES"; cat; } > "$OUT"`,
+	}}
+	triggers, err := Evaluate(db, policies, index, time.Now())
+	if err != nil || len(triggers) != 1 {
+		t.Fatalf("Expected 1 trigger, got %v (%v)", triggers, err)
+	}
+
+	t.Setenv("OUT", out)
+	if err := triggers[0].Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read command output: %v", err)
+	}
+	expected := "videos laptop 2\n/laptop/new.mov\x00/laptop/old.mov\x00"
+	if string(data) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(data))
+	}
+
+	triggers[0].Policy.Command = "exit 3"
+	if err := triggers[0].Run(); err == nil {
+		t.Error("Expected an error from a failing command")
+	}
+}
+
+func TestUnfired(t *testing.T) {
+	db, index := setupTestIndex(t)
+	policies := []config.Policy{
+		{Name: "videos", Where: "ext=mov", Action: config.PolicyAlert},
+		{Name: "listing", Where: "ext=mov", Action: config.PolicyExec, Command: "cat > /dev/null"},
+	}
+
+	unfired := func() []string {
+		triggers, err := Evaluate(db, policies, index, time.Now())
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		triggers, err = Unfired(db, policies, index, triggers, time.Now())
+		if err != nil {
+			t.Fatalf("Unfired failed: %v", err)
+		}
+		var names []string
+		for _, trigger := range triggers {
+			names = append(names, trigger.Policy.Name)
+		}
+		return names
+	}
+
+	if names := unfired(); strings.Join(names, ",") != "videos,listing" {
+		t.Fatalf("Expected both policies to trigger first, got %v", names)
+	}
+	if names := unfired(); strings.Join(names, ",") != "listing" {
+		t.Fatalf("Expected the alert to fire only once, got %v", names)
+	}
+
+	// Once the index no longer meets the policy, the alert fires again
+	policies[0].Where = "ext=mkv"
+	if names := unfired(); strings.Join(names, ",") != "listing" {
+		t.Fatalf("Expected only the exec policy to trigger, got %v", names)
+	}
+	policies[0].Where = "ext=mov"
+	if names := unfired(); strings.Join(names, ",") != "videos,listing" {
+		t.Fatalf("Expected the alert to fire again, got %v", names)
+	}
+}
+
+func TestEvaluate_LeavesOutPinned(t *testing.T) {
+	db, index := setupTestIndex(t)
+	if err := db.AddPin(&models.Pin{IndexID: index.ID, RelativePath: "old.mov", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddPin failed: %v", err)
+	}
+
+	policies := []config.Policy{
+		{Name: "cold-videos", Where: "ext=mov and mtime<2y", Action: config.PolicyAlert},
+		{Name: "videos", Where: "ext=mov", Action: config.PolicyExec, Command: `cat > "$OUT"`},
+	}
+	triggers, err := Evaluate(db, policies, index, time.Now())
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if len(triggers) != 1 || triggers[0].Files != 1 || triggers[0].Size != 2000 {
+		t.Fatalf("Expected only videos to trigger, for new.mov, got %v", triggers)
+	}
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	t.Setenv("OUT", out)
+	if err := triggers[0].Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "/laptop/new.mov\x00" {
+		t.Errorf("Expected only new.mov on stdin, got %q", string(data))
+	}
+}
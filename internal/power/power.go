@@ -0,0 +1,118 @@
+// Package power reads whether a laptop runs on battery, so background
+// scans can wait for the charger instead of draining it.
+package power
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned where the power status cannot be read
+var ErrUnsupported = errors.New("power status not available on this system")
+
+// Status is the power source of the machine
+type Status struct {
+	OnBattery bool
+	// Percent is the battery charge, or -1 without a battery or when the
+	// charge is unknown
+	Percent int
+}
+
+// Read returns the power status of this machine
+func Read() (*Status, error) {
+	return readPlatform()
+}
+
+// Policy tells when scans should wait
+type Policy struct {
+	// RequireAC defers scans while the machine runs on battery
+	RequireAC bool
+	// MinBattery defers scans on battery below this charge in percent
+	MinBattery int
+}
+
+// Active reports whether the policy can defer anything
+func (p Policy) Active() bool {
+	return p.RequireAC || p.MinBattery > 0
+}
+
+// Defer returns why a scan should wait under the given status, or "" when
+// it can run. A machine on AC power never waits.
+func (p Policy) Defer(status *Status) string {
+	if !status.OnBattery {
+		return ""
+	}
+	charge := "charge unknown"
+	if status.Percent >= 0 {
+		charge = fmt.Sprintf("%d%%", status.Percent)
+	}
+	if p.RequireAC {
+		return fmt.Sprintf("running on battery (%s)", charge)
+	}
+	if p.MinBattery > 0 && status.Percent >= 0 && status.Percent < p.MinBattery {
+		return fmt.Sprintf("battery at %d%%, below %d%%", status.Percent, p.MinBattery)
+	}
+	return ""
+}
+
+// readSysfs reads the power supplies Linux lists under dir, usually
+// /sys/class/power_supply. Without a mains supply, the battery status
+// tells whether it is discharging.
+func readSysfs(dir string) (*Status, error) {
+	supplies, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	read := func(supply, name string) string {
+		data, _ := os.ReadFile(filepath.Join(dir, supply, name))
+		return strings.TrimSpace(string(data))
+	}
+
+	status := &Status{Percent: -1}
+	var mains, online, battery, discharging bool
+	for _, supply := range supplies {
+		switch read(supply.Name(), "type") {
+		case "Mains", "USB":
+			mains = true
+			online = online || read(supply.Name(), "online") == "1"
+		case "Battery":
+			if read(supply.Name(), "scope") == "Device" {
+				continue // a mouse or headset, not the laptop
+			}
+			battery = true
+			discharging = discharging || read(supply.Name(), "status") == "Discharging"
+			if percent, err := strconv.Atoi(read(supply.Name(), "capacity")); err == nil && status.Percent < 0 {
+				status.Percent = percent
+			}
+		}
+	}
+	if mains {
+		status.OnBattery = battery && !online
+	} else {
+		status.OnBattery = discharging
+	}
+	return status, nil
+}
+
+var pmsetPercent = regexp.MustCompile(`(\d+)%`)
+
+// parsePmset reads the output of macOS `pmset -g batt`
+func parsePmset(out string) (*Status, error) {
+	status := &Status{Percent: -1}
+	switch {
+	case strings.Contains(out, "'Battery Power'"):
+		status.OnBattery = true
+	case strings.Contains(out, "'AC Power'"), strings.Contains(out, "'UPS Power'"):
+	default:
+		return nil, fmt.Errorf("unexpected pmset output: %q", out)
+	}
+	if m := pmsetPercent.FindStringSubmatch(out); m != nil {
+		status.Percent, _ = strconv.Atoi(m[1])
+	}
+	return status, nil
+}
@@ -0,0 +1,85 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSupply(t *testing.T, dir, name string, files map[string]string) {
+	os.MkdirAll(filepath.Join(dir, name), 0755)
+	for file, content := range files {
+		os.WriteFile(filepath.Join(dir, name, file), []byte(content+"\n"), 0644)
+	}
+}
+
+func TestReadSysfs(t *testing.T) {
+	dir := t.TempDir()
+	writeSupply(t, dir, "AC", map[string]string{"type": "Mains", "online": "0"})
+	writeSupply(t, dir, "BAT0", map[string]string{"type": "Battery", "status": "Discharging", "capacity": "42"})
+	writeSupply(t, dir, "hidpp_battery_0", map[string]string{"type": "Battery", "scope": "Device", "capacity": "5"})
+
+	status, err := readSysfs(dir)
+	if err != nil {
+		t.Fatalf("readSysfs failed: %v", err)
+	}
+	if !status.OnBattery || status.Percent != 42 {
+		t.Errorf("Expected on battery at 42%%, got %+v", status)
+	}
+
+	writeSupply(t, dir, "AC", map[string]string{"online": "1"})
+	if status, _ := readSysfs(dir); status.OnBattery {
+		t.Error("Expected AC power once the charger is online")
+	}
+
+	// A desktop lists no battery
+	desktop := t.TempDir()
+	writeSupply(t, desktop, "AC", map[string]string{"type": "Mains", "online": "1"})
+	if status, _ := readSysfs(desktop); status.OnBattery || status.Percent != -1 {
+		t.Errorf("Expected AC power without a charge, got %+v", status)
+	}
+
+	if _, err := readSysfs(filepath.Join(dir, "missing")); err != ErrUnsupported {
+		t.Errorf("Expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestParsePmset(t *testing.T) {
+	status, err := parsePmset("Now drawing from 'Battery Power'\n -InternalBattery-0 (id=4653155)\t76%; discharging; 5:12 remaining present: true\n")
+	if err != nil {
+		t.Fatalf("parsePmset failed: %v", err)
+	}
+	if !status.OnBattery || status.Percent != 76 {
+		t.Errorf("Expected on battery at 76%%, got %+v", status)
+	}
+
+	status, _ = parsePmset("Now drawing from 'AC Power'\n -InternalBattery-0 (id=4653155)\t100%; charged; 0:00 remaining present: true\n")
+	if status.OnBattery || status.Percent != 100 {
+		t.Errorf("Expected AC power at 100%%, got %+v", status)
+	}
+
+	if _, err := parsePmset("garbage"); err == nil {
+		t.Error("Expected an error for unexpected output")
+	}
+}
+
+func TestPolicyDefer(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		status   Status
+		deferred bool
+	}{
+		{Policy{RequireAC: true}, Status{OnBattery: false, Percent: 10}, false},
+		{Policy{RequireAC: true}, Status{OnBattery: true, Percent: 90}, true},
+		{Policy{MinBattery: 30}, Status{OnBattery: true, Percent: 29}, true},
+		{Policy{MinBattery: 30}, Status{OnBattery: true, Percent: 30}, false},
+		{Policy{MinBattery: 30}, Status{OnBattery: true, Percent: -1}, false},
+		{Policy{}, Status{OnBattery: true, Percent: 1}, false},
+	}
+	for _, tt := range tests {
+		reason := tt.policy.Defer(&tt.status)
+		if (reason != "") != tt.deferred {
+			t.Errorf("%+v with %+v: expected defer %v, got %q", tt.policy, tt.status, tt.deferred, reason)
+		}
+	}
+}
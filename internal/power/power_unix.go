@@ -0,0 +1,22 @@
+//go:build !windows
+
+package power
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+func readPlatform() (*Status, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return readSysfs("/sys/class/power_supply")
+	case "darwin":
+		out, err := exec.Command("pmset", "-g", "batt").Output()
+		if err != nil {
+			return nil, ErrUnsupported
+		}
+		return parsePmset(string(out))
+	}
+	return nil, ErrUnsupported
+}
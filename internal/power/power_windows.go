@@ -0,0 +1,33 @@
+//go:build windows
+
+package power
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// systemPowerStatus is SYSTEM_POWER_STATUS of the Windows API
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+var getSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+func readPlatform() (*Status, error) {
+	var s systemPowerStatus
+	if ok, _, _ := getSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s))); ok == 0 {
+		return nil, ErrUnsupported
+	}
+	status := &Status{Percent: -1, OnBattery: s.ACLineStatus == 0}
+	// 128 means no system battery, 255 an unknown status or charge
+	if s.BatteryFlag != 128 && s.BatteryFlag != 255 && s.BatteryLifePercent != 255 {
+		status.Percent = int(s.BatteryLifePercent)
+	}
+	return status, nil
+}
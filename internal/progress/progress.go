@@ -0,0 +1,296 @@
+// Package progress draws the progress bars of long-running commands on
+// stderr. Bars are only shown when stdout and stderr are terminals; when
+// either is redirected every constructor returns nil and the nil bars
+// ignore all calls, so callers never need to check.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"github.com/victor/stormindexer/pkg/humanize"
+	"golang.org/x/term"
+)
+
+// throttle is the minimum time between two redraws of a bar
+const throttle = 100 * time.Millisecond
+
+// descriptionWidth is the width group bars pad their description to
+const descriptionWidth = 32
+
+var (
+	enabledOnce sync.Once
+	enabled     bool
+)
+
+// Enabled reports whether progress bars are drawn: only when both stdout and
+// stderr are terminals, so piped output and log files stay free of control
+// characters
+func Enabled() bool {
+	enabledOnce.Do(func() {
+		enabled = term.IsTerminal(int(os.Stdout.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+	})
+	return enabled
+}
+
+// Bar is a single progress bar. A nil Bar ignores every call.
+type Bar struct {
+	pb *progressbar.ProgressBar
+
+	// Set for bars drawn as a line of a Group
+	group       *Group
+	description string
+	current     int64
+	total       int64
+	bytes       bool
+}
+
+// New creates a bar counting items up to total. A total of -1 draws an
+// indeterminate bar. Returns nil when progress is disabled.
+func New(description string, total int64) *Bar {
+	if !Enabled() {
+		return nil
+	}
+	return newBar(os.Stderr, description, total, false)
+}
+
+// NewBytes creates a bar counting bytes up to total, for use as the writer
+// of an io.Copy or io.TeeReader. Returns nil when progress is disabled.
+func NewBytes(description string, total int64) *Bar {
+	if !Enabled() {
+		return nil
+	}
+	return newBar(os.Stderr, description, total, true)
+}
+
+func newBar(w io.Writer, description string, total int64, bytes bool) *Bar {
+	return &Bar{pb: progressbar.NewOptions64(
+		total,
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWidth(40),
+		progressbar.OptionShowBytes(bytes),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetWriter(w),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "=",
+			SaucerHead:    ">",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(w, "\n")
+		}),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionThrottle(throttle),
+	)}
+}
+
+// Add advances the bar by n
+func (b *Bar) Add(n int64) {
+	if b == nil {
+		return
+	}
+	if b.group == nil {
+		_ = b.pb.Add64(n)
+		return
+	}
+	b.group.mu.Lock()
+	defer b.group.mu.Unlock()
+	b.current += n
+	b.group.draw(false)
+}
+
+// Write advances the bar by the length of p, so a bytes bar can sit behind
+// an io.MultiWriter or io.TeeReader
+func (b *Bar) Write(p []byte) (int, error) {
+	b.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// Describe changes the text in front of the bar
+func (b *Bar) Describe(description string) {
+	if b == nil {
+		return
+	}
+	if b.group == nil {
+		b.pb.Describe(description)
+		return
+	}
+	b.group.mu.Lock()
+	defer b.group.mu.Unlock()
+	b.description = description
+	b.group.draw(false)
+}
+
+// Reset starts the bar over with a new description and total, e.g. for the
+// next file of a worker
+func (b *Bar) Reset(description string, total int64) {
+	if b == nil {
+		return
+	}
+	if b.group == nil {
+		b.pb.Reset()
+		b.pb.ChangeMax64(total)
+		b.pb.Describe(description)
+		return
+	}
+	b.group.mu.Lock()
+	defer b.group.mu.Unlock()
+	b.description = description
+	b.current = 0
+	b.total = total
+	b.group.draw(false)
+}
+
+// Clear erases the bar, or the whole group of a group bar, so a message can
+// be printed. It is drawn again on the next update.
+func (b *Bar) Clear() {
+	if b == nil {
+		return
+	}
+	if b.group == nil {
+		_ = b.pb.Clear()
+		return
+	}
+	b.group.Clear()
+}
+
+// Close finishes the bar. Group bars are finished with their group.
+func (b *Bar) Close() {
+	if b == nil || b.group != nil {
+		return
+	}
+	_ = b.pb.Close()
+}
+
+// line renders a group bar as one line of text
+func (b *Bar) line() string {
+	description := b.description
+	if len(description) > descriptionWidth {
+		description = "..." + description[len(description)-descriptionWidth+3:]
+	}
+
+	count := fmt.Sprintf("%d", b.current)
+	if b.bytes {
+		count = humanize.Bytes(b.current)
+	}
+	if b.total <= 0 {
+		return fmt.Sprintf("%-*s %s", descriptionWidth, description, count)
+	}
+
+	max := fmt.Sprintf("%d", b.total)
+	if b.bytes {
+		max = humanize.Bytes(b.total)
+	}
+	current := b.current
+	if current > b.total {
+		current = b.total
+	}
+	const width = 30
+	filled := int(current * width / b.total)
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	return fmt.Sprintf("%-*s %3d%% [%s] (%s/%s)", descriptionWidth, description,
+		current*100/b.total, bar, count, max)
+}
+
+// Group draws several bars at once, one line each, e.g. an overall bar and
+// one bar per worker. Its bars may be updated from several goroutines. A nil
+// Group returns nil bars.
+type Group struct {
+	mu     sync.Mutex
+	w      io.Writer
+	bars   []*Bar
+	drawn  int // lines on screen from the last draw
+	last   time.Time
+	closed bool
+}
+
+// NewGroup creates an empty group. Returns nil when progress is disabled.
+func NewGroup() *Group {
+	if !Enabled() {
+		return nil
+	}
+	return newGroup(os.Stderr)
+}
+
+func newGroup(w io.Writer) *Group {
+	return &Group{w: w}
+}
+
+// Add appends a bar counting items up to total. A total of 0 or less shows
+// only the count.
+func (g *Group) Add(description string, total int64) *Bar {
+	return g.add(description, total, false)
+}
+
+// AddBytes appends a bar counting bytes up to total
+func (g *Group) AddBytes(description string, total int64) *Bar {
+	return g.add(description, total, true)
+}
+
+func (g *Group) add(description string, total int64, bytes bool) *Bar {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b := &Bar{group: g, description: description, total: total, bytes: bytes}
+	g.bars = append(g.bars, b)
+	g.draw(true)
+	return b
+}
+
+// Clear erases all bars of the group so a message can be printed below the
+// previous output. They are drawn again on the next update.
+func (g *Group) Clear() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.drawn > 0 {
+		fmt.Fprintf(g.w, "\033[%dA\r\033[J", g.drawn)
+	}
+	g.drawn = 0
+}
+
+// Close draws the final state of all bars and stops further updates
+func (g *Group) Close() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.draw(true)
+	g.closed = true
+}
+
+// draw redraws every bar over the previous draw, at most once per throttle
+// interval unless forced. The caller holds g.mu.
+func (g *Group) draw(force bool) {
+	if g.closed || (!force && time.Since(g.last) < throttle) {
+		return
+	}
+	g.last = time.Now()
+
+	var sb strings.Builder
+	if g.drawn > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", g.drawn)
+	}
+	for _, b := range g.bars {
+		sb.WriteString("\r\033[2K")
+		sb.WriteString(b.line())
+		sb.WriteString("\n")
+	}
+	g.drawn = len(g.bars)
+	io.WriteString(g.w, sb.String())
+}
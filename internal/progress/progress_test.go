@@ -0,0 +1,75 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNilBar(t *testing.T) {
+	var bar *Bar
+	bar.Add(1)
+	bar.Describe("ignored")
+	bar.Reset("ignored", 10)
+	bar.Clear()
+	bar.Close()
+
+	n, err := io.Copy(io.MultiWriter(io.Discard, bar), strings.NewReader("content"))
+	if err != nil || n != 7 {
+		t.Errorf("Expected a nil bar to accept writes, got %d, %v", n, err)
+	}
+
+	var group *Group
+	if group.Add("ignored", 1) != nil {
+		t.Errorf("Expected a nil group to return nil bars")
+	}
+	group.Close()
+}
+
+func TestGroup_DrawsEveryBar(t *testing.T) {
+	var out bytes.Buffer
+	group := newGroup(&out)
+	overall := group.Add("Rehashing", 4)
+	worker := group.AddBytes("worker 1", 2048)
+
+	overall.Add(2)
+	worker.Add(1024)
+	group.Close()
+
+	// Only the final state matters: the last two lines drawn
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected at least 2 lines, got %q", out.String())
+	}
+	last := lines[len(lines)-2:]
+	if !strings.Contains(last[0], "Rehashing") || !strings.Contains(last[0], " 50%") || !strings.Contains(last[0], "(2/4)") {
+		t.Errorf("Expected overall bar at 50%%, got %q", last[0])
+	}
+	if !strings.Contains(last[1], "worker 1") || !strings.Contains(last[1], " 50%") {
+		t.Errorf("Expected worker bar at 50%%, got %q", last[1])
+	}
+
+	// Updates after Close are not drawn
+	size := out.Len()
+	overall.Add(1)
+	if out.Len() != size {
+		t.Errorf("Expected no output after Close")
+	}
+}
+
+func TestGroup_ClearErasesDrawnLines(t *testing.T) {
+	var out bytes.Buffer
+	group := newGroup(&out)
+	group.Add("one", 1)
+	group.Add("two", 1)
+
+	out.Reset()
+	group.Clear()
+	if out.String() != "\033[2A\r\033[J" {
+		t.Errorf("Expected cursor to move up 2 lines and clear, got %q", out.String())
+	}
+	if group.drawn != 0 {
+		t.Errorf("Expected no drawn lines after Clear, got %d", group.drawn)
+	}
+}
@@ -0,0 +1,150 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/smart"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// DriveDigest is what happened to one index during a digest period
+type DriveDigest struct {
+	Index *models.Index
+	database.Activity
+	Removed int
+	// Stale counts checksums dropped because a changed file could not be read
+	Stale int64
+	// Health lists how the drive degraded since its first SMART capture
+	Health []string
+}
+
+// Digest summarizes the catalog activity of a period, e.g. the last week
+type Digest struct {
+	Since, Until time.Time
+	Drives       []*DriveDigest
+	FailedJobs   []*models.Job
+	Backups      []*models.Backup
+}
+
+// BuildDigest collects the activity of all indexes since the given time
+func BuildDigest(db *database.DB, since, now time.Time) (*Digest, error) {
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	digest := &Digest{Since: since, Until: now}
+	for _, index := range indexes {
+		drive := &DriveDigest{Index: index}
+		activity, err := db.GetActivity(index.ID, since)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read activity of %s: %w", index.Name, err)
+		}
+		drive.Activity = *activity
+
+		removed, err := db.ListRemovedFiles(index.ID, since)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read removed files of %s: %w", index.Name, err)
+		}
+		drive.Removed = len(removed)
+
+		coverage, err := db.GetChecksumCoverage(index.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checksum coverage of %s: %w", index.Name, err)
+		}
+		drive.Stale = coverage.Stale
+
+		if _, reasons, err := smart.Check(db, index.ID); err == nil {
+			drive.Health = reasons
+		}
+		digest.Drives = append(digest.Drives, drive)
+	}
+
+	jobs, err := db.ListJobs(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if job.Status == models.JobFailed && !job.StartedAt.Before(since) {
+			digest.FailedJobs = append(digest.FailedJobs, job)
+		}
+	}
+
+	digest.Backups, err = db.ListBackups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	return digest, nil
+}
+
+// WriteText writes the digest as plain text, suitable for the body of an email
+func (d *Digest) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "stormindexer digest: %s to %s\n",
+		d.Since.Local().Format("2006-01-02"), d.Until.Local().Format("2006-01-02"))
+
+	fmt.Fprintf(w, "\nNew data\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	quiet := 0
+	var duplicates, duplicateSize int64
+	for _, drive := range d.Drives {
+		duplicates += drive.DuplicateFiles
+		duplicateSize += drive.DuplicateSize
+		if drive.NewFiles == 0 && drive.Removed == 0 {
+			quiet++
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t+%d files\t%s\tremoved %d\n",
+			drive.Index.Name, drive.NewFiles, humanize.Bytes(drive.NewSize), drive.Removed)
+	}
+	tw.Flush()
+	if quiet == len(d.Drives) {
+		fmt.Fprintf(w, "  No new or removed files\n")
+	} else if quiet > 0 {
+		fmt.Fprintf(w, "  %d other drives unchanged\n", quiet)
+	}
+
+	fmt.Fprintf(w, "\nFailed scans\n")
+	if len(d.FailedJobs) == 0 {
+		fmt.Fprintf(w, "  None\n")
+	}
+	for _, job := range d.FailedJobs {
+		fmt.Fprintf(w, "  #%d %s %s, %s: %s\n", job.ID, job.Kind, job.Description,
+			job.StartedAt.Local().Format("2006-01-02 15:04"), job.Error)
+	}
+
+	fmt.Fprintf(w, "\nNew duplicates\n")
+	if duplicates == 0 {
+		fmt.Fprintf(w, "  None\n")
+	} else {
+		fmt.Fprintf(w, "  %d new files (%s) exist more than once in the catalog; run 'duplicates' for details\n",
+			duplicates, humanize.Bytes(duplicateSize))
+	}
+
+	fmt.Fprintf(w, "\nVerification\n")
+	issues := 0
+	for _, drive := range d.Drives {
+		for _, reason := range drive.Health {
+			fmt.Fprintf(w, "  ⚠ %s: drive health degraded: %s\n", drive.Index.Name, reason)
+			issues++
+		}
+		if drive.Stale > 0 {
+			fmt.Fprintf(w, "  %s: %d stale checksums; run 'rehash %s --stale'\n", drive.Index.Name, drive.Stale, drive.Index.Name)
+			issues++
+		}
+	}
+	for _, backup := range d.Backups {
+		if backup.CheckedAt.Before(d.Since) {
+			fmt.Fprintf(w, "  Backup %s not verified since %s; run 'backup check'\n",
+				backup.Path, backup.CheckedAt.Local().Format("2006-01-02"))
+			issues++
+		}
+	}
+	if issues == 0 {
+		fmt.Fprintf(w, "  All drives and backups OK\n")
+	}
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"sort"
+
+	"github.com/victor/stormindexer/internal/database"
+)
+
+// DirGroup is a set of directories holding identical trees
+type DirGroup struct {
+	Signature string
+	Dirs      []*Dir
+	Files     int64 // files in each copy
+	Size      int64 // size of each copy
+}
+
+// Wasted returns the bytes taken by the extra copies
+func (g *DirGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Dirs)-1)
+}
+
+// DuplicateDirs finds directory trees with the same relative paths and
+// checksums, within and across indexes. Only the topmost duplicated
+// directories are reported: when two copies of a folder are themselves part
+// of two identical parent folders, just the parents are listed.
+func DuplicateDirs(db *database.DB, indexIDs []string) ([]*DirGroup, error) {
+	bySignature := make(map[string]*DirGroup)
+	for _, indexID := range indexIDs {
+		root, err := LoadTree(db, indexID)
+		if err != nil {
+			return nil, err
+		}
+		root.Walk(func(d *Dir) {
+			if d.Signature == "" {
+				return
+			}
+			group, ok := bySignature[d.Signature]
+			if !ok {
+				group = &DirGroup{Signature: d.Signature, Files: d.TotalFiles, Size: d.TotalSize}
+				bySignature[d.Signature] = group
+			}
+			group.Dirs = append(group.Dirs, d)
+		})
+	}
+
+	var groups []*DirGroup
+	for _, group := range bySignature {
+		if len(group.Dirs) > 1 && !coveredByParents(group, bySignature) {
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted() != groups[j].Wasted() {
+			return groups[i].Wasted() > groups[j].Wasted()
+		}
+		return groups[i].Dirs[0].Path() < groups[j].Dirs[0].Path()
+	})
+	return groups, nil
+}
+
+// coveredByParents reports whether every directory of the group sits in a
+// parent that is itself duplicated the same number of times
+func coveredByParents(group *DirGroup, bySignature map[string]*DirGroup) bool {
+	parentSignature := ""
+	for _, d := range group.Dirs {
+		if d.Parent == nil || d.Parent.Signature == "" {
+			return false
+		}
+		if parentSignature != "" && d.Parent.Signature != parentSignature {
+			return false
+		}
+		parentSignature = d.Parent.Signature
+	}
+	return len(bySignature[parentSignature].Dirs) == len(group.Dirs)
+}
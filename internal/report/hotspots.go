@@ -0,0 +1,115 @@
+package report
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Hotspot is a directory holding content that is also stored elsewhere in
+// the catalog, or more than once within it
+type Hotspot struct {
+	Index *models.Index
+	Dir   string // relative to the index root, "" for the root
+	// DuplicateFiles and DuplicateBytes count the files of the directory
+	// whose content is stored more than once
+	DuplicateFiles int64
+	DuplicateBytes int64
+	// Reclaimable is what deleting the duplicates of the directory would
+	// free while keeping at least one copy of each content in the catalog
+	Reclaimable int64
+}
+
+// Ref names the directory as report similarity accepts it, "index:dir"
+func (h *Hotspot) Ref() string {
+	if h.Dir == "" {
+		return h.Index.Name
+	}
+	return h.Index.Name + ":" + h.Dir
+}
+
+// FindHotspots sums the duplicated content of the directories of the given
+// indexes, matching copies across the whole catalog, and ranks them by
+// reclaimable bytes. Files are grouped by the directory holding them, or
+// with depth > 0 by their directory cut to its first depth levels, which
+// sums a tree of small folders into one line.
+func FindHotspots(db *database.DB, indexes []*models.Index, depth int) ([]*Hotspot, error) {
+	copies, err := db.GetDuplicateCopies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicates: %w", err)
+	}
+
+	byID := make(map[string]*models.Index)
+	for _, index := range indexes {
+		byID[index.ID] = index
+	}
+
+	type key struct{ indexID, dir string }
+	hotspots := make(map[key]*Hotspot)
+	// Copies of each content per directory
+	counts := make(map[key]map[string]int64)
+	contents := make(map[string]*database.DuplicateCopy)
+	for _, c := range copies {
+		index, ok := byID[c.IndexID]
+		if !ok {
+			continue
+		}
+		k := key{c.IndexID, hotspotDir(c.RelativePath, depth)}
+		h := hotspots[k]
+		if h == nil {
+			h = &Hotspot{Index: index, Dir: k.dir}
+			hotspots[k] = h
+			counts[k] = make(map[string]int64)
+		}
+		h.DuplicateFiles++
+		h.DuplicateBytes += c.Size
+		counts[k][c.Checksum]++
+		contents[c.Checksum] = c
+	}
+
+	var result []*Hotspot
+	for k, h := range hotspots {
+		for checksum, n := range counts[k] {
+			c := contents[checksum]
+			if n == c.Copies {
+				// Every copy is here, one has to stay
+				n--
+			}
+			h.Reclaimable += n * c.Size
+		}
+		result = append(result, h)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Reclaimable != b.Reclaimable {
+			return a.Reclaimable > b.Reclaimable
+		}
+		if a.DuplicateBytes != b.DuplicateBytes {
+			return a.DuplicateBytes > b.DuplicateBytes
+		}
+		if a.Index.Name != b.Index.Name {
+			return a.Index.Name < b.Index.Name
+		}
+		return a.Dir < b.Dir
+	})
+	return result, nil
+}
+
+// hotspotDir returns the directory a file is counted in
+func hotspotDir(relativePath string, depth int) string {
+	dir := path.Dir(relativePath)
+	if dir == "." {
+		return ""
+	}
+	if depth > 0 {
+		if parts := strings.Split(dir, "/"); len(parts) > depth {
+			dir = strings.Join(parts[:depth], "/")
+		}
+	}
+	return dir
+}
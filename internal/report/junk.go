@@ -0,0 +1,123 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// junkNames are operating system droppings that are safe to delete (lower
+// case). Hidden ones such as .DS_Store or ._ AppleDouble files are never
+// indexed, so they cannot be listed here.
+var junkNames = map[string]bool{
+	"thumbs.db":   true,
+	"ehthumbs.db": true,
+	"desktop.ini": true,
+}
+
+// IsJunkName reports whether a file name is a known junk file
+func IsJunkName(name string) bool {
+	return junkNames[strings.ToLower(name)]
+}
+
+// Junk lists the clutter found in an index
+type Junk struct {
+	Root *Dir
+	// EmptyDirs holds the topmost directories without any file below them
+	EmptyDirs  []*Dir
+	EmptyFiles []*models.FileEntry
+	JunkFiles  []*models.FileEntry
+	JunkBytes  int64
+}
+
+// FindJunk collects empty directories, zero-byte files and known junk files
+func FindJunk(root *Dir) *Junk {
+	junk := &Junk{Root: root}
+	root.Walk(func(d *Dir) {
+		if d.Parent != nil && d.TotalFiles == 0 && (d.Parent.TotalFiles > 0 || d.Parent.Parent == nil) {
+			junk.EmptyDirs = append(junk.EmptyDirs, d)
+		}
+		for _, file := range d.Files {
+			switch {
+			case IsJunkName(filepath.Base(file.RelativePath)):
+				junk.JunkFiles = append(junk.JunkFiles, file)
+				junk.JunkBytes += file.Size
+			case file.Size == 0:
+				junk.EmptyFiles = append(junk.EmptyFiles, file)
+			}
+		}
+	})
+	return junk
+}
+
+// Clean deletes the junk files and empty directories from disk and from the
+// index. Zero-byte files are only deleted when emptyFiles is set, since some
+// are meaningful (lock files, markers). Directories are removed bottom-up
+// with os.Remove, so a directory holding unindexed (e.g. hidden) files is
+// kept. Pinned entries, and the directories above them, are never removed;
+// each pinned entry is reported as a failure. It returns the number of
+// entries removed and the failures.
+func (j *Junk) Clean(db *database.DB, emptyFiles bool) (int, []error) {
+	var removed int
+	var errs []error
+
+	if _, err := os.Stat(j.Root.Path()); err != nil {
+		return 0, []error{fmt.Errorf("%s is not online: %w", j.Root.Path(), err)}
+	}
+	pins, err := db.ListPins(j.Root.Index.ID)
+	if err != nil {
+		return 0, []error{fmt.Errorf("failed to list pins: %w", err)}
+	}
+
+	remove := func(path, relativePath string, indexed bool) {
+		if pins.Covering(relativePath) != nil {
+			errs = append(errs, fmt.Errorf("%s is pinned, not removed", relativePath))
+			return
+		}
+		if pins.Within(relativePath) {
+			return
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			return
+		}
+		if indexed {
+			if err := db.DeleteFile(path, j.Root.Index.ID); err != nil {
+				errs = append(errs, err)
+				return
+			}
+		}
+		removed++
+	}
+
+	files := j.JunkFiles
+	if emptyFiles {
+		files = append(files, j.EmptyFiles...)
+	}
+	for _, file := range files {
+		remove(file.DiskPath(), file.RelativePath, true)
+	}
+
+	for _, dir := range j.EmptyDirs {
+		var dirs []*Dir
+		dir.Walk(func(d *Dir) { dirs = append(dirs, d) })
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if dirs[i].Entry != nil {
+				remove(dirs[i].Entry.DiskPath(), dirs[i].RelativePath, true)
+			} else {
+				remove(dirs[i].Path(), dirs[i].RelativePath, false)
+			}
+		}
+	}
+
+	if err := db.UpdateIndexStats(j.Root.Index.ID); err != nil {
+		errs = append(errs, err)
+	}
+	return removed, errs
+}
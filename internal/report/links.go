@@ -0,0 +1,73 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// BrokenLink is a symlink whose target could not be found
+type BrokenLink struct {
+	File *models.FileEntry
+	// Target is the absolute path the link points to
+	Target string
+	Reason string
+}
+
+// LinkReport lists the symlinks of an index that point nowhere
+type LinkReport struct {
+	Links  int64
+	Broken []BrokenLink
+	// Unverified counts links pointing outside the index that were not checked on disk
+	Unverified int64
+}
+
+// BrokenLinks checks every symlink of an index. Targets inside the index
+// are looked up in the catalog; with onDisk the links are also resolved on
+// the drive, which also covers targets outside the index.
+func BrokenLinks(root *Dir, onDisk bool) *LinkReport {
+	indexed := make(map[string]bool)
+	var links []*models.FileEntry
+	root.Walk(func(d *Dir) {
+		indexed[d.RelativePath] = true
+		for _, file := range d.Files {
+			indexed[file.RelativePath] = true
+			if file.IsSymlink() {
+				links = append(links, file)
+			}
+		}
+	})
+
+	report := &LinkReport{Links: int64(len(links))}
+	rootPath := root.Path()
+	for _, link := range links {
+		target := link.LinkTarget
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link.DiskPath()), target)
+		}
+		target = filepath.Clean(target)
+
+		if rel, err := filepath.Rel(rootPath, target); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if rel == "." {
+				rel = ""
+			}
+			rel, _ = models.SanitizePath(rel)
+			if !indexed[rel] {
+				report.Broken = append(report.Broken, BrokenLink{File: link, Target: target, Reason: "target not in index"})
+				continue
+			}
+		} else if !onDisk {
+			report.Unverified++
+			continue
+		}
+
+		if onDisk {
+			if _, err := os.Stat(link.DiskPath()); err != nil {
+				report.Broken = append(report.Broken, BrokenLink{File: link, Target: target, Reason: "target missing on disk"})
+			}
+		}
+	}
+	return report
+}
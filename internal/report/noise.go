@@ -0,0 +1,54 @@
+package report
+
+import (
+	"sort"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/noise"
+)
+
+// NoiseUsage sums the files of an index in one category of noise
+type NoiseUsage struct {
+	Category string
+	Files    int64
+	Size     int64
+}
+
+// FindNoise classifies the files of an index and sums them per category of
+// noise, the largest first. The database must not exclude noise.
+func FindNoise(db *database.DB, indexID string, c *noise.Classifier) ([]*NoiseUsage, error) {
+	byCategory := make(map[string]*NoiseUsage)
+	err := db.EachFile(indexID, func(file *models.FileEntry) error {
+		if file.IsDirectory {
+			return nil
+		}
+		category := c.Classify(file.RelativePath)
+		if category == "" {
+			return nil
+		}
+		usage := byCategory[category]
+		if usage == nil {
+			usage = &NoiseUsage{Category: category}
+			byCategory[category] = usage
+		}
+		usage.Files++
+		usage.Size += file.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]*NoiseUsage, 0, len(byCategory))
+	for _, usage := range byCategory {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Size != usages[j].Size {
+			return usages[i].Size > usages[j].Size
+		}
+		return usages[i].Category < usages[j].Category
+	})
+	return usages, nil
+}
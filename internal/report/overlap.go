@@ -0,0 +1,142 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+)
+
+// supersededPercent is the coverage above which an index is considered a
+// copy of the other one
+const supersededPercent = 95
+
+// Overlap is a pair of indexes that nest or share much of their content.
+// For nested indexes A is the outer one; otherwise A is the index more
+// covered by B.
+type Overlap struct {
+	A, B *models.Index
+	// Nested is set when the root of B lies inside the root of A, and
+	// Skipped when the last scan of A left B out
+	Nested, Skipped bool
+	Content         *database.IndexOverlap
+}
+
+// CoverageA returns the percentage of A's content also present in B
+func (o *Overlap) CoverageA() float64 {
+	if o.Content == nil {
+		return 0
+	}
+	if o.Content.IndexA == o.A.ID {
+		return o.Content.CoverageA()
+	}
+	return o.Content.CoverageB()
+}
+
+// CoverageB returns the percentage of B's content also present in A
+func (o *Overlap) CoverageB() float64 {
+	if o.Content == nil {
+		return 0
+	}
+	if o.Content.IndexA == o.A.ID {
+		return o.Content.CoverageB()
+	}
+	return o.Content.CoverageA()
+}
+
+// Suggestion proposes how to consolidate the two indexes, or returns ""
+// when nothing needs to be done
+func (o *Overlap) Suggestion() string {
+	switch {
+	case o.Nested && o.Skipped:
+		return ""
+	case o.Nested:
+		return fmt.Sprintf("reindex %s to skip the nested root of %s, or remove one of the indexes", o.A.Name, o.B.Name)
+	case o.CoverageA() >= supersededPercent && o.CoverageB() >= supersededPercent:
+		return fmt.Sprintf("%s and %s hold the same content; unless one is a backup of the other, retire one", o.A.Name, o.B.Name)
+	case o.CoverageA() >= supersededPercent:
+		return fmt.Sprintf("%s is superseded by %s; consider retiring it", o.A.Name, o.B.Name)
+	}
+	return fmt.Sprintf("run 'report similarity %s %s' and consolidate the shared content", o.A.Name, o.B.Name)
+}
+
+// OverlapReport lists the overlapping indexes of the catalog
+type OverlapReport struct {
+	Overlaps []*Overlap
+	// TotalSize sums the sizes of all indexes, and DoubleCounted the bytes
+	// of it that are content already counted in another index
+	TotalSize     int64
+	DoubleCounted int64
+}
+
+// FindOverlaps finds the indexes of the same machine whose roots nest, and
+// the indexes whose content overlaps by at least minPercent of either side
+func FindOverlaps(db *database.DB, minPercent float64) (*OverlapReport, error) {
+	indexes, err := db.ListIndexes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	byID := make(map[string]*models.Index)
+	r := &OverlapReport{}
+	for _, index := range indexes {
+		byID[index.ID] = index
+		r.TotalSize += index.TotalSize
+	}
+
+	r.DoubleCounted, err = db.GetDoubleCountedBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute double-counted bytes: %w", err)
+	}
+	contents, err := db.GetIndexOverlaps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute content overlaps: %w", err)
+	}
+	content := make(map[[2]string]*database.IndexOverlap)
+	for _, c := range contents {
+		content[[2]string{c.IndexA, c.IndexB}] = c
+		content[[2]string{c.IndexB, c.IndexA}] = c
+	}
+
+	seen := make(map[*database.IndexOverlap]bool)
+	for _, a := range indexes {
+		for _, b := range indexes {
+			if a.ID == b.ID || a.MachineID != b.MachineID || a.RootPath == b.RootPath ||
+				!paths.Contains(paths.NormalizeRoot(a.RootPath), paths.NormalizeRoot(b.RootPath)) {
+				continue
+			}
+			o := &Overlap{A: a, B: b, Nested: true, Content: content[[2]string{a.ID, b.ID}]}
+			nested, err := db.ListNestedIndexes(a.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list nested indexes of %s: %w", a.Name, err)
+			}
+			for _, n := range nested {
+				o.Skipped = o.Skipped || n.IndexID == a.ID && n.NestedIndexID == b.ID
+			}
+			if o.Content != nil {
+				seen[o.Content] = true
+			}
+			r.Overlaps = append(r.Overlaps, o)
+		}
+	}
+
+	for _, c := range contents {
+		a, b := byID[c.IndexA], byID[c.IndexB]
+		if seen[c] || a == nil || b == nil {
+			continue
+		}
+		if c.CoverageA() < minPercent && c.CoverageB() < minPercent {
+			continue
+		}
+		if c.CoverageB() > c.CoverageA() {
+			a, b = b, a
+		}
+		r.Overlaps = append(r.Overlaps, &Overlap{A: a, B: b, Content: c})
+	}
+
+	sort.SliceStable(r.Overlaps, func(i, j int) bool {
+		return r.Overlaps[i].Nested && !r.Overlaps[j].Nested
+	})
+	return r, nil
+}
@@ -0,0 +1,512 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/indexer"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/noise"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+// seedFiles creates an index whose files map relative paths to checksums;
+// the size of each file is the length of its checksum
+func seedFiles(t *testing.T, db *database.DB, id string, files map[string]string) {
+	root := "/" + id
+	if err := db.CreateIndex(&models.Index{ID: id, Name: id, RootPath: root, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for rel, checksum := range files {
+		err := db.UpsertFile(&models.FileEntry{
+			Path:         filepath.Join(root, rel),
+			RelativePath: rel,
+			Size:         int64(len(checksum)),
+			ModTime:      time.Now(),
+			Checksum:     checksum,
+			IndexID:      id,
+			LastScanned:  time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to add file: %v", err)
+		}
+	}
+}
+
+func TestDuplicateDirs(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	photos := map[string]string{"2019/a.jpg": "aaaa", "2019/b.jpg": "bbbb", "2020/c.jpg": "cccc"}
+	drive1 := map[string]string{"other.txt": "1111"}
+	drive2 := map[string]string{"backup/other.txt": "2222"}
+	for rel, sum := range photos {
+		drive1["Photos/"+rel] = sum
+		drive2["backup/Photos/"+rel] = sum
+		drive2["backup/Photos-copy/"+rel] = sum
+	}
+	// A partial copy is not a duplicate tree
+	drive2["old/Photos/2019/a.jpg"] = "aaaa"
+	seedFiles(t, db, "drive1", drive1)
+	seedFiles(t, db, "drive2", drive2)
+
+	groups, err := DuplicateDirs(db, []string{"drive1", "drive2"})
+	if err != nil {
+		t.Fatalf("DuplicateDirs failed: %v", err)
+	}
+
+	if len(groups) != 1 {
+		for _, g := range groups {
+			for _, d := range g.Dirs {
+				t.Logf("group %s: %s", g.Signature[:8], d.Path())
+			}
+		}
+		t.Fatalf("Expected 1 duplicated tree, got %d", len(groups))
+	}
+	group := groups[0]
+	if len(group.Dirs) != 3 {
+		t.Errorf("Expected 3 copies, got %d", len(group.Dirs))
+	}
+	if group.Files != 3 || group.Size != 12 {
+		t.Errorf("Expected 3 files / 12 bytes per copy, got %d / %d", group.Files, group.Size)
+	}
+	if group.Wasted() != 24 {
+		t.Errorf("Expected 24 wasted bytes, got %d", group.Wasted())
+	}
+	for _, d := range group.Dirs {
+		if filepath.Base(d.RelativePath) != "Photos" && filepath.Base(d.RelativePath) != "Photos-copy" {
+			t.Errorf("Expected only the topmost duplicated folders, got %s", d.Path())
+		}
+	}
+}
+
+func TestDuplicateDirs_RequiresChecksums(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	files := make(map[string]string)
+	for i := 0; i < 3; i++ {
+		files[fmt.Sprintf("a/%d", i)] = ""
+		files[fmt.Sprintf("b/%d", i)] = ""
+	}
+	seedFiles(t, db, "drive", files)
+
+	groups, err := DuplicateDirs(db, []string{"drive"})
+	if err != nil {
+		t.Fatalf("DuplicateDirs failed: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Expected unhashed folders to be skipped, got %d groups", len(groups))
+	}
+}
+
+func TestCompareDirs(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	seedFiles(t, db, "old", map[string]string{
+		"backup/a.txt":       "aaaa",
+		"backup/b.txt":       "bbbb",
+		"backup/sub/c.txt":   "cccc",
+		"backup/unique.txt":  "uuuuuuuu",
+		"elsewhere/skip.txt": "ssss",
+	})
+	seedFiles(t, db, "new", map[string]string{
+		"a.txt":         "aaaa",
+		"renamed/b.txt": "bbbb",
+		"moved-c.txt":   "cccc",
+		"newer.txt":     "nnnn",
+	})
+
+	oldTree, _ := LoadTree(db, "old")
+	newTree, _ := LoadTree(db, "new")
+
+	s := CompareDirs(oldTree.Find("backup"), newTree.Find(""))
+	if s.SharedFiles != 3 || s.SharedBytes != 12 {
+		t.Errorf("Expected 3 shared files / 12 bytes, got %d / %d", s.SharedFiles, s.SharedBytes)
+	}
+	if len(s.OnlyInA) != 1 || s.OnlyInA[0].RelativePath != "backup/unique.txt" {
+		t.Errorf("Expected unique.txt only in the old backup, got %v", s.OnlyInA)
+	}
+	if s.OnlyInBFiles != 1 {
+		t.Errorf("Expected 1 file only in the new tree, got %d", s.OnlyInBFiles)
+	}
+	if s.CoverageA() != 60 {
+		t.Errorf("Expected 60%% of the old backup covered, got %.1f", s.CoverageA())
+	}
+	if s.CoverageB() != 75 {
+		t.Errorf("Expected 75%% of the new tree covered, got %.1f", s.CoverageB())
+	}
+
+	if oldTree.Find("missing") != nil {
+		t.Error("Expected nil for a missing directory")
+	}
+}
+
+func TestFindOverlaps(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	seedFiles(t, db, "old", map[string]string{"a.txt": "aaaa", "b.txt": "bbbb", "c.txt": "cccc"})
+	seedFiles(t, db, "new", map[string]string{"a.txt": "aaaa", "b.txt": "bbbb", "c.txt": "cccc", "d.txt": "dddddddddddd"})
+	seedFiles(t, db, "other", map[string]string{"a.txt": "aaaa", "x.txt": "xxxxxxxxxxxxxxxxxxxx"})
+	nested := &models.Index{ID: "nested", Name: "nested", RootPath: "/old/photos", CreatedAt: time.Now()}
+	if err := db.CreateIndex(nested); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	for _, id := range []string{"old", "new", "other"} {
+		db.UpdateIndexStats(id)
+	}
+
+	r, err := FindOverlaps(db, 50)
+	if err != nil {
+		t.Fatalf("FindOverlaps failed: %v", err)
+	}
+	if r.TotalSize != 60 {
+		t.Errorf("Expected a catalog size of 60, got %d", r.TotalSize)
+	}
+	// aaaa in three indexes, bbbb and cccc in two
+	if r.DoubleCounted != 16 {
+		t.Errorf("Expected 16 double-counted bytes, got %d", r.DoubleCounted)
+	}
+
+	if len(r.Overlaps) != 2 {
+		t.Fatalf("Expected 2 overlaps, got %d", len(r.Overlaps))
+	}
+	n := r.Overlaps[0]
+	if !n.Nested || n.A.ID != "old" || n.B.ID != "nested" || n.Skipped {
+		t.Errorf("Expected nested index inside old, got %s in %s", n.B.ID, n.A.ID)
+	}
+	o := r.Overlaps[1]
+	if o.A.ID != "old" || o.B.ID != "new" {
+		t.Fatalf("Expected old covered by new, got %s and %s", o.A.ID, o.B.ID)
+	}
+	if o.CoverageA() != 100 || o.CoverageB() != 50 {
+		t.Errorf("Expected 100%% and 50%% coverage, got %.1f and %.1f", o.CoverageA(), o.CoverageB())
+	}
+	if !strings.Contains(o.Suggestion(), "superseded") {
+		t.Errorf("Expected old to be reported as superseded, got %q", o.Suggestion())
+	}
+}
+
+func TestFindJunkAndClean(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	root := t.TempDir()
+	db.CreateIndex(&models.Index{ID: "drive", Name: "Drive", RootPath: root, CreatedAt: time.Now()})
+	add := func(rel, content string, isDir bool) {
+		path := filepath.Join(root, rel)
+		if isDir {
+			os.MkdirAll(path, 0755)
+		} else {
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte(content), 0644)
+		}
+		db.UpsertFile(&models.FileEntry{
+			Path: path, RelativePath: rel, Size: int64(len(content)), ModTime: time.Now(),
+			IndexID: "drive", LastScanned: time.Now(), IsDirectory: isDir,
+		})
+	}
+	add("photos", "", true)
+	add("photos/a.jpg", "jpeg", false)
+	add("photos/Thumbs.db", "thumbs", false)
+	add("photos/desktop.ini", "ini", false)
+	add("photos/.lock", "", false)
+	add("empty", "", true)
+	add("empty/nested", "", true)
+
+	tree, err := LoadTree(db, "drive")
+	if err != nil {
+		t.Fatalf("LoadTree failed: %v", err)
+	}
+	junk := FindJunk(tree)
+
+	if len(junk.JunkFiles) != 2 || junk.JunkBytes != 9 {
+		t.Errorf("Expected 2 junk files / 9 bytes, got %d / %d", len(junk.JunkFiles), junk.JunkBytes)
+	}
+	if len(junk.EmptyFiles) != 1 {
+		t.Errorf("Expected 1 zero-byte file, got %d", len(junk.EmptyFiles))
+	}
+	if len(junk.EmptyDirs) != 1 || junk.EmptyDirs[0].RelativePath != "empty" {
+		t.Fatalf("Expected only the topmost empty directory, got %v", junk.EmptyDirs)
+	}
+
+	removed, errs := junk.Clean(db, false)
+	if len(errs) != 0 {
+		t.Fatalf("Clean failed: %v", errs)
+	}
+	if removed != 4 {
+		t.Errorf("Expected 4 removed entries, got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(root, "empty")); err == nil {
+		t.Error("Expected empty directory to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(root, "photos/.lock")); err != nil {
+		t.Error("Zero-byte files should be kept unless requested")
+	}
+	if _, err := db.GetFile(filepath.Join(root, "photos/Thumbs.db"), "drive"); err == nil {
+		t.Error("Expected junk file to be removed from the index")
+	}
+}
+
+func TestFindJunk_IndexedTree(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	root := t.TempDir()
+	for rel, content := range map[string]string{
+		"photos/a.jpg":       "jpeg",
+		"photos/Thumbs.db":   "thumbs",
+		"photos/.DS_Store":   "ds",
+		"photos/._a.jpg":     "apple",
+		"mac-only/.DS_Store": "ds",
+	} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(rel)), 0755)
+		os.WriteFile(filepath.Join(root, rel), []byte(content), 0644)
+	}
+	db.CreateIndex(&models.Index{ID: "drive", Name: "Drive", RootPath: root, CreatedAt: time.Now()})
+	if err := indexer.NewIndexer(db, "drive", root).Index(false); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	tree, err := LoadTree(db, "drive")
+	if err != nil {
+		t.Fatalf("LoadTree failed: %v", err)
+	}
+	junk := FindJunk(tree)
+
+	// Hidden droppings are not indexed, only Thumbs.db is found
+	if len(junk.JunkFiles) != 1 || junk.JunkFiles[0].RelativePath != "photos/Thumbs.db" {
+		t.Errorf("Expected only photos/Thumbs.db as junk, got %v", junk.JunkFiles)
+	}
+	if len(junk.EmptyDirs) != 1 || junk.EmptyDirs[0].RelativePath != "mac-only" {
+		t.Fatalf("Expected mac-only to count as empty, got %v", junk.EmptyDirs)
+	}
+
+	// The directory still holds the hidden file, so cleaning keeps it
+	removed, errs := junk.Clean(db, false)
+	if removed != 1 || len(errs) != 1 {
+		t.Errorf("Expected Thumbs.db removed and mac-only kept, got %d removed, %v", removed, errs)
+	}
+	if _, err := os.Stat(filepath.Join(root, "mac-only", ".DS_Store")); err != nil {
+		t.Error("Expected the hidden file to be left alone")
+	}
+}
+
+func TestJunkClean_Pinned(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	root := t.TempDir()
+	db.CreateIndex(&models.Index{ID: "drive", Name: "Drive", RootPath: root, CreatedAt: time.Now()})
+	for _, rel := range []string{"photos/Thumbs.db", "photos/desktop.ini", "keep/nested/empty"} {
+		path := filepath.Join(root, rel)
+		isDir := !strings.Contains(rel, ".")
+		if isDir {
+			os.MkdirAll(path, 0755)
+		} else {
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte("junk"), 0644)
+		}
+		db.UpsertFile(&models.FileEntry{
+			Path: path, RelativePath: rel, Size: 4, ModTime: time.Now(),
+			IndexID: "drive", LastScanned: time.Now(), IsDirectory: isDir,
+		})
+	}
+	for _, rel := range []string{"photos/Thumbs.db", "keep/nested"} {
+		if err := db.AddPin(&models.Pin{IndexID: "drive", RelativePath: rel, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("AddPin failed: %v", err)
+		}
+	}
+
+	tree, err := LoadTree(db, "drive")
+	if err != nil {
+		t.Fatalf("LoadTree failed: %v", err)
+	}
+	removed, errs := FindJunk(tree).Clean(db, false)
+	if removed != 1 {
+		t.Errorf("Expected 1 removed entry, got %d", removed)
+	}
+	if len(errs) != 3 {
+		t.Errorf("Expected the 3 pinned entries to be refused, got %v", errs)
+	}
+	for _, rel := range []string{"photos/Thumbs.db", "keep/nested/empty"} {
+		if _, err := os.Stat(filepath.Join(root, rel)); err != nil {
+			t.Errorf("Expected pinned %s to be kept", rel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "photos/desktop.ini")); err == nil {
+		t.Error("Expected unpinned junk file to be deleted")
+	}
+}
+
+func TestFindHotspots(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	seedFiles(t, db, "photos", map[string]string{"2019/a.jpg": "aaaa", "2019/b.jpg": "bbbb", "2020/c.jpg": "cccccc", "d.jpg": "dd"})
+	seedFiles(t, db, "backup", map[string]string{"old/2019/a.jpg": "aaaa", "old/2019/b.jpg": "bbbb", "old/x/c.jpg": "cccccc", "old/x/c2.jpg": "cccccc"})
+	seedFiles(t, db, "solo", map[string]string{"x/e": "ee", "x/e2": "ee"})
+	indexes, _ := db.ListIndexes()
+
+	describe := func(hotspots []*Hotspot) string {
+		var lines []string
+		for _, h := range hotspots {
+			lines = append(lines, fmt.Sprintf("%s %d/%d/%d", h.Ref(), h.Reclaimable, h.DuplicateBytes, h.DuplicateFiles))
+		}
+		return strings.Join(lines, ", ")
+	}
+
+	hotspots, err := FindHotspots(db, indexes, 0)
+	if err != nil {
+		t.Fatalf("FindHotspots failed: %v", err)
+	}
+	expected := "backup:old/x 12/12/2, backup:old/2019 8/8/2, photos:2019 8/8/2, photos:2020 6/6/1, solo:x 2/4/2"
+	if got := describe(hotspots); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	var backup []*models.Index
+	for _, index := range indexes {
+		if index.ID == "backup" {
+			backup = append(backup, index)
+		}
+	}
+	hotspots, _ = FindHotspots(db, backup, 1)
+	if got := describe(hotspots); got != "backup:old 20/20/4" {
+		t.Errorf("Expected the backup tree summed at depth 1, got %s", got)
+	}
+}
+
+func TestBrokenLinks(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	seedFiles(t, db, "media", map[string]string{"movies/a.mkv": "aaaa"})
+	for rel, target := range map[string]string{
+		"links/ok":      "../movies/a.mkv",
+		"links/dir":     "/media/movies",
+		"links/moved":   "../movies/old.mkv",
+		"links/outside": "/elsewhere/b.mkv",
+	} {
+		db.UpsertFile(&models.FileEntry{
+			Path: filepath.Join("/media", rel), RelativePath: rel, ModTime: time.Now(),
+			IndexID: "media", LastScanned: time.Now(), LinkTarget: target,
+		})
+	}
+
+	tree, err := LoadTree(db, "media")
+	if err != nil {
+		t.Fatalf("LoadTree failed: %v", err)
+	}
+	report := BrokenLinks(tree, false)
+
+	if report.Links != 4 {
+		t.Errorf("Expected 4 links, got %d", report.Links)
+	}
+	if len(report.Broken) != 1 || report.Broken[0].File.RelativePath != "links/moved" {
+		t.Fatalf("Expected links/moved to be broken, got %v", report.Broken)
+	}
+	if report.Broken[0].Target != "/media/movies/old.mkv" {
+		t.Errorf("Expected resolved target /media/movies/old.mkv, got %s", report.Broken[0].Target)
+	}
+	if report.Unverified != 1 {
+		t.Errorf("Expected 1 unverified link outside the index, got %d", report.Unverified)
+	}
+}
+
+func TestBuildDigest(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	seedFiles(t, db, "drive1", map[string]string{"a.jpg": "aaaa", "b.jpg": "bbbb"})
+	seedFiles(t, db, "drive2", map[string]string{"copy/a.jpg": "aaaa"})
+	seedFiles(t, db, "drive3", map[string]string{})
+
+	job := &models.Job{Kind: "reindex", IndexID: "drive2", Description: "drive2", Status: models.JobRunning, StartedAt: time.Now()}
+	db.CreateJob(job)
+	db.FinishJob(job.ID, models.JobFailed, "drive not mounted", time.Now())
+
+	digest, err := BuildDigest(db, time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatalf("BuildDigest failed: %v", err)
+	}
+	if len(digest.Drives) != 3 {
+		t.Fatalf("Expected 3 drives, got %d", len(digest.Drives))
+	}
+	var drive1 *DriveDigest
+	for _, d := range digest.Drives {
+		if d.Index.ID == "drive1" {
+			drive1 = d
+		}
+	}
+	if drive1.NewFiles != 2 || drive1.NewSize != 8 || drive1.DuplicateFiles != 1 {
+		t.Errorf("Expected 2 new files (8 bytes), 1 duplicate on drive1, got %+v", drive1.Activity)
+	}
+	if len(digest.FailedJobs) != 1 {
+		t.Errorf("Expected 1 failed job, got %d", len(digest.FailedJobs))
+	}
+
+	var out strings.Builder
+	digest.WriteText(&out)
+	for _, want := range []string{"drive1  +2 files", "1 other drives unchanged", "drive not mounted", "2 new files (8 B) exist more than once"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected digest to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	// Nothing is new after the period
+	digest, _ = BuildDigest(db, time.Now().Add(time.Hour), time.Now())
+	if digest.Drives[0].NewFiles != 0 || len(digest.FailedJobs) != 0 {
+		t.Errorf("Expected no activity in a later period")
+	}
+
+	// First seen times stored in other zones are compared as instants
+	since := time.Now().Add(2 * time.Hour).In(time.FixedZone("", -2*3600))
+	for rel, seen := range map[string]time.Time{
+		"east.jpg": since.Add(-time.Hour).In(time.FixedZone("", 5*3600)),
+		"west.jpg": since.Add(6 * time.Hour).In(time.FixedZone("", -5*3600)),
+	} {
+		db.UpsertFile(&models.FileEntry{Path: "/drive3/" + rel, RelativePath: rel, Size: 1, ModTime: seen,
+			IndexID: "drive3", LastScanned: seen, FirstSeen: seen})
+	}
+	digest, _ = BuildDigest(db, since, since)
+	for _, d := range digest.Drives {
+		if d.Index.ID == "drive3" && d.NewFiles != 1 {
+			t.Errorf("Expected only west.jpg to be new on drive3, got %d new files", d.NewFiles)
+		}
+	}
+}
+
+func TestFindNoise(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	seedFiles(t, db, "home", map[string]string{
+		"photos/a.jpg":                 "aaaa",
+		"photos/Thumbs.db":             "tt",
+		"code/node_modules/x/index.js": "xxxxxxxx",
+		"code/node_modules/y.js":       "yy",
+	})
+
+	classifier, _ := noise.New(noise.Builtin())
+	usages, err := FindNoise(db, "home", classifier)
+	if err != nil {
+		t.Fatalf("FindNoise failed: %v", err)
+	}
+	if len(usages) != 2 {
+		t.Fatalf("Expected 2 categories, got %d", len(usages))
+	}
+	if usages[0].Category != noise.Packages || usages[0].Files != 2 || usages[0].Size != 10 {
+		t.Errorf("Expected packages first with 2 files / 10 bytes, got %+v", usages[0])
+	}
+	if usages[1].Category != noise.OS || usages[1].Files != 1 || usages[1].Size != 2 {
+		t.Errorf("Expected os with 1 file / 2 bytes, got %+v", usages[1])
+	}
+}
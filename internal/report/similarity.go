@@ -0,0 +1,92 @@
+package report
+
+import (
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Similarity compares the content of two directories by checksum
+type Similarity struct {
+	A, B *Dir
+
+	// SharedFiles and SharedBytes count the files of A whose content also exists in B
+	SharedFiles int64
+	SharedBytes int64
+	// SharedBytesB counts the bytes of B whose content also exists in A
+	SharedBytesB int64
+
+	// OnlyInA lists the files of A whose content is missing from B
+	OnlyInA []*models.FileEntry
+	// OnlyInBFiles counts the files of B whose content is missing from A
+	OnlyInBFiles int64
+	// Unhashed counts files of either side without a checksum, which cannot be compared
+	Unhashed int64
+}
+
+// CompareDirs computes how much content two directories share. Files are
+// matched by checksum, so renamed or moved files still count as shared.
+func CompareDirs(a, b *Dir) *Similarity {
+	s := &Similarity{A: a, B: b}
+
+	inA := checksums(a, &s.Unhashed)
+	inB := checksums(b, &s.Unhashed)
+
+	a.EachFile(func(file *models.FileEntry) {
+		if file.Checksum == "" {
+			return
+		}
+		if inB[file.Checksum] {
+			s.SharedFiles++
+			s.SharedBytes += file.Size
+		} else {
+			s.OnlyInA = append(s.OnlyInA, file)
+		}
+	})
+	b.EachFile(func(file *models.FileEntry) {
+		if file.Checksum == "" {
+			return
+		}
+		if inA[file.Checksum] {
+			s.SharedBytesB += file.Size
+		} else {
+			s.OnlyInBFiles++
+		}
+	})
+
+	return s
+}
+
+// CoverageA returns the percentage of A's bytes also present in B;
+// 100 means A is fully superseded by B
+func (s *Similarity) CoverageA() float64 {
+	return percent(s.SharedBytes, s.A.TotalSize)
+}
+
+// CoverageB returns the percentage of B's bytes also present in A
+func (s *Similarity) CoverageB() float64 {
+	return percent(s.SharedBytesB, s.B.TotalSize)
+}
+
+// Score returns the share of bytes common to both directories, relative to
+// their combined size
+func (s *Similarity) Score() float64 {
+	return percent(s.SharedBytes+s.SharedBytesB, s.A.TotalSize+s.B.TotalSize)
+}
+
+func checksums(d *Dir, unhashed *int64) map[string]bool {
+	sums := make(map[string]bool)
+	d.EachFile(func(file *models.FileEntry) {
+		if file.Checksum == "" {
+			*unhashed++
+			return
+		}
+		sums[file.Checksum] = true
+	})
+	return sums
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
@@ -0,0 +1,160 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+)
+
+// Dir is a directory of an index with the files below it aggregated
+type Dir struct {
+	Index        *models.Index
+	RelativePath string // "" for the index root
+	Parent       *Dir
+	Children     map[string]*Dir
+	Files        []*models.FileEntry // files directly in this directory
+	Entry        *models.FileEntry   // the directory row itself, nil for the root or implied parents
+
+	TotalFiles int64 // files in this directory and below
+	TotalSize  int64
+	// Signature hashes the relative paths and checksums of every file below
+	// the directory. It is empty when a file below has no checksum.
+	Signature string
+}
+
+// Path returns the absolute path of the directory
+func (d *Dir) Path() string {
+	return paths.Join(d.Index.RootPath, d.RelativePath)
+}
+
+// Walk calls fn for d and every directory below it, parents first
+func (d *Dir) Walk(fn func(*Dir)) {
+	fn(d)
+	for _, name := range d.childNames() {
+		d.Children[name].Walk(fn)
+	}
+}
+
+func (d *Dir) childNames() []string {
+	names := make([]string, 0, len(d.Children))
+	for name := range d.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTree reads an index into a directory tree
+func LoadTree(db *database.DB, indexID string) (*Dir, error) {
+	index, err := db.GetIndex(indexID)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &Dir{Index: index, Children: make(map[string]*Dir)}
+	dirFor := func(rel string) *Dir {
+		d := root
+		if rel == "" || rel == "." {
+			return d
+		}
+		for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+			child, ok := d.Children[name]
+			if !ok {
+				child = &Dir{
+					Index:        index,
+					RelativePath: path.Join(d.RelativePath, name),
+					Parent:       d,
+					Children:     make(map[string]*Dir),
+				}
+				d.Children[name] = child
+			}
+			d = child
+		}
+		return d
+	}
+
+	err = db.EachFile(indexID, func(file *models.FileEntry) error {
+		if file.RelativePath == "" || file.RelativePath == "." {
+			return nil
+		}
+		if file.IsDirectory {
+			dirFor(file.RelativePath).Entry = file
+		} else {
+			parent := dirFor(path.Dir(file.RelativePath))
+			parent.Files = append(parent.Files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	root.summarize()
+	return root, nil
+}
+
+// summarize computes totals and signatures bottom-up
+func (d *Dir) summarize() {
+	hash := sha256.New()
+	complete := true
+
+	sort.Slice(d.Files, func(i, j int) bool { return d.Files[i].RelativePath < d.Files[j].RelativePath })
+	for _, file := range d.Files {
+		d.TotalFiles++
+		d.TotalSize += file.Size
+		if file.Checksum == "" {
+			complete = false
+		}
+		hash.Write([]byte("f " + path.Base(file.RelativePath) + " " + file.Checksum + "\n"))
+	}
+
+	for _, name := range d.childNames() {
+		child := d.Children[name]
+		child.summarize()
+		d.TotalFiles += child.TotalFiles
+		d.TotalSize += child.TotalSize
+		if child.TotalFiles == 0 {
+			continue
+		}
+		if child.Signature == "" {
+			complete = false
+		}
+		hash.Write([]byte("d " + name + " " + child.Signature + "\n"))
+	}
+
+	if complete && d.TotalFiles > 0 {
+		d.Signature = hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// Find returns the directory at a path relative to d, or nil
+func (d *Dir) Find(rel string) *Dir {
+	rel = strings.Trim(filepath.ToSlash(filepath.Clean(rel)), "/")
+	if rel == "" || rel == "." {
+		return d
+	}
+	for _, name := range strings.Split(rel, "/") {
+		child, ok := d.Children[name]
+		if !ok {
+			return nil
+		}
+		d = child
+	}
+	return d
+}
+
+// EachFile calls fn for every file in d and below
+func (d *Dir) EachFile(fn func(*models.FileEntry)) {
+	d.Walk(func(dir *Dir) {
+		for _, file := range dir.Files {
+			fn(file)
+		}
+	})
+}
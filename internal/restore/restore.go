@@ -0,0 +1,225 @@
+package restore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Restored describes a file copied back from one of its available copies
+type Restored struct {
+	File   *models.FileEntry
+	Source string
+}
+
+// Missing describes a file for which no usable copy was found
+type Missing struct {
+	File   *models.FileEntry
+	Reason string
+}
+
+// Result summarizes a restore
+type Result struct {
+	Restored []Restored
+	Missing  []Missing
+	// Existing lists files left alone because the destination already
+	// holds a file of that name (see Restorer.Force)
+	Existing []*models.FileEntry
+	Bytes    int64
+}
+
+// Restorer copies files of an index from the best available copy in the catalog
+type Restorer struct {
+	db *database.DB
+	// DryRun only resolves the copies without writing anything
+	DryRun bool
+	// Force overwrites files already present at the destination
+	Force bool
+	// OnFile is called after each file is handled (e.g. to drive a progress bar)
+	OnFile func(file *models.FileEntry)
+	// Context stops the restore between two files when cancelled; the
+	// files restored so far are kept
+	Context context.Context
+}
+
+// NewRestorer creates a new restorer
+func NewRestorer(db *database.DB) *Restorer {
+	return &Restorer{db: db}
+}
+
+// Restore copies every file of an index below the relative directory under
+// (everything when empty) into dest. Each file is taken from its indexed
+// location when it is reachable, otherwise from any other online copy with
+// the same checksum. Copies are verified against the indexed checksum.
+// Files already present in dest are kept and reported unless Force is set.
+func (r *Restorer) Restore(indexID, under, dest string) (*Result, error) {
+	under = strings.Trim(filepath.ToSlash(filepath.Clean(under)), "/")
+	if under == "." {
+		under = ""
+	}
+
+	var files []*models.FileEntry
+	err := r.db.EachFile(indexID, func(file *models.FileEntry) error {
+		rel := filepath.ToSlash(file.RelativePath)
+		if under == "" || rel == under || strings.HasPrefix(rel, under+"/") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	result := &Result{}
+	for _, file := range files {
+		if r.Context != nil && r.Context.Err() != nil {
+			return result, r.Context.Err()
+		}
+
+		rel, _ := filepath.Rel(filepath.FromSlash(under), file.RelativePath)
+		target := filepath.Join(dest, diskRelative(file, rel))
+
+		if file.IsDirectory {
+			if !r.DryRun {
+				if err := os.MkdirAll(target, 0755); err != nil {
+					return result, fmt.Errorf("failed to create directory %s: %w", target, err)
+				}
+			}
+		} else if _, err := os.Lstat(target); err == nil && !r.Force {
+			result.Existing = append(result.Existing, file)
+		} else if source, reason := r.restoreFile(file, target); source != "" {
+			result.Restored = append(result.Restored, Restored{File: file, Source: source})
+			result.Bytes += file.Size
+		} else {
+			result.Missing = append(result.Missing, Missing{File: file, Reason: reason})
+		}
+
+		if r.OnFile != nil {
+			r.OnFile(file)
+		}
+	}
+
+	return result, nil
+}
+
+// diskRelative returns rel, a trailing part of the relative path of file,
+// spelled with the raw bytes of its name on disk so restored files keep
+// names that are not printable UTF-8
+func diskRelative(file *models.FileEntry, rel string) string {
+	if len(file.RawPath) == 0 || rel == "." {
+		return rel
+	}
+	// Escaping never touches separators, so both forms have as many parts
+	n := len(strings.Split(rel, string(filepath.Separator)))
+	parts := strings.Split(file.DiskPath(), string(filepath.Separator))
+	return filepath.Join(parts[len(parts)-n:]...)
+}
+
+// candidates lists the paths that may hold the content of a file, best first
+func (r *Restorer) candidates(file *models.FileEntry) ([]string, error) {
+	paths := []string{file.DiskPath()}
+	if file.Checksum == "" {
+		return paths, nil
+	}
+
+	copies, err := r.db.FindFilesByChecksum(file.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	// Prefer copies on the same index, then any other drive
+	for _, sameIndex := range []bool{true, false} {
+		for _, c := range copies {
+			if c.DiskPath() != file.DiskPath() && !c.IsDirectory && (c.IndexID == file.IndexID) == sameIndex {
+				paths = append(paths, c.DiskPath())
+			}
+		}
+	}
+	return paths, nil
+}
+
+// restoreFile copies the first usable candidate to target and returns its
+// path, or an empty path and the reason nothing could be restored
+func (r *Restorer) restoreFile(file *models.FileEntry, target string) (string, string) {
+	candidates, err := r.candidates(file)
+	if err != nil {
+		return "", err.Error()
+	}
+
+	reason := "no copy is online"
+	for _, source := range candidates {
+		info, err := os.Stat(source)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if info.Size() != file.Size {
+			reason = "online copies differ from the index"
+			continue
+		}
+		if r.DryRun {
+			return source, ""
+		}
+
+		if err := copyVerified(source, target, file); err != nil {
+			reason = err.Error()
+			continue
+		}
+		return source, ""
+	}
+
+	if file.Checksum == "" && reason == "no copy is online" {
+		reason = "not online and no checksum to find other copies"
+	}
+	return "", reason
+}
+
+// copyVerified copies source to target and checks the content against the
+// indexed checksum. The copy is written next to the target and only renamed
+// over it once verified, so a file already at the target survives a bad
+// copy, and so does a source that is the target itself.
+func copyVerified(source, target string, file *models.FileEntry) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".restore-*")
+	if err != nil {
+		return err
+	}
+	temp := out.Name()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && file.Checksum != "" && hex.EncodeToString(hash.Sum(nil)) != file.Checksum {
+		err = fmt.Errorf("checksum mismatch in %s", source)
+	}
+	if err == nil {
+		err = os.Chmod(temp, 0644)
+	}
+	if err == nil {
+		err = os.Chtimes(temp, file.ModTime, file.ModTime)
+	}
+	if err == nil {
+		err = os.Rename(temp, target)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+	return err
+}
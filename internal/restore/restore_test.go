@@ -0,0 +1,143 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+// addFile writes content below root and records it in the index
+func addFile(t *testing.T, db *database.DB, indexID, root, rel, content string) *models.FileEntry {
+	path := filepath.Join(root, rel)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	checksum, _ := models.CalculateChecksum(path)
+	file := &models.FileEntry{
+		Path:         path,
+		RelativePath: rel,
+		Size:         int64(len(content)),
+		ModTime:      time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+		Checksum:     checksum,
+		IndexID:      indexID,
+		LastScanned:  time.Now(),
+	}
+	db.UpsertFile(file)
+	return file
+}
+
+func TestRestore_FromOtherCopies(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	primary := filepath.Join(t.TempDir(), "primary")
+	backup := filepath.Join(t.TempDir(), "backup")
+	db.CreateIndex(&models.Index{ID: "primary", Name: "Primary", RootPath: primary, CreatedAt: time.Now()})
+	db.CreateIndex(&models.Index{ID: "backup", Name: "Backup", RootPath: backup, CreatedAt: time.Now()})
+
+	addFile(t, db, "primary", primary, "Projects/2022/online.txt", "still here")
+	addFile(t, db, "primary", primary, "Projects/2022/lost.txt", "backed up")
+	addFile(t, db, "primary", primary, "Projects/2022/gone.txt", "nowhere else")
+	addFile(t, db, "primary", primary, "Projects/2023/other.txt", "not requested")
+	addFile(t, db, "backup", backup, "old/lost-copy.txt", "backed up")
+
+	// The primary drive lost two files; only one has a copy elsewhere
+	os.Remove(filepath.Join(primary, "Projects/2022/lost.txt"))
+	os.Remove(filepath.Join(primary, "Projects/2022/gone.txt"))
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	result, err := NewRestorer(db).Restore("primary", "Projects/2022", dest)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if len(result.Restored) != 2 {
+		t.Fatalf("Expected 2 restored files, got %d", len(result.Restored))
+	}
+	if len(result.Missing) != 1 || result.Missing[0].File.RelativePath != "Projects/2022/gone.txt" {
+		t.Errorf("Expected gone.txt to be unrestorable, got %v", result.Missing)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "lost.txt"))
+	if err != nil || string(data) != "backed up" {
+		t.Errorf("Expected lost.txt restored from the backup, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "other.txt")); err == nil {
+		t.Error("Files outside --under should not be restored")
+	}
+
+	info, _ := os.Stat(filepath.Join(dest, "online.txt"))
+	if info == nil || !info.ModTime().Equal(time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Error("Expected restored file to keep its indexed modification time")
+	}
+}
+
+func TestRestore_RejectsModifiedCopy(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	root := t.TempDir()
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Index", RootPath: root, CreatedAt: time.Now()})
+	addFile(t, db, "idx", root, "doc.txt", "original")
+
+	// Same size, different content
+	os.WriteFile(filepath.Join(root, "doc.txt"), []byte("tampered"), 0644)
+
+	dest := t.TempDir()
+	result, err := NewRestorer(db).Restore("idx", "", dest)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(result.Missing) != 1 {
+		t.Fatalf("Expected the modified file to be unrestorable, got %d missing", len(result.Missing))
+	}
+	if _, err := os.Stat(filepath.Join(dest, "doc.txt")); err == nil {
+		t.Error("Expected mismatching copy to be removed")
+	}
+}
+
+func TestRestore_KeepsExistingFiles(t *testing.T) {
+	db := testutil.NewCatalog(t).DB
+	defer db.Close()
+
+	root := t.TempDir()
+	db.CreateIndex(&models.Index{ID: "idx", Name: "Index", RootPath: root, CreatedAt: time.Now()})
+	addFile(t, db, "idx", root, "doc.txt", "original")
+
+	dest := t.TempDir()
+	os.WriteFile(filepath.Join(dest, "doc.txt"), []byte("newer work"), 0644)
+
+	result, err := NewRestorer(db).Restore("idx", "", dest)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(result.Existing) != 1 || len(result.Restored) != 0 {
+		t.Errorf("Expected doc.txt to be reported as existing, got %d existing, %d restored", len(result.Existing), len(result.Restored))
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "doc.txt")); string(data) != "newer work" {
+		t.Errorf("Expected the existing file to be kept, got %q", data)
+	}
+
+	restorer := NewRestorer(db)
+	restorer.Force = true
+	if result, err = restorer.Restore("idx", "", dest); err != nil || len(result.Restored) != 1 {
+		t.Fatalf("Expected a forced restore to overwrite doc.txt, got %+v (%v)", result, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "doc.txt")); string(data) != "original" {
+		t.Errorf("Expected the forced restore to overwrite the file, got %q", data)
+	}
+
+	// Restoring an index onto itself reads and replaces the same file
+	if result, err = restorer.Restore("idx", "", root); err != nil || len(result.Restored) != 1 {
+		t.Fatalf("Expected a restore in place to succeed, got %+v (%v)", result, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "doc.txt")); string(data) != "original" {
+		t.Errorf("Expected the file restored in place to keep its content, got %q", data)
+	}
+}
@@ -0,0 +1,206 @@
+// Package smart captures drive health with smartmontools' smartctl and
+// tells when a drive got worse since the catalog first saw it.
+package smart
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// ErrNotInstalled is returned when smartctl is not in PATH
+var ErrNotInstalled = errors.New("smartctl not found in PATH, install smartmontools")
+
+// ATA attributes read from the SMART table
+const (
+	attrReallocated   = 5
+	attrPending       = 197
+	attrUncorrectable = 198
+)
+
+// Capture reads the health of the drive holding path
+func Capture(ctx context.Context, path string) (*models.DriveHealth, error) {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil, ErrNotInstalled
+	}
+	device, err := Device(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// smartctl sets informational bits in its exit status (e.g. "disk
+	// failing"), so the JSON is read whatever the status
+	out, runErr := exec.CommandContext(ctx, "smartctl", "--json", "-i", "-H", "-A", device).Output()
+	health, err := Parse(out)
+	if err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("smartctl %s: %w", device, runErr)
+		}
+		return nil, fmt.Errorf("smartctl %s: %w", device, err)
+	}
+	health.Device = device
+	health.CapturedAt = time.Now()
+	return health, nil
+}
+
+// Device returns the block device holding path: the whole disk rather than
+// the partition, since SMART describes the drive
+func Device(path string) (string, error) {
+	out, err := exec.Command("df", "-P", path).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the device of %s: %w", path, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Scan() // header
+	if !scanner.Scan() {
+		return "", fmt.Errorf("failed to find the device of %s", path)
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/dev/") {
+		return "", fmt.Errorf("%s is not on a local drive", path)
+	}
+	return wholeDisk(fields[0]), nil
+}
+
+var darwinPartition = regexp.MustCompile(`^(/dev/disk\d+)s\d+$`)
+
+func wholeDisk(device string) string {
+	switch runtime.GOOS {
+	case "linux":
+		out, err := exec.Command("lsblk", "-no", "pkname", device).Output()
+		if parent := strings.TrimSpace(string(out)); err == nil && parent != "" {
+			return "/dev/" + strings.Fields(parent)[0]
+		}
+	case "darwin":
+		if m := darwinPartition.FindStringSubmatch(device); m != nil {
+			return m[1]
+		}
+	}
+	return device
+}
+
+// smartctlOutput is the part of `smartctl --json` output we read
+type smartctlOutput struct {
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	Temperature struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		MediaErrors int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// Parse reads the output of `smartctl --json -i -H -A`
+func Parse(data []byte) (*models.DriveHealth, error) {
+	var out smartctlOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("unexpected output: %w", err)
+	}
+	if out.SmartStatus == nil {
+		for _, msg := range out.Smartctl.Messages {
+			if msg.Severity == "error" {
+				return nil, errors.New(msg.String)
+			}
+		}
+		return nil, errors.New("no SMART health status reported")
+	}
+
+	health := &models.DriveHealth{
+		Model:        out.ModelName,
+		Serial:       out.SerialNumber,
+		Passed:       out.SmartStatus.Passed,
+		PowerOnHours: out.PowerOnTime.Hours,
+		Temperature:  out.Temperature.Current,
+	}
+	for _, attr := range out.ATASmartAttributes.Table {
+		switch attr.ID {
+		case attrReallocated:
+			health.ReallocatedSectors = attr.Raw.Value
+		case attrPending:
+			health.PendingSectors = attr.Raw.Value
+		case attrUncorrectable:
+			health.UncorrectableSectors = attr.Raw.Value
+		}
+	}
+	if out.NVMeHealth != nil {
+		health.UncorrectableSectors = out.NVMeHealth.MediaErrors
+	}
+	return health, nil
+}
+
+// Degraded lists how a drive got worse between two captures. A failed
+// self-assessment is always reported.
+func Degraded(baseline, latest *models.DriveHealth) []string {
+	var reasons []string
+	if !latest.Passed {
+		reasons = append(reasons, "SMART self-assessment failed")
+	}
+	if baseline == nil {
+		return reasons
+	}
+	counters := []struct {
+		name        string
+		before, now int64
+	}{
+		{"reallocated sectors", baseline.ReallocatedSectors, latest.ReallocatedSectors},
+		{"pending sectors", baseline.PendingSectors, latest.PendingSectors},
+		{"uncorrectable sectors", baseline.UncorrectableSectors, latest.UncorrectableSectors},
+	}
+	for _, c := range counters {
+		if c.now > c.before {
+			reasons = append(reasons, fmt.Sprintf("%s %d → %d", c.name, c.before, c.now))
+		}
+	}
+	return reasons
+}
+
+// Check returns the latest capture of an index and how the drive degraded
+// since it was first captured. The capture is nil when the drive was never
+// captured.
+func Check(db *database.DB, indexID string) (*models.DriveHealth, []string, error) {
+	latest, err := db.LatestDriveHealth(indexID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	baseline, err := db.FirstDriveHealth(indexID, latest.Serial)
+	if err != nil {
+		return nil, nil, err
+	}
+	return latest, Degraded(baseline, latest), nil
+}
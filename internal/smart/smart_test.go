@@ -0,0 +1,132 @@
+package smart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
+)
+
+const ataOutput = `{
+  "smartctl": {"version": [7, 3], "exit_status": 0},
+  "model_name": "WDC WD40EFRX-68N32N0",
+  "serial_number": "WD-WCC7K0000000",
+  "smart_status": {"passed": true},
+  "power_on_time": {"hours": 21034},
+  "temperature": {"current": 34},
+  "ata_smart_attributes": {"table": [
+    {"id": 5, "name": "Reallocated_Sector_Ct", "raw": {"value": 8, "string": "8"}},
+    {"id": 9, "name": "Power_On_Hours", "raw": {"value": 21034, "string": "21034"}},
+    {"id": 197, "name": "Current_Pending_Sector", "raw": {"value": 2, "string": "2"}},
+    {"id": 198, "name": "Offline_Uncorrectable", "raw": {"value": 1, "string": "1"}}
+  ]}
+}`
+
+const nvmeOutput = `{
+  "model_name": "Samsung SSD 980 1TB",
+  "serial_number": "S64ANS0T000000",
+  "smart_status": {"passed": false},
+  "power_on_time": {"hours": 1200},
+  "temperature": {"current": 41},
+  "nvme_smart_health_information_log": {"critical_warning": 4, "media_errors": 3}
+}`
+
+const errorOutput = `{
+  "smartctl": {"messages": [{"string": "Smartctl open device: /dev/sdb failed: Permission denied", "severity": "error"}], "exit_status": 2}
+}`
+
+func TestParse_ATA(t *testing.T) {
+	health, err := Parse([]byte(ataOutput))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !health.Passed || health.Serial != "WD-WCC7K0000000" || health.PowerOnHours != 21034 || health.Temperature != 34 {
+		t.Errorf("Unexpected drive info: %+v", health)
+	}
+	if health.ReallocatedSectors != 8 || health.PendingSectors != 2 || health.UncorrectableSectors != 1 {
+		t.Errorf("Expected 8/2/1 bad sectors, got %d/%d/%d",
+			health.ReallocatedSectors, health.PendingSectors, health.UncorrectableSectors)
+	}
+}
+
+func TestParse_NVMe(t *testing.T) {
+	health, err := Parse([]byte(nvmeOutput))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if health.Passed {
+		t.Error("Expected failed self-assessment")
+	}
+	if health.UncorrectableSectors != 3 {
+		t.Errorf("Expected 3 media errors, got %d", health.UncorrectableSectors)
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	if _, err := Parse([]byte(errorOutput)); err == nil || err.Error() != "Smartctl open device: /dev/sdb failed: Permission denied" {
+		t.Errorf("Expected smartctl error message, got %v", err)
+	}
+	if _, err := Parse([]byte("")); err == nil {
+		t.Error("Expected error for empty output")
+	}
+}
+
+func TestDegraded(t *testing.T) {
+	baseline := &models.DriveHealth{Passed: true, ReallocatedSectors: 8}
+
+	if reasons := Degraded(baseline, baseline); len(reasons) != 0 {
+		t.Errorf("Expected no degradation, got %v", reasons)
+	}
+
+	latest := &models.DriveHealth{Passed: false, ReallocatedSectors: 24, PendingSectors: 1}
+	reasons := Degraded(baseline, latest)
+	if len(reasons) != 3 {
+		t.Fatalf("Expected 3 reasons, got %v", reasons)
+	}
+	if reasons[1] != "reallocated sectors 8 → 24" {
+		t.Errorf("Expected reallocated sectors 8 → 24, got %s", reasons[1])
+	}
+}
+
+func TestCheck(t *testing.T) {
+	catalog := testutil.NewCatalog(t)
+	catalog.AddIndex(&models.Index{ID: "idx", Name: "Backup", RootPath: "/mnt/backup", MachineID: "m"})
+	db := catalog.DB
+
+	if latest, _, err := Check(db, "idx"); err != nil || latest != nil {
+		t.Fatalf("Expected no capture, got %v (%v)", latest, err)
+	}
+
+	start := time.Now().Add(-48 * time.Hour)
+	captures := []*models.DriveHealth{
+		{Serial: "A", Passed: true, ReallocatedSectors: 0, CapturedAt: start},
+		{Serial: "A", Passed: true, ReallocatedSectors: 16, CapturedAt: start.Add(time.Hour)},
+		{Serial: "A", Passed: true, ReallocatedSectors: 16, CapturedAt: start.Add(2 * time.Hour)},
+	}
+	for _, h := range captures {
+		h.IndexID, h.Device = "idx", "/dev/sdb"
+		if err := db.RecordDriveHealth(h); err != nil {
+			t.Fatalf("Failed to record health: %v", err)
+		}
+	}
+
+	// Still degraded compared to the first capture, not just the previous one
+	latest, reasons, err := Check(db, "idx")
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if latest.ID != captures[2].ID {
+		t.Errorf("Expected latest capture %d, got %d", captures[2].ID, latest.ID)
+	}
+	if len(reasons) != 1 {
+		t.Errorf("Expected 1 reason, got %v", reasons)
+	}
+
+	// A replaced drive starts a new baseline
+	replaced := &models.DriveHealth{IndexID: "idx", Device: "/dev/sdb", Serial: "B", Passed: true, ReallocatedSectors: 2, CapturedAt: start.Add(3 * time.Hour)}
+	db.RecordDriveHealth(replaced)
+	if _, reasons, _ := Check(db, "idx"); len(reasons) != 0 {
+		t.Errorf("Expected no degradation for a new drive, got %v", reasons)
+	}
+}
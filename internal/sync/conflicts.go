@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// How CompareIndexes treats a file that differs between source and target
+const (
+	update   = iota // copy the source over the target
+	conflict        // the target changed too: record a conflict
+	keep            // keep the target copy, as a resolution chose
+)
+
+// pairConflicts holds what is known about conflicts of syncs from one index
+// to another
+type pairConflicts struct {
+	lastSync time.Time
+	open     map[string]*models.Conflict
+	// kept are the latest conflicts resolved by keeping the target copy
+	kept map[string]*models.Conflict
+}
+
+func (s *Syncer) loadConflicts(sourceIndexID, targetIndexID string) (*pairConflicts, error) {
+	lastSync, err := s.db.LastSync(sourceIndexID, targetIndexID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last sync: %w", err)
+	}
+	conflicts, err := s.db.PairConflicts(sourceIndexID, targetIndexID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conflicts: %w", err)
+	}
+
+	pc := &pairConflicts{
+		lastSync: lastSync,
+		open:     make(map[string]*models.Conflict),
+		kept:     make(map[string]*models.Conflict),
+	}
+	for _, c := range conflicts {
+		switch {
+		case c.ResolvedAt.IsZero():
+			pc.open[c.RelativePath] = c
+		case c.Resolution == models.PreferTarget:
+			pc.kept[c.RelativePath] = c
+		default:
+			delete(pc.kept, c.RelativePath)
+		}
+	}
+	return pc, nil
+}
+
+// classify decides what a sync does with a file whose source and target
+// copies differ. Open conflicts stay conflicts until resolved. A target
+// copy kept by a resolution is left alone while neither copy changes; a
+// later change of the source is a new conflict. Otherwise the target
+// conflicts when it was modified since the last sync, or, before the first
+// sync, when it is newer than the source. Copies with the same checksum
+// never conflict.
+func (pc *pairConflicts) classify(sourceFile, targetFile *models.FileEntry) int {
+	if sourceFile.Checksum != "" && sourceFile.Checksum == targetFile.Checksum {
+		return update
+	}
+	if _, ok := pc.open[sourceFile.RelativePath]; ok {
+		return conflict
+	}
+	if c, ok := pc.kept[sourceFile.RelativePath]; ok && sameFile(targetFile, c.TargetSize, c.TargetModTime) {
+		if sameFile(sourceFile, c.SourceSize, c.SourceModTime) {
+			return keep
+		}
+		return conflict
+	}
+
+	changedSince := sourceFile.ModTime
+	if !pc.lastSync.IsZero() {
+		changedSince = pc.lastSync
+	}
+	if targetFile.ModTime.Unix() > changedSince.Unix() {
+		return conflict
+	}
+	return update
+}
+
+// sameFile reports whether a file still has the given size and mtime
+func sameFile(file *models.FileEntry, size int64, modTime time.Time) bool {
+	return file.Size == size && file.ModTime.Unix() == modTime.Unix()
+}
+
+func newConflict(sourceFile, targetFile *models.FileEntry) *models.Conflict {
+	return &models.Conflict{
+		SourceIndexID:  sourceFile.IndexID,
+		TargetIndexID:  targetFile.IndexID,
+		RelativePath:   sourceFile.RelativePath,
+		SourcePath:     sourceFile.Path,
+		SourceSize:     sourceFile.Size,
+		SourceModTime:  sourceFile.ModTime,
+		SourceChecksum: sourceFile.Checksum,
+		TargetPath:     targetFile.Path,
+		TargetSize:     targetFile.Size,
+		TargetModTime:  targetFile.ModTime,
+		TargetChecksum: targetFile.Checksum,
+		DetectedAt:     time.Now(),
+	}
+}
+
+// skipped returns the relative paths a sync must not touch: conflicts and
+// kept target copies
+func (r *SyncResult) skipped() map[string]bool {
+	skip := make(map[string]bool)
+	for _, c := range r.Conflicts {
+		skip[c.RelativePath] = true
+	}
+	for _, file := range r.KeptFiles {
+		skip[file.RelativePath] = true
+	}
+	return skip
+}
+
+// writeRsyncExcludes writes the skipped paths to a temporary rsync exclude
+// file and returns its name. Patterns are anchored at the transfer root;
+// wildcards in names are escaped, which rsync only honours in patterns that
+// contain a wildcard.
+func writeRsyncExcludes(skip map[string]bool) (string, error) {
+	f, err := os.CreateTemp("", "stormindexer-exclude-*")
+	if err != nil {
+		return "", err
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	for relativePath := range skip {
+		pattern := relativePath
+		if strings.ContainsAny(pattern, "*?[") {
+			pattern = escaper.Replace(pattern)
+		}
+		fmt.Fprintf(f, "/%s\n", pattern)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// ResolveConflict resolves a sync conflict by keeping the copy of the
+// preferred side: models.PreferSource copies the source over the target,
+// models.PreferTarget keeps the target copy, which later syncs leave alone
+// until either copy changes, and models.PreferNewest keeps the copy
+// modified last. It returns the side kept.
+func (s *Syncer) ResolveConflict(c *models.Conflict, prefer string) (string, error) {
+	if !c.ResolvedAt.IsZero() {
+		return "", fmt.Errorf("conflict %d is already resolved", c.ID)
+	}
+
+	side := prefer
+	switch prefer {
+	case models.PreferSource, models.PreferTarget:
+	case models.PreferNewest:
+		side = c.Newest()
+	default:
+		return "", fmt.Errorf("invalid preference %q: use source, target or newest", prefer)
+	}
+
+	if side == models.PreferSource {
+		if err := s.copyConflictSource(c); err != nil {
+			return "", err
+		}
+	}
+	if err := s.db.ResolveConflict(c.ID, side, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to resolve conflict %d: %w", c.ID, err)
+	}
+	return side, nil
+}
+
+// copyConflictSource copies the source copy of a conflicted file over the
+// target copy and records it in the target index
+func (s *Syncer) copyConflictSource(c *models.Conflict) error {
+	sourceIndex, err := s.db.GetIndex(c.SourceIndexID)
+	if err != nil {
+		return fmt.Errorf("failed to get source index: %w", err)
+	}
+	targetIndex, err := s.db.GetIndex(c.TargetIndexID)
+	if err != nil {
+		return fmt.Errorf("failed to get target index: %w", err)
+	}
+	sourceFile, err := s.db.GetFile(c.SourcePath, c.SourceIndexID)
+	if err != nil {
+		return fmt.Errorf("%s is no longer in the source index", c.RelativePath)
+	}
+
+	targetFile := syncedEntry(sourceFile, sourceIndex.RootPath, targetIndex.RootPath, targetIndex.ID)
+	if err := copyFile(sourceFile, targetFile.DiskPath(), nil); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", c.RelativePath, err)
+	}
+	if err := s.db.UpsertFile(targetFile); err != nil {
+		return fmt.Errorf("failed to update %s: %w", targetFile.Path, err)
+	}
+	return s.db.UpdateIndexStats(targetIndex.ID)
+}
@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/internal/progress"
+)
+
+// useRsync reports whether a sync between two roots can run rsync, and why
+// not. rsync reads "C:" as a remote host and has no notion of UNC shares, so
+// Windows roots are always copied directly.
+func useRsync(sourceRootPath, targetRootPath string) (bool, string) {
+	if paths.IsWindows(sourceRootPath) || paths.IsWindows(targetRootPath) {
+		return false, "Windows paths are not supported by rsync"
+	}
+	if _, err := exec.LookPath("rsync"); err != nil {
+		return false, "rsync not found in PATH"
+	}
+	return true, ""
+}
+
+// copyFiles copies the new and updated files of a comparison to the target
+// root, keeping their modification times. With deleteExtra the indexed
+// target files missing from the source are removed, except pinned ones.
+// Unlike rsync --delete, files the target index does not know about are
+// left alone.
+func (s *Syncer) copyFiles(result *SyncResult, sourceRootPath, targetRootPath string, deleteExtra bool) error {
+	files := append(append([]*models.FileEntry{}, result.NewFiles...), result.UpdatedFiles...)
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	bar := progress.NewBytes("Copying", total)
+	defer bar.Close()
+
+	for i, file := range files {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		target := targetDiskPath(file, sourceRootPath, targetRootPath)
+		if progress.Enabled() {
+			bar.Describe(fmt.Sprintf("Copying [%d/%d]", i+1, len(files)))
+		} else {
+			fmt.Printf("[%d/%d] %s\n", i+1, len(files), file.RelativePath)
+		}
+		if err := copyFile(file, target, bar); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", file.RelativePath, err)
+		}
+	}
+
+	if deleteExtra {
+		deleted, pinned := result.Deletions()
+		for _, file := range pinned {
+			fmt.Printf("keeping pinned %s\n", file.RelativePath)
+		}
+		for _, file := range deleted {
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+			if err := os.Remove(file.DiskPath()); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete %s: %w", file.RelativePath, err)
+			}
+			fmt.Printf("deleting %s\n", file.RelativePath)
+		}
+	}
+	return nil
+}
+
+// copyFile copies one indexed file to target through a temporary file, so an
+// interrupted copy never leaves a truncated file under the real name. The
+// bytes copied are reported to bar.
+func copyFile(file *models.FileEntry, target string, bar *progress.Bar) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if file.LinkTarget != "" {
+		os.Remove(target)
+		return os.Symlink(file.LinkTarget, target)
+	}
+
+	src, err := os.Open(file.DiskPath())
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".stormindexer-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(io.MultiWriter(tmp, bar), src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Deletions splits the target files missing from the source into those a
+// sync with --delete removes and those pinned on the target, which it keeps
+func (r *SyncResult) Deletions() (deleted, pinned []*models.FileEntry) {
+	for _, file := range r.DeletedFiles {
+		if r.Pins.Covering(file.RelativePath) != nil {
+			pinned = append(pinned, file)
+		} else {
+			deleted = append(deleted, file)
+		}
+	}
+	return deleted, pinned
+}
+
+// writeRsyncProtects writes rsync protect rules for the pinned paths to a
+// temporary merge file and returns its name. Each path is protected along
+// with everything below it, so rsync --delete leaves pinned files and
+// directories alone while still updating them from the source.
+func writeRsyncProtects(pins models.Pins) (string, error) {
+	f, err := os.CreateTemp("", "stormindexer-protect-*")
+	if err != nil {
+		return "", err
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	for _, pin := range pins {
+		if pin.RelativePath == "" {
+			fmt.Fprintln(f, "P *")
+			continue
+		}
+		// "dir/***" only matches directories, so files need their own rule
+		pattern := pin.RelativePath
+		if strings.ContainsAny(pattern, "*?[") {
+			pattern = escaper.Replace(pattern)
+		}
+		fmt.Fprintf(f, "P /%s\nP /%s/***\n", pattern, escaper.Replace(pin.RelativePath))
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
+	"github.com/victor/stormindexer/internal/progress"
+	"github.com/victor/stormindexer/pkg/humanize"
+)
+
+// SetReuseTarget sets whether a sync copies the new files whose content the
+// target already holds at another path from that copy, on the target drive,
+// instead of transferring them from the source. On by default.
+func (s *Syncer) SetReuseTarget(reuse bool) {
+	s.reuseTarget = reuse
+}
+
+// SetHardlink makes reused content hard linked instead of copied when the
+// target copy has the modification time of the source file, so the content
+// is stored once. Both paths then change together if either is edited.
+func (s *Syncer) SetHardlink(hardlink bool) {
+	s.hardlink = hardlink
+}
+
+// Reusable returns the new files whose content the target holds at another
+// path, and their total size
+func (r *SyncResult) Reusable() ([]*models.FileEntry, int64) {
+	var files []*models.FileEntry
+	var size int64
+	for _, file := range r.NewFiles {
+		if len(r.DuplicateFiles[file.RelativePath]) > 0 {
+			files = append(files, file)
+			size += file.Size
+		}
+	}
+	return files, size
+}
+
+// withoutFiles returns a copy of the result whose new files leave out the
+// given relative paths
+func (r *SyncResult) withoutFiles(done map[string]bool) *SyncResult {
+	rest := *r
+	rest.NewFiles = nil
+	for _, file := range r.NewFiles {
+		if !done[file.RelativePath] {
+			rest.NewFiles = append(rest.NewFiles, file)
+		}
+	}
+	return &rest
+}
+
+// reuseTargetContent places the new files whose content is already on the
+// target from a copy there, and returns the relative paths it placed. A
+// copy is only used while it is still on the drive as indexed; files
+// without one are left to the transfer from the source.
+func (s *Syncer) reuseTargetContent(result *SyncResult, sourceRootPath, targetRootPath string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	files, total := result.Reusable()
+	if len(files) == 0 {
+		return done, nil
+	}
+	bar := progress.NewBytes("Reusing", total)
+	var reused int64
+	err := func() error {
+		defer bar.Close()
+		for _, file := range files {
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+			existing := unchangedCopy(result.DuplicateFiles[file.RelativePath], file.Size)
+			if existing == nil {
+				continue
+			}
+			if !progress.Enabled() {
+				fmt.Printf("reusing %s for %s\n", existing.RelativePath, file.RelativePath)
+			}
+			target := targetDiskPath(file, sourceRootPath, targetRootPath)
+			if err := s.placeCopy(existing, file, target, bar); err != nil {
+				return fmt.Errorf("failed to reuse %s for %s: %w", existing.RelativePath, file.RelativePath, err)
+			}
+			done[file.RelativePath] = true
+			reused += file.Size
+		}
+		return nil
+	}()
+	if len(done) > 0 {
+		fmt.Printf("Reused %d files already on the target, %s not transferred from the source\n", len(done), humanize.Bytes(reused))
+	}
+	return done, err
+}
+
+// unchangedCopy returns the first target copy still on the drive with the
+// size and modification time it was indexed with
+func unchangedCopy(copies []*models.FileEntry, size int64) *models.FileEntry {
+	for _, c := range copies {
+		if c.LinkTarget != "" || c.Size != size {
+			continue
+		}
+		info, err := os.Lstat(c.DiskPath())
+		if err == nil && info.Mode().IsRegular() && info.Size() == c.Size && info.ModTime().Unix() == c.ModTime.Unix() {
+			return c
+		}
+	}
+	return nil
+}
+
+// placeCopy puts the content of an existing target file at the path of a
+// new file, with the modification time of the source so later syncs and
+// rsync see it as up to date
+func (s *Syncer) placeCopy(existing, file *models.FileEntry, target string, bar *progress.Bar) error {
+	if s.hardlink && existing.ModTime.Unix() == file.ModTime.Unix() {
+		if err := hardlink(existing.DiskPath(), target); err == nil {
+			bar.Add(file.Size)
+			return nil
+		}
+	}
+	if err := copyFile(existing, target, bar); err != nil {
+		return err
+	}
+	return os.Chtimes(target, file.ModTime, file.ModTime)
+}
+
+// hardlink links target to an existing file through a temporary name, so
+// a file already at target is replaced as a copy would replace it
+func hardlink(existing, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(target), ".stormindexer-link-"+filepath.Base(target))
+	os.Remove(tmp)
+	if err := os.Link(existing, tmp); err != nil {
+		return err
+	}
+	// Renaming onto another link of the same file leaves both names
+	defer os.Remove(tmp)
+	return os.Rename(tmp, target)
+}
+
+// targetDiskPath returns where a source file goes on the target drive.
+// Names that are not printable UTF-8 are copied with their raw bytes.
+func targetDiskPath(file *models.FileEntry, sourceRootPath, targetRootPath string) string {
+	if len(file.RawPath) > 0 {
+		if rawRel, err := filepath.Rel(sourceRootPath, file.DiskPath()); err == nil {
+			return paths.Join(targetRootPath, filepath.ToSlash(rawRel))
+		}
+	}
+	return paths.Join(targetRootPath, file.RelativePath)
+}
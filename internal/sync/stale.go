@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// Staleness compares when the source and target of a sync were last
+// scanned. A sync decides what to copy and delete from the catalog, so a
+// target scanned long before the source may be compared with files that
+// are no longer, or not yet, on the drive.
+type Staleness struct {
+	SourceScan time.Time
+	TargetScan time.Time // zero when the target was never scanned
+}
+
+// Lag returns how much older the target scan is than the source scan
+func (st *Staleness) Lag() time.Duration {
+	return st.SourceScan.Sub(st.TargetScan)
+}
+
+// Stale reports whether the target was never scanned, or scanned more than
+// maxLag before the source
+func (st *Staleness) Stale(maxLag time.Duration) bool {
+	return st.TargetScan.IsZero() || st.Lag() > maxLag
+}
+
+// CheckStaleness reads when the source and target indexes were last
+// scanned
+func (s *Syncer) CheckStaleness(source, target *models.Index) (*Staleness, error) {
+	sourceScan, err := s.lastScan(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last scan of %s: %w", source.Name, err)
+	}
+	targetScan, err := s.lastScan(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last scan of %s: %w", target.Name, err)
+	}
+	return &Staleness{SourceScan: sourceScan, TargetScan: targetScan}, nil
+}
+
+// lastScan returns when an index was last scanned. Catalogs from before
+// job tracking, and imported indexes, have no scan in the job history and
+// fall back to the last update of the index, which syncs also set. An
+// index whose scans all stopped, failed or were cancelled was never
+// scanned completely: the update they made does not count.
+func (s *Syncer) lastScan(index *models.Index) (time.Time, error) {
+	scan, err := s.db.LastScan(index.ID)
+	if err != nil || !scan.IsZero() {
+		return scan, err
+	}
+	if partial, err := s.db.HasEndedScan(index.ID); err != nil || partial {
+		return time.Time{}, err
+	}
+	return index.LastSync, nil
+}
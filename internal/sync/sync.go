@@ -1,14 +1,17 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/victor/stormindexer/internal/database"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/paths"
 )
 
 type SyncResult struct {
@@ -18,14 +21,41 @@ type SyncResult struct {
 	UpdatedFiles  []*models.FileEntry
 	DeletedFiles  []*models.FileEntry
 	DuplicateFiles map[string][]*models.FileEntry
+	// Conflicts are files changed on the target since the last sync; they
+	// are recorded and left alone instead of being overwritten
+	Conflicts []*models.Conflict
+	// KeptFiles are target copies an earlier conflict resolution chose over
+	// the source, left alone while neither side changes
+	KeptFiles []*models.FileEntry
+	// Pins are the pins of the target; the deleted files they cover are
+	// never removed by a sync
+	Pins models.Pins
 }
 
 type Syncer struct {
-	db *database.DB
+	db  *database.DB
+	ctx context.Context
+	recordEntries bool
+	reuseTarget   bool
+	hardlink      bool
 }
 
 func NewSyncer(db *database.DB) *Syncer {
-	return &Syncer{db: db}
+	return &Syncer{db: db, ctx: context.Background(), recordEntries: true, reuseTarget: true}
+}
+
+// SetRecordEntries sets whether a completed sync records the synced source
+// entries in the target index. Turn it off when the target is reindexed
+// after the sync, so the catalog holds what actually reached the drive. A
+// cancelled sync always records the files it copied.
+func (s *Syncer) SetRecordEntries(record bool) {
+	s.recordEntries = record
+}
+
+// SetContext sets a context whose cancellation stops a running sync. Files
+// already copied are still recorded in the target index.
+func (s *Syncer) SetContext(ctx context.Context) {
+	s.ctx = ctx
 }
 
 // CompareIndexes compares two indexes and returns differences
@@ -40,6 +70,16 @@ func (s *Syncer) CompareIndexes(sourceIndexID, targetIndexID string) (*SyncResul
 		return nil, fmt.Errorf("failed to list target files: %w", err)
 	}
 
+	conflicts, err := s.loadConflicts(sourceIndexID, targetIndexID)
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := s.db.ListPins(targetIndexID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target pins: %w", err)
+	}
+
 	// Build maps for quick lookup
 	targetMap := make(map[string]*models.FileEntry)
 	targetChecksumMap := make(map[string][]*models.FileEntry)
@@ -60,6 +100,7 @@ func (s *Syncer) CompareIndexes(sourceIndexID, targetIndexID string) (*SyncResul
 		UpdatedFiles:   []*models.FileEntry{},
 		DeletedFiles:   []*models.FileEntry{},
 		DuplicateFiles: make(map[string][]*models.FileEntry),
+		Pins:           pins,
 	}
 
 	// Find new and updated files
@@ -83,7 +124,14 @@ func (s *Syncer) CompareIndexes(sourceIndexID, targetIndexID string) (*SyncResul
 			if sourceFile.Size != targetFile.Size ||
 				sourceFile.ModTime.Unix() != targetFile.ModTime.Unix() ||
 				(sourceFile.Checksum != "" && targetFile.Checksum != "" && sourceFile.Checksum != targetFile.Checksum) {
-				result.UpdatedFiles = append(result.UpdatedFiles, sourceFile)
+				switch conflicts.classify(sourceFile, targetFile) {
+				case keep:
+					result.KeptFiles = append(result.KeptFiles, targetFile)
+				case conflict:
+					result.Conflicts = append(result.Conflicts, newConflict(sourceFile, targetFile))
+				default:
+					result.UpdatedFiles = append(result.UpdatedFiles, sourceFile)
+				}
 			}
 		}
 	}
@@ -113,6 +161,7 @@ func (s *Syncer) SyncToIndex(sourceIndexID, targetIndexID, targetRootPath string
 	}
 
 	sourceRootPath := sourceIndex.RootPath
+	startTime := time.Now()
 
 	result, err := s.CompareIndexes(sourceIndexID, targetIndexID)
 	if err != nil {
@@ -125,18 +174,138 @@ func (s *Syncer) SyncToIndex(sourceIndexID, targetIndexID, targetRootPath string
 	fmt.Printf("New files: %d\n", len(result.NewFiles))
 	fmt.Printf("Updated files: %d\n", len(result.UpdatedFiles))
 	fmt.Printf("Deleted files: %d\n", len(result.DeletedFiles))
+	if _, pinned := result.Deletions(); deleteExtra && len(pinned) > 0 {
+		fmt.Printf("Pinned, not deleted: %d\n", len(pinned))
+	}
 	fmt.Printf("Duplicate files found: %d\n", len(result.DuplicateFiles))
+	fmt.Printf("Conflicts: %d\n", len(result.Conflicts))
 
 	if dryRun {
 		fmt.Printf("\n[DRY RUN] No changes will be made.\n")
 		return nil
 	}
 
+	for _, c := range result.Conflicts {
+		c.DetectedAt = startTime
+		if err := s.db.RecordConflict(c); err != nil {
+			return fmt.Errorf("failed to record conflict of %s: %w", c.RelativePath, err)
+		}
+	}
+	skip := result.skipped()
+
 	// Ensure target directory exists
 	if err := os.MkdirAll(targetRootPath, 0755); err != nil {
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
+	// Content already on the target is copied there first, before rsync
+	// --delete or the direct copy remove the old paths of moved files
+	reused := make(map[string]bool)
+	if s.reuseTarget {
+		reused, err = s.reuseTargetContent(result, sourceRootPath, targetRootPath)
+	}
+	if err == nil {
+		if ok, reason := useRsync(sourceRootPath, targetRootPath); ok {
+			err = s.runRsync(sourceRootPath, targetRootPath, deleteExtra, union(skip, reused), result.Pins)
+		} else {
+			fmt.Printf("\n%s, copying files directly...\n", reason)
+			err = s.copyFiles(result.withoutFiles(reused), sourceRootPath, targetRootPath, deleteExtra)
+		}
+	}
+	cancelled := s.ctx.Err()
+	if err != nil && cancelled == nil {
+		return err
+	}
+
+	if s.recordEntries || cancelled != nil {
+		// After the copy completes, update the database with synced files
+		fmt.Printf("\nUpdating index database...\n")
+
+		// Get source files
+		sourceFiles, err := s.db.ListFiles(sourceIndexID)
+		if err != nil {
+			return fmt.Errorf("failed to list source files: %w", err)
+		}
+
+		// Create file entries for target index
+		for _, sourceFile := range sourceFiles {
+			if skip[sourceFile.RelativePath] {
+				continue
+			}
+			targetFile := syncedEntry(sourceFile, sourceRootPath, targetRootPath, targetIndexID)
+			if cancelled != nil && !copied(sourceFile, targetFile.DiskPath()) {
+				continue
+			}
+			if err := s.db.UpsertFile(targetFile); err != nil {
+				return fmt.Errorf("failed to sync file %s: %w", targetFile.Path, err)
+			}
+		}
+
+		// Update target index stats
+		if err := s.db.UpdateIndexStats(targetIndexID); err != nil {
+			return fmt.Errorf("failed to update target index stats: %w", err)
+		}
+	}
+
+	if cancelled != nil {
+		fmt.Printf("\nSync cancelled, files copied so far were recorded.\n")
+		return cancelled
+	}
+	if err := s.db.RecordSync(sourceIndexID, targetIndexID, startTime); err != nil {
+		return fmt.Errorf("failed to record sync: %w", err)
+	}
+
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("\n⚠ %d files changed on the target since the last sync were not overwritten.\n", len(result.Conflicts))
+		fmt.Printf("Run 'sync conflicts list' to review and 'sync conflicts resolve' to resolve them.\n")
+	}
+	fmt.Printf("\nSync completed successfully!\n")
+	return nil
+}
+
+// union returns the relative paths of both sets
+func union(a, b map[string]bool) map[string]bool {
+	all := make(map[string]bool, len(a)+len(b))
+	for path := range a {
+		all[path] = true
+	}
+	for path := range b {
+		all[path] = true
+	}
+	return all
+}
+
+// syncedEntry returns the target index entry of a file synced from the
+// source root to the target root
+func syncedEntry(sourceFile *models.FileEntry, sourceRootPath, targetRootPath, targetIndexID string) *models.FileEntry {
+	targetPath := paths.Join(targetRootPath, sourceFile.RelativePath)
+	diskPath := targetPath
+	if len(sourceFile.RawPath) > 0 {
+		// Names that are not printable UTF-8 are copied with their raw bytes
+		if rawRel, err := filepath.Rel(sourceRootPath, sourceFile.DiskPath()); err == nil {
+			diskPath = paths.Join(targetRootPath, filepath.ToSlash(rawRel))
+		}
+	}
+	targetFile := &models.FileEntry{
+		Path:         targetPath,
+		RelativePath: sourceFile.RelativePath,
+		Size:         sourceFile.Size,
+		ModTime:      sourceFile.ModTime,
+		Checksum:     sourceFile.Checksum,
+		IndexID:      targetIndexID,
+		LastScanned:  time.Now(),
+		IsDirectory:  sourceFile.IsDirectory,
+	}
+	if diskPath != targetPath {
+		targetFile.RawPath = []byte(diskPath)
+	}
+	return targetFile
+}
+
+// runRsync copies the source root to the target root with rsync, leaving
+// the skipped relative paths alone. With deleteExtra the pinned paths are
+// protected from deletion.
+func (s *Syncer) runRsync(sourceRootPath, targetRootPath string, deleteExtra bool, skip map[string]bool, pins models.Pins) error {
 	// Build rsync command
 	// rsync options:
 	// -a: archive mode (preserves permissions, timestamps, etc.)
@@ -153,9 +322,27 @@ func (s *Syncer) SyncToIndex(sourceIndexID, targetIndexID, targetRootPath string
 		rsyncArgs = append(rsyncArgs, "--delete")
 	}
 
+	if len(skip) > 0 {
+		excludeFile, err := writeRsyncExcludes(skip)
+		if err != nil {
+			return fmt.Errorf("failed to write rsync excludes: %w", err)
+		}
+		defer os.Remove(excludeFile)
+		rsyncArgs = append(rsyncArgs, "--exclude-from="+excludeFile)
+	}
+
+	if deleteExtra && len(pins) > 0 {
+		protectFile, err := writeRsyncProtects(pins)
+		if err != nil {
+			return fmt.Errorf("failed to write rsync protect rules: %w", err)
+		}
+		defer os.Remove(protectFile)
+		rsyncArgs = append(rsyncArgs, "--filter=merge "+protectFile)
+	}
+
 	// Add source path (with trailing slash to sync contents)
 	sourcePath := sourceRootPath
-	if sourcePath[len(sourcePath)-1] != '/' {
+	if !strings.HasSuffix(sourcePath, "/") {
 		sourcePath += "/"
 	}
 	rsyncArgs = append(rsyncArgs, sourcePath)
@@ -163,58 +350,37 @@ func (s *Syncer) SyncToIndex(sourceIndexID, targetIndexID, targetRootPath string
 	// Add target path
 	rsyncArgs = append(rsyncArgs, targetRootPath)
 
-	// Check if rsync is available
-	if _, err := exec.LookPath("rsync"); err != nil {
-		return fmt.Errorf("rsync not found in PATH. Please install rsync to use file synchronization")
-	}
-
 	fmt.Printf("\nRunning rsync...\n")
 	fmt.Printf("Command: rsync %v\n", rsyncArgs)
 
-	// Execute rsync
-	cmd := exec.Command("rsync", rsyncArgs...)
+	// Execute rsync. On cancellation it is interrupted so it can clean up
+	// its partial file, and killed if it does not exit.
+	cmd := exec.CommandContext(s.ctx, "rsync", rsyncArgs...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("rsync failed: %w", err)
 	}
+	return nil
+}
 
-	// After rsync completes, update the database with synced files
-	fmt.Printf("\nUpdating index database...\n")
-
-	// Get source files
-	sourceFiles, err := s.db.ListFiles(sourceIndexID)
+// copied reports whether a file reached the target of an interrupted sync.
+// Both rsync and the direct copy preserve modification times, so a complete
+// copy has the size and mtime of the source.
+func copied(sourceFile *models.FileEntry, targetPath string) bool {
+	info, err := os.Lstat(targetPath)
 	if err != nil {
-		return fmt.Errorf("failed to list source files: %w", err)
+		return false
 	}
-
-	// Create file entries for target index
-	for _, sourceFile := range sourceFiles {
-		targetPath := filepath.Join(targetRootPath, sourceFile.RelativePath)
-		targetFile := &models.FileEntry{
-			Path:         targetPath,
-			RelativePath: sourceFile.RelativePath,
-			Size:         sourceFile.Size,
-			ModTime:      sourceFile.ModTime,
-			Checksum:     sourceFile.Checksum,
-			IndexID:      targetIndexID,
-			LastScanned:  time.Now(),
-			IsDirectory:  sourceFile.IsDirectory,
-		}
-
-		if err := s.db.UpsertFile(targetFile); err != nil {
-			return fmt.Errorf("failed to sync file %s: %w", targetPath, err)
-		}
+	if sourceFile.IsDirectory {
+		return info.IsDir()
 	}
-
-	// Update target index stats
-	if err := s.db.UpdateIndexStats(targetIndexID); err != nil {
-		return fmt.Errorf("failed to update target index stats: %w", err)
-	}
-
-	fmt.Printf("\nSync completed successfully!\n")
-	return nil
+	return info.Size() == sourceFile.Size && info.ModTime().Unix() == sourceFile.ModTime.Unix()
 }
 
 // FindDuplicates finds duplicate files across all indexes
@@ -8,16 +8,12 @@ import (
 
 	"github.com/victor/stormindexer/internal/database"
 	"github.com/victor/stormindexer/internal/models"
+	"github.com/victor/stormindexer/internal/testutil"
 )
 
 func setupTestSync(t *testing.T) (*Syncer, *database.DB, string, string) {
 	tmpDir := t.TempDir()
-	dbPath := filepath.Join(tmpDir, "test.db")
-
-	db, err := database.NewDB(dbPath)
-	if err != nil {
-		t.Fatalf("Failed to create test database: %v", err)
-	}
+	db := testutil.NewCatalog(t).DB
 
 	sourceRoot := filepath.Join(tmpDir, "source")
 	targetRoot := filepath.Join(tmpDir, "target")
@@ -326,3 +322,344 @@ func TestFindDuplicates_AcrossMultipleDrives(t *testing.T) {
 	}
 }
 
+
+func TestCopyFiles_WithoutRsync(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+
+	os.MkdirAll(filepath.Join(sourceRoot, "docs"), 0755)
+	sourcePath := filepath.Join(sourceRoot, "docs", "a.txt")
+	os.WriteFile(sourcePath, []byte("hello"), 0644)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(sourcePath, modTime, modTime)
+	addTestFile(t, db, "source-index", sourcePath, "docs/a.txt", 5, "")
+
+	extraPath := filepath.Join(targetRoot, "extra.txt")
+	os.WriteFile(extraPath, []byte("old"), 0644)
+	addTestFile(t, db, "target-index", extraPath, "extra.txt", 3, "")
+
+	result, err := syncer.CompareIndexes("source-index", "target-index")
+	if err != nil {
+		t.Fatalf("CompareIndexes failed: %v", err)
+	}
+	if err := syncer.copyFiles(result, sourceRoot, targetRoot, true); err != nil {
+		t.Fatalf("copyFiles failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(targetRoot, "docs", "a.txt"))
+	if err != nil {
+		t.Fatalf("Expected copied file: %v", err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("Expected mod time %v, got %v", modTime, info.ModTime())
+	}
+	if _, err := os.Stat(extraPath); !os.IsNotExist(err) {
+		t.Errorf("Expected extra file to be deleted, got %v", err)
+	}
+}
+
+func TestCopyFiles_KeepsPinnedFiles(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+
+	for _, rel := range []string{"extra.txt", "keep/a.txt", "keep.txt"} {
+		path := filepath.Join(targetRoot, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("old"), 0644)
+		addTestFile(t, db, "target-index", path, rel, 3, "")
+	}
+	for _, rel := range []string{"keep", "keep.txt"} {
+		if err := db.AddPin(&models.Pin{IndexID: "target-index", RelativePath: rel, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("AddPin failed: %v", err)
+		}
+	}
+
+	result, err := syncer.CompareIndexes("source-index", "target-index")
+	if err != nil {
+		t.Fatalf("CompareIndexes failed: %v", err)
+	}
+	if deleted, pinned := result.Deletions(); len(deleted) != 1 || len(pinned) != 2 {
+		t.Fatalf("Expected 1 deleted and 2 pinned files, got %d and %d", len(deleted), len(pinned))
+	}
+	if err := syncer.copyFiles(result, sourceRoot, targetRoot, true); err != nil {
+		t.Fatalf("copyFiles failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(targetRoot, "extra.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected unpinned extra file to be deleted, got %v", err)
+	}
+	for _, rel := range []string{"keep/a.txt", "keep.txt"} {
+		if _, err := os.Stat(filepath.Join(targetRoot, rel)); err != nil {
+			t.Errorf("Expected pinned %s to be kept: %v", rel, err)
+		}
+	}
+}
+
+func TestWriteRsyncProtects(t *testing.T) {
+	name, err := writeRsyncProtects(models.Pins{{RelativePath: "keep"}, {RelativePath: "a*b.txt"}})
+	if err != nil {
+		t.Fatalf("writeRsyncProtects failed: %v", err)
+	}
+	defer os.Remove(name)
+
+	data, _ := os.ReadFile(name)
+	expected := "P /keep\nP /keep/***\nP /a\\*b.txt\nP /a\\*b.txt/***\n"
+	if string(data) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(data))
+	}
+}
+
+func TestUseRsync_WindowsRoots(t *testing.T) {
+	for _, root := range []string{`D:\Photos`, `\\nas\share`} {
+		if ok, _ := useRsync(root, "/tmp/target"); ok {
+			t.Errorf("Expected direct copy for %s", root)
+		}
+	}
+}
+
+func TestCompareIndexes_Conflicts(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+
+	lastSync := time.Now().Add(-time.Hour)
+	db.RecordSync("source-index", "target-index", lastSync)
+
+	// Changed on both sides since the last sync
+	addTestFile(t, db, "source-index", filepath.Join(sourceRoot, "both.txt"), "both.txt", 100, "source1")
+	addTestFile(t, db, "target-index", filepath.Join(targetRoot, "both.txt"), "both.txt", 200, "target1")
+
+	// Only changed on the source
+	source := &models.FileEntry{Path: filepath.Join(sourceRoot, "source.txt"), RelativePath: "source.txt", Size: 100,
+		ModTime: time.Now(), Checksum: "source2", IndexID: "source-index", LastScanned: time.Now()}
+	target := &models.FileEntry{Path: filepath.Join(targetRoot, "source.txt"), RelativePath: "source.txt", Size: 200,
+		ModTime: lastSync.Add(-time.Hour), Checksum: "target2", IndexID: "target-index", LastScanned: time.Now()}
+	db.UpsertFile(source)
+	db.UpsertFile(target)
+
+	result, err := syncer.CompareIndexes("source-index", "target-index")
+	if err != nil {
+		t.Fatalf("CompareIndexes failed: %v", err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].RelativePath != "both.txt" {
+		t.Fatalf("Expected a conflict for both.txt, got %+v", result.Conflicts)
+	}
+	if len(result.UpdatedFiles) != 1 || result.UpdatedFiles[0].RelativePath != "source.txt" {
+		t.Errorf("Expected source.txt to be updated, got %d updated files", len(result.UpdatedFiles))
+	}
+
+	c := result.Conflicts[0]
+	if err := db.RecordConflict(c); err != nil {
+		t.Fatalf("RecordConflict failed: %v", err)
+	}
+	if err := db.RecordConflict(c); err != nil {
+		t.Fatalf("RecordConflict failed: %v", err)
+	}
+	if open, _ := db.ListConflicts(false); len(open) != 1 {
+		t.Errorf("Expected one open conflict, got %d", len(open))
+	}
+
+	// Keeping the target copy is remembered while neither copy changes
+	if side, err := syncer.ResolveConflict(c, models.PreferTarget); err != nil || side != models.PreferTarget {
+		t.Fatalf("Expected target to be kept, got %s: %v", side, err)
+	}
+	result, _ = syncer.CompareIndexes("source-index", "target-index")
+	if len(result.Conflicts) != 0 || len(result.KeptFiles) != 1 {
+		t.Errorf("Expected the target copy to be kept, got %d conflicts and %d kept files", len(result.Conflicts), len(result.KeptFiles))
+	}
+	if open, _ := db.ListConflicts(false); len(open) != 0 {
+		t.Errorf("Expected no open conflicts, got %d", len(open))
+	}
+}
+
+func TestConflict_Newest(t *testing.T) {
+	now := time.Now()
+	c := &models.Conflict{SourceModTime: now, TargetModTime: now}
+	if c.Newest() != models.PreferTarget {
+		t.Errorf("Expected target on equal times, got %s", c.Newest())
+	}
+	c.SourceModTime = now.Add(time.Minute)
+	if c.Newest() != models.PreferSource {
+		t.Errorf("Expected source, got %s", c.Newest())
+	}
+}
+
+func TestCheckStaleness(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+	source, _ := db.GetIndex("source-index")
+	target, _ := db.GetIndex("target-index")
+
+	now := time.Now()
+	for _, scan := range []struct {
+		indexID  string
+		finished time.Time
+	}{{"source-index", now}, {"target-index", now.Add(-72 * time.Hour)}} {
+		job := &models.Job{Kind: "reindex", IndexID: scan.indexID, Status: models.JobRunning, StartedAt: scan.finished, Heartbeat: scan.finished}
+		if err := db.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob failed: %v", err)
+		}
+		db.FinishJob(job.ID, models.JobFinished, "", scan.finished)
+	}
+
+	staleness, err := syncer.CheckStaleness(source, target)
+	if err != nil {
+		t.Fatalf("CheckStaleness failed: %v", err)
+	}
+	if lag := staleness.Lag().Round(time.Hour); lag != 72*time.Hour {
+		t.Errorf("Expected a lag of 72h, got %v", lag)
+	}
+	if !staleness.Stale(24*time.Hour) || staleness.Stale(96*time.Hour) {
+		t.Error("Expected the target to be stale after 24h but not after 96h")
+	}
+
+	// Without a scan in the job history the last update of the index counts
+	createTestIndex(t, db, "imported-index", "Imported", filepath.Join(targetRoot, "imported"))
+	db.UpdateIndexStats("imported-index")
+	imported, _ := db.GetIndex("imported-index")
+	staleness, _ = syncer.CheckStaleness(source, imported)
+	if staleness.TargetScan.IsZero() || !staleness.TargetScan.Equal(imported.LastSync) {
+		t.Errorf("Expected the last update as last scan, got %v", staleness.TargetScan)
+	}
+
+	// A scan stopped at its time limit walked only part of the tree
+	job := &models.Job{Kind: "reindex", IndexID: "imported-index", Status: models.JobRunning, StartedAt: now, Heartbeat: now}
+	if err := db.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob failed: %v", err)
+	}
+	db.FinishJob(job.ID, models.JobStopped, "", now)
+	staleness, _ = syncer.CheckStaleness(source, imported)
+	if !staleness.TargetScan.IsZero() || !staleness.Stale(96*time.Hour) {
+		t.Errorf("Expected a stopped scan not to count, got %v", staleness.TargetScan)
+	}
+}
+
+func TestSyncToIndex_WithoutRecordingEntries(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+
+	sourcePath := filepath.Join(sourceRoot, "a.txt")
+	os.WriteFile(sourcePath, []byte("hello"), 0644)
+	addTestFile(t, db, "source-index", sourcePath, "a.txt", 5, "")
+
+	syncer.SetRecordEntries(false)
+	if err := syncer.SyncToIndex("source-index", "target-index", targetRoot, false, false); err != nil {
+		t.Fatalf("SyncToIndex failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(targetRoot, "a.txt")); err != nil {
+		t.Errorf("Expected a.txt to be copied: %v", err)
+	}
+	files, _ := db.ListFiles("target-index")
+	if len(files) != 0 {
+		t.Errorf("Expected the target index to be left to a reindex, got %d entries", len(files))
+	}
+}
+
+func TestSyncToIndex_ReusesTargetContent(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+
+	// The source moved old/a.txt to new/a.txt; the target still has the old path
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.MkdirAll(filepath.Join(sourceRoot, "new"), 0755)
+	os.MkdirAll(filepath.Join(targetRoot, "old"), 0755)
+	for _, path := range []string{filepath.Join(sourceRoot, "new", "a.txt"), filepath.Join(targetRoot, "old", "a.txt")} {
+		os.WriteFile(path, []byte("hello"), 0644)
+		os.Chtimes(path, modTime, modTime)
+	}
+	for _, f := range []*models.FileEntry{
+		{Path: filepath.Join(sourceRoot, "new", "a.txt"), RelativePath: "new/a.txt", IndexID: "source-index", Size: 5, Checksum: "aaa", ModTime: modTime},
+		{Path: filepath.Join(targetRoot, "old", "a.txt"), RelativePath: "old/a.txt", IndexID: "target-index", Size: 5, Checksum: "aaa", ModTime: modTime},
+	} {
+		f.LastScanned = time.Now()
+		db.UpsertFile(f)
+	}
+	// Only the target copy is on disk: a transfer from the source would fail
+	os.Remove(filepath.Join(sourceRoot, "new", "a.txt"))
+
+	syncer.SetHardlink(true)
+	if err := syncer.SyncToIndex("source-index", "target-index", targetRoot, false, false); err != nil {
+		t.Fatalf("SyncToIndex failed: %v", err)
+	}
+
+	reused, err := os.Stat(filepath.Join(targetRoot, "new", "a.txt"))
+	if err != nil {
+		t.Fatalf("Expected new/a.txt on the target: %v", err)
+	}
+	existing, _ := os.Stat(filepath.Join(targetRoot, "old", "a.txt"))
+	if !os.SameFile(reused, existing) {
+		t.Error("Expected new/a.txt to be a hard link of old/a.txt")
+	}
+	if file, _ := db.GetFile(filepath.Join(targetRoot, "new", "a.txt"), "target-index"); file == nil || file.Checksum != "aaa" {
+		t.Errorf("Expected new/a.txt to be recorded in the target index, got %v", file)
+	}
+}
+
+func TestReuseTargetContent(t *testing.T) {
+	syncer, db, sourceRoot, targetRoot := setupTestSync(t)
+	defer db.Close()
+
+	createTestIndex(t, db, "source-index", "Source", sourceRoot)
+	createTestIndex(t, db, "target-index", "Target", targetRoot)
+
+	sourceTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	targetTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"same.txt", "changed.txt"} {
+		path := filepath.Join(targetRoot, "old-"+name)
+		os.WriteFile(path, []byte("12345"), 0644)
+		os.Chtimes(path, targetTime, targetTime)
+		db.UpsertFile(&models.FileEntry{Path: path, RelativePath: "old-" + name, IndexID: "target-index", Size: 5, Checksum: name, ModTime: targetTime, LastScanned: targetTime})
+		db.UpsertFile(&models.FileEntry{Path: filepath.Join(sourceRoot, name), RelativePath: name, IndexID: "source-index", Size: 5, Checksum: name, ModTime: sourceTime, LastScanned: sourceTime})
+	}
+	// Edited after the target was indexed: no longer the indexed content
+	os.WriteFile(filepath.Join(targetRoot, "old-changed.txt"), []byte("edited"), 0644)
+
+	result, err := syncer.CompareIndexes("source-index", "target-index")
+	if err != nil {
+		t.Fatalf("CompareIndexes failed: %v", err)
+	}
+	if files, size := result.Reusable(); len(files) != 2 || size != 10 {
+		t.Errorf("Expected 2 reusable files of 10 bytes, got %d of %d", len(files), size)
+	}
+
+	syncer.SetHardlink(true)
+	done, err := syncer.reuseTargetContent(result, sourceRoot, targetRoot)
+	if err != nil {
+		t.Fatalf("reuseTargetContent failed: %v", err)
+	}
+	if !done["same.txt"] || done["changed.txt"] {
+		t.Errorf("Expected only same.txt to be reused, got %v", done)
+	}
+	info, err := os.Stat(filepath.Join(targetRoot, "same.txt"))
+	if err != nil {
+		t.Fatalf("Expected same.txt on the target: %v", err)
+	}
+	// Modification times differ, so the content is copied rather than linked
+	if !info.ModTime().Equal(sourceTime) {
+		t.Errorf("Expected the source mod time %v, got %v", sourceTime, info.ModTime())
+	}
+	if old, _ := os.Stat(filepath.Join(targetRoot, "old-same.txt")); !old.ModTime().Equal(targetTime) {
+		t.Error("Expected the existing copy to keep its mod time")
+	}
+	if rest := result.withoutFiles(done); len(rest.NewFiles) != 1 || rest.NewFiles[0].RelativePath != "changed.txt" {
+		t.Errorf("Expected changed.txt left to the transfer, got %d files", len(rest.NewFiles))
+	}
+}
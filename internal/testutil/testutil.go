@@ -0,0 +1,131 @@
+// Package testutil builds catalogs in memory for the tests of stormindexer,
+// so they can exercise queries, reports and syncs against realistic indexes
+// without scanning drives or touching the disk:
+//
+//	catalog := testutil.NewCatalog(t)
+//	catalog.Index("photos", "/mnt/photos").
+//		File("2019/a.jpg", 2048, "abc").
+//		File("2020/a copy.jpg", 2048, "abc")
+//	copies, _ := catalog.DB.FindFilesByChecksum("abc")
+package testutil
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victor/stormindexer/internal/database"
+	"github.com/victor/stormindexer/internal/models"
+)
+
+// MachineID is the machine of the indexes added with Catalog.Index
+const MachineID = "test-machine"
+
+// Catalog is an in-memory catalog closed when its test ends
+type Catalog struct {
+	DB *database.DB
+	// Now is the creation, modification and scan time of what is added
+	// without one
+	Now time.Time
+
+	t testing.TB
+}
+
+// NewCatalog opens an empty in-memory catalog for a test
+func NewCatalog(t testing.TB) *Catalog {
+	t.Helper()
+	db, err := database.NewDB(database.Memory)
+	if err != nil {
+		t.Fatalf("testutil: failed to open an in-memory catalog: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Catalog{DB: db, Now: time.Now().Truncate(time.Second), t: t}
+}
+
+// Index adds an index of this machine, whose ID is its name
+func (c *Catalog) Index(name, root string) *Index {
+	c.t.Helper()
+	return c.AddIndex(&models.Index{ID: name, Name: name, RootPath: root, MachineID: MachineID})
+}
+
+// AddIndex adds an index as given, created now unless it has a date
+func (c *Catalog) AddIndex(index *models.Index) *Index {
+	c.t.Helper()
+	if index.CreatedAt.IsZero() {
+		index.CreatedAt = c.Now
+	}
+	if err := c.DB.CreateIndex(index); err != nil {
+		c.t.Fatalf("testutil: failed to create index %s: %v", index.Name, err)
+	}
+	return &Index{Index: index, catalog: c, dirs: make(map[string]bool)}
+}
+
+// Index adds files to an index of a Catalog. The statistics of the
+// embedded models.Index are those it was created with; read the index back
+// from the catalog for up to date ones.
+type Index struct {
+	*models.Index
+
+	catalog *Catalog
+	dirs    map[string]bool
+}
+
+// File adds a file by its slash-separated path relative to the index root.
+// An empty checksum leaves the file unhashed.
+func (i *Index) File(relativePath string, size int64, checksum string) *Index {
+	i.catalog.t.Helper()
+	return i.Add(&models.FileEntry{RelativePath: relativePath, Size: size, Checksum: checksum})
+}
+
+// Dir adds a directory by its slash-separated path relative to the index root
+func (i *Index) Dir(relativePath string) *Index {
+	i.catalog.t.Helper()
+	return i.Add(&models.FileEntry{RelativePath: relativePath, IsDirectory: true})
+}
+
+// Add adds an entry, filling in its index, absolute path and times when
+// unset. As a scan would, it records the parent directories missing from
+// the index unless the index skips directories.
+func (i *Index) Add(entry *models.FileEntry) *Index {
+	i.catalog.t.Helper()
+	entry.RelativePath = strings.Trim(filepath.ToSlash(entry.RelativePath), "/")
+	entry.IndexID = i.ID
+	if entry.Path == "" {
+		entry.Path = filepath.Join(i.RootPath, filepath.FromSlash(entry.RelativePath))
+	}
+	now := i.catalog.Now
+	for _, t := range []*time.Time{&entry.ModTime, &entry.LastScanned, &entry.FirstSeen, &entry.LastSeen} {
+		if t.IsZero() {
+			*t = now
+		}
+	}
+
+	entries := []*models.FileEntry{entry}
+	if !i.SkipDirectories {
+		for dir := path.Dir(entry.RelativePath); dir != "."; dir = path.Dir(dir) {
+			if i.dirs[dir] {
+				break
+			}
+			entries = append(entries, &models.FileEntry{
+				Path: filepath.Join(i.RootPath, filepath.FromSlash(dir)), RelativePath: dir, IndexID: i.ID,
+				IsDirectory: true, ModTime: now, LastScanned: now, FirstSeen: now, LastSeen: now,
+			})
+		}
+	}
+	if entry.IsDirectory {
+		i.dirs[entry.RelativePath] = true
+	}
+	for _, parent := range entries[1:] {
+		i.dirs[parent.RelativePath] = true
+	}
+
+	if err := i.catalog.DB.UpsertFiles(entries); err != nil {
+		i.catalog.t.Fatalf("testutil: failed to add %s to %s: %v", entry.RelativePath, i.Name, err)
+	}
+	if err := i.catalog.DB.UpdateIndexStats(i.ID); err != nil {
+		i.catalog.t.Fatalf("testutil: failed to update the statistics of %s: %v", i.Name, err)
+	}
+	return i
+}
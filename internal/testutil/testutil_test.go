@@ -0,0 +1,67 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/victor/stormindexer/internal/models"
+)
+
+func TestCatalog(t *testing.T) {
+	catalog := NewCatalog(t)
+	photos := catalog.Index("photos", "/mnt/photos").
+		File("2019/summer/a.jpg", 100, "abc").
+		File("2019/b.jpg", 50, "").
+		Dir("empty")
+	catalog.AddIndex(&models.Index{ID: "backup-id", Name: "backup", RootPath: "/mnt/backup", MachineID: "nas", SkipDirectories: true}).
+		File("photos/a.jpg", 100, "abc")
+
+	if !catalog.DB.InMemory() {
+		t.Error("Expected the catalog to be in memory")
+	}
+
+	index, err := catalog.DB.GetIndex(photos.ID)
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if index.TotalFiles != 5 || index.TotalSize != 150 {
+		t.Errorf("Expected 5 entries of 150 bytes, got %d of %d", index.TotalFiles, index.TotalSize)
+	}
+
+	files, _ := catalog.DB.ListFiles("photos")
+	paths := map[string]bool{}
+	for _, file := range files {
+		paths[file.RelativePath] = file.IsDirectory
+		if file.ModTime.IsZero() || file.LastScanned.IsZero() {
+			t.Errorf("Expected %s to have times", file.RelativePath)
+		}
+	}
+	for _, dir := range []string{"2019", "2019/summer", "empty"} {
+		if isDir, ok := paths[dir]; !ok || !isDir {
+			t.Errorf("Expected directory %s to be recorded", dir)
+		}
+	}
+	if len(files) != 5 {
+		t.Errorf("Expected 5 entries, got %d", len(files))
+	}
+	if file, _ := catalog.DB.GetFile("/mnt/photos/2019/summer/a.jpg", "photos"); file == nil {
+		t.Error("Expected the absolute path to be derived from the root")
+	}
+
+	backup, _ := catalog.DB.ListFiles("backup-id")
+	if len(backup) != 1 {
+		t.Errorf("Expected no directories in an index skipping them, got %d entries", len(backup))
+	}
+	copies, _ := catalog.DB.FindFilesByChecksum("abc")
+	if len(copies) != 2 {
+		t.Errorf("Expected 2 copies across indexes, got %d", len(copies))
+	}
+}
+
+func TestNewCatalog_Private(t *testing.T) {
+	first, second := NewCatalog(t), NewCatalog(t)
+	first.Index("photos", "/mnt/photos")
+
+	if indexes, _ := second.DB.ListIndexes(); len(indexes) != 0 {
+		t.Errorf("Expected catalogs to be independent, got %d indexes", len(indexes))
+	}
+}
@@ -0,0 +1,140 @@
+// Package thumbs makes the small previews of images and videos stored in
+// the catalog, so media can be compared without mounting their drives.
+package thumbs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the decoders used by image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// MaxSize is the largest width and height of a thumbnail in pixels
+const MaxSize = 160
+
+// quality is the JPEG quality thumbnails are encoded with
+const quality = 75
+
+// ErrUnsupported is returned for files that are neither a decodable image
+// nor, when ffmpeg is installed, a video
+var ErrUnsupported = errors.New("no thumbnail for this file type")
+
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+var videoExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".avi": true,
+	".webm": true, ".wmv": true, ".mts": true, ".m2ts": true, ".3gp": true,
+}
+
+// ffmpeg returns the path of ffmpeg, looked up in PATH once per process
+var ffmpeg = sync.OnceValues(func() (string, error) {
+	return exec.LookPath("ffmpeg")
+})
+
+// Supported reports whether a thumbnail can be made for path, judging by
+// its extension. Videos need ffmpeg in PATH.
+func Supported(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if imageExtensions[ext] {
+		return true
+	}
+	if videoExtensions[ext] {
+		_, err := ffmpeg()
+		return err == nil
+	}
+	return false
+}
+
+// Generate makes the JPEG thumbnail of an image, or of the frame one second
+// into a video, scaled to fit MaxSize
+func Generate(ctx context.Context, path string) ([]byte, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case imageExtensions[ext]:
+		return imageThumbnail(path)
+	case videoExtensions[ext]:
+		return videoThumbnail(ctx, path)
+	}
+	return nil, ErrUnsupported
+}
+
+func imageThumbnail(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Scale(img, MaxSize), &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// videoThumbnail asks ffmpeg for a frame, from the start of videos shorter
+// than a second
+func videoThumbnail(ctx context.Context, path string) ([]byte, error) {
+	command, err := ffmpeg()
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	scale := fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease", MaxSize, MaxSize)
+	for _, seek := range []string{"1", "0"} {
+		out, err := exec.CommandContext(ctx, command, "-v", "error", "-ss", seek, "-i", path,
+			"-frames:v", "1", "-vf", scale, "-q:v", "5", "-f", "image2pipe", "-c:v", "mjpeg", "-").Output()
+		if err == nil && len(out) > 0 {
+			return out, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("ffmpeg could not read a frame of %s", path)
+}
+
+// Scale shrinks an image to fit a square of size pixels, averaging the
+// source pixels each target pixel covers. Smaller images are returned as is.
+func Scale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n>>8), uint8(g/n>>8), uint8(b/n>>8), uint8(a/n>>8)
+		}
+	}
+	return dst
+}
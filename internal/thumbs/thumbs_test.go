@@ -0,0 +1,84 @@
+package thumbs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		w, h         int
+		wantW, wantH int
+	}{
+		{640, 480, 160, 120},
+		{480, 640, 120, 160},
+		{100, 50, 100, 50},
+		{2000, 1, 160, 1},
+	}
+	for _, tt := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+		got := Scale(img, MaxSize).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("%dx%d: expected %dx%d, got %dx%d", tt.w, tt.h, tt.wantW, tt.wantH, got.Dx(), got.Dy())
+		}
+	}
+}
+
+func TestScale_AveragesPixels(t *testing.T) {
+	// Alternating black and white columns average to grey
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x += 2 {
+		img.SetGray(x, 0, color.Gray{Y: 255})
+		img.SetGray(x, 1, color.Gray{Y: 255})
+	}
+	r, _, _, _ := Scale(img, 2).At(0, 0).RGBA()
+	if r>>8 != 127 {
+		t.Errorf("Expected a grey pixel of 127, got %d", r>>8)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.PNG")
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 800, 400)))
+	os.WriteFile(path, buf.Bytes(), 0644)
+
+	if !Supported(path) {
+		t.Fatalf("Expected %s to be supported", path)
+	}
+	data, err := Generate(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a JPEG thumbnail: %v", err)
+	}
+	if got := thumb.Bounds(); got.Dx() != 160 || got.Dy() != 80 {
+		t.Errorf("Expected 160x80, got %dx%d", got.Dx(), got.Dy())
+	}
+
+	text := filepath.Join(dir, "notes.txt")
+	os.WriteFile(text, []byte("hello"), 0644)
+	if Supported(text) {
+		t.Errorf("Expected %s to be unsupported", text)
+	}
+	if _, err := Generate(context.Background(), text); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported, got %v", err)
+	}
+
+	broken := filepath.Join(dir, "broken.jpg")
+	os.WriteFile(broken, []byte("not an image"), 0644)
+	if _, err := Generate(context.Background(), broken); err == nil {
+		t.Error("Expected an error for an undecodable image")
+	}
+}
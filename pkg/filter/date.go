@@ -0,0 +1,79 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	relativeDatePattern = regexp.MustCompile(`^(\d+)\s+(day|days|week|weeks|month|months|year|years)\s+ago$`)
+	agePattern          = regexp.MustCompile(`^(\d+)\s*([dwmy])$`)
+)
+
+// ParseDate parses a point in time relative to now. Accepted forms, matched
+// case-insensitively after trimming whitespace:
+//
+//	today, yesterday
+//	N day(s)|week(s)|month(s)|year(s) ago
+//	2006-01-02
+//	2006-01-02 15:04:05
+//	RFC 3339, e.g. 2006-01-02T15:04:05Z
+//
+// Dates without a zone are UTC.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	switch strings.ToLower(s) {
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	case "today":
+		return now, nil
+	}
+
+	if matches := relativeDatePattern.FindStringSubmatch(strings.ToLower(s)); matches != nil {
+		return ago(now, matches[1], matches[2][0])
+	}
+
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse date: %s", s)
+}
+
+// ParseAge parses a short age such as "90d", "6w", "18m" or "3y" (days,
+// weeks, months, years) into the time that long before now. Anything else
+// is parsed with ParseDate.
+func ParseAge(s string, now time.Time) (time.Time, error) {
+	matches := agePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if matches == nil {
+		return ParseDate(s, now)
+	}
+	return ago(now, matches[1], matches[2][0])
+}
+
+// maxAgo bounds relative dates so they cannot overflow
+const maxAgo = 1000000
+
+// ago returns the time count units (d, w, m or y) before now
+func ago(now time.Time, count string, unit byte) (time.Time, error) {
+	num, err := strconv.Atoi(count)
+	if err != nil || num > maxAgo {
+		return time.Time{}, fmt.Errorf("too far back: %s", count)
+	}
+	switch unit {
+	case 'd':
+		return now.AddDate(0, 0, -num), nil
+	case 'w':
+		return now.AddDate(0, 0, -num*7), nil
+	case 'm':
+		return now.AddDate(0, -num, 0), nil
+	default:
+		return now.AddDate(-num, 0, 0), nil
+	}
+}
@@ -0,0 +1,354 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed filter expression, see ParseExpr
+type Expr interface {
+	// String formats the expression in the syntax ParseExpr reads, with
+	// fields and keywords in their canonical form
+	String() string
+}
+
+// And matches when both sides match
+type And struct{ Left, Right Expr }
+
+// Or matches when either side matches
+type Or struct{ Left, Right Expr }
+
+// Not matches when its operand does not
+type Not struct{ Expr Expr }
+
+// Cond compares one field with a value
+type Cond struct {
+	Field string // canonical field name
+	Op    string // =, !=, <, <=, > or >=
+	Value string // as written, without quotes
+
+	Size int64     // parsed value of size conditions
+	Time time.Time // parsed value of mtime and seen conditions
+}
+
+func (e *And) String() string { return e.Left.String() + " and " + e.Right.String() }
+func (e *Or) String() string  { return "(" + e.Left.String() + " or " + e.Right.String() + ")" }
+func (e *Not) String() string { return "not " + group(e.Expr) }
+
+func (c *Cond) String() string {
+	value := c.Value
+	if value == "" || strings.ContainsAny(value, " \t\n)") || value[0] == '"' || value[0] == '\'' {
+		quote := `"`
+		if strings.Contains(value, `"`) {
+			quote = "'"
+		}
+		value = quote + value + quote
+	}
+	return c.Field + c.Op + value
+}
+
+// group parenthesizes compound operands of not
+func group(e Expr) string {
+	if _, ok := e.(*And); ok {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+// Field kinds, deciding the operators and values a field accepts
+const (
+	kindPattern = iota // = and != with a shell-style pattern
+	kindExact          // = and != with a literal value
+	kindSize           // all operators with a size
+	kindTime           // <, <=, >, >= with a date
+	kindChoice         // = and != with one of a fixed set of words
+)
+
+// fields maps every accepted field name, including aliases, to its
+// canonical name and kind
+var fields = map[string]struct {
+	name string
+	kind int
+}{
+	"name":       {"name", kindPattern},
+	"path":       {"path", kindPattern},
+	"dir":        {"dir", kindPattern},
+	"ext":        {"ext", kindPattern},
+	"index":      {"index", kindPattern},
+	"drive":      {"index", kindPattern},
+	"checksum":   {"checksum", kindExact},
+	"sha256":     {"checksum", kindExact},
+	"size":       {"size", kindSize},
+	"mtime":      {"mtime", kindTime},
+	"modified":   {"mtime", kindTime},
+	"seen":       {"seen", kindTime},
+	"first_seen": {"seen", kindTime},
+	"type":       {"type", kindChoice},
+	"dup":        {"dup", kindChoice},
+	"duplicate":  {"dup", kindChoice},
+}
+
+// choices lists the values of choice fields
+var choices = map[string][]string{
+	"type": {"file", "dir", "link"},
+	"dup":  {"true", "false"},
+}
+
+// operators in the order they are matched, longest first
+var operators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// ParseExpr parses a filter expression such as
+//
+//	ext=mp4 and size>1G and (index=NAS or index=USB1) and mtime<2020-01-01
+//
+// An expression combines conditions with "and", "or", "not" and
+// parentheses; "and" binds tighter than "or" and may be left out between
+// two conditions. Keywords are case-insensitive. A condition is a field, an
+// operator and a value, without spaces between them. Values holding spaces
+// or parentheses are quoted with " or '.
+//
+// Fields:
+//
+//	name, path, dir   shell-style pattern on the base name, the relative path
+//	                  or any directory of the path (= and !=)
+//	ext               file extension, without the dot (= and !=)
+//	index, drive      index name pattern or ID (= and !=)
+//	checksum, sha256  exact checksum (= and !=)
+//	size              size as read by ParseBytes (all operators)
+//	mtime, modified   modification time as read by ParseAge (<, <=, >, >=)
+//	seen, first_seen  time a scan first saw the file (<, <=, >, >=)
+//	type              file, dir or link (= and !=)
+//	dup, duplicate    true or false: the content exists more than once
+//
+// Times are points in time, so "mtime>30d" selects files modified within
+// the last 30 days and "mtime<2020-01-01" files modified before 2020.
+// Relative dates are resolved against now.
+func ParseExpr(s string, now time.Time) (Expr, error) {
+	p := &exprParser{s: s, now: now}
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return nil, fmt.Errorf("empty filter expression")
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	s   string
+	pos int
+	now time.Time
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("filter expression at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// keyword consumes the keyword at the current position if present. A
+// keyword must be followed by a space, a parenthesis or the end.
+func (p *exprParser) keyword(word string) bool {
+	end := p.pos + len(word)
+	if end > len(p.s) || !strings.EqualFold(p.s[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.s) && !strings.ContainsRune(" \t\n()", rune(p.s[end])) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.keyword("or") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] == ')' {
+			return left, nil
+		}
+		start := p.pos
+		if p.keyword("or") {
+			p.pos = start
+			return left, nil
+		}
+		p.keyword("and")
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return nil, p.errorf("expected a condition")
+	}
+	if p.s[p.pos] == '(' {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+	if p.keyword("not") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: e}, nil
+	}
+	return p.parseCond()
+}
+
+func (p *exprParser) parseCond() (Expr, error) {
+	start := p.pos
+	for p.pos < len(p.s) && (p.s[p.pos] == '_' || isLetter(p.s[p.pos])) {
+		p.pos++
+	}
+	name := strings.ToLower(p.s[start:p.pos])
+	field, ok := fields[name]
+	if !ok {
+		p.pos = start
+		if name == "" {
+			return nil, p.errorf("expected a condition such as size>1G")
+		}
+		return nil, p.errorf("unknown field %q", name)
+	}
+
+	cond := &Cond{Field: field.name}
+	for _, op := range operators {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			cond.Op = op
+			break
+		}
+	}
+	if cond.Op == "" {
+		return nil, p.errorf("expected an operator after %s", name)
+	}
+	p.pos += len(cond.Op)
+
+	valueStart := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	cond.Value = value
+
+	// Report invalid values at their start
+	end := p.pos
+	p.pos = valueStart
+
+	equality := cond.Op == "=" || cond.Op == "!="
+	switch field.kind {
+	case kindPattern, kindExact:
+		if !equality {
+			return nil, p.errorf("%s only supports = and !=", cond.Field)
+		}
+	case kindChoice:
+		if !equality {
+			return nil, p.errorf("%s only supports = and !=", cond.Field)
+		}
+		cond.Value = strings.ToLower(value)
+		if cond.Field == "dup" {
+			switch cond.Value {
+			case "yes", "1":
+				cond.Value = "true"
+			case "no", "0":
+				cond.Value = "false"
+			}
+		}
+		valid := false
+		for _, choice := range choices[cond.Field] {
+			valid = valid || choice == cond.Value
+		}
+		if !valid {
+			return nil, p.errorf("%s must be one of %s", cond.Field, strings.Join(choices[cond.Field], ", "))
+		}
+	case kindSize:
+		size, err := ParseBytes(value)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		cond.Size = size
+	case kindTime:
+		if equality {
+			return nil, p.errorf("%s only supports <, <=, > and >=", cond.Field)
+		}
+		t, err := ParseAge(value, p.now)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		cond.Time = t
+	}
+	p.pos = end
+	return cond, nil
+}
+
+// parseValue reads a quoted value, or a bare one up to the next space or
+// closing parenthesis
+func (p *exprParser) parseValue() (string, error) {
+	if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+		quote := p.s[p.pos]
+		end := strings.IndexByte(p.s[p.pos+1:], quote)
+		if end < 0 {
+			return "", p.errorf("missing closing %c", quote)
+		}
+		value := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t\n)", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a value")
+	}
+	return p.s[start:p.pos], nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
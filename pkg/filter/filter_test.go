@@ -0,0 +1,293 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		expr     string
+		min, max int64 // -1 means open
+	}{
+		{">100M", 100<<20 + 1, -1},
+		{">=1.5TB", 3 << 39, -1},
+		{"<1G", -1, 1<<30 - 1},
+		{"<= 512", -1, 512},
+		{"=500K", 500 << 10, 500 << 10},
+		{"=0", 0, 0},
+		{"<1", -1, 0},
+		{">1.5", 2, -1},
+		{"<1.5", -1, 1},
+		{">=64kib", 64 << 10, -1},
+		{"=10b", 10, 10},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseSize(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSize(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := boundValue(r.Min); got != tt.min {
+			t.Errorf("ParseSize(%q) min = %d, want %d", tt.expr, got, tt.min)
+		}
+		if got := boundValue(r.Max); got != tt.max {
+			t.Errorf("ParseSize(%q) max = %d, want %d", tt.expr, got, tt.max)
+		}
+	}
+
+	for _, expr := range []string{"", "100M", "=>1K", "<0", "=1.5", ">1X", ">-1", "> 1 1", ">99999999999T", ">iB"} {
+		if _, err := ParseSize(expr); err == nil {
+			t.Errorf("ParseSize(%q) expected an error", expr)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	if n, err := ParseBytes("1.5 GB"); err != nil || n != 3<<29 {
+		t.Errorf("Expected %d, got %d (%v)", int64(3<<29), n, err)
+	}
+	if _, err := ParseBytes(">1K"); err == nil {
+		t.Error("Expected error for a comparison")
+	}
+}
+
+func TestPatternToLike(t *testing.T) {
+	tests := map[string]string{
+		"*.txt":      "%.txt",
+		"file?.go":   "file_.go",
+		"100%_done":  `100\%\_done`,
+		`C:\temp\*`:  `C:\\temp\\%`,
+		"[a-b]*.txt": "[a-b]%.txt",
+		"plain name": "plain name",
+	}
+	for pattern, want := range tests {
+		if got := PatternToLike(pattern); got != want {
+			t.Errorf("PatternToLike(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"today":               now,
+		"Yesterday":           now.AddDate(0, 0, -1),
+		"2 weeks ago":         now.AddDate(0, 0, -14),
+		"1 month ago":         now.AddDate(0, -1, 0),
+		"2024-01-15":          time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		"2024-01-15 08:30:00": time.Date(2024, 1, 15, 8, 30, 0, 0, time.UTC),
+	}
+	for s, want := range tests {
+		got, err := ParseDate(s, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseDate(%q) = %v (%v), want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseDate("next tuesday", now); err == nil {
+		t.Error("Expected error for unsupported date")
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"90d":        now.AddDate(0, 0, -90),
+		"6w":         now.AddDate(0, 0, -42),
+		"18m":        now.AddDate(0, -18, 0),
+		"3Y":         now.AddDate(-3, 0, 0),
+		"2020-01-01": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for s, want := range tests {
+		got, err := ParseAge(s, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseAge(%q) = %v (%v), want %v", s, got, err, want)
+		}
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := map[string]string{
+		"ext=mp4 and size>1G and (index=NAS or index=USB1) and mtime<2020-01-01": "ext=mp4 and size>1G and (index=NAS or index=USB1) and mtime<2020-01-01",
+		"EXT=mp4 size>=1G":                 "ext=mp4 and size>=1G",
+		"a_or_b":                           "",
+		"name=a or name=b and not dup=yes": "(name=a or name=b and not dup=true)",
+		"not (type=file and drive=x)":      "not (type=file and index=x)",
+		`dir="My Photos" or path='a "b"'`:  `(dir="My Photos" or path='a "b"')`,
+		"modified>30d":                     "mtime>30d",
+		"(size<1K)":                        "size<1K",
+		"size>1X":                          "",
+		"mtime=2020-01-01":                 "",
+		"ext>mp4":                          "",
+		"type=socket":                      "",
+		"(ext=mp4":                         "",
+		"ext=mp4)":                         "",
+		"ext=mp4 and":                      "",
+		"name=\"unterminated":              "",
+		"":                                 "",
+	}
+	for input, want := range tests {
+		e, err := ParseExpr(input, now)
+		if want == "" {
+			if err == nil {
+				t.Errorf("ParseExpr(%q) = %s, want error", input, e)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseExpr(%q) failed: %v", input, err)
+			continue
+		}
+		if e.String() != want {
+			t.Errorf("ParseExpr(%q) = %s, want %s", input, e, want)
+		}
+	}
+
+	e, _ := ParseExpr("size>1.5K mtime>2w", now)
+	and := e.(*And)
+	if size := and.Left.(*Cond).Size; size != 1536 {
+		t.Errorf("Expected size 1536, got %d", size)
+	}
+	if mtime := and.Right.(*Cond).Time; !mtime.Equal(now.AddDate(0, 0, -14)) {
+		t.Errorf("Expected mtime two weeks ago, got %v", mtime)
+	}
+}
+
+func FuzzParseSize(f *testing.F) {
+	for _, seed := range []string{">100M", ">=1.5TB", "<1", "=0", "<0", "=1.5", "<= 2 KiB", ">9999999T", "=>1"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		r, err := ParseSize(expr)
+		if err != nil {
+			return
+		}
+		if r.Min == nil && r.Max == nil {
+			t.Fatalf("ParseSize(%q) returned an unbounded range", expr)
+		}
+		if r.Min != nil && *r.Min < 0 || r.Max != nil && *r.Max < 0 {
+			t.Fatalf("ParseSize(%q) returned a negative bound: %d %d", expr, boundValue(r.Min), boundValue(r.Max))
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			t.Fatalf("ParseSize(%q) returned an empty range", expr)
+		}
+	})
+}
+
+func FuzzPatternToLike(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"[a-b]*.txt", "[a-b]notes.txt"},
+		{"*.txt", "a.txt"},
+		{"100%", "1000"},
+		{"a_b", "axb"},
+		{`a\*`, `a\bc`},
+		{"?", "é"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, pattern, name string) {
+		like := PatternToLike(pattern)
+		if got, want := likeMatch(like, name), globMatch(pattern, name); got != want {
+			t.Fatalf("pattern %q (LIKE %q) on %q: LIKE matched %v, glob matched %v", pattern, like, name, got, want)
+		}
+	})
+}
+
+func FuzzParseDate(f *testing.F) {
+	for _, seed := range []string{"today", "3 days ago", "2024-02-30", "99999999999 years ago", "18m", "2024-01-15T10:00:00+02:00"} {
+		f.Add(seed)
+	}
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, s string) {
+		ParseDate(s, now)
+		if got, err := ParseAge(s, now); err == nil && strings.HasSuffix(strings.TrimSpace(s), " ago") && got.After(now) {
+			t.Fatalf("ParseAge(%q) = %v is in the future", s, got)
+		}
+	})
+}
+
+func FuzzParseExpr(f *testing.F) {
+	for _, seed := range []string{"ext=mp4 and size>1G and (index=NAS or index=USB1)", "not (dup=yes or name='a b')", `path="x'y"`, "a=b", "name=a'b\"c"} {
+		f.Add(seed)
+	}
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, s string) {
+		e, err := ParseExpr(s, now)
+		if err != nil {
+			return
+		}
+		again, err := ParseExpr(e.String(), now)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) = %s, which does not parse: %v", s, e, err)
+		}
+		if again.String() != e.String() {
+			t.Fatalf("ParseExpr(%q) = %s, reparsed as %s", s, e, again)
+		}
+	})
+}
+
+func boundValue(b *int64) int64 {
+	if b == nil {
+		return -1
+	}
+	return *b
+}
+
+// globMatch is the reference semantics of PatternToLike: "*" and "?" are
+// wildcards, every other character is literal
+func globMatch(pattern, name string) bool {
+	var re strings.Builder
+	re.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString(name)
+}
+
+// likeMatch evaluates an SQL LIKE pattern with LikeEscape, case-sensitively
+func likeMatch(like, name string) bool {
+	p, s := []rune(like), []rune(name)
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for i < len(p) {
+			switch {
+			case p[i] == '%':
+				for k := j; k <= len(s); k++ {
+					if match(i+1, k) {
+						return true
+					}
+				}
+				return false
+			case p[i] == '_':
+				if j >= len(s) {
+					return false
+				}
+			case string(p[i]) == LikeEscape && i+1 < len(p):
+				i++
+				if j >= len(s) || s[j] != p[i] {
+					return false
+				}
+			default:
+				if j >= len(s) || s[j] != p[i] {
+					return false
+				}
+			}
+			i++
+			j++
+		}
+		return j == len(s)
+	}
+	return match(0, 0)
+}
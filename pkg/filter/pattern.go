@@ -0,0 +1,31 @@
+package filter
+
+import "strings"
+
+// LikeEscape is the escape character of patterns built by PatternToLike.
+// Queries must declare it: "name LIKE ? ESCAPE '\'".
+const LikeEscape = `\`
+
+// PatternToLike converts a shell-style pattern into an SQL LIKE pattern.
+//
+// "*" matches any run of characters and "?" exactly one character. Every
+// other character matches itself, including "%", "_", "\" and brackets:
+// "[a-b]*.txt" matches names starting with the five characters "[a-b]".
+// Matching is case-insensitive for ASCII letters, as LIKE is in SQLite.
+func PatternToLike(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteString(LikeEscape)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
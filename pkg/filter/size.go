@@ -0,0 +1,100 @@
+// Package filter parses the search filters accepted on the command line:
+// size comparisons, shell-style name patterns and dates.
+//
+// The CLI and any other front end parse user input through this package, so
+// the same string always selects the same files. Each parser documents the
+// exact syntax it accepts; anything else is rejected with an error rather
+// than guessed at.
+package filter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SizeRange is an inclusive range of sizes in bytes. A nil bound is open.
+type SizeRange struct {
+	Min *int64
+	Max *int64
+}
+
+// Contains reports whether size falls in the range.
+func (r SizeRange) Contains(size int64) bool {
+	return (r.Min == nil || size >= *r.Min) && (r.Max == nil || size <= *r.Max)
+}
+
+var sizePattern = regexp.MustCompile(`^(>=|<=|>|<|=)\s*(\d+(?:\.\d+)?)\s*(?:([KMGT])(?:I?B)?|B)?$`)
+
+var unitMultipliers = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a size comparison such as ">100M", "<= 1.5GB" or "=0".
+//
+// The operator is one of >, >=, <, <= and = and is required. The number may
+// have a fractional part. Units are B, K, M, G and T, optionally followed by
+// B or iB (KB, KiB), case-insensitive and always powers of 1024; no unit means
+// bytes. Whitespace is allowed around the number.
+//
+// Fractional sizes are rounded so the range holds exactly the whole byte
+// counts satisfying the comparison: ">1.5" starts at 2 and "<1.5" ends at 1.
+// "=" requires a whole number of bytes. Comparisons no size can satisfy,
+// like "<0", are an error.
+func ParseSize(expr string) (SizeRange, error) {
+	matches := sizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(expr)))
+	if matches == nil {
+		return SizeRange{}, fmt.Errorf("invalid size format: %s (expected format: >100M, <1G, =500K)", expr)
+	}
+
+	value, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return SizeRange{}, fmt.Errorf("invalid size: %s", matches[2])
+	}
+	value *= unitMultipliers[matches[3]]
+	if value > math.MaxInt64/2 {
+		return SizeRange{}, fmt.Errorf("size too large: %s", expr)
+	}
+
+	floor, ceil := int64(math.Floor(value)), int64(math.Ceil(value))
+	var r SizeRange
+	switch matches[1] {
+	case ">":
+		r.Min = bound(floor + 1)
+	case ">=":
+		r.Min = bound(ceil)
+	case "<":
+		if ceil == 0 {
+			return SizeRange{}, fmt.Errorf("no size is below 0 bytes")
+		}
+		r.Max = bound(ceil - 1)
+	case "<=":
+		r.Max = bound(floor)
+	case "=":
+		if floor != ceil {
+			return SizeRange{}, fmt.Errorf("%s is not a whole number of bytes", expr)
+		}
+		r.Min, r.Max = bound(floor), bound(floor)
+	}
+	return r, nil
+}
+
+// ParseBytes parses a plain size such as "512", "64K" or "1.5 GB" using the
+// units of ParseSize, rounding down to a whole byte.
+func ParseBytes(s string) (int64, error) {
+	r, err := ParseSize("<=" + s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return *r.Max, nil
+}
+
+func bound(n int64) *int64 {
+	return &n
+}
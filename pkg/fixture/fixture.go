@@ -0,0 +1,162 @@
+// Package fixture generates synthetic directory trees with a controllable
+// share of duplicate files.
+//
+// The trees back the indexer benchmarks and the gen-fixture command, so
+// users can check indexing and duplicate detection speed on their own
+// hardware. Generation is deterministic: the same options and seed always
+// produce the same tree.
+package fixture
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Options controls the shape of a generated tree.
+type Options struct {
+	// Files is the number of files to create.
+	Files int
+	// Depth is the maximum directory nesting below the root.
+	Depth int
+	// DupRatio is the share of files (0 to 1) whose content copies another
+	// generated file.
+	DupRatio float64
+	// FilesPerDir is the average number of files per directory. Zero means 20.
+	FilesPerDir int
+	// MinSize and MaxSize bound file sizes. Sizes are spread log-uniformly,
+	// so small files dominate as on real drives. Zero means 512 B and 64 KB.
+	MinSize, MaxSize int64
+	// MaxAge spreads modification times over the past period. Zero means
+	// five years.
+	MaxAge time.Duration
+	// Seed selects the tree. Zero means 1.
+	Seed int64
+}
+
+// Result describes a generated tree.
+type Result struct {
+	Files       int
+	Directories int
+	Duplicates  int
+	Bytes       int64
+}
+
+var extensions = []string{".jpg", ".png", ".mp4", ".mov", ".pdf", ".txt", ".doc", ".zip", ".mp3", ".go"}
+
+func (o *Options) setDefaults() {
+	if o.FilesPerDir <= 0 {
+		o.FilesPerDir = 20
+	}
+	if o.MinSize <= 0 {
+		o.MinSize = 512
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = 64 * 1024
+	}
+	if o.MaxSize < o.MinSize {
+		o.MaxSize = o.MinSize
+	}
+	if o.MaxAge <= 0 {
+		o.MaxAge = 5 * 365 * 24 * time.Hour
+	}
+	if o.Seed == 0 {
+		o.Seed = 1
+	}
+}
+
+// Generate creates a tree under root, which must not exist or be empty.
+func Generate(root string, opts Options) (*Result, error) {
+	if opts.Files < 0 || opts.Depth < 0 {
+		return nil, fmt.Errorf("files and depth must not be negative")
+	}
+	if opts.DupRatio < 0 || opts.DupRatio >= 1 {
+		return nil, fmt.Errorf("dup ratio must be at least 0 and below 1, got %g", opts.DupRatio)
+	}
+	opts.setDefaults()
+
+	if entries, err := os.ReadDir(root); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", root)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	result := &Result{}
+
+	// Grow the tree by attaching each new directory to a random existing one
+	// that is not yet at the maximum depth
+	type dir struct {
+		path  string
+		depth int
+	}
+	dirs := []dir{{path: root}}
+	open := []int{0}
+	wantDirs := opts.Files / opts.FilesPerDir
+	for len(dirs) < wantDirs && opts.Depth > 0 && len(open) > 0 {
+		parent := dirs[open[rng.Intn(len(open))]]
+		d := dir{path: filepath.Join(parent.path, fmt.Sprintf("dir%05d", len(dirs))), depth: parent.depth + 1}
+		if err := os.Mkdir(d.path, 0755); err != nil {
+			return result, err
+		}
+		dirs = append(dirs, d)
+		if d.depth < opts.Depth {
+			open = append(open, len(dirs)-1)
+		}
+		result.Directories++
+	}
+
+	duplicates := int(math.Round(float64(opts.Files) * opts.DupRatio))
+	var originals []string
+	now := time.Now()
+
+	for i := 0; i < opts.Files; i++ {
+		d := dirs[rng.Intn(len(dirs))]
+		ext := extensions[rng.Intn(len(extensions))]
+		path := filepath.Join(d.path, fmt.Sprintf("file%07d%s", i, ext))
+
+		// Spread duplicates evenly: file i is a copy once enough originals
+		// exist and the running share of duplicates is below the target
+		isDuplicate := len(originals) > 0 && result.Duplicates < duplicates &&
+			result.Duplicates*opts.Files < duplicates*(i+1)
+
+		var data []byte
+		if isDuplicate {
+			source := originals[rng.Intn(len(originals))]
+			var err error
+			if data, err = os.ReadFile(source); err != nil {
+				return result, err
+			}
+			result.Duplicates++
+		} else {
+			data = make([]byte, randomSize(rng, opts.MinSize, opts.MaxSize))
+			rng.Read(data)
+			originals = append(originals, path)
+		}
+
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return result, err
+		}
+		modTime := now.Add(-time.Duration(rng.Int63n(int64(opts.MaxAge))))
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return result, err
+		}
+		result.Files++
+		result.Bytes += int64(len(data))
+	}
+
+	return result, nil
+}
+
+// randomSize picks a size between min and max on a logarithmic scale
+func randomSize(rng *rand.Rand, min, max int64) int64 {
+	if min == max {
+		return min
+	}
+	lo, hi := math.Log(float64(min)), math.Log(float64(max))
+	return int64(math.Exp(lo + rng.Float64()*(hi-lo)))
+}
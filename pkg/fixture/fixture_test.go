@@ -0,0 +1,74 @@
+package fixture
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "tree")
+
+	result, err := Generate(root, Options{Files: 200, Depth: 3, DupRatio: 0.25, FilesPerDir: 10})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if result.Files != 200 {
+		t.Errorf("Expected 200 files, got %d", result.Files)
+	}
+	if result.Duplicates != 50 {
+		t.Errorf("Expected 50 duplicates, got %d", result.Duplicates)
+	}
+
+	files, unique, maxDepth := 0, map[[32]byte]bool{}, 0
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(root, path)
+		if info.IsDir() && rel != "." {
+			if depth := strings.Count(filepath.ToSlash(rel), "/") + 1; depth > maxDepth {
+				maxDepth = depth
+			}
+		}
+		if !info.IsDir() {
+			files++
+			data, _ := os.ReadFile(path)
+			unique[sha256.Sum256(data)] = true
+		}
+		return nil
+	})
+
+	if files != 200 {
+		t.Errorf("Expected 200 files on disk, got %d", files)
+	}
+	if len(unique) != 150 {
+		t.Errorf("Expected 150 distinct contents, got %d", len(unique))
+	}
+	if maxDepth > 3 {
+		t.Errorf("Expected depth at most 3, got %d", maxDepth)
+	}
+}
+
+func TestGenerate_Deterministic(t *testing.T) {
+	a, b := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	opts := Options{Files: 30, Depth: 2, DupRatio: 0.1, FilesPerDir: 5, Seed: 42}
+
+	ra, err := Generate(a, opts)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	rb, _ := Generate(b, opts)
+	if *ra != *rb {
+		t.Errorf("Expected identical results, got %+v and %+v", ra, rb)
+	}
+}
+
+func TestGenerate_RefusesNonEmptyRoot(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "existing"), []byte("x"), 0644)
+
+	if _, err := Generate(root, Options{Files: 1}); err == nil {
+		t.Error("Expected error for a non-empty root")
+	}
+}
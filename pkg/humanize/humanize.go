@@ -0,0 +1,118 @@
+// Package humanize formats byte counts and durations for display.
+//
+// The same helpers back every table, progress bar and summary line printed by
+// stormindexer, and are exported so programs embedding the indexer render
+// values identically.
+package humanize
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Options controls how values are rendered.
+type Options struct {
+	// SI selects powers of 1000 (kB, MB, ...) instead of powers of 1024.
+	SI bool
+	// DecimalSeparator replaces "." in fractional values. Empty means ".".
+	DecimalSeparator string
+}
+
+// Default is used by Bytes and Duration. Applications set it once at startup,
+// typically from ForLocale with a locale the user configured; it is not taken
+// from the environment, so output parsed by scripts does not depend on LANG.
+var Default = Options{}
+
+// commaLocales lists languages that write decimals with a comma.
+var commaLocales = map[string]bool{
+	"cs": true, "da": true, "de": true, "es": true, "fi": true, "fr": true,
+	"id": true, "it": true, "nb": true, "nl": true, "pl": true, "pt": true,
+	"ru": true, "sv": true, "tr": true, "uk": true,
+}
+
+// ForLocale returns options for a locale such as "de_DE.UTF-8", "fr-FR" or "en".
+// Unknown or empty locales fall back to the default "." separator.
+func ForLocale(locale string) Options {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if commaLocales[lang] {
+		return Options{DecimalSeparator: ","}
+	}
+	return Options{}
+}
+
+// Bytes formats a byte count using Default, e.g. "1.5 MB".
+func Bytes(n int64) string {
+	return BytesWith(n, Default)
+}
+
+// BytesWith formats a byte count using the given options.
+func BytesWith(n int64, opts Options) string {
+	if n < 0 {
+		if n == math.MinInt64 {
+			// -n overflows; one byte does not show at this scale
+			n++
+		}
+		return "-" + BytesWith(-n, opts)
+	}
+
+	unit := int64(1024)
+	prefixes := "KMGTPE"
+	if opts.SI {
+		unit = 1000
+		prefixes = "kMGTPE"
+	}
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	value := fmt.Sprintf("%.1f", float64(n)/float64(div))
+	return fmt.Sprintf("%s %cB", opts.decimal(value), prefixes[exp])
+}
+
+// Duration formats a duration using Default, e.g. "850ms", "4.2s" or "1h 3m 5s".
+func Duration(d time.Duration) string {
+	return DurationWith(d, Default)
+}
+
+// DurationWith formats a duration using the given options.
+func DurationWith(d time.Duration, opts Options) string {
+	if d < 0 {
+		if d == math.MinInt64 {
+			// -d overflows; one nanosecond does not show at this scale
+			d++
+		}
+		return "-" + DurationWith(-d, opts)
+	}
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	if d < time.Minute {
+		return opts.decimal(fmt.Sprintf("%.1f", d.Seconds())) + "s"
+	}
+	minutes := int(d.Minutes())
+	seconds := int(d.Seconds()) % 60
+	if minutes < 60 {
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	}
+	hours := minutes / 60
+	minutes = minutes % 60
+	return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
+}
+
+// decimal swaps the "." in a formatted number for the configured separator.
+func (o Options) decimal(s string) string {
+	if o.DecimalSeparator == "" || o.DecimalSeparator == "." {
+		return s
+	}
+	return strings.Replace(s, ".", o.DecimalSeparator, 1)
+}
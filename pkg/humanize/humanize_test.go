@@ -0,0 +1,86 @@
+package humanize
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+		{3 * 1024 * 1024 * 1024 * 1024, "3.0 TB"},
+		{-2048, "-2.0 KB"},
+		{math.MaxInt64, "8.0 EB"},
+		{math.MinInt64, "-8.0 EB"},
+	}
+
+	for _, tt := range tests {
+		if got := BytesWith(tt.in, Options{}); got != tt.want {
+			t.Errorf("BytesWith(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBytes_SI(t *testing.T) {
+	if got := BytesWith(1500, Options{SI: true}); got != "1.5 kB" {
+		t.Errorf("Expected 1.5 kB, got %q", got)
+	}
+	if got := BytesWith(2_000_000_000, Options{SI: true}); got != "2.0 GB" {
+		t.Errorf("Expected 2.0 GB, got %q", got)
+	}
+}
+
+func TestBytes_Locale(t *testing.T) {
+	opts := ForLocale("de_DE.UTF-8")
+	if got := BytesWith(1536, opts); got != "1,5 KB" {
+		t.Errorf("Expected 1,5 KB, got %q", got)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{250 * time.Millisecond, "250ms"},
+		{4200 * time.Millisecond, "4.2s"},
+		{90 * time.Second, "1m 30s"},
+		{time.Hour + 3*time.Minute + 5*time.Second, "1h 3m 5s"},
+		{-90 * time.Second, "-1m 30s"},
+		{math.MinInt64, "-2562047h 47m 16s"},
+	}
+
+	for _, tt := range tests {
+		if got := DurationWith(tt.in, Options{}); got != tt.want {
+			t.Errorf("DurationWith(%s) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if got := DurationWith(4200*time.Millisecond, ForLocale("fr")); got != "4,2s" {
+		t.Errorf("Expected 4,2s, got %q", got)
+	}
+}
+
+func TestForLocale(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"C":           "",
+		"en_US.UTF-8": "",
+		"de-DE":       ",",
+		"pt_BR":       ",",
+	}
+
+	for locale, want := range tests {
+		if got := ForLocale(locale).DecimalSeparator; got != want {
+			t.Errorf("ForLocale(%q).DecimalSeparator = %q, want %q", locale, got, want)
+		}
+	}
+}